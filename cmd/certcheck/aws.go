@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/imarsman/certcheck/v2/pkg/cloud"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// AWSCmd arguments for the aws subcommand
+type AWSCmd struct {
+	Region  []string `arg:"--region,separate" placeholder:"REGION" help:"region to list ACM certificates in, can be repeated (default that of the profile or environment)"`
+	Profile string   `arg:"--aws-profile" placeholder:"PROFILE" help:"shared config or credentials file profile to use (default the environment, then AWS_PROFILE or default)"`
+	IAM     bool     `arg:"--iam" help:"also list IAM server certificates"`
+}
+
+// awsCerts list the ACM certificates of each region and, if asked for, the
+// IAM server certificates
+func awsCerts(aws *cloud.AWS, args *AWSCmd, warnAtDays int) *model.CertDataSet {
+	regions := args.Region
+	if len(regions) == 0 {
+		regions = []string{aws.Region}
+	}
+	certDataSet := model.NewCertDataSet()
+	for _, region := range regions {
+		certDataSet.MergeSource(aws.ACM(region, warnAtDays), model.SourceCloud)
+	}
+	if args.IAM {
+		certDataSet.MergeSource(aws.IAM(warnAtDays), model.SourceCloud)
+	}
+
+	return certDataSet
+}
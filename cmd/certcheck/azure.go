@@ -0,0 +1,6 @@
+package main
+
+// AzureCmd arguments for the azure subcommand
+type AzureCmd struct {
+	Vault []string `arg:"positional,required" placeholder:"VAULT" help:"Key Vault to list certificates in, by name or URL"`
+}
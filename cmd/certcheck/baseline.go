@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/imarsman/certcheck/v2/pkg/baseline"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// BaselineCmd arguments for the baseline subcommand
+type BaselineCmd struct {
+	File  string            `arg:"-f,--file" default:"certcheck-baseline.yaml" help:"baseline file"`
+	Save  *BaselineSaveCmd  `arg:"subcommand:save" help:"save the certificates hosts serve as the approved baseline"`
+	Check *BaselineCheckCmd `arg:"subcommand:check" help:"fail if hosts serve certificates other than the baseline"`
+}
+
+// BaselineSaveCmd arguments for baseline save
+type BaselineSaveCmd struct{}
+
+// BaselineCheckCmd arguments for baseline check
+type BaselineCheckCmd struct{}
+
+// saveBaseline save checked hosts as the baseline, reporting hosts that could
+// not be saved to w
+func saveBaseline(w io.Writer, path string, certDataSet *model.CertDataSet, allIPs bool) (err error) {
+	newBaseline, skipped := baseline.New(certDataSet, allIPs)
+	for _, certData := range skipped {
+		fmt.Fprintf(w, "%s:%s not saved: %s\n", certData.Host, certData.Port, certData.Message)
+	}
+	err = newBaseline.Write(path)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "saved %d entries to %s\n", len(newBaseline.Entries), path)
+
+	return
+}
+
+// checkBaseline compare checked hosts with the baseline, reporting drift to w
+func checkBaseline(w io.Writer, approved *baseline.Baseline, certDataSet *model.CertDataSet) (drifted bool) {
+	drift := approved.Check(certDataSet)
+	for _, line := range drift {
+		fmt.Fprintln(w, line)
+	}
+
+	return len(drift) > 0
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+)
+
+// clockInterval time between clock checks while watching
+const clockInterval = time.Hour
+
+// checkClock warn on w if the local clock differs from the source by more
+// than maxSkew. A source that can't be reached is also reported, but doesn't
+// stop the checks.
+func checkClock(ctx context.Context, w io.Writer, source string, timeout, maxSkew time.Duration) {
+	skew, err := clock.Skew(ctx, source, timeout)
+	if err != nil {
+		fmt.Fprintf(w, "warning: could not check the clock against %s: %v\n", source, err)
+		return
+	}
+	switch {
+	case skew > maxSkew:
+		fmt.Fprintf(w, "warning: the local clock is %v ahead of %s, expiry results will be wrong\n", skew, source)
+	case skew < -maxSkew:
+		fmt.Fprintf(w, "warning: the local clock is %v behind %s, expiry results will be wrong\n", -skew, source)
+	}
+}
+
+// watchClock check the clock every interval until ctx is done
+func watchClock(ctx context.Context, w io.Writer, source string, timeout, maxSkew, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkClock(ctx, w, source, timeout, maxSkew)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// CompareCmd arguments for the compare subcommand
+type CompareCmd struct {
+	Hosts []string `arg:"positional,required" placeholder:"HOST:PORT" help:"hosts that should serve the same certificate"`
+}
+
+// endpoint describe where a result came from
+func endpoint(certData model.CertData) string {
+	if certData.IP == "" {
+		return fmt.Sprintf("%s:%s", certData.Host, certData.Port)
+	}
+
+	return fmt.Sprintf("%s:%s (%s)", certData.Host, certData.Port, certData.IP)
+}
+
+// shortHash abbreviate a hash for messages
+func shortHash(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16]
+	}
+
+	return hash
+}
+
+// compareCerts compare each result with the first and describe every endpoint
+// that serves a different certificate or chain or could not be checked
+func compareCerts(certDataList []model.CertData) (mismatches []string) {
+	var base *model.CertData
+	for i := range certDataList {
+		certData := certDataList[i]
+		switch {
+		case certData.Fingerprint == "":
+			mismatches = append(mismatches, fmt.Sprintf("%s: %s", endpoint(certData), certData.Message))
+		case base == nil:
+			base = &certDataList[i]
+		case certData.Fingerprint != base.Fingerprint:
+			mismatches = append(mismatches, fmt.Sprintf("%s serves certificate %s, %s serves %s",
+				endpoint(certData), shortHash(certData.Fingerprint), endpoint(*base), shortHash(base.Fingerprint)))
+		case certData.ChainHash != base.ChainHash:
+			mismatches = append(mismatches, fmt.Sprintf("%s serves the same certificate with a different chain than %s",
+				endpoint(certData), endpoint(*base)))
+		}
+	}
+
+	return
+}
+
+// compare check every host in order and report whether they all serve the
+// same certificate and chain
+func compare(ctx context.Context, compareCmd *CompareCmd, options hosts.Options) (certDataSet *model.CertDataSet, mismatches []string) {
+	var certDataList []model.CertData
+	for _, entry := range compareCmd.Hosts {
+		for _, item := range hosts.ExpandPorts(entry) {
+			certDataList = append(certDataList, hosts.Lookup(ctx, item, options)...)
+		}
+	}
+	mismatches = compareCerts(certDataList)
+
+	certDataSet = model.NewCertDataSet()
+	certDataSet.Add(certDataList...)
+
+	return
+}
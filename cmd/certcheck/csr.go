@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"gopkg.in/yaml.v3"
+)
+
+// checkCSRs summarize the certificate signing requests given with --csr and
+// write them to w as JSON, or YAML if asked. Files larger than maxSize can't
+// be read. failed is set if a pattern matches nothing or a request can't be
+// read or has problems.
+func checkCSRs(w io.Writer, patterns []string, maxSize int64, asYAML bool) (failed bool, err error) {
+	options := hosts.Options{MaxCertSize: maxSize}
+	paths, errs := certFilePaths(patterns)
+	csrs := []hosts.CSRData{}
+	for pattern, err := range errs {
+		csrs = append(csrs, hosts.CSRData{File: pattern, Error: true, Message: err.Error()})
+	}
+	for _, path := range paths {
+		csrs = append(csrs, options.ReadCSR(path))
+	}
+	for _, csr := range csrs {
+		if csr.Error || len(csr.Problems) > 0 {
+			failed = true
+		}
+	}
+
+	var bytes []byte
+	if asYAML {
+		bytes, err = yaml.Marshal(csrs)
+	} else {
+		bytes, err = json.MarshalIndent(csrs, "", "  ")
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.Write(append(bytes, '\n'))
+
+	return
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/forecast"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// ForecastCmd arguments for the forecast subcommand
+type ForecastCmd struct {
+	Horizon string `arg:"--horizon" default:"90d" help:"how far ahead to forecast, such as 90d or 12w"`
+}
+
+// writeForecast forecast expiry of the checked certificates from now and
+// write it to w as JSON, or YAML if asked
+func writeForecast(w io.Writer, forecastCmd *ForecastCmd, certDataSet *model.CertDataSet, now time.Time, asYAML bool) (err error) {
+	horizon, err := forecast.ParseHorizon(forecastCmd.Horizon)
+	if err != nil {
+		return
+	}
+	result := forecast.New(certDataSet, now, horizon)
+
+	var bytes []byte
+	if asYAML {
+		bytes, err = yaml.Marshal(result)
+	} else {
+		bytes, err = json.MarshalIndent(result, "", "  ")
+	}
+	if err != nil {
+		return
+	}
+	_, err = w.Write(append(bytes, '\n'))
+
+	return
+}
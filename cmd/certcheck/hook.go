@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+)
+
+// hookEnv environment for a hook command, naming the host being checked
+func hookEnv(host, port string) []string {
+	return append(os.Environ(), "CERTCHECK_HOST="+host, "CERTCHECK_PORT="+port)
+}
+
+// hookShell shell hook commands are run with, so they can quote arguments
+var hookShell = "sh"
+
+// runHook run a hook command with the shell. Its output goes to stderr so it
+// does not mix with results.
+func runHook(ctx context.Context, command string, env []string, stdin io.Reader) error {
+	cmd := exec.CommandContext(ctx, hookShell, "-c", command)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// preHook run a command before each host is checked, with the host and port
+// in CERTCHECK_HOST and CERTCHECK_PORT. A host is not checked if it fails.
+func preHook(command string) hosts.BeforeCheckFunc {
+	return func(ctx context.Context, host, port string) error {
+		return runHook(ctx, command, hookEnv(host, port), nil)
+	}
+}
+
+// postHook run a command with each result as JSON on stdin. Failures are
+// reported on stderr and do not change the result.
+func postHook(command string) hosts.AfterCheckFunc {
+	return func(ctx context.Context, certData hosts.CertData) {
+		data, err := certData.JSON()
+		if err == nil {
+			err = runHook(ctx, command, hookEnv(certData.Host, certData.Port), bytes.NewReader(data))
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("post hook for %s: %v", certData.Host, err))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+)
+
+// readHostList read hosts separated by spaces or newlines. Anything after a #
+// is a comment.
+func readHostList(reader io.Reader) (hostList []string, err error) {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		hostList = append(hostList, strings.Fields(line)...)
+	}
+	err = scanner.Err()
+
+	return
+}
+
+// readHostsFile read the hosts listed in a file
+func readHostsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readHostList(f)
+}
+
+// readURLsFile read the hosts of the URLs in a sitemap or file of URLs
+func readURLsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hostList, err := hosts.ReadURLHosts(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return hostList, nil
+}
@@ -0,0 +1,7 @@
+package main
+
+// ImageCmd arguments for the image subcommand
+type ImageCmd struct {
+	Image    string `arg:"positional,required" placeholder:"IMAGE" help:"image to pull, or tar file written by docker save or holding an OCI layout"`
+	Platform string `arg:"--platform" placeholder:"OS/ARCH" help:"image to use from a multi-platform index (default linux and the architecture of this machine)"`
+}
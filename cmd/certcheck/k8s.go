@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/k8s"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// K8sCmd arguments for the k8s subcommand
+type K8sCmd struct {
+	Namespace []string `arg:"-n,--namespace,separate" placeholder:"NAMESPACE" help:"namespace to list TLS secrets in, can be repeated (default all)"`
+	Selector  string   `arg:"-l,--selector" placeholder:"SELECTOR" help:"label selector secrets must match, such as app=web"`
+	Context   string   `arg:"--context" placeholder:"CONTEXT" help:"kubeconfig context to use (default the current one)"`
+}
+
+// k8sCerts check the chain in tls.crt of each TLS secret listed as for a cert
+// file, with File set to the namespace and name of the secret. Errors are
+// returned only if secrets can't be listed.
+func k8sCerts(hostSet *hosts.HostSet, args *K8sCmd, warnAtDays int, timeout time.Duration) (*model.CertDataSet, error) {
+	query := k8s.Query{Namespaces: args.Namespace, Selector: args.Selector, Context: args.Context}
+	secrets, err := k8s.TLSSecrets(query, timeout)
+	if err != nil {
+		return nil, err
+	}
+	certDataSet := model.NewCertDataSet()
+	for _, secret := range secrets {
+		if len(secret.Cert) == 0 {
+			certDataSet.Add(model.CertData{File: secret.Name, HostError: true, Message: fmt.Sprintf("secret %s has no tls.crt", secret.Name)})
+			continue
+		}
+		certDataSet.Merge(hostSet.ProcessCertReader(secret.Name, bytes.NewReader(secret.Cert), warnAtDays))
+	}
+
+	return certDataSet, nil
+}
@@ -3,22 +3,43 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"fmt"
-	"io"
+	"net"
 	"os"
-	"regexp"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"time"
 
 	"github.com/alexflint/go-arg"
-	"github.com/imarsman/certcheck/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/appliance"
+	"github.com/imarsman/certcheck/v2/pkg/baseline"
+	"github.com/imarsman/certcheck/v2/pkg/calendar"
+	"github.com/imarsman/certcheck/v2/pkg/cdn"
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/cloud"
+	"github.com/imarsman/certcheck/v2/pkg/ct"
+	"github.com/imarsman/certcheck/v2/pkg/envoy"
+	"github.com/imarsman/certcheck/v2/pkg/geoip"
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/imarsman/certcheck/v2/pkg/output"
+	"github.com/imarsman/certcheck/v2/pkg/score"
+	"github.com/imarsman/certcheck/v2/pkg/trust"
+	"github.com/imarsman/certcheck/v2/pkg/webhook"
 	"github.com/posener/complete/v2"
 	"github.com/posener/complete/v2/predict"
 )
 
+const (
+	defaultTimeout    = 10 * time.Second // connection timeout if none is given by flag or profile
+	politeConcurrency = 2                // hosts checked at once with --polite
+	politeJitter      = 2 * time.Second  // longest delay before each check with --polite
+)
+
 var GitCommit string
 var GitLastTag string
 var GitExactTag string
@@ -26,12 +47,123 @@ var Date string
 
 // Args CLI Args
 type Args struct {
-	Hosts      []string `arg:"-H,--hosts" help:"host:port list to check"`
-	CertFile   string   `arg:"-c,--certfile" help:"certificate file to parse"`
-	Timeout    int      `arg:"-t,--timeout" default:"10" help:"connection timeout seconds"`
-	WarnAtDays int      `arg:"-w,--warn-at-days" placeholder:"WARNAT" default:"30" help:"warn if expiry before days"`
-	YAML       bool     `arg:"-y,--yaml" help:"display output as YAML"`
-	JSON       bool     `arg:"-j,--json" help:"display output as JSON (default)"`
+	Hosts             []string      `arg:"-H,--hosts" help:"host:port list to check"`
+	HostsFile         []string      `arg:"--hosts-file,separate" placeholder:"PATH" help:"file of hosts to check, separated by spaces or lines with # comments, can be repeated"`
+	URLsFile          []string      `arg:"--urls-file,separate" placeholder:"PATH" help:"sitemap.xml, sitemap index or file of URLs to check the hosts of, each once, can be repeated"`
+	CertFile          []string      `arg:"-c,--certfile,separate" placeholder:"PATH" help:"certificate file to parse, PEM, PKCS#12 or Java keystore, or a glob pattern such as 'certs/*.pem', or - for stdin, can be repeated"`
+	KeyFile           []string      `arg:"--keyfile,separate" placeholder:"PATH" help:"private key file or glob pattern to check certificate files match, reporting keymatch, can be repeated"`
+	CSR               []string      `arg:"--csr,separate" placeholder:"PATH" help:"certificate signing request file or glob pattern to summarize instead of checking hosts, exiting 1 on problems, can be repeated"`
+	Password          string        `arg:"--password,env:CERTCHECK_PASSWORD" help:"password for PKCS#12 (.p12, .pfx) certificate files, Java keystores and encrypted key files"`
+	MaxCertSize       int64         `arg:"--max-cert-size" placeholder:"BYTES" help:"largest certificate file to read, larger files are an error (default 8388608)"`
+	CertArchive       string        `arg:"--cert-archive" placeholder:"FILE" help:"tar, tar.gz or zip archive to search for certificate files to parse"`
+	ServerConfig      string        `arg:"--server-config" placeholder:"PATH" help:"nginx, Apache or haproxy config file or directory to check the certificate files named in"`
+	Kubeconfig        string        `arg:"--kubeconfig" placeholder:"PATH" help:"kubeconfig file to report the cluster CA and client certificates of"`
+	CertDir           string        `arg:"--certdir" placeholder:"DIR" help:"directory tree to search for PEM, DER and PKCS#12 certificate files, reporting each certificate"`
+	SSHTarget         string        `arg:"--ssh-target" placeholder:"[USER@]HOST:PATH" help:"remote .pem, .crt and .cer files matching a path pattern to fetch over SFTP and parse"`
+	SSHCert           []string      `arg:"--ssh-cert,separate" placeholder:"PATH" help:"OpenSSH host or user certificate file or glob pattern, such as '/etc/ssh/*-cert.pub', to check the expiry and CA signature of, can be repeated"`
+	KnownHosts        string        `arg:"--known-hosts" placeholder:"FILE" help:"known_hosts file to check the host certificates of the hosts named in, using ssh-keyscan"`
+	EnvoyAdmin        []string      `arg:"--envoy-admin" placeholder:"URL" help:"Envoy/Istio admin URL list to read /certs from"`
+	F5                []string      `arg:"--f5" placeholder:"URL" help:"F5 BIG-IP management URL list to list certificates from"`
+	NetScaler         []string      `arg:"--netscaler" placeholder:"URL" help:"Citrix ADC management URL list to list certificates from"`
+	ApplianceUser     string        `arg:"--appliance-user,env:CERTCHECK_APPLIANCE_USER" help:"appliance API user"`
+	AppliancePassword string        `arg:"--appliance-password,env:CERTCHECK_APPLIANCE_PASSWORD" help:"appliance API password"`
+	ApplianceInsecure bool          `arg:"--appliance-insecure" help:"skip verification of appliance API certificates"`
+	CloudflareZone    []string      `arg:"--cloudflare-zone" placeholder:"ZONEID" help:"Cloudflare zone list to audit edge certificates for"`
+	CloudflareToken   string        `arg:"--cloudflare-token,env:CLOUDFLARE_API_TOKEN" help:"Cloudflare API token"`
+	AkamaiContract    []string      `arg:"--akamai-contract" placeholder:"CONTRACTID" help:"Akamai contract list to audit CPS edge certificates for"`
+	EdgeRC            string        `arg:"--edgerc" default:"~/.edgerc" help:"Akamai EdgeGrid credentials file"`
+	EdgeRCSection     string        `arg:"--edgerc-section" default:"default" help:"Akamai EdgeGrid credentials section"`
+	LERateLimit       bool          `arg:"--le-rate-limit" help:"report Let's Encrypt weekly issuance per domain from CT logs"`
+	CTLookup          bool          `arg:"--ct-lookup" help:"list other unexpired certificates logged in CT logs for each host's name"`
+	CTURL             string        `arg:"--ct-url" placeholder:"URL" help:"crt.sh compatible CT search URL for --ct-lookup and --le-rate-limit (default https://crt.sh/)"`
+	GeoIPDB           []string      `arg:"--geoip-db,separate" placeholder:"FILE" help:"MaxMind DB file such as GeoLite2-ASN.mmdb or GeoLite2-Country.mmdb to add each address's ASN and country from, can be repeated"`
+	DNS               string        `arg:"--dns" placeholder:"SERVER" help:"DNS server to resolve hosts with (1.1.1.1:53, tls://1.1.1.1, https://cloudflare-dns.com/dns-query)"`
+	Insecure          bool          `arg:"-k,--insecure" help:"report certificates that fail verification, with the reason in verifyerror"`
+	TrustStore        string        `arg:"--trust-store" default:"system" help:"roots to verify against (system, mozilla, none)"`
+	CAFile            string        `arg:"--ca-file" placeholder:"FILE" help:"PEM file of extra root certificates to trust, such as an internal CA"`
+	CADir             string        `arg:"--ca-dir" placeholder:"DIR" help:"directory of PEM root certificates to trust"`
+	MinTLS            string        `arg:"--min-tls" placeholder:"VERSION" help:"lowest TLS version to offer (1.0, 1.1, 1.2, 1.3)"`
+	MaxTLS            string        `arg:"--max-tls" placeholder:"VERSION" help:"highest TLS version to offer (1.0, 1.1, 1.2, 1.3)"`
+	WaitForValid      bool          `arg:"--wait-for-valid" help:"recheck hosts until all present valid certificates, exiting 1 on timeout"`
+	MaxWait           time.Duration `arg:"--max-wait" default:"10m" help:"longest time to wait with --wait-for-valid"`
+	ExpectSame        bool          `arg:"--expect-same" help:"report hosts serving a different certificate from the rest, such as a stale backend in a pool, as errors"`
+	Strict            bool          `arg:"--strict" help:"list anything short of a clean result in anomalies, exiting 1 if any host has one or fails"`
+	CheckChain        bool          `arg:"--check-chain" help:"check that each host sends the intermediates needed to reach a root"`
+	ChaseAIA          bool          `arg:"--chase-aia" help:"fetch intermediates a host leaves out from their AIA issuer URLs to complete verification"`
+	CheckOCSP         bool          `arg:"--check-ocsp" help:"ask each leaf certificate's OCSP responder for its revocation status"`
+	CheckCRL          bool          `arg:"--check-crl" help:"check each certificate in the chain against its CRL"`
+	CRLCache          string        `arg:"--crl-cache" placeholder:"DIR" help:"directory to keep downloaded CRLs in between runs, implies --check-crl"`
+	HTTPProbe         bool          `arg:"--http-probe" help:"make HEAD requests to record HSTS and HTTP to HTTPS redirects"`
+	UserAgent         string        `arg:"--user-agent" help:"user agent for HTTP requests, to identify scans to site owners"`
+	CheckCAA          bool          `arg:"--check-caa" help:"check that CAA records authorize each certificate's issuer"`
+	GRPCHealth        bool          `arg:"--grpc-health" help:"call the gRPC health service of hosts checked with --protocol grpc"`
+	GRPCService       string        `arg:"--grpc-service" placeholder:"NAME" help:"service to ask the gRPC health service about (default the server)"`
+	Score             bool          `arg:"--score" help:"score each host by risk and list the riskiest first"`
+	ScoreWeights      string        `arg:"--score-weights" placeholder:"WEIGHTS" help:"weights for --score as name=value pairs, such as expiry=100,weakkey=10"`
+	MinScore          int           `arg:"--min-score" help:"only list hosts with at least this score, implies --score"`
+	FreezeCalendar    string        `arg:"--freeze-calendar" placeholder:"FILE" help:"change freezes and holidays, one per line as START [END] [NAME], to warn in time to renew before"`
+	ExpiresBefore     string        `arg:"--expires-before" placeholder:"DATE" help:"only list certificates expiring before a date such as 2025-09-01, in UTC"`
+	AsOf              string        `arg:"--as-of" placeholder:"DATE" help:"calculate expiry as of a date such as 2025-09-01 or an RFC 3339 time instead of now"`
+	MaxLifetime       int           `arg:"--max-lifetime" default:"398" placeholder:"DAYS" help:"flag certificates valid for longer than this in total, 0 to not check"`
+	WarnIfNewerThan   time.Duration `arg:"--warn-if-newer-than" placeholder:"DURATION" help:"flag certificates issued less than this long ago, such as 24h, exiting 1 if any are"`
+	CheckACMEDNS      bool          `arg:"--check-acme-dns" help:"check the _acme-challenge CNAME each host uses for DNS-01 validation"`
+	ACMETarget        string        `arg:"--acme-target" placeholder:"ZONE" help:"zone _acme-challenge CNAMEs must point into, implies --check-acme-dns"`
+	ClockSource       string        `arg:"--clock-source" placeholder:"SOURCE" help:"NTP server or https URL to compare the local clock with before checking"`
+	MaxSkew           time.Duration `arg:"--max-skew" default:"1m" help:"warn if the local clock differs from --clock-source by more than this"`
+	Distrusted        string        `arg:"--distrusted" placeholder:"FILE" help:"file of CA common names or sha256/ pins to flag in distrustedissuer, added to the built in list"`
+	RequireNames      string        `arg:"--require-names" placeholder:"NAMES" help:"comma separated names each certificate's SANs must cover, an error naming any that are missing"`
+	Pins              string        `arg:"--pins" placeholder:"FILE" help:"file of hosts and expected SPKI SHA-256 pins, a mismatch is an error"`
+	PreHook           string        `arg:"--pre-hook" placeholder:"COMMAND" help:"command to run before checking each host, with CERTCHECK_HOST and CERTCHECK_PORT set, skipping the host if it fails"`
+	PostHook          string        `arg:"--post-hook" placeholder:"COMMAND" help:"command to run with each result as JSON on stdin"`
+	Webhook           string        `arg:"--webhook" placeholder:"URL" help:"URL to post the results to as JSON, or each finished scan with serve"`
+	WebhookSecret     string        `arg:"--webhook-secret,env:CERTCHECK_WEBHOOK_SECRET" help:"shared secret to sign webhook payloads with HMAC-SHA256"`
+	WebhookRetries    int           `arg:"--webhook-retries" default:"5" help:"times to retry a failed webhook delivery, with exponential backoff"`
+	WebhookDeadLetter string        `arg:"--webhook-dead-letter" placeholder:"FILE" help:"file to append webhook payloads that could not be delivered to"`
+	Cost              bool          `arg:"--cost" help:"report the connections, bytes and DNS queries the scan sent"`
+	CostByNetwork     bool          `arg:"--cost-by-network" help:"also report connections and bytes for each /24 or /64 network, implies --cost"`
+	Polite            bool          `arg:"--polite" help:"check few hosts at once with a random delay before each, for third-party infrastructure"`
+	PublicScan        bool          `arg:"--public-scan" help:"skip hosts that opted out of scans by DNS TXT record or security.txt, checking them as with --polite"`
+	Concurrency       int           `arg:"--concurrency" help:"hosts to check at once (default number of CPUs, 2 with --polite)"`
+	Jitter            time.Duration `arg:"--jitter" help:"longest random delay before checking each host (default 0, 2s with --polite)"`
+	ProbeTLS          bool          `arg:"--probe-tls" help:"report every TLS version each host accepts"`
+	ProbeCiphers      bool          `arg:"--probe-ciphers" help:"report weak cipher suites each host accepts"`
+	ProbeKeyTypes     bool          `arg:"--probe-key-types" help:"report the RSA and ECDSA certificates each host serves, to find dual certificates"`
+	ProbeSession      bool          `arg:"--probe-session" help:"report session resumption and secure renegotiation support"`
+	AllIPs            bool          `arg:"--all-ips" help:"check every IP address a host resolves to"`
+	SourceIP          string        `arg:"--source-ip" placeholder:"IP" help:"local address to connect to hosts from, on scanners with more than one network"`
+	Interface         string        `arg:"--interface" placeholder:"NAME" help:"network interface to connect to hosts from, by its address"`
+	NetPath           []string      `arg:"--net-path,separate" placeholder:"NAME=SETTINGS" help:"check hosts over a named network path and compare paths, as NAME=source=IP,interface=NAME,dns=SERVER,proxy=URL (repeatable)"`
+	Protocol          string        `arg:"-p,--protocol" default:"auto" help:"TLS negotiation protocol (auto, tls, smtp, pop3, imap, ftp, ldap, postgres)"`
+	Timeout           int           `arg:"-t,--timeout" help:"connection timeout seconds (default 10, or that of the profile)"`
+	Retries           int           `arg:"--retries" help:"times to retry a host if no TLS connection could be made"`
+	Profile           string        `arg:"--profile" help:"scan preset (fast, thorough, audit)"`
+	WarnAtDays        int           `arg:"-w,--warn-at-days" placeholder:"WARNAT" default:"30" help:"warn if expiry before days"`
+	YAML              bool          `arg:"-y,--yaml" help:"display output as YAML"`
+	JSON              bool          `arg:"-j,--json" help:"display output as JSON (default)"`
+	Watch             *WatchCmd     `arg:"subcommand:watch" help:"check one host repeatedly and show changes"`
+	Compare           *CompareCmd   `arg:"subcommand:compare" help:"check that hosts serve the same certificate and chain"`
+	Baseline          *BaselineCmd  `arg:"subcommand:baseline" help:"save or check approved certificates for hosts"`
+	Forecast          *ForecastCmd  `arg:"subcommand:forecast" help:"count certificates expiring each week, grouped by issuer"`
+	Image             *ImageCmd     `arg:"subcommand:image" help:"check certificate files in a container image"`
+	Repo              *RepoCmd      `arg:"subcommand:repo" help:"find certificates and private keys in a git repository"`
+	K8s               *K8sCmd       `arg:"subcommand:k8s" help:"check the certificates in Kubernetes TLS secrets, listed from the API server"`
+	AWS               *AWSCmd       `arg:"subcommand:aws" help:"list the certificates in AWS Certificate Manager and their renewal eligibility"`
+	Azure             *AzureCmd     `arg:"subcommand:azure" help:"list the certificates in Azure Key Vaults and their auto-renewal, with any hosts given"`
+	TrustAudit        *TrustCmd     `arg:"subcommand:truststore" help:"list the roots of a JVM cacerts file or the system trust store that expire soon"`
+	Serve             *ServeCmd     `arg:"subcommand:serve" help:"serve an HTTP API that runs scans in the background"`
+}
+
+// subcommandSkipsHosts check whether the subcommand given works without the
+// hosts checked, so hosts aren't read from stdin for it. Baseline, forecast
+// and azure check the hosts given along with their own work.
+func subcommandSkipsHosts(args Args) bool {
+	switch {
+	case args.Watch != nil, args.Compare != nil, args.Image != nil, args.Repo != nil,
+		args.K8s != nil, args.AWS != nil, args.TrustAudit != nil, args.Serve != nil:
+		return true
+	}
+
+	return false
 }
 
 // Version get version information
@@ -64,108 +196,806 @@ var callArgs Args
 func main() {
 	cmd := &complete.Command{
 		Flags: map[string]complete.Predictor{
-			"hosts":        predict.Nothing,
-			"certfile":     predict.Files("*"),
-			"timeout":      predict.Nothing,
-			"warn-at-days": predict.Nothing,
-			"yaml":         predict.Nothing,
-			"json":         predict.Nothing,
+			"hosts":               predict.Nothing,
+			"hosts-file":          predict.Files("*"),
+			"urls-file":           predict.Files("*"),
+			"cert-archive":        predict.Files("*"),
+			"certdir":             predict.Dirs("*"),
+			"kubeconfig":          predict.Files("*"),
+			"server-config":       predict.Files("*"),
+			"ssh-target":          predict.Nothing,
+			"ssh-cert":            predict.Files("*"),
+			"known-hosts":         predict.Files("*"),
+			"certfile":            predict.Files("*"),
+			"keyfile":             predict.Files("*"),
+			"csr":                 predict.Files("*"),
+			"max-cert-size":       predict.Nothing,
+			"password":            predict.Nothing,
+			"envoy-admin":         predict.Nothing,
+			"f5":                  predict.Nothing,
+			"netscaler":           predict.Nothing,
+			"appliance-user":      predict.Nothing,
+			"appliance-password":  predict.Nothing,
+			"appliance-insecure":  predict.Nothing,
+			"cloudflare-zone":     predict.Nothing,
+			"cloudflare-token":    predict.Nothing,
+			"akamai-contract":     predict.Nothing,
+			"edgerc":              predict.Files("*"),
+			"edgerc-section":      predict.Nothing,
+			"le-rate-limit":       predict.Nothing,
+			"ct-lookup":           predict.Nothing,
+			"ct-url":              predict.Nothing,
+			"geoip-db":            predict.Files("*.mmdb"),
+			"dns":                 predict.Nothing,
+			"insecure":            predict.Nothing,
+			"trust-store":         predict.Set(trust.Stores),
+			"ca-file":             predict.Files("*"),
+			"ca-dir":              predict.Dirs("*"),
+			"min-tls":             predict.Set(hosts.TLSVersionNames),
+			"max-tls":             predict.Set(hosts.TLSVersionNames),
+			"wait-for-valid":      predict.Nothing,
+			"max-wait":            predict.Nothing,
+			"expect-same":         predict.Nothing,
+			"strict":              predict.Nothing,
+			"check-chain":         predict.Nothing,
+			"chase-aia":           predict.Nothing,
+			"check-ocsp":          predict.Nothing,
+			"check-crl":           predict.Nothing,
+			"crl-cache":           predict.Dirs("*"),
+			"http-probe":          predict.Nothing,
+			"user-agent":          predict.Nothing,
+			"check-caa":           predict.Nothing,
+			"grpc-health":         predict.Nothing,
+			"grpc-service":        predict.Nothing,
+			"score":               predict.Nothing,
+			"score-weights":       predict.Nothing,
+			"min-score":           predict.Nothing,
+			"freeze-calendar":     predict.Files("*"),
+			"expires-before":      predict.Nothing,
+			"max-lifetime":        predict.Nothing,
+			"warn-if-newer-than":  predict.Nothing,
+			"check-acme-dns":      predict.Nothing,
+			"acme-target":         predict.Nothing,
+			"clock-source":        predict.Nothing,
+			"as-of":               predict.Nothing,
+			"max-skew":            predict.Nothing,
+			"pins":                predict.Files("*"),
+			"distrusted":          predict.Files("*"),
+			"require-names":       predict.Nothing,
+			"cost":                predict.Nothing,
+			"cost-by-network":     predict.Nothing,
+			"pre-hook":            predict.Nothing,
+			"post-hook":           predict.Nothing,
+			"webhook":             predict.Nothing,
+			"webhook-secret":      predict.Nothing,
+			"webhook-retries":     predict.Nothing,
+			"webhook-dead-letter": predict.Files("*"),
+			"polite":              predict.Nothing,
+			"public-scan":         predict.Nothing,
+			"concurrency":         predict.Nothing,
+			"jitter":              predict.Nothing,
+			"probe-tls":           predict.Nothing,
+			"probe-ciphers":       predict.Nothing,
+			"probe-key-types":     predict.Nothing,
+			"probe-session":       predict.Nothing,
+			"all-ips":             predict.Nothing,
+			"source-ip":           predict.Nothing,
+			"interface":           predict.Nothing,
+			"net-path":            predict.Nothing,
+			"protocol":            predict.Set(append([]string{"auto"}, hosts.Protocols...)),
+			"timeout":             predict.Nothing,
+			"retries":             predict.Nothing,
+			"profile":             predict.Set(hosts.ProfileNames()),
+			"warn-at-days":        predict.Nothing,
+			"yaml":                predict.Nothing,
+			"json":                predict.Nothing,
+		},
+		Sub: map[string]*complete.Command{
+			"watch": {
+				Flags: map[string]complete.Predictor{
+					"every": predict.Nothing,
+					"count": predict.Nothing,
+				},
+			},
+			"compare": {},
+			"baseline": {
+				Flags: map[string]complete.Predictor{
+					"file": predict.Files("*"),
+				},
+				Sub: map[string]*complete.Command{
+					"save":  {},
+					"check": {},
+				},
+			},
+			"forecast": {
+				Flags: map[string]complete.Predictor{
+					"horizon": predict.Nothing,
+				},
+			},
+			"image": {
+				Flags: map[string]complete.Predictor{
+					"platform": predict.Nothing,
+				},
+			},
+			"repo": {
+				Flags: map[string]complete.Predictor{
+					"history": predict.Nothing,
+				},
+			},
+			"k8s": {
+				Flags: map[string]complete.Predictor{
+					"namespace": predict.Nothing,
+					"selector":  predict.Nothing,
+					"context":   predict.Nothing,
+				},
+			},
+			"aws": {
+				Flags: map[string]complete.Predictor{
+					"region":      predict.Nothing,
+					"aws-profile": predict.Nothing,
+					"iam":         predict.Nothing,
+				},
+			},
+			"azure": {},
+			"truststore": {
+				Flags: map[string]complete.Predictor{
+					"all": predict.Nothing,
+				},
+				Args: predict.Files("*"),
+			},
+			"serve": {
+				Flags: map[string]complete.Predictor{
+					"listen":             predict.Nothing,
+					"max-hosts":          predict.Nothing,
+					"max-scans":          predict.Nothing,
+					"retain":             predict.Nothing,
+					"api-keys":           predict.Files("*"),
+					"oidc-issuer":        predict.Nothing,
+					"oidc-audience":      predict.Nothing,
+					"oidc-role-claim":    predict.Nothing,
+					"oidc-client-id":     predict.Nothing,
+					"oidc-client-secret": predict.Nothing,
+					"external-url":       predict.Nothing,
+				},
+			},
 		},
 	}
 
 	cmd.Complete("certcheck")
 
+	// Hand off to an external subcommand such as certcheck-foo for certcheck foo
+	if path, ok := findPlugin(os.Args[1:]); ok {
+		exitCode, err := runPlugin(path, os.Args[2:])
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+		}
+		os.Exit(exitCode)
+	}
+
 	// var callArgs args // initialize call args structure
 	arg.MustParse(&callArgs)
 
+	// Summarize signing requests instead of checking certificates
+	if len(callArgs.CSR) > 0 {
+		failed, err := checkCSRs(os.Stdout, callArgs.CSR, callArgs.MaxCertSize, callArgs.YAML)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
 	// Make a cert value set that will hold the output data
 	var certDataSet = hosts.NewCertDataSet()
+	var exitCode int
 
 	// Use stdin if it is available. Path will be ignored.
 	stat, _ := os.Stdin.Stat()
 	// var hostsToCheck []string
 
 	var hostSet = hosts.NewHostSet()
+	hostSet.Protocol = callArgs.Protocol
+	hostSet.AllIPs = callArgs.AllIPs
+	if callArgs.SourceIP != "" {
+		hostSet.SourceIP = net.ParseIP(callArgs.SourceIP)
+		if hostSet.SourceIP == nil {
+			fmt.Println(fmt.Errorf("error invalid source IP %s", callArgs.SourceIP))
+			os.Exit(1)
+		}
+	}
+	hostSet.Interface = callArgs.Interface
 
-	if (stat.Mode() & os.ModeCharDevice) == 0 {
-
-		var scanner = bufio.NewScanner(os.Stdin)
-		// Tell scanner to scan by lines.
-		scanner.Split(bufio.ScanLines)
-
-		for scanner.Scan() {
-			host := scanner.Text()
-			host = strings.TrimSpace(host)
+	// Hosts from stdin, the command line and host files are checked together
+	if !subcommandSkipsHosts(callArgs) && !readsStdin(callArgs) && (stat.Mode()&os.ModeCharDevice) == 0 {
+		stdinHosts, err := readHostList(os.Stdin)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Add(stdinHosts...)
+	}
+	hostSet.Add(callArgs.Hosts...)
+	for _, path := range callArgs.HostsFile {
+		fileHosts, err := readHostsFile(path)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Add(fileHosts...)
+	}
+	for _, path := range callArgs.URLsFile {
+		urlHosts, err := readURLsFile(path)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Add(urlHosts...)
+	}
 
-			if strings.TrimSpace(host) == "" {
-				continue
-			}
+	// Check the hosts in the baseline unless others are given
+	var approved *baseline.Baseline
+	if callArgs.Baseline != nil && callArgs.Baseline.Check != nil {
+		var err error
+		approved, err = baseline.Read(callArgs.Baseline.File)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		if len(hostSet.Hosts) == 0 {
+			hostSet.Add(approved.Hosts()...)
+		}
+	}
 
-			// If hosts are space separated
-			if strings.Contains(host, " ") {
-				re := regexp.MustCompile(`\s+`)
-				// Split on space
-				stdinHosts := re.Split(host, -1)
-				for _, part := range stdinHosts {
-					part = strings.TrimSpace(part)
-					if part == "" {
-						continue
-					}
-					hostSet.Add(part)
-				}
-			} else {
-				hostSet.Add(strings.TrimSpace(host))
-			}
+	// Check the date before any hosts are checked
+	var expiresBefore time.Time
+	if callArgs.ExpiresBefore != "" {
+		var err error
+		expiresBefore, err = parseDate(callArgs.ExpiresBefore)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
 		}
-	} else {
-		hostSet.Add(callArgs.Hosts...)
+	}
+	var freezes []calendar.Freeze
+	if callArgs.FreezeCalendar != "" {
+		var err error
+		freezes, err = calendar.Read(callArgs.FreezeCalendar)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	}
+	hostSet.Clock = clock.System
+	if callArgs.AsOf != "" {
+		asOf, err := parseDate(callArgs.AsOf)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Clock = clock.Fixed(asOf)
 	}
 
 	// Set minimum if below threshold
 	if callArgs.WarnAtDays < 1 {
 		callArgs.WarnAtDays = 30
 	}
+	hostSet.Timeout = time.Duration(callArgs.Timeout) * time.Second
+	hostSet.ProbeTLS = callArgs.ProbeTLS
+	hostSet.ProbeCiphers = callArgs.ProbeCiphers
+	hostSet.ProbeKeyTypes = callArgs.ProbeKeyTypes
+	hostSet.ProbeSession = callArgs.ProbeSession
+	hostSet.Insecure = callArgs.Insecure
+	hostSet.CheckChain = callArgs.CheckChain
+	hostSet.Strict = callArgs.Strict
+	for _, name := range strings.Split(callArgs.RequireNames, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			hostSet.RequireNames = append(hostSet.RequireNames, name)
+		}
+	}
+	hostSet.ChaseAIA = callArgs.ChaseAIA
+	hostSet.CheckOCSP = callArgs.CheckOCSP
+	hostSet.CheckCAA = callArgs.CheckCAA
+	hostSet.CheckACMEDNS = callArgs.CheckACMEDNS || callArgs.ACMETarget != ""
+	hostSet.ACMETarget = callArgs.ACMETarget
+	hostSet.HTTPProbe = callArgs.HTTPProbe
+	hostSet.UserAgent = callArgs.UserAgent
+	hostSet.Retries = callArgs.Retries
+	if callArgs.PreHook != "" {
+		hostSet.BeforeCheck = preHook(callArgs.PreHook)
+	}
+	if callArgs.PostHook != "" {
+		hostSet.AfterCheck = postHook(callArgs.PostHook)
+	}
+	hostSet.GRPCHealth = callArgs.GRPCHealth
+	hostSet.GRPCService = callArgs.GRPCService
+	hostSet.Password = callArgs.Password
+	hostSet.MaxCertSize = callArgs.MaxCertSize
+	if len(callArgs.KeyFile) > 0 {
+		paths, errs := certFilePaths(callArgs.KeyFile)
+		for _, err := range errs {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		for _, path := range paths {
+			keyFile, err := hostSet.ReadKeyFile(path, callArgs.Password)
+			if err != nil {
+				fmt.Println(fmt.Errorf("error %v", err))
+				os.Exit(1)
+			}
+			hostSet.Keys = append(hostSet.Keys, keyFile)
+		}
+	}
+	if callArgs.Pins != "" {
+		f, err := os.Open(callArgs.Pins)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Pins, err = hosts.ReadPins(f)
+		f.Close()
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	}
+	if callArgs.Distrusted != "" {
+		f, err := os.Open(callArgs.Distrusted)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		distrusted, err := hosts.ReadDistrusted(f)
+		f.Close()
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Distrusted = append(append([]hosts.DistrustedCA(nil), hosts.DefaultDistrusted...), distrusted...)
+	}
+
+	// Fill in checks and settings from a scan profile
+	if callArgs.Profile != "" {
+		err := hostSet.ApplyProfile(callArgs.Profile)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	}
+
 	// Set minimum if below threshold
-	if callArgs.Timeout < 1 {
-		callArgs.Timeout = 5
+	if hostSet.Timeout < time.Second {
+		hostSet.Timeout = defaultTimeout
 	}
+	timeout := hostSet.Timeout
 
-	if callArgs.CertFile != "" {
-		file, err := os.Open(callArgs.CertFile)
+	// Results are pushed once checked, or as each scan finishes when serving
+	var sender *webhook.Sender
+	if callArgs.Webhook != "" {
+		sender = webhook.NewSender(callArgs.Webhook, callArgs.WebhookSecret, timeout)
+		sender.Retries = callArgs.WebhookRetries
+		sender.DeadLetter = callArgs.WebhookDeadLetter
+	}
+	hostSet.Concurrency = callArgs.Concurrency
+	hostSet.Jitter = callArgs.Jitter
+	// Public scans are of third-party infrastructure
+	hostSet.PublicScan = callArgs.PublicScan
+	if callArgs.Polite || callArgs.PublicScan {
+		if hostSet.Concurrency == 0 {
+			hostSet.Concurrency = politeConcurrency
+		}
+		if hostSet.Jitter == 0 {
+			hostSet.Jitter = politeJitter
+		}
+	}
+	// A CRL cache directory implies checking CRLs, and is also used by a
+	// profile that checks them
+	if callArgs.CheckCRL || callArgs.CRLCache != "" {
+		hostSet.Enable(hosts.FeatureCheckCRL)
+		hostSet.CRLCache.Dir = callArgs.CRLCache
+	}
+	if callArgs.MinTLS != "" {
+		version, err := hosts.ParseTLSVersion(callArgs.MinTLS)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.MinTLS = version
+	}
+	if callArgs.MaxTLS != "" {
+		version, err := hosts.ParseTLSVersion(callArgs.MaxTLS)
 		if err != nil {
 			fmt.Println(fmt.Errorf("error %v", err))
 			os.Exit(1)
 		}
-		// Limit to max PEM file size. Found in Cisco document about changes
-		// to max.
-		limitReader := io.LimitReader(file, 8192)
-		contents, err := io.ReadAll(limitReader)
+		hostSet.MaxTLS = version
+	}
+
+	// Verify against the chosen roots plus any internal PKI. The system store
+	// with nothing added is the Go default.
+	if callArgs.TrustStore != trust.StoreSystem || callArgs.CAFile != "" || callArgs.CADir != "" {
+		pool, err := trust.Pool(callArgs.TrustStore)
 		if err != nil {
 			fmt.Println(fmt.Errorf("error %v", err))
 			os.Exit(1)
 		}
-		certDataSet = hosts.NewHostSet().ProcessCertFile(contents, callArgs.WarnAtDays, time.Duration(callArgs.Timeout*int(time.Second)))
-	} else {
-		certDataSet = hostSet.Process(callArgs.WarnAtDays, time.Duration(callArgs.Timeout*int(time.Second)))
+		err = hosts.AppendRoots(pool, callArgs.CAFile, callArgs.CADir)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Roots = pool
 	}
 
-	var bytes []byte
-	var err error
+	if callArgs.DNS != "" {
+		resolver, err := hosts.NewResolver(callArgs.DNS, timeout)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		hostSet.Resolver = resolver
+	}
 
-	// Handle YAML output
-	if callArgs.YAML {
-		bytes, err = certDataSet.YAML()
+	// Databases are read before checking so a bad path fails fast
+	var geoDBs []*geoip.DB
+	for _, path := range callArgs.GeoIPDB {
+		db, err := geoip.Open(path)
 		if err != nil {
-			panic(err)
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		geoDBs = append(geoDBs, db)
+	}
+
+	// Count what the scan sends, for approving large recurring scans
+	var costMeter *hosts.CostMeter
+	if callArgs.Cost || callArgs.CostByNetwork {
+		costMeter = hosts.NewCostMeter(callArgs.CostByNetwork)
+		hostSet.Cost = costMeter
+		hostSet.Resolver = costMeter.Resolver(hostSet.Resolver)
+	}
+
+	// Named network paths to check each host over
+	var netPaths []hosts.NetPath
+	for _, spec := range callArgs.NetPath {
+		netPath, err := hosts.ParseNetPath(spec, timeout)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		if netPath.Resolver != nil && costMeter != nil {
+			netPath.Resolver = costMeter.Resolver(netPath.Resolver)
+		}
+		netPaths = append(netPaths, netPath)
+	}
+
+	// Expiry math is only as good as the local clock
+	if callArgs.ClockSource != "" {
+		checkClock(context.Background(), os.Stderr, callArgs.ClockSource, timeout, callArgs.MaxSkew)
+	}
+
+	// Check a single host repeatedly until interrupted
+	if callArgs.Watch != nil {
+		hostSet.WarnAtDays = callArgs.WarnAtDays
+		hostSet.Timeout = timeout
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if callArgs.ClockSource != "" {
+			go watchClock(ctx, os.Stderr, callArgs.ClockSource, timeout, callArgs.MaxSkew, clockInterval)
+		}
+		watch(ctx, os.Stdout, callArgs.Watch, hostSet.Options)
+		return
+	}
+
+	// Run scans for API callers until interrupted
+	if callArgs.Serve != nil {
+		hostSet.WarnAtDays = callArgs.WarnAtDays
+		hostSet.Timeout = timeout
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		if err := serve(ctx, os.Stderr, callArgs.Serve, hostSet.Options, sender); err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	if callArgs.Compare != nil {
+		// Compare what hosts serve, failing if they differ
+		hostSet.WarnAtDays = callArgs.WarnAtDays
+		hostSet.Timeout = timeout
+		var mismatches []string
+		certDataSet, mismatches = compare(context.Background(), callArgs.Compare, hostSet.Options)
+		for _, mismatch := range mismatches {
+			fmt.Fprintln(os.Stderr, mismatch)
+		}
+		if len(mismatches) > 0 {
+			exitCode = 1
+		}
+	} else if callArgs.Image != nil {
+		var err error
+		certDataSet, err = hostSet.ProcessImage(callArgs.Image.Image, callArgs.Image.Platform, callArgs.WarnAtDays)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	} else if callArgs.K8s != nil {
+		var err error
+		certDataSet, err = k8sCerts(hostSet, callArgs.K8s, callArgs.WarnAtDays, timeout)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	} else if callArgs.AWS != nil {
+		aws, err := cloud.NewAWS(callArgs.AWS.Profile, timeout)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		aws.Clock = hostSet.Clock
+		certDataSet = awsCerts(aws, callArgs.AWS, callArgs.WarnAtDays)
+		if certDataSet.HostErrors > 0 {
+			exitCode = 1
+		}
+	} else if callArgs.Azure != nil {
+		azure, err := cloud.NewAzure(timeout)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		azure.Clock = hostSet.Clock
+		for _, vault := range callArgs.Azure.Vault {
+			certDataSet.MergeSource(azure.KeyVault(vault, callArgs.WarnAtDays), model.SourceCloud)
+		}
+		// Hosts given with the vaults are checked in the same run
+		if len(hostSet.Hosts) > 0 {
+			certDataSet.MergeSource(hostSet.Process(callArgs.WarnAtDays, timeout), model.SourceHost)
+		}
+		if certDataSet.HostErrors > 0 {
+			exitCode = 1
+		}
+	} else if callArgs.TrustAudit != nil {
+		var err error
+		certDataSet, err = hostSet.ProcessTrustStore(callArgs.TrustAudit.Path, callArgs.TrustAudit.All, callArgs.WarnAtDays)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+	} else if callArgs.Repo != nil {
+		var err error
+		certDataSet, err = hostSet.ProcessRepo(callArgs.Repo.Path, callArgs.Repo.History, callArgs.WarnAtDays)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
 		}
-		// Handle JSON output
 	} else {
-		bytes, err = certDataSet.JSON()
+		// Files and hosts given together are checked in one run
+		var failed bool
+		certDataSet, failed = checkFiles(callArgs, hostSet)
+		if failed {
+			exitCode = 1
+		}
+		if len(hostSet.Hosts) > 0 {
+			var hostDataSet *hosts.CertDataSet
+			if callArgs.WaitForValid {
+				// Gate on certificate propagation, failing if it doesn't happen in time
+				ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+				defer stop()
+				var valid bool
+				hostDataSet, valid = waitForValid(ctx, os.Stderr, hostSet, callArgs.WarnAtDays, timeout, callArgs.MaxWait, waitInterval)
+				if !valid {
+					exitCode = 1
+				}
+			} else if len(netPaths) > 0 {
+				hostDataSet = hostSet.ProcessPaths(netPaths, callArgs.WarnAtDays, timeout)
+			} else {
+				hostDataSet = hostSet.Process(callArgs.WarnAtDays, timeout)
+			}
+			certDataSet.MergeSource(hostDataSet, model.SourceHost)
+			// A host serving different certs over different paths fails the run
+			if len(netPaths) > 0 && certDataSet.ComparePaths() > 0 {
+				exitCode = 1
+			}
+		}
+	}
+	if costMeter != nil {
+		certDataSet.Cost = costMeter.Report()
+	}
+	if hostSet.CRLCache != nil {
+		// Lists that couldn't be kept are downloaded again by the next run
+		if err := hostSet.CRLCache.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error %v", err))
+		}
+	}
+
+	// Report upcoming expiry instead of the checked hosts
+	if callArgs.Forecast != nil {
+		err := writeForecast(os.Stdout, callArgs.Forecast, certDataSet, hostSet.Clock.Now(), callArgs.YAML)
 		if err != nil {
-			panic(err)
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Save or check the approved baseline
+	if callArgs.Baseline != nil && callArgs.Baseline.Save != nil {
+		err := saveBaseline(os.Stderr, callArgs.Baseline.File, certDataSet, hostSet.AllIPs)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
 		}
 	}
-	fmt.Println(string(bytes))
+	if approved != nil && checkBaseline(os.Stderr, approved, certDataSet) {
+		exitCode = 1
+	}
+
+	if callArgs.CTURL != "" {
+		ct.CrtShURL = callArgs.CTURL
+		if !strings.HasSuffix(ct.CrtShURL, "/") {
+			ct.CrtShURL += "/"
+		}
+	}
+
+	// Estimate Let's Encrypt issuance for domains of checked hosts
+	if callArgs.LERateLimit {
+		certDataSet.RateLimits = ct.LetsEncryptRateLimits(certDataSet, timeout)
+	}
+
+	// Find certs issued for checked names other than the ones being served
+	if callArgs.CTLookup {
+		ct.OtherCerts(certDataSet, timeout)
+	}
+
+	// Add the network and country of each address checked
+	if len(geoDBs) > 0 {
+		if err := geoip.Annotate(certDataSet, geoDBs); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error %v", err))
+		}
+	}
+
+	// Audit CDN edge certificates against what the checked hosts serve
+	var edgeCerts []cdn.EdgeCert
+	var edgeErrors []hosts.CertData
+	edgeError := func(host string, err error) hosts.CertData {
+		return hosts.CertData{Host: host, HostError: true, Message: err.Error(), CheckTime: hostSet.Clock.Now().Format(model.TimeFormat)}
+	}
+	for _, zoneID := range callArgs.CloudflareZone {
+		zoneCerts, err := cdn.Cloudflare(callArgs.CloudflareToken, zoneID, timeout)
+		if err != nil {
+			edgeErrors = append(edgeErrors, edgeError("cloudflare zone "+zoneID, err))
+			continue
+		}
+		edgeCerts = append(edgeCerts, zoneCerts...)
+	}
+	if len(callArgs.AkamaiContract) > 0 {
+		edgeRC := callArgs.EdgeRC
+		if strings.HasPrefix(edgeRC, "~/") {
+			home, _ := os.UserHomeDir()
+			edgeRC = filepath.Join(home, edgeRC[2:])
+		}
+		edgeGrid, readErr := cdn.ReadEdgeRC(edgeRC, callArgs.EdgeRCSection)
+		for _, contractID := range callArgs.AkamaiContract {
+			if readErr != nil {
+				edgeErrors = append(edgeErrors, edgeError("akamai contract "+contractID, readErr))
+				continue
+			}
+			contractCerts, err := cdn.Akamai(edgeGrid, contractID, timeout)
+			if err != nil {
+				edgeErrors = append(edgeErrors, edgeError("akamai contract "+contractID, err))
+				continue
+			}
+			edgeCerts = append(edgeCerts, contractCerts...)
+		}
+	}
+	if len(edgeCerts) > 0 {
+		certDataSet.MergeSource(cdn.Audit(edgeCerts, certDataSet, callArgs.WarnAtDays, hostSet.Clock.Now()), model.SourceCDN)
+	}
+	certDataSet.MergeSource(&hosts.CertDataSet{CertData: edgeErrors}, model.SourceCDN)
+
+	// Merge in certificates reported by Envoy sidecars and gateways
+	for _, adminURL := range callArgs.EnvoyAdmin {
+		certDataSet.MergeSource(envoy.Lookup(adminURL, callArgs.WarnAtDays, timeout, hostSet.Clock.Now()), model.SourceEnvoy)
+	}
+
+	// Merge in certificates installed on load balancer appliances
+	for _, apiURL := range callArgs.F5 {
+		a := appliance.NewAppliance(apiURL, callArgs.ApplianceUser, callArgs.AppliancePassword, callArgs.ApplianceInsecure, timeout)
+		a.Clock = hostSet.Clock
+		certDataSet.MergeSource(a.F5(callArgs.WarnAtDays), model.SourceAppliance)
+	}
+	for _, apiURL := range callArgs.NetScaler {
+		a := appliance.NewAppliance(apiURL, callArgs.ApplianceUser, callArgs.AppliancePassword, callArgs.ApplianceInsecure, timeout)
+		a.Clock = hostSet.Clock
+		certDataSet.MergeSource(a.NetScaler(callArgs.WarnAtDays), model.SourceAppliance)
+	}
+
+	// Find backends in a pool that serve something else
+	if callArgs.ExpectSame && certDataSet.ExpectSame() > 0 {
+		exitCode = 1
+	}
+
+	// Warn in time to renew before freezes that block renewal
+	if len(freezes) > 0 {
+		calendar.Apply(certDataSet, freezes, hostSet.Clock.Now())
+	}
+
+	// Answer questions such as what expires before a freeze
+	if callArgs.ExpiresBefore != "" {
+		certDataSet.ExpiringBefore(expiresBefore)
+	}
+
+	// Flag certs browsers would reject as valid for too long
+	if callArgs.MaxLifetime > 0 {
+		certDataSet.MarkLongLifetime(callArgs.MaxLifetime)
+	}
+
+	// Trip on certs issued unexpectedly or renewed outside of plans
+	if callArgs.WarnIfNewerThan > 0 {
+		certDataSet.MarkNewlyIssued(callArgs.WarnIfNewerThan, hostSet.Clock.Now())
+		for _, certData := range certDataSet.CertData {
+			if certData.NewlyIssued {
+				exitCode = 1
+			}
+		}
+	}
+
+	// Rate hosts by risk once every source has been merged in
+	if callArgs.Score || callArgs.MinScore > 0 {
+		weights, err := score.ParseWeights(callArgs.ScoreWeights)
+		if err != nil {
+			fmt.Println(fmt.Errorf("error %v", err))
+			os.Exit(1)
+		}
+		weights.Apply(certDataSet)
+		if callArgs.MinScore > 0 {
+			score.Filter(certDataSet, callArgs.MinScore)
+		}
+		score.Sort(certDataSet)
+	}
+
+	// Fail on anything short of a clean result
+	if callArgs.Strict {
+		for _, certData := range certDataSet.CertData {
+			if certData.HostError || len(certData.Anomalies) > 0 {
+				exitCode = 1
+			}
+		}
+	}
+
+	// Do JSON output by default
+	writer := output.JSON
+	if callArgs.YAML {
+		writer = output.YAML
+	}
+	err := writer.Write(os.Stdout, certDataSet)
+	if err != nil {
+		panic(err)
+	}
+
+	// Push the results to a receiver, failing if they couldn't be delivered
+	if sender != nil {
+		if err := sender.Send(context.Background(), certDataSet); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error delivering webhook %v", err))
+			exitCode = 1
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+// parseDate get a time from a date such as 2025-09-01, taken as midnight UTC
+// as output times are UTC, or from an RFC 3339 time
+func parseDate(date string) (t time.Time, err error) {
+	t, err = time.Parse("2006-01-02", date)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, date)
+	}
+	if err != nil {
+		return t, fmt.Errorf("invalid date %s, expected a date such as 2025-09-01", date)
+	}
 
 	return
 }
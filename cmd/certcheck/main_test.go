@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestBuiltinCommands(t *testing.T) {
+	is := is.New(t)
+
+	args := reflect.TypeOf(Args{})
+	subcommands := 0
+	for i := 0; i < args.NumField(); i++ {
+		tag := args.Field(i).Tag.Get("arg")
+		if _, name, ok := strings.Cut(tag, "subcommand:"); ok {
+			subcommands++
+			is.True(builtinCommands[name]) // every subcommand takes precedence over plugins
+		}
+	}
+	is.Equal(len(builtinCommands), subcommands)
+	is.True(!builtinCommands["hosts"])
+
+	path, ok := findPlugin([]string{"watch"})
+	is.Equal(path, "")
+	is.True(!ok)
+}
+
+func TestRunPlugin(t *testing.T) {
+	is := is.New(t)
+
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell")
+	}
+	exitCode, err := runPlugin(sh, []string{"-c", "exit 3"})
+	is.NoErr(err)
+	is.Equal(exitCode, 3)
+
+	// A plugin killed by SIGTERM exits as a shell reports it
+	exitCode, err = runPlugin(sh, []string{"-c", "kill -TERM $$"})
+	is.NoErr(err)
+	is.Equal(exitCode, 143)
+}
+
+func TestWatchState(t *testing.T) {
+	is := is.New(t)
+
+	// A reissued cert is a change even with the same issuer and expiry
+	before := model.CertData{IP: "192.0.2.1", Issuer: "CN=R3", NotAfter: "2026-01-01T00:00:00Z", Fingerprint: "aa", Message: "OK"}
+	after := before
+	after.Fingerprint = "bb"
+	is.True(watchState(before) != watchState(after))
+	is.Equal(watchState(before), watchState(before))
+}
+
+func TestSubcommandSkipsHosts(t *testing.T) {
+	is := is.New(t)
+
+	is.True(!subcommandSkipsHosts(Args{}))
+	is.True(!subcommandSkipsHosts(Args{Baseline: &BaselineCmd{}}))
+	is.True(!subcommandSkipsHosts(Args{Forecast: &ForecastCmd{}}))
+	is.True(!subcommandSkipsHosts(Args{Azure: &AzureCmd{}}))
+	is.True(subcommandSkipsHosts(Args{Watch: &WatchCmd{}}))
+	is.True(subcommandSkipsHosts(Args{AWS: &AWSCmd{}}))
+	is.True(subcommandSkipsHosts(Args{Serve: &ServeCmd{}}))
+}
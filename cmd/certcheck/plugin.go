@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"syscall"
+)
+
+// pluginPrefix prefix of executables on PATH run as certcheck subcommands
+const pluginPrefix = "certcheck-"
+
+// builtinCommands subcommands that take precedence over plugins
+var builtinCommands = subcommandNames(reflect.TypeOf(Args{}))
+
+// subcommandNames get the names in the subcommand tags of an arguments struct
+func subcommandNames(args reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < args.NumField(); i++ {
+		for _, option := range strings.Split(args.Field(i).Tag.Get("arg"), ",") {
+			if strings.HasPrefix(option, "subcommand:") {
+				for _, name := range strings.Split(strings.TrimPrefix(option, "subcommand:"), "|") {
+					names[name] = true
+				}
+			}
+		}
+	}
+
+	return names
+}
+
+// findPlugin get the path of the executable for a subcommand, if the first
+// argument names one. Flags are never treated as subcommands.
+func findPlugin(args []string) (path string, ok bool) {
+	if len(args) == 0 {
+		return
+	}
+	name := args[0]
+	if name == "" || builtinCommands[name] || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return
+	}
+	path, err := exec.LookPath(pluginPrefix + name)
+	if err != nil {
+		return
+	}
+
+	return path, true
+}
+
+// runPlugin run an external subcommand such as certcheck-foo for certcheck foo,
+// passing the remaining arguments and standard streams through. The CERTCHECK
+// environment variable is set to this executable so plugins can call back.
+func runPlugin(path string, args []string) (exitCode int, err error) {
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if self, selfErr := os.Executable(); selfErr == nil {
+		cmd.Env = append(cmd.Env, "CERTCHECK="+self)
+	}
+
+	err = cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return pluginExitCode(exitErr), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+
+	return
+}
+
+// pluginExitCode get the exit code to pass on for a plugin that failed, 128
+// plus the signal number as shells give it for a plugin killed by a signal
+func pluginExitCode(exitErr *exec.ExitError) int {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := exitErr.ExitCode(); code >= 0 {
+		return code
+	}
+
+	return 1
+}
@@ -0,0 +1,7 @@
+package main
+
+// RepoCmd arguments for the repo subcommand
+type RepoCmd struct {
+	Path    string `arg:"positional" default:"." placeholder:"DIR" help:"repository working tree to search"`
+	History bool   `arg:"--history" help:"also search every commit on every branch, using git"`
+}
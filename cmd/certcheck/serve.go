@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/access"
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/imarsman/certcheck/v2/pkg/webhook"
+)
+
+// ServeCmd arguments for the serve subcommand
+type ServeCmd struct {
+	Listen           string        `arg:"--listen" default:"localhost:8080" help:"address to serve the scans API on"`
+	MaxHosts         int           `arg:"--max-hosts" default:"10000" help:"most hosts accepted in one scan"`
+	MaxScans         int           `arg:"--max-scans" default:"4" help:"most scans run at once, more are refused until one finishes"`
+	Retain           time.Duration `arg:"--retain" default:"1h" help:"how long to keep the results of finished scans"`
+	APIKeys          string        `arg:"--api-keys" placeholder:"FILE" help:"file of API keys and their roles, one key, role and name per line"`
+	OIDCIssuer       string        `arg:"--oidc-issuer" placeholder:"URL" help:"OpenID Connect issuer whose tokens are accepted"`
+	OIDCAudience     string        `arg:"--oidc-audience" default:"certcheck" help:"audience tokens must be issued for"`
+	OIDCRoleClaim    string        `arg:"--oidc-role-claim" default:"roles" help:"token claim naming the caller's roles"`
+	OIDCClientID     string        `arg:"--oidc-client-id" help:"client ID to log browsers in with at /login"`
+	OIDCClientSecret string        `arg:"--oidc-client-secret,env:CERTCHECK_OIDC_CLIENT_SECRET" help:"client secret to log browsers in with"`
+	ExternalURL      string        `arg:"--external-url" placeholder:"URL" help:"URL the server is reached at, for login redirects (default http:// and --listen)"`
+}
+
+// Scan states
+const (
+	scanRunning = "running"
+	scanDone    = "done"
+)
+
+// maxScanRequestSize largest scan request body accepted
+const maxScanRequestSize = 4 << 20
+
+// scanRequest body of a request to start a scan
+type scanRequest struct {
+	Hosts []string `json:"hosts"`
+}
+
+// scanJob a scan run in the background. Results are set when it is done.
+type scanJob struct {
+	ID       string             `json:"id"`
+	Status   string             `json:"status"`
+	Total    int                `json:"total"`
+	Checked  int                `json:"checked"`
+	Created  string             `json:"created"`
+	Finished string             `json:"finished,omitempty"`
+	Results  *model.CertDataSet `json:"results,omitempty"`
+
+	finished time.Time
+	arrived  []model.CertData   // results in the order they arrived, for streams
+	changed  chan struct{}      // closed and replaced when a result arrives or the scan is done
+	cancel   context.CancelFunc // stops the scan when it is deleted
+}
+
+// notify wake streams waiting for the job to change. The server lock must be
+// held.
+func (job *scanJob) notify() {
+	close(job.changed)
+	job.changed = make(chan struct{})
+}
+
+// scanServer run scans in the background so callers don't have to keep a
+// connection open for a long scan, and report on them until they expire
+type scanServer struct {
+	ctx     context.Context
+	options hosts.Options
+	serve   *ServeCmd
+	guard   *access.Guard
+	webhook *webhook.Sender
+
+	mu   sync.Mutex
+	jobs map[string]*scanJob
+}
+
+// newJobID make a random scan ID
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// writeJSON write a response as JSON
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError write an error response as JSON
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// run check the hosts of a scan, counting hosts as their results arrive
+func (server *scanServer) run(ctx context.Context, job *scanJob, hostList []string) {
+	hostSet := hosts.NewHostSet()
+	hostSet.Add(hostList...)
+	hostSet.Options = server.options
+
+	certDataSet := model.NewCertDataSet()
+	checked := make(map[string]bool)
+	for certData := range hostSet.ProcessStream(ctx) {
+		certDataSet.CertData = append(certDataSet.CertData, certData)
+		checked[certData.Host+":"+certData.Port] = true
+		server.mu.Lock()
+		job.Checked = len(checked)
+		job.arrived = append(job.arrived, certData)
+		job.notify()
+		server.mu.Unlock()
+	}
+	certDataSet.Finalize()
+
+	server.mu.Lock()
+	job.Results = certDataSet
+	job.Status = scanDone
+	job.finished = time.Now()
+	job.Finished = job.finished.UTC().Format(model.TimeFormat)
+	job.notify()
+	finished := *job
+	server.mu.Unlock()
+
+	// Deleted scans are not pushed
+	if server.webhook != nil && ctx.Err() == nil {
+		if err := server.webhook.Send(server.ctx, finished); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("scan %s: error delivering webhook %v", job.ID, err))
+		}
+	}
+}
+
+// writeEvent write a server-sent event with JSON data
+func writeEvent(w io.Writer, event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+
+	return err
+}
+
+// stream send each result of a scan as a server-sent certdata event as it
+// arrives, starting with those already in, then a done event with the scan
+// and its summary once it is done
+func (server *scanServer) stream(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.New("streaming not supported"))
+		return
+	}
+	server.mu.Lock()
+	job, ok := server.jobs[id]
+	server.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan %s", id))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	sent := 0
+	for {
+		server.mu.Lock()
+		pending := job.arrived[sent:]
+		done := job.Status == scanDone
+		changed := job.changed
+		summary := *job
+		server.mu.Unlock()
+
+		for _, certData := range pending {
+			if writeEvent(w, "certdata", certData) != nil {
+				return
+			}
+		}
+		sent += len(pending)
+		if done {
+			// The results were all streamed, so only the summary is sent
+			summary.Results = &model.CertDataSet{
+				Total:           summary.Results.Total,
+				HostErrors:      summary.Results.HostErrors,
+				ExpiredWarnings: summary.Results.ExpiredWarnings,
+			}
+			writeEvent(w, "done", summary)
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// create start a scan of the hosts in the request body
+func (server *scanServer) create(w http.ResponseWriter, r *http.Request) {
+	var request scanRequest
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxScanRequestSize))
+	if err == nil {
+		err = json.Unmarshal(body, &request)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid scan request: %v", err))
+		return
+	}
+	// Hosts with several ports count once for each port
+	var hostList []string
+	for _, item := range request.Hosts {
+		hostList = append(hostList, hosts.ExpandPorts(item)...)
+	}
+	if len(hostList) == 0 {
+		writeError(w, http.StatusBadRequest, errors.New("no hosts to scan"))
+		return
+	}
+	if len(hostList) > server.serve.MaxHosts {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Errorf("%d hosts is more than the limit of %d", len(hostList), server.serve.MaxHosts))
+		return
+	}
+	id, err := newJobID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(server.ctx)
+	job := &scanJob{
+		ID:      id,
+		Status:  scanRunning,
+		Total:   len(hostList),
+		Created: time.Now().UTC().Format(model.TimeFormat),
+		changed: make(chan struct{}),
+		cancel:  cancel,
+	}
+	server.mu.Lock()
+	// Forget scans whose results have been kept long enough
+	running := 0
+	for jobID, old := range server.jobs {
+		if old.Status == scanDone && time.Since(old.finished) > server.serve.Retain {
+			delete(server.jobs, jobID)
+		}
+		if old.Status == scanRunning {
+			running++
+		}
+	}
+	if running >= server.serve.MaxScans {
+		server.mu.Unlock()
+		cancel()
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusTooManyRequests, fmt.Errorf("%d scans are running, the limit is %d", running, server.serve.MaxScans))
+		return
+	}
+	server.jobs[id] = job
+	server.mu.Unlock()
+	go server.run(ctx, job, hostList)
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	w.Header().Set("Location", "/scans/"+id)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// remove stop a scan if it is running and forget it
+func (server *scanServer) remove(w http.ResponseWriter, id string) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	job, ok := server.jobs[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no scan %s", id))
+		return
+	}
+	job.cancel()
+	delete(server.jobs, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requiredRole the role needed for a request. Reading scans needs a viewer,
+// starting them an operator and deleting them an admin.
+func requiredRole(method string) access.Role {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return access.RoleViewer
+	case http.MethodPost:
+		return access.RoleOperator
+	}
+
+	return access.RoleAdmin
+}
+
+// authorize check the caller has the role a request needs, writing an error
+// response if not
+func (server *scanServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	name, role, err := server.guard.Authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, err)
+		return false
+	}
+	if required := requiredRole(r.Method); role < required {
+		writeError(w, http.StatusForbidden, fmt.Errorf("%s has role %s, %s %s needs %s", name, role, r.Method, r.URL.Path, required))
+		return false
+	}
+
+	return true
+}
+
+// ServeHTTP handle POST /scans to start a scan, GET /scans/{id} for its
+// progress and results, GET /scans/{id}/stream for results as they arrive and
+// DELETE /scans/{id} to stop and forget a scan. With an OIDC client, /login,
+// /callback and /logout log browsers in and out.
+func (server *scanServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Paths such as /scansX are not scans
+	isScans := r.URL.Path == "/scans" || strings.HasPrefix(r.URL.Path, "/scans/")
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/scans"), "/")
+	isStream := strings.HasSuffix(id, "/stream")
+	switch {
+	case server.guard.Login != nil && r.URL.Path == "/login":
+		server.guard.Login.Start(w, r)
+	case server.guard.Login != nil && r.URL.Path == "/callback":
+		server.guard.Login.Callback(w, r)
+	case server.guard.Login != nil && r.URL.Path == "/logout":
+		server.guard.Login.Logout(w, r)
+	case !isScans:
+		writeError(w, http.StatusNotFound, errors.New("not found"))
+	case !server.authorize(w, r):
+	case id == "" && r.Method == http.MethodPost:
+		server.create(w, r)
+	case isStream && r.Method == http.MethodGet:
+		server.stream(w, r, strings.TrimSuffix(id, "/stream"))
+	case id != "" && r.Method == http.MethodGet:
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		job, ok := server.jobs[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no scan %s", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	case id != "" && !isStream && r.Method == http.MethodDelete:
+		server.remove(w, id)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s %s not supported", r.Method, r.URL.Path))
+	}
+}
+
+// serve run the scans API until ctx is done. Every scan uses the options
+// given on the command line, and finished scans are sent to the webhook if
+// there is one.
+func serve(ctx context.Context, w io.Writer, serveCmd *ServeCmd, options hosts.Options, sender *webhook.Sender) error {
+	guard, err := newGuard(serveCmd, options.Timeout)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr: serveCmd.Listen,
+		Handler: &scanServer{
+			ctx:     ctx,
+			options: options,
+			serve:   serveCmd,
+			guard:   guard,
+			webhook: sender,
+			jobs:    make(map[string]*scanJob),
+		},
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(w, "serving scans API on %s\n", serveCmd.Listen)
+	if !guard.Enabled() {
+		fmt.Fprintln(w, "no --api-keys or --oidc-issuer, so every caller is an admin")
+	}
+	err = httpServer.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// newGuard read the API keys and set up the OIDC issuer callers can
+// authenticate with, and log browsers in with if there is a client ID
+func newGuard(serveCmd *ServeCmd, timeout time.Duration) (*access.Guard, error) {
+	guard := &access.Guard{}
+	if serveCmd.APIKeys != "" {
+		file, err := os.Open(serveCmd.APIKeys)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		guard.Keys, err = access.ReadKeys(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", serveCmd.APIKeys, err)
+		}
+	}
+	if serveCmd.OIDCIssuer != "" {
+		guard.OIDC = access.NewOIDC(serveCmd.OIDCIssuer, serveCmd.OIDCAudience, serveCmd.OIDCRoleClaim, timeout)
+	}
+	if serveCmd.OIDCClientID != "" {
+		if guard.OIDC == nil {
+			return nil, errors.New("--oidc-client-id needs --oidc-issuer")
+		}
+		externalURL := serveCmd.ExternalURL
+		if externalURL == "" {
+			externalURL = "http://" + serveCmd.Listen
+		}
+		guard.Login = &access.Login{
+			OIDC:         guard.OIDC,
+			ClientID:     serveCmd.OIDCClientID,
+			ClientSecret: serveCmd.OIDCClientSecret,
+			RedirectURL:  strings.TrimSuffix(externalURL, "/") + "/callback",
+		}
+	}
+
+	return guard, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// stdinCertFile --certfile value that reads a certificate from stdin
+const stdinCertFile = "-"
+
+// readsStdin whether --certfile reads a certificate from stdin, which then
+// can't also give hosts
+func readsStdin(args Args) bool {
+	for _, pattern := range args.CertFile {
+		if pattern == stdinCertFile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// certFilePaths get the files given with --certfile, expanding glob patterns.
+// Each file is listed once however many patterns match it. A pattern that
+// matches nothing is an error, so a typo isn't mistaken for no certificates.
+// Stdin is left out.
+func certFilePaths(patterns []string) (paths []string, errs map[string]error) {
+	seen := make(map[string]bool)
+	errs = make(map[string]error)
+	for _, pattern := range patterns {
+		if pattern == stdinCertFile {
+			continue
+		}
+		matches := []string{pattern}
+		if hosts.HasGlob(pattern) {
+			var err error
+			if matches, err = filepath.Glob(pattern); err != nil {
+				errs[pattern] = err
+				continue
+			}
+			if len(matches) == 0 {
+				errs[pattern] = fmt.Errorf("no files match %s", pattern)
+				continue
+			}
+		}
+		for _, path := range matches {
+			if !seen[path] {
+				seen[path] = true
+				paths = append(paths, path)
+			}
+		}
+	}
+
+	return
+}
+
+// checkFiles check the certificate files, archive, directory and SSH target
+// given, setting the source of each result. A source that can't be read is
+// reported as an error result rather than ending the run, so hosts checked
+// along with it are still reported. failed is set if a source or a
+// certificate file couldn't be read, or if a certificate doesn't match any of
+// the keys given with --keyfile.
+func checkFiles(args Args, hostSet *hosts.HostSet) (certDataSet *model.CertDataSet, failed bool) {
+	certDataSet = model.NewCertDataSet()
+	addError := func(file, source string, err error) {
+		certDataSet.Add(model.CertData{File: file, Source: source, HostError: true, Message: err.Error()})
+		failed = true
+	}
+
+	if len(args.CertFile) > 0 {
+		paths, errs := certFilePaths(args.CertFile)
+		for pattern, err := range errs {
+			addError(pattern, model.SourceFile, err)
+		}
+		if len(paths) > 0 {
+			fileSet := hostSet.ProcessCertFiles(paths, args.WarnAtDays)
+			failed = failed || fileSet.HostErrors > 0
+			certDataSet.MergeSource(fileSet, model.SourceFile)
+		}
+	}
+	if readsStdin(args) {
+		stdinSet := hostSet.ProcessCertReader(stdinCertFile, os.Stdin, args.WarnAtDays)
+		failed = failed || stdinSet.HostErrors > 0
+		certDataSet.MergeSource(stdinSet, model.SourceFile)
+	}
+	if args.CertArchive != "" {
+		archiveSet, err := hostSet.ProcessCertArchive(args.CertArchive, args.WarnAtDays)
+		if err != nil {
+			addError(args.CertArchive, model.SourceArchive, err)
+		} else {
+			certDataSet.MergeSource(archiveSet, model.SourceArchive)
+		}
+	}
+	if args.CertDir != "" {
+		dirSet, err := hostSet.ProcessCertDir(args.CertDir, args.WarnAtDays)
+		if err != nil {
+			addError(args.CertDir, model.SourceFile, err)
+		} else {
+			certDataSet.MergeSource(dirSet, model.SourceFile)
+		}
+	}
+	if args.ServerConfig != "" {
+		configSet, err := hostSet.ProcessServerConfig(args.ServerConfig, args.WarnAtDays)
+		if err != nil {
+			addError(args.ServerConfig, model.SourceFile, err)
+		} else {
+			failed = failed || configSet.HostErrors > 0
+			certDataSet.MergeSource(configSet, model.SourceFile)
+		}
+	}
+	if args.Kubeconfig != "" {
+		kubeSet, err := hostSet.ProcessKubeconfig(args.Kubeconfig, args.WarnAtDays)
+		if err != nil {
+			addError(args.Kubeconfig, model.SourceKube, err)
+		} else {
+			certDataSet.MergeSource(kubeSet, model.SourceKube)
+		}
+	}
+	if args.SSHTarget != "" {
+		sshSet, err := hostSet.ProcessSSHTarget(args.SSHTarget, args.WarnAtDays)
+		if err != nil {
+			addError(args.SSHTarget, model.SourceSSH, err)
+		} else {
+			certDataSet.MergeSource(sshSet, model.SourceSSH)
+		}
+	}
+	if len(args.SSHCert) > 0 {
+		paths, errs := certFilePaths(args.SSHCert)
+		for pattern, err := range errs {
+			addError(pattern, model.SourceSSHCert, err)
+		}
+		if len(paths) > 0 {
+			sshCertSet := hostSet.ProcessSSHCerts(paths, args.WarnAtDays)
+			failed = failed || sshCertSet.HostErrors > 0
+			certDataSet.MergeSource(sshCertSet, model.SourceSSHCert)
+		}
+	}
+	if args.KnownHosts != "" {
+		knownHostsSet, err := hostSet.ProcessKnownHosts(args.KnownHosts, args.WarnAtDays)
+		if err != nil {
+			addError(args.KnownHosts, model.SourceSSHCert, err)
+		} else {
+			failed = failed || knownHostsSet.HostErrors > 0
+			certDataSet.MergeSource(knownHostsSet, model.SourceSSHCert)
+		}
+	}
+	for _, certData := range certDataSet.CertData {
+		if certData.KeyMatch == hosts.KeyMismatched {
+			failed = true
+		}
+	}
+
+	return
+}
@@ -0,0 +1,7 @@
+package main
+
+// TrustCmd arguments for the truststore subcommand
+type TrustCmd struct {
+	Path string `arg:"positional" placeholder:"PATH" help:"JVM cacerts file or other Java keystore, PKCS#12 file or PEM bundle to audit (default the operating system bundle)"`
+	All  bool   `arg:"--all" help:"list every root, not only those expiring within --warn-at-days"`
+}
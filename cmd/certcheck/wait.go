@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// waitInterval time between checks while waiting for valid certificates
+const waitInterval = 10 * time.Second
+
+// allValid check that every result has a valid certificate outside of the
+// warning period
+func allValid(certDataSet *model.CertDataSet) bool {
+	return certDataSet.Total > 0 && certDataSet.HostErrors == 0 && certDataSet.ExpiredWarnings == 0
+}
+
+// waitForValid check hosts until they all present valid certificates that are
+// not about to expire, or until maxWait has passed or ctx is done. Progress is
+// written to w and the last results are returned.
+func waitForValid(ctx context.Context, w io.Writer, hostSet *hosts.HostSet, warnAtDays int, timeout, maxWait, interval time.Duration) (certDataSet *model.CertDataSet, valid bool) {
+	deadline := time.Now().Add(maxWait)
+	for {
+		certDataSet = hostSet.Process(warnAtDays, timeout)
+		if allValid(certDataSet) {
+			return certDataSet, true
+		}
+		remaining := time.Until(deadline)
+		fmt.Fprintf(w, "waiting for valid certificates: %d of %d hosts not ready, %s left\n",
+			certDataSet.HostErrors+certDataSet.ExpiredWarnings, certDataSet.Total, remaining.Round(time.Second))
+		if remaining < interval {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
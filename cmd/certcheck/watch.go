@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// WatchCmd arguments for the watch subcommand
+type WatchCmd struct {
+	Host  string        `arg:"positional,required" placeholder:"HOST:PORT" help:"host to check repeatedly"`
+	Every time.Duration `arg:"--every" default:"30s" help:"time between checks"`
+	Count int           `arg:"--count" help:"stop after this many checks, 0 to run until interrupted"`
+}
+
+// watchState the values of a check that matter when watching for a change
+func watchState(certData model.CertData) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s", certData.IP, certData.Fingerprint, certData.Issuer, certData.NotAfter, certData.Message)
+}
+
+// watchLine a one line summary of a check, marked with * when it differs from
+// the previous check
+func watchLine(certData model.CertData, changed bool) string {
+	mark := " "
+	if changed {
+		mark = "*"
+	}
+	line := fmt.Sprintf("%s %s %s:%s %s", mark, time.Now().UTC().Format(model.TimeFormat), certData.Host, certData.Port, certData.IP)
+	if certData.HostError {
+		return fmt.Sprintf("%s ERROR %s", line, certData.Message)
+	}
+	status := "OK"
+	if certData.ExpiryWarning {
+		status = "WARN"
+	}
+
+	return fmt.Sprintf("%s TLS%s expires %s (%dd) %s", line, certData.TLSVersion, certData.NotAfter, certData.DaysToExpiry, status)
+}
+
+// watch check one host every interval, writing a line per result, until the
+// count is reached or ctx is done
+func watch(ctx context.Context, w io.Writer, watchCmd *WatchCmd, options hosts.Options) {
+	if watchCmd.Every <= 0 {
+		watchCmd.Every = 30 * time.Second
+	}
+	ticker := time.NewTicker(watchCmd.Every)
+	defer ticker.Stop()
+
+	previous := make(map[string]string)
+	for i := 1; ; i++ {
+		for _, certData := range hosts.Lookup(ctx, watchCmd.Host, options) {
+			state := watchState(certData)
+			last, seen := previous[certData.IP]
+			fmt.Fprintln(w, watchLine(certData, seen && last != state))
+			previous[certData.IP] = state
+		}
+		if watchCmd.Count > 0 && i >= watchCmd.Count {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,49 @@
+// Command embed checks hosts with custom options from a Go program, the way
+// certcheck does. Hosts are given as arguments, such as
+//
+//	go run ./examples/embed example.com example.org:8443
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Println("usage: embed host[:port] ...")
+		os.Exit(2)
+	}
+
+	hostSet := hosts.NewHostSet()
+	hostSet.Add(os.Args[1:]...)
+	hostSet.Options = hosts.Options{
+		Concurrency: 4,
+		Retries:     1,
+		ProbeTLS:    true,
+		// Report each result as it arrives, before the set is complete
+		AfterCheck: func(ctx context.Context, certData hosts.CertData) {
+			fmt.Fprintf(os.Stderr, "checked %s:%s\n", certData.Host, certData.Port)
+		},
+	}
+
+	// Process sets the warning period and timeout for the run
+	certDataSet := hostSet.Process(21, 5*time.Second)
+	for _, certData := range certDataSet.CertData {
+		switch {
+		case certData.HostError:
+			fmt.Printf("%s: error %s\n", certData.Host, certData.Message)
+		case certData.ExpiryWarning:
+			fmt.Printf("%s: expires in %d days\n", certData.Host, certData.DaysToExpiry)
+		default:
+			fmt.Printf("%s: ok, %d days left, %v\n", certData.Host, certData.DaysToExpiry, certData.TLSVersions)
+		}
+	}
+	if certDataSet.HostErrors > 0 || certDataSet.ExpiredWarnings > 0 {
+		os.Exit(1)
+	}
+}
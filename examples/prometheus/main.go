@@ -0,0 +1,70 @@
+// Command prometheus serves certificate expiry as Prometheus metrics. Each
+// scrape checks the hosts with ProcessStream and writes the results in the
+// Prometheus text format, so no client library is needed.
+//
+//	go run ./examples/prometheus -listen :9117 example.com example.org
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/hosts"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// labelEscaper escape label values for the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// handler check the hosts on every scrape
+func handler(hostNames []string, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hostSet := hosts.NewHostSet()
+		hostSet.Add(hostNames...)
+		hostSet.Timeout = timeout
+
+		// Samples of a metric must be written together, so each metric is
+		// collected separately as results arrive
+		var hostErrors, notAfters bytes.Buffer
+		// Checks stop if the scrape is abandoned
+		for certData := range hostSet.ProcessStream(r.Context()) {
+			labels := fmt.Sprintf(`host="%s",port="%s",ip="%s"`,
+				labelEscaper.Replace(certData.Host), labelEscaper.Replace(certData.Port), labelEscaper.Replace(certData.IP))
+			hostError := 0
+			if certData.HostError {
+				hostError = 1
+			}
+			fmt.Fprintf(&hostErrors, "certcheck_host_error{%s} %d\n", labels, hostError)
+			if notAfter, err := time.Parse(model.TimeFormat, certData.NotAfter); err == nil {
+				fmt.Fprintf(&notAfters, "certcheck_not_after_seconds{%s} %d\n", labels, notAfter.Unix())
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintln(w, "# HELP certcheck_host_error 1 if the host could not be checked.")
+		fmt.Fprintln(w, "# TYPE certcheck_host_error gauge")
+		hostErrors.WriteTo(w)
+		fmt.Fprintln(w, "# HELP certcheck_not_after_seconds Expiry of the certificate as a Unix time.")
+		fmt.Fprintln(w, "# TYPE certcheck_not_after_seconds gauge")
+		notAfters.WriteTo(w)
+	}
+}
+
+func main() {
+	listen := flag.String("listen", ":9117", "address to serve metrics on")
+	timeout := flag.Duration("timeout", 5*time.Second, "timeout for each host")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Println("usage: prometheus [-listen addr] [-timeout duration] host[:port] ...")
+		os.Exit(2)
+	}
+
+	http.Handle("/metrics", handler(flag.Args(), *timeout))
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
@@ -0,0 +1,53 @@
+// Command writer adds a CSV output format by implementing output.Writer, and
+// reads certcheck JSON output from stdin so it can sit at the end of a pipe.
+//
+//	certcheck -H example.com example.org | go run ./examples/writer
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/imarsman/certcheck/v2/pkg/output"
+)
+
+// CSV writer with one row per result
+var CSV output.Writer = output.WriterFunc(func(w io.Writer, certDataSet *model.CertDataSet) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"host", "port", "ip", "issuer", "notafter", "daystoexpiry", "error"})
+	for _, certData := range certDataSet.CertData {
+		message := ""
+		if certData.HostError {
+			message = certData.Message
+		}
+		writer.Write([]string{
+			certData.Host,
+			certData.Port,
+			certData.IP,
+			certData.Issuer,
+			certData.NotAfter,
+			strconv.Itoa(certData.DaysToExpiry),
+			message,
+		})
+	}
+	writer.Flush()
+
+	return writer.Error()
+})
+
+func main() {
+	var certDataSet model.CertDataSet
+	if err := json.NewDecoder(os.Stdin).Decode(&certDataSet); err != nil {
+		fmt.Println(fmt.Errorf("error %v", err))
+		os.Exit(1)
+	}
+	if err := CSV.Write(os.Stdout, &certDataSet); err != nil {
+		fmt.Println(fmt.Errorf("error %v", err))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,140 @@
+// Package access decides what callers of the scans API may do, by API key or
+// by an OpenID Connect token, so one server can let some users start scans and
+// others only read their results.
+package access
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Role what a caller may do. Each role may do everything the roles below it
+// may.
+type Role int
+
+// Roles from least to most access
+const (
+	RoleNone     Role = iota // no access
+	RoleViewer               // read scans and their results
+	RoleOperator             // start scans
+	RoleAdmin                // cancel and delete scans
+)
+
+// roleNames role names as used in key files and token claims
+var roleNames = map[string]Role{
+	"viewer":   RoleViewer,
+	"operator": RoleOperator,
+	"admin":    RoleAdmin,
+}
+
+// ErrNoCredentials the request has no API key or token
+var ErrNoCredentials = errors.New("no credentials")
+
+// ParseRole get a role by name
+func ParseRole(name string) (Role, error) {
+	role, ok := roleNames[strings.ToLower(name)]
+	if !ok {
+		return RoleNone, fmt.Errorf("unknown role %s", name)
+	}
+
+	return role, nil
+}
+
+// String the name of the role
+func (role Role) String() string {
+	for name, r := range roleNames {
+		if r == role {
+			return name
+		}
+	}
+
+	return "none"
+}
+
+// Key an API key, the name of whoever holds it and its role
+type Key struct {
+	Key  string
+	Name string
+	Role Role
+}
+
+// ReadKeys read API keys, one per line as a key, a role and optionally a name
+// for whoever holds it. Blank lines and lines starting with # are skipped.
+func ReadKeys(reader io.Reader) (keys []Key, err error) {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: expected a key and a role", line)
+		}
+		role, roleErr := ParseRole(fields[1])
+		if roleErr != nil {
+			return nil, fmt.Errorf("line %d: %v", line, roleErr)
+		}
+		key := Key{Key: fields[0], Name: fmt.Sprintf("key %d", line), Role: role}
+		if len(fields) > 2 {
+			key.Name = strings.Join(fields[2:], " ")
+		}
+		keys = append(keys, key)
+	}
+	err = scanner.Err()
+
+	return
+}
+
+// Guard find who is calling and with what role, from an API key or an OIDC
+// token sent as a bearer token, an API key in an X-API-Key header or the
+// session cookie of a user who logged in
+type Guard struct {
+	Keys  []Key
+	OIDC  *OIDC
+	Login *Login
+}
+
+// Enabled whether any way to authenticate is configured. Without one every
+// caller is an admin.
+func (guard *Guard) Enabled() bool {
+	return guard != nil && (len(guard.Keys) > 0 || guard.OIDC != nil || guard.Login != nil)
+}
+
+// Authenticate get the name and role of the caller making a request
+func (guard *Guard) Authenticate(r *http.Request) (name string, role Role, err error) {
+	if !guard.Enabled() {
+		return "anonymous", RoleAdmin, nil
+	}
+	token := r.Header.Get("X-API-Key")
+	if bearer := r.Header.Get("Authorization"); token == "" && bearer != "" {
+		scheme, value, _ := strings.Cut(bearer, " ")
+		if !strings.EqualFold(scheme, "Bearer") {
+			return "", RoleNone, fmt.Errorf("unsupported authorization scheme %s", scheme)
+		}
+		token = strings.TrimSpace(value)
+	}
+	if token == "" && guard.Login != nil {
+		return guard.Login.session(r)
+	}
+	if token == "" {
+		return "", RoleNone, ErrNoCredentials
+	}
+
+	for _, key := range guard.Keys {
+		if subtle.ConstantTimeCompare([]byte(key.Key), []byte(token)) == 1 {
+			return key.Name, key.Role, nil
+		}
+	}
+	// API keys are opaque, tokens are three dot separated parts
+	if guard.OIDC != nil && strings.Count(token, ".") == 2 {
+		return guard.OIDC.Verify(r.Context(), token)
+	}
+
+	return "", RoleNone, errors.New("invalid credentials")
+}
@@ -0,0 +1,335 @@
+package access
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestReadKeys(t *testing.T) {
+	is := is.New(t)
+
+	keys, err := ReadKeys(strings.NewReader("# keys\nk1 viewer dashboards\n\nk2 Operator\nk3 admin on call\n"))
+	is.NoErr(err)
+	is.Equal(len(keys), 3)
+	is.Equal(keys[0], Key{Key: "k1", Name: "dashboards", Role: RoleViewer})
+	is.Equal(keys[1], Key{Key: "k2", Name: "key 4", Role: RoleOperator})
+	is.Equal(keys[2].Name, "on call")
+	is.Equal(keys[2].Role.String(), "admin")
+
+	_, err = ReadKeys(strings.NewReader("k1 root\n"))
+	is.True(err != nil)
+	_, err = ReadKeys(strings.NewReader("k1\n"))
+	is.True(err != nil)
+}
+
+func TestGuardKeys(t *testing.T) {
+	is := is.New(t)
+
+	request := func(header, value string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/scans", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+
+	// Without keys or an issuer everyone is an admin
+	var open *Guard
+	_, role, err := open.Authenticate(request("", ""))
+	is.NoErr(err)
+	is.Equal(role, RoleAdmin)
+
+	guard := &Guard{Keys: []Key{{Key: "secret", Name: "ci", Role: RoleOperator}}}
+	name, role, err := guard.Authenticate(request("Authorization", "Bearer secret"))
+	is.NoErr(err)
+	is.Equal(name, "ci")
+	is.Equal(role, RoleOperator)
+
+	_, role, err = guard.Authenticate(request("X-API-Key", "secret"))
+	is.NoErr(err)
+	is.Equal(role, RoleOperator)
+
+	_, _, err = guard.Authenticate(request("", ""))
+	is.Equal(err, ErrNoCredentials)
+	_, _, err = guard.Authenticate(request("Authorization", "Bearer wrong"))
+	is.True(err != nil)
+	_, _, err = guard.Authenticate(request("Authorization", "Basic c2VjcmV0"))
+	is.True(err != nil)
+}
+
+// signToken make a token signed with a key
+func signToken(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := encode(header) + "." + encode(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		signature, _ = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+
+	return signed + "." + encode(signature)
+}
+
+// newIssuer run an OIDC issuer publishing an RSA and an EC key, with a token
+// endpoint answering with the ID token given
+func newIssuer(t *testing.T, idToken func() string) (server *httptest.Server, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	var issuer string
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer,
+				"authorization_endpoint": issuer + "/authorize",
+				"token_endpoint":         issuer + "/token",
+				"jwks_uri":               issuer + "/keys",
+			})
+		case "/keys":
+			json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{
+				{"kid": "rsa", "kty": "RSA", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+				{"kid": "ec", "kty": "EC", "crv": "P-256", "x": encode(ecKey.X.Bytes()), "y": encode(ecKey.Y.Bytes())},
+			}})
+		case "/token":
+			user, secret, _ := r.BasicAuth()
+			if r.PostFormValue("code") != "good" || user != "client" || secret != "secret" {
+				http.Error(w, "invalid grant", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"id_token": idToken()})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	issuer = server.URL
+
+	return
+}
+
+func TestOIDCVerify(t *testing.T) {
+	is := is.New(t)
+
+	server, rsaKey, ecKey := newIssuer(t, nil)
+	defer server.Close()
+	issuer := server.URL
+	encode := base64.RawURLEncoding.EncodeToString
+
+	oidc := NewOIDC(issuer, "certcheck", "groups", 5*time.Second)
+	guard := &Guard{OIDC: oidc}
+	claims := func(aud any, exp time.Time, groups any) map[string]any {
+		return map[string]any{"iss": issuer, "sub": "alice", "aud": aud, "exp": exp.Unix(), "groups": groups}
+	}
+	later := time.Now().Add(time.Hour)
+
+	token := signToken(t, "RS256", "rsa", rsaKey, claims("certcheck", later, []string{"staff", "operator", "viewer"}))
+	r := httptest.NewRequest(http.MethodGet, "/scans", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	name, role, err := guard.Authenticate(r)
+	is.NoErr(err)
+	is.Equal(name, "alice")
+	is.Equal(role, RoleOperator)
+
+	subject, role, err := oidc.Verify(r.Context(), signToken(t, "ES256", "ec", ecKey, claims([]string{"other", "certcheck"}, later, "admin")))
+	is.NoErr(err)
+	is.Equal(subject, "alice")
+	is.Equal(role, RoleAdmin)
+
+	// A token without a role claim authenticates with no access
+	_, role, err = oidc.Verify(r.Context(), signToken(t, "RS256", "rsa", rsaKey, claims("certcheck", later, nil)))
+	is.NoErr(err)
+	is.Equal(role, RoleNone)
+
+	// Expired, for another audience, signed with the wrong key or algorithm
+	_, _, err = oidc.Verify(r.Context(), signToken(t, "RS256", "rsa", rsaKey, claims("certcheck", time.Now().Add(-time.Hour), "admin")))
+	is.True(err != nil)
+	_, _, err = oidc.Verify(r.Context(), signToken(t, "RS256", "rsa", rsaKey, claims("other", later, "admin")))
+	is.True(err != nil)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	is.NoErr(err)
+	_, _, err = oidc.Verify(r.Context(), signToken(t, "RS256", "rsa", otherKey, claims("certcheck", later, "admin")))
+	is.True(err != nil)
+	_, _, err = oidc.Verify(r.Context(), signToken(t, "ES256", "rsa", ecKey, claims("certcheck", later, "admin")))
+	is.True(err != nil)
+	_, _, err = oidc.Verify(r.Context(), signToken(t, "RS256", "missing", rsaKey, claims("certcheck", later, "admin")))
+	is.True(err != nil)
+
+	// Unsigned tokens are refused
+	header := encode([]byte(`{"alg":"none","kid":"rsa"}`))
+	payload, _ := json.Marshal(claims("certcheck", later, "admin"))
+	_, _, err = oidc.Verify(r.Context(), header+"."+encode(payload)+".")
+	is.True(err != nil)
+}
+
+// roundTripFunc an http.RoundTripper from a function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip implement http.RoundTripper
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestOIDCForgedTokens(t *testing.T) {
+	is := is.New(t)
+
+	server, rsaKey, _ := newIssuer(t, nil)
+	defer server.Close()
+	issuer := server.URL
+	encode := base64.RawURLEncoding.EncodeToString
+
+	oidc := NewOIDC(issuer, "certcheck", "groups", 5*time.Second)
+	keyFetches := 0
+	oidc.Client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path == "/keys" {
+			keyFetches++
+		}
+		return http.DefaultTransport.RoundTrip(r)
+	})
+	payload, _ := json.Marshal(map[string]any{
+		"iss": issuer, "sub": "mallory", "aud": "certcheck", "exp": time.Now().Add(time.Hour).Unix(), "groups": "admin",
+	})
+	forge := func(header string, signature []byte) string {
+		return encode([]byte(header)) + "." + encode(payload) + "." + encode(signature)
+	}
+
+	// Unsigned tokens, however alg none is spelled
+	for _, header := range []string{`{"alg":"none","kid":"rsa"}`, `{"alg":"None","kid":"rsa"}`, `{"alg":"NONE"}`, `{"alg":""}`} {
+		_, _, err := oidc.Verify(context.Background(), forge(header, nil))
+		is.True(err != nil)
+	}
+
+	// HS256 with the issuer's public RSA key as the HMAC secret, which
+	// verifiers that take the algorithm from the token accept
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	is.NoErr(err)
+	for _, secret := range [][]byte{der, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), rsaKey.N.Bytes()} {
+		header := `{"alg":"HS256","kid":"rsa"}`
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(encode([]byte(header)) + "." + encode(payload)))
+		_, _, err = oidc.Verify(context.Background(), forge(header, mac.Sum(nil)))
+		is.True(err != nil)
+	}
+	is.Equal(keyFetches, 1)
+
+	// Unknown key IDs fetch the keys again at most once a keyRefresh
+	for _, kid := range []string{"unknown", "other", "rsa2"} {
+		_, _, err = oidc.Verify(context.Background(), signToken(t, "RS256", kid, rsaKey, map[string]any{}))
+		is.True(err != nil)
+	}
+	is.Equal(keyFetches, 1)
+	oidc.fetched = time.Now().Add(-2 * keyRefresh)
+	_, _, err = oidc.Verify(context.Background(), signToken(t, "RS256", "unknown", rsaKey, map[string]any{}))
+	is.True(err != nil)
+	is.Equal(keyFetches, 2)
+	_, _, err = oidc.Verify(context.Background(), signToken(t, "RS256", "unknown", rsaKey, map[string]any{}))
+	is.True(err != nil)
+	is.Equal(keyFetches, 2)
+}
+
+func TestLogin(t *testing.T) {
+	is := is.New(t)
+
+	var idToken string
+	server, rsaKey, _ := newIssuer(t, func() string { return idToken })
+	defer server.Close()
+	login := &Login{
+		OIDC:         NewOIDC(server.URL, "certcheck", "roles", 5*time.Second),
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RedirectURL:  "https://certcheck.example.com/callback",
+	}
+	guard := &Guard{OIDC: login.OIDC, Login: login}
+	idToken = signToken(t, "RS256", "rsa", rsaKey, map[string]any{
+		"iss": server.URL, "sub": "bob", "aud": "client", "exp": time.Now().Add(time.Hour).Unix(), "roles": "viewer",
+	})
+
+	// Starting sends the browser to the issuer with a state cookie
+	w := httptest.NewRecorder()
+	login.Start(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	is.Equal(w.Code, http.StatusFound)
+	redirect, err := url.Parse(w.Header().Get("Location"))
+	is.NoErr(err)
+	is.Equal(redirect.Path, "/authorize")
+	is.Equal(redirect.Query().Get("client_id"), "client")
+	is.Equal(redirect.Query().Get("redirect_uri"), login.RedirectURL)
+	state := w.Result().Cookies()[0]
+	is.Equal(state.Value, redirect.Query().Get("state"))
+	is.True(state.Secure)
+
+	callback := func(query string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/callback?"+query, nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		login.Callback(w, r)
+		return w
+	}
+
+	// Callbacks without the state of the browser are refused
+	is.Equal(callback("code=good&state=other", state).Code, http.StatusBadRequest)
+	is.Equal(callback("code=good&state="+state.Value).Code, http.StatusBadRequest)
+	empty := &http.Cookie{Name: state.Name, Value: ""}
+	is.Equal(callback("code=good&state=", empty).Code, http.StatusBadRequest)
+	is.Equal(callback("code=good", empty).Code, http.StatusBadRequest)
+	is.Equal(callback("code=bad&state="+state.Value, state).Code, http.StatusBadGateway)
+
+	w = callback("code=good&state="+state.Value, state)
+	is.Equal(w.Code, http.StatusOK)
+	var session *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == SessionCookie {
+			session = cookie
+		}
+	}
+	is.True(session != nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/scans/1", nil)
+	r.AddCookie(session)
+	name, role, err := guard.Authenticate(r)
+	is.NoErr(err)
+	is.Equal(name, "bob")
+	is.Equal(role, RoleViewer)
+
+	// ID tokens are for the client, so they aren't accepted as API tokens
+	_, _, err = login.OIDC.Verify(r.Context(), session.Value)
+	is.True(err != nil)
+}
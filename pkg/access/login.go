@@ -0,0 +1,159 @@
+package access
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// SessionCookie cookie holding the ID token of a user who logged in
+const SessionCookie = "certcheck_session"
+
+// stateCookie cookie tying a login callback to the browser that started it
+const stateCookie = "certcheck_login"
+
+// Login log users in through the issuer with the authorization code flow,
+// keeping their ID token in a session cookie so browsers can use the API.
+// Sessions last as long as the ID token is valid.
+type Login struct {
+	OIDC         *OIDC
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string // the callback URL registered with the issuer
+}
+
+// cookie a cookie only sent back to this server
+func (login *Login) cookie(name, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(login.RedirectURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// Start send the browser to the issuer to log in
+func (login *Login) Start(w http.ResponseWriter, r *http.Request) {
+	authorization, _, err := login.OIDC.endpoints(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	state := hex.EncodeToString(b)
+	http.SetCookie(w, login.cookie(stateCookie, state, 600))
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {login.ClientID},
+		"redirect_uri":  {login.RedirectURL},
+		"scope":         {"openid"},
+		"state":         {state},
+	}
+	separator := "?"
+	if strings.Contains(authorization, "?") {
+		separator = "&"
+	}
+	http.Redirect(w, r, authorization+separator+query.Encode(), http.StatusFound)
+}
+
+// exchange get the ID token for an authorization code
+func (login *Login) exchange(r *http.Request, code string) (string, error) {
+	_, tokenEndpoint, err := login.OIDC.endpoints(r.Context())
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {login.RedirectURL},
+		"client_id":    {login.ClientID},
+	}
+	request, err := http.NewRequestWithContext(r.Context(), http.MethodPost, tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if login.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(login.ClientID), url.QueryEscape(login.ClientSecret))
+	}
+	response, err := login.OIDC.Client.Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %s", response.Status)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint returned no ID token")
+	}
+
+	return tokens.IDToken, nil
+}
+
+// Callback finish logging in when the issuer sends the browser back, checking
+// the ID token and keeping it in the session cookie
+func (login *Login) Callback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if message := query.Get("error"); message != "" {
+		http.Error(w, "login failed: "+message, http.StatusUnauthorized)
+		return
+	}
+	// An empty state would match a callback forged without one
+	state, err := r.Cookie(stateCookie)
+	if err != nil || state.Value == "" || query.Get("state") == "" ||
+		subtle.ConstantTimeCompare([]byte(state.Value), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "login failed: state does not match", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, login.cookie(stateCookie, "", -1))
+
+	idToken, err := login.exchange(r, query.Get("code"))
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	subject, role, err := login.OIDC.verify(r.Context(), idToken, login.ClientID)
+	if err != nil {
+		http.Error(w, "login failed: "+err.Error(), http.StatusUnauthorized)
+		return
+	}
+	http.SetCookie(w, login.cookie(SessionCookie, idToken, 0))
+	fmt.Fprintf(w, "logged in as %s with role %s\n", subject, role)
+}
+
+// Logout forget the session
+func (login *Login) Logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, login.cookie(SessionCookie, "", -1))
+	fmt.Fprintln(w, "logged out")
+}
+
+// session get the name and role of a user from their session cookie
+func (login *Login) session(r *http.Request) (name string, role Role, err error) {
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return "", RoleNone, ErrNoCredentials
+	}
+
+	return login.OIDC.verify(r.Context(), cookie.Value, login.ClientID)
+}
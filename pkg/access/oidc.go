@@ -0,0 +1,361 @@
+package access
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockLeeway allowance for clock differences with the issuer when checking
+// token times
+const clockLeeway = time.Minute
+
+// keyRefresh least time between fetches of the issuer's keys, so tokens with
+// unknown key IDs can't make the server fetch them on every request
+const keyRefresh = time.Minute
+
+// OIDC verify tokens signed by an OpenID Connect issuer, taking the role from
+// a claim holding a role name or a list of them. Keys are found through the
+// issuer's discovery document and RS256 and ES256 signatures are accepted.
+type OIDC struct {
+	Issuer    string
+	Audience  string
+	RoleClaim string
+	Client    *http.Client
+
+	mu        sync.Mutex
+	discovery *discovery
+	keys      map[string]crypto.PublicKey
+	fetched   time.Time
+}
+
+// discovery the parts of an issuer's discovery document used
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC verify tokens from an issuer for an audience
+func NewOIDC(issuer, audience, roleClaim string, timeout time.Duration) *OIDC {
+	return &OIDC{
+		Issuer:    strings.TrimSuffix(issuer, "/"),
+		Audience:  audience,
+		RoleClaim: roleClaim,
+		Client:    &http.Client{Timeout: timeout},
+	}
+}
+
+// jwk a JSON web key as published by an issuer
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey the RSA or P-256 key of a JSON web key
+func (key jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch key.Kty {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		if key.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", key.Crv)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return nil, err
+		}
+		publicKey := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !publicKey.Curve.IsOnCurve(publicKey.X, publicKey.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+
+		return publicKey, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %s", key.Kty)
+}
+
+// getJSON get a JSON document from the issuer
+func (oidc *OIDC) getJSON(ctx context.Context, url string, v any) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := oidc.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, response.Status)
+	}
+
+	return json.NewDecoder(response.Body).Decode(v)
+}
+
+// discover get the issuer's discovery document, once. The lock must be held.
+func (oidc *OIDC) discover(ctx context.Context) (*discovery, error) {
+	if oidc.discovery != nil {
+		return oidc.discovery, nil
+	}
+	document := &discovery{}
+	if err := oidc.getJSON(ctx, oidc.Issuer+"/.well-known/openid-configuration", document); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(document.Issuer, "/") != oidc.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %s", document.Issuer)
+	}
+	oidc.discovery = document
+
+	return document, nil
+}
+
+// endpoints get the issuer's authorization and token endpoints
+func (oidc *OIDC) endpoints(ctx context.Context) (authorization, token string, err error) {
+	oidc.mu.Lock()
+	defer oidc.mu.Unlock()
+	document, err := oidc.discover(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	if document.AuthorizationEndpoint == "" || document.TokenEndpoint == "" {
+		return "", "", errors.New("issuer does not support logging in")
+	}
+
+	return document.AuthorizationEndpoint, document.TokenEndpoint, nil
+}
+
+// fetchKeys get the issuer's signing keys by key ID. The lock must be held.
+func (oidc *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	document, err := oidc.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := oidc.getJSON(ctx, document.JWKSURI, &jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, key := range jwks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		// Keys that can't be used are skipped rather than failing the rest
+		if publicKey, err := key.publicKey(); err == nil {
+			keys[key.Kid] = publicKey
+		}
+	}
+
+	return keys, nil
+}
+
+// key get the signing key with an ID, fetching the issuer's keys when it isn't
+// known, as after the issuer rotates them
+func (oidc *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	oidc.mu.Lock()
+	defer oidc.mu.Unlock()
+	if key, ok := oidc.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(oidc.fetched) > keyRefresh {
+		keys, err := oidc.fetchKeys(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("fetching keys: %v", err)
+		}
+		oidc.keys = keys
+		oidc.fetched = time.Now()
+	}
+	key, ok := oidc.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %s", kid)
+	}
+
+	return key, nil
+}
+
+// verifySignature check the signature of a token's header and payload
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("RS256 token signed with a non-RSA key")
+		}
+
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errors.New("invalid ES256 signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return errors.New("invalid signature")
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+// audience a token's aud claim, which is a string or a list of them
+type audience []string
+
+// UnmarshalJSON read an audience from a string or a list of them
+func (aud *audience) UnmarshalJSON(data []byte) error {
+	var one string
+	if json.Unmarshal(data, &one) == nil {
+		*aud = audience{one}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*[]string)(aud))
+}
+
+// claimRole the highest role named in a claim holding a role name or a list of
+// them. Names that aren't roles are ignored, as claims such as groups often
+// hold other things too.
+func claimRole(claim any) Role {
+	var names []string
+	switch value := claim.(type) {
+	case string:
+		names = strings.Fields(value)
+	case []any:
+		for _, v := range value {
+			if name, ok := v.(string); ok {
+				names = append(names, name)
+			}
+		}
+	}
+	best := RoleNone
+	for _, name := range names {
+		if role, err := ParseRole(name); err == nil && role > best {
+			best = role
+		}
+	}
+
+	return best
+}
+
+// Verify check a token was signed by the issuer for the audience and is
+// current, returning its subject and the role it claims
+func (oidc *OIDC) Verify(ctx context.Context, token string) (subject string, role Role, err error) {
+	return oidc.verify(ctx, token, oidc.Audience)
+}
+
+// verify check a token was signed by the issuer for an audience and is current
+func (oidc *OIDC) verify(ctx context.Context, token, forAudience string) (subject string, role Role, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", RoleNone, errors.New("malformed token")
+	}
+	decode := base64.RawURLEncoding.DecodeString
+	headerJSON, err := decode(parts[0])
+	if err != nil {
+		return "", RoleNone, fmt.Errorf("malformed token header: %v", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err = json.Unmarshal(headerJSON, &header); err != nil {
+		return "", RoleNone, fmt.Errorf("malformed token header: %v", err)
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return "", RoleNone, fmt.Errorf("malformed token signature: %v", err)
+	}
+	key, err := oidc.key(ctx, header.Kid)
+	if err != nil {
+		return "", RoleNone, err
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return "", RoleNone, err
+	}
+
+	payload, err := decode(parts[1])
+	if err != nil {
+		return "", RoleNone, fmt.Errorf("malformed token claims: %v", err)
+	}
+	var claims struct {
+		Issuer    string   `json:"iss"`
+		Subject   string   `json:"sub"`
+		Audience  audience `json:"aud"`
+		Expires   int64    `json:"exp"`
+		NotBefore int64    `json:"nbf"`
+	}
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return "", RoleNone, fmt.Errorf("malformed token claims: %v", err)
+	}
+	now := time.Now()
+	switch {
+	case strings.TrimSuffix(claims.Issuer, "/") != oidc.Issuer:
+		return "", RoleNone, fmt.Errorf("token issued by %s", claims.Issuer)
+	case !claims.Audience.contains(forAudience):
+		return "", RoleNone, errors.New("token not issued for this audience")
+	case claims.Expires == 0 || now.After(time.Unix(claims.Expires, 0).Add(clockLeeway)):
+		return "", RoleNone, errors.New("token expired")
+	case claims.NotBefore != 0 && now.Add(clockLeeway).Before(time.Unix(claims.NotBefore, 0)):
+		return "", RoleNone, errors.New("token not valid yet")
+	}
+
+	var all map[string]any
+	json.Unmarshal(payload, &all)
+
+	return claims.Subject, claimRole(all[oidc.RoleClaim]), nil
+}
+
+// contains whether the audience includes a name
+func (aud audience) contains(name string) bool {
+	for _, a := range aud {
+		if a == name {
+			return true
+		}
+	}
+
+	return false
+}
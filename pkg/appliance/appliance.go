@@ -0,0 +1,249 @@
+// Package appliance lists certificates installed on load balancer appliances
+// through their management APIs. F5 BIG-IP iControl REST and Citrix ADC
+// (NetScaler) NITRO are supported.
+package appliance
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	f5Path        = "/mgmt/tm/sys/file/ssl-cert"
+	netScalerPath = "/nitro/v1/config/sslcertkey"
+	// NetScaler reports dates in the same form as openssl
+	netScalerTimeFormat = "Jan _2 15:04:05 2006 MST"
+)
+
+// Appliance connection details for an appliance management API
+type Appliance struct {
+	URL      string
+	User     string
+	Password string
+	Insecure bool // management interfaces commonly use self-signed certs
+	Timeout  time.Duration
+	Clock    clock.Clock // time to calculate expiry at, clock.System if nil
+}
+
+// NewAppliance make a new appliance with connection details
+func NewAppliance(apiURL, user, password string, insecure bool, timeout time.Duration) *Appliance {
+	appliance := Appliance{
+		URL:      strings.TrimSuffix(apiURL, "/"),
+		User:     user,
+		Password: password,
+		Insecure: insecure,
+		Timeout:  timeout,
+	}
+
+	return &appliance
+}
+
+// now the time of the appliance's clock
+func (appliance *Appliance) now() time.Time {
+	if appliance.Clock == nil {
+		return clock.System.Now()
+	}
+
+	return appliance.Clock.Now()
+}
+
+// f5Cert a certificate as reported by iControl REST
+type f5Cert struct {
+	Name           string `json:"name"`
+	FullPath       string `json:"fullPath"`
+	CommonName     string `json:"commonName"`
+	Issuer         string `json:"issuer"`
+	ExpirationDate int64  `json:"expirationDate"`
+}
+
+// f5Response the body of an iControl REST ssl-cert listing
+type f5Response struct {
+	Items []f5Cert `json:"items"`
+}
+
+// netScalerCert a certificate as reported by NITRO
+type netScalerCert struct {
+	CertKey             string `json:"certkey"`
+	Cert                string `json:"cert"`
+	Issuer              string `json:"issuer"`
+	Subject             string `json:"subject"`
+	Status              string `json:"status"`
+	ClientCertNotBefore string `json:"clientcertnotbefore"`
+	ClientCertNotAfter  string `json:"clientcertnotafter"`
+	DaysToExpiration    int    `json:"daystoexpiration"`
+}
+
+// netScalerResponse the body of a NITRO sslcertkey listing
+type netScalerResponse struct {
+	SSLCertKey []netScalerCert `json:"sslcertkey"`
+}
+
+// get do an authenticated GET against the management API and return the body
+func (appliance *Appliance) get(path string, setAuth func(*http.Request)) (body []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), appliance.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, appliance.URL+path, nil)
+	if err != nil {
+		return
+	}
+	request.Header.Set("Accept", "application/json")
+	setAuth(request)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: appliance.Insecure},
+		},
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s returned %s", appliance.host(), response.Status)
+		return
+	}
+	body, err = io.ReadAll(response.Body)
+
+	return
+}
+
+// host get the appliance host name for use in messages
+func (appliance *Appliance) host() string {
+	parsed, err := url.Parse(appliance.URL)
+	if err != nil || parsed.Host == "" {
+		return appliance.URL
+	}
+
+	return parsed.Host
+}
+
+// hostError make a cert data set with a single error for the appliance
+func (appliance *Appliance) hostError(err error, warnAtDays int, tRun time.Time) *model.CertDataSet {
+	certDataSet := model.NewCertDataSet()
+	certData := model.CertData{
+		Host:       appliance.host(),
+		HostError:  true,
+		Message:    err.Error(),
+		WarnAtDays: warnAtDays,
+		CheckTime:  tRun.Format(model.TimeFormat),
+		FetchTime:  time.Since(tRun).Round(time.Millisecond).String(),
+	}
+	certDataSet.Add(certData)
+
+	return certDataSet
+}
+
+// parseF5 convert an iControl REST listing to cert data
+func parseF5(body []byte, warnAtDays int, now time.Time) (certDataList []model.CertData, err error) {
+	var response f5Response
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return
+	}
+
+	for _, item := range response.Items {
+		certData := model.CertData{}
+		certData.Host = item.CommonName
+		if certData.Host == "" {
+			certData.Host = item.FullPath
+		}
+		certData.Issuer = item.Issuer
+		certData.CheckTime = now.Format(model.TimeFormat)
+		certData.Message = "OK f5 " + item.FullPath
+		certData.SetExpiry(time.Time{}, time.Unix(item.ExpirationDate, 0), warnAtDays, now)
+
+		certDataList = append(certDataList, certData)
+	}
+
+	return
+}
+
+// parseNetScaler convert a NITRO listing to cert data
+func parseNetScaler(body []byte, warnAtDays int, now time.Time) (certDataList []model.CertData, err error) {
+	var response netScalerResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return
+	}
+
+	for _, item := range response.SSLCertKey {
+		certData := model.CertData{}
+		certData.Host = item.CertKey
+		certData.Issuer = item.Issuer
+		certData.CheckTime = now.Format(model.TimeFormat)
+
+		notAfter, err := time.Parse(netScalerTimeFormat, item.ClientCertNotAfter)
+		if err != nil {
+			certData.HostError = true
+			certData.Message = fmt.Sprintf("invalid clientcertnotafter %q", item.ClientCertNotAfter)
+			certDataList = append(certDataList, certData)
+			continue
+		}
+		notBefore, _ := time.Parse(netScalerTimeFormat, item.ClientCertNotBefore)
+		certData.Message = "OK netscaler " + item.Cert
+		certData.SetExpiry(notBefore, notAfter, warnAtDays, now)
+
+		certDataList = append(certDataList, certData)
+	}
+
+	return
+}
+
+// lookup fetch a listing and convert it to a cert data set
+func (appliance *Appliance) lookup(
+	path string,
+	setAuth func(*http.Request),
+	parse func([]byte, int, time.Time) ([]model.CertData, error),
+	warnAtDays int) *model.CertDataSet {
+	tRun := time.Now()
+
+	body, err := appliance.get(path, setAuth)
+	if err != nil {
+		return appliance.hostError(err, warnAtDays, tRun)
+	}
+	certDataList, err := parse(body, warnAtDays, appliance.now())
+	if err != nil {
+		return appliance.hostError(err, warnAtDays, tRun)
+	}
+
+	fetchTime := time.Since(tRun).Round(time.Millisecond).String()
+	for i := range certDataList {
+		certDataList[i].FetchTime = fetchTime
+	}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(certDataList...)
+
+	return certDataSet
+}
+
+// F5 list certificates installed on an F5 BIG-IP
+func (appliance *Appliance) F5(warnAtDays int) *model.CertDataSet {
+	setAuth := func(request *http.Request) {
+		request.SetBasicAuth(appliance.User, appliance.Password)
+	}
+
+	return appliance.lookup(f5Path, setAuth, parseF5, warnAtDays)
+}
+
+// NetScaler list certificates installed on a Citrix ADC
+func (appliance *Appliance) NetScaler(warnAtDays int) *model.CertDataSet {
+	setAuth := func(request *http.Request) {
+		request.Header.Set("X-NITRO-USER", appliance.User)
+		request.Header.Set("X-NITRO-PASS", appliance.Password)
+	}
+
+	return appliance.lookup(netScalerPath, setAuth, parseNetScaler, warnAtDays)
+}
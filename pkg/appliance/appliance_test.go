@@ -0,0 +1,118 @@
+package appliance
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/matryer/is"
+)
+
+const f5JSON = `{
+  "kind": "tm:sys:file:ssl-cert:ssl-certcollectionstate",
+  "items": [
+    {
+      "name": "default.crt",
+      "fullPath": "/Common/default.crt",
+      "commonName": "localhost.localdomain",
+      "issuer": "CN=localhost.localdomain",
+      "expirationDate": 1262304000
+    },
+    {
+      "name": "www.crt",
+      "fullPath": "/Common/www.crt",
+      "commonName": "www.example.com",
+      "issuer": "CN=Example CA",
+      "expirationDate": 4102444800
+    }
+  ]
+}`
+
+const netScalerJSON = `{
+  "errorcode": 0,
+  "message": "Done",
+  "sslcertkey": [
+    {
+      "certkey": "ns-server-certificate",
+      "cert": "ns-server.cert",
+      "issuer": "CN=NetScaler",
+      "subject": "CN=NetScaler",
+      "status": "Valid",
+      "clientcertnotbefore": "Jan  1 00:00:00 2020 GMT",
+      "clientcertnotafter": "Jan  1 00:00:00 2100 GMT",
+      "daystoexpiration": 27000
+    }
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+	certDataList, err := parseF5([]byte(f5JSON), 30, now)
+	is.NoErr(err)
+	is.Equal(len(certDataList), 2)
+	is.True(certDataList[0].ExpiryWarning)
+	is.True(!certDataList[1].ExpiryWarning)
+	is.Equal(certDataList[1].Host, "www.example.com")
+
+	certDataList, err = parseNetScaler([]byte(netScalerJSON), 30, now)
+	is.NoErr(err)
+	is.Equal(len(certDataList), 1)
+	is.Equal(certDataList[0].NotBefore, "2020-01-01T00:00:00Z")
+	is.True(!certDataList[0].HostError)
+
+	// Before its expiry the first F5 cert is no longer a warning
+	certDataList, err = parseF5([]byte(f5JSON), 30, time.Date(2009, 1, 1, 0, 0, 0, 0, time.UTC))
+	is.NoErr(err)
+	is.True(!certDataList[0].ExpiryWarning)
+	is.Equal(certDataList[0].DaysToExpiry, 365)
+}
+
+func TestLookup(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case f5Path:
+			user, password, ok := r.BasicAuth()
+			if !ok || user != "admin" || password != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(f5JSON))
+		case netScalerPath:
+			if r.Header.Get("X-NITRO-USER") != "admin" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(netScalerJSON))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	appliance := NewAppliance(server.URL, "admin", "secret", true, 2*time.Second)
+	certDataSet := appliance.F5(30)
+	is.Equal(certDataSet.Total, 2)
+	is.Equal(certDataSet.ExpiredWarnings, 1)
+
+	certDataSet = appliance.NetScaler(30)
+	is.Equal(certDataSet.Total, 1)
+	is.Equal(certDataSet.HostErrors, 0)
+
+	// A fixed clock calculates expiry at that time
+	appliance.Clock = clock.Fixed(time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC))
+	certDataSet = appliance.NetScaler(30)
+	is.Equal(certDataSet.ExpiredWarnings, 0)
+	is.Equal(certDataSet.CertData[0].DaysToExpiry, 365)
+	is.Equal(certDataSet.CertData[0].CheckTime, "2099-01-01T00:00:00Z")
+
+	// Without skipping verification the test server's cert is rejected
+	appliance = NewAppliance(server.URL, "admin", "secret", false, 2*time.Second)
+	certDataSet = appliance.F5(30)
+	is.Equal(certDataSet.HostErrors, 1)
+}
@@ -0,0 +1,147 @@
+// Package baseline records the certificates hosts are expected to serve and
+// finds hosts that have drifted from them, for change-controlled deployments.
+package baseline
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Entry the approved certificate for a host, or one address of a host
+type Entry struct {
+	Host        string `json:"host" yaml:"host"`
+	Port        string `json:"port" yaml:"port"`
+	IP          string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	NotAfter    string `json:"notafter" yaml:"notafter"`
+}
+
+// Baseline approved certificates for a set of hosts
+type Baseline struct {
+	Saved   string  `json:"saved" yaml:"saved"`
+	AllIPs  bool    `json:"allips,omitempty" yaml:"allips,omitempty"`
+	Entries []Entry `json:"entries" yaml:"entries"`
+}
+
+// key identify the endpoint of an entry or result
+func key(host, port, ip string, allIPs bool) string {
+	if !allIPs {
+		ip = ""
+	}
+
+	return fmt.Sprintf("%s:%s/%s", host, port, ip)
+}
+
+// endpoint describe a host and port, with the address if known
+func endpoint(host, port, ip string) string {
+	if ip == "" {
+		return fmt.Sprintf("%s:%s", host, port)
+	}
+
+	return fmt.Sprintf("%s:%s (%s)", host, port, ip)
+}
+
+// New make a baseline from checked hosts. Results with no certificate are
+// skipped and returned so they can be reported.
+func New(certDataSet *model.CertDataSet, allIPs bool) (baseline *Baseline, skipped []model.CertData) {
+	baseline = new(Baseline)
+	baseline.Saved = time.Now().UTC().Format(model.TimeFormat)
+	baseline.AllIPs = allIPs
+	for _, certData := range certDataSet.CertData {
+		if certData.Fingerprint == "" {
+			skipped = append(skipped, certData)
+			continue
+		}
+		entry := Entry{Host: certData.Host, Port: certData.Port, Fingerprint: certData.Fingerprint, NotAfter: certData.NotAfter}
+		if allIPs {
+			entry.IP = certData.IP
+		}
+		baseline.Entries = append(baseline.Entries, entry)
+	}
+
+	return
+}
+
+// Read read a baseline file
+func Read(path string) (baseline *Baseline, err error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	baseline = new(Baseline)
+	err = yaml.Unmarshal(bytes, baseline)
+
+	return
+}
+
+// Write write a baseline file
+func (baseline *Baseline) Write(path string) (err error) {
+	bytes, err := yaml.Marshal(baseline)
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(path, bytes, 0o644)
+}
+
+// Hosts get the host:port list of the baseline, once each
+func (baseline *Baseline) Hosts() (hosts []string) {
+	seen := make(map[string]bool)
+	for _, entry := range baseline.Entries {
+		item := fmt.Sprintf("%s:%s", entry.Host, entry.Port)
+		if !seen[item] {
+			seen[item] = true
+			hosts = append(hosts, item)
+		}
+	}
+
+	return
+}
+
+// Check compare checked hosts with the baseline. Results that differ from the
+// baseline or are not in it are marked as host errors, and a description of
+// each difference, including baseline hosts that were not checked, is
+// returned.
+func (baseline *Baseline) Check(certDataSet *model.CertDataSet) (drift []string) {
+	expected := make(map[string]Entry)
+	for _, entry := range baseline.Entries {
+		expected[key(entry.Host, entry.Port, entry.IP, baseline.AllIPs)] = entry
+	}
+
+	checked := make(map[string]bool)
+	for i := range certDataSet.CertData {
+		certData := &certDataSet.CertData[i]
+		k := key(certData.Host, certData.Port, certData.IP, baseline.AllIPs)
+		checked[k] = true
+		entry, ok := expected[k]
+
+		var message string
+		switch {
+		case !ok:
+			message = "not in baseline"
+		case certData.Fingerprint == "":
+			drift = append(drift, fmt.Sprintf("%s %s", endpoint(certData.Host, certData.Port, certData.IP), certData.Message))
+			continue
+		case certData.Fingerprint != entry.Fingerprint:
+			message = fmt.Sprintf("drift from baseline: serves %s expiring %s, approved %s expiring %s",
+				certData.Fingerprint, certData.NotAfter, entry.Fingerprint, entry.NotAfter)
+		default:
+			continue
+		}
+		certData.HostError = true
+		certData.Message = message
+		drift = append(drift, fmt.Sprintf("%s %s", endpoint(certData.Host, certData.Port, certData.IP), message))
+	}
+	for _, entry := range baseline.Entries {
+		if !checked[key(entry.Host, entry.Port, entry.IP, baseline.AllIPs)] {
+			drift = append(drift, fmt.Sprintf("%s not checked", endpoint(entry.Host, entry.Port, entry.IP)))
+		}
+	}
+	certDataSet.Finalize()
+
+	return
+}
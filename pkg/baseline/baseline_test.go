@@ -0,0 +1,53 @@
+package baseline
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestSaveAndCheck(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "a.example.com", Port: "443", Fingerprint: "aaaa"},
+		model.CertData{Host: "b.example.com", Port: "443", Fingerprint: "bbbb"},
+		model.CertData{Host: "c.example.com", Port: "443", HostError: true, Message: "timeout"},
+	)
+	baseline, skipped := New(certDataSet, false)
+	is.Equal(len(baseline.Entries), 2)
+	is.Equal(len(skipped), 1)
+
+	dir, err := os.MkdirTemp("", "baseline")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "baseline.yaml")
+	is.NoErr(baseline.Write(path))
+
+	baseline, err = Read(path)
+	is.NoErr(err)
+	is.Equal(baseline.Hosts(), []string{"a.example.com:443", "b.example.com:443"})
+
+	// Unchanged hosts have no drift
+	live := model.NewCertDataSet()
+	live.Add(
+		model.CertData{Host: "a.example.com", Port: "443", IP: "192.0.2.1", Fingerprint: "aaaa"},
+		model.CertData{Host: "b.example.com", Port: "443", Fingerprint: "bbbb"},
+	)
+	is.Equal(len(baseline.Check(live)), 0)
+	is.Equal(live.HostErrors, 0)
+
+	// A changed certificate, a new host and a missing host all drift
+	live = model.NewCertDataSet()
+	live.Add(
+		model.CertData{Host: "a.example.com", Port: "443", Fingerprint: "cccc"},
+		model.CertData{Host: "d.example.com", Port: "443", Fingerprint: "dddd"},
+	)
+	drift := baseline.Check(live)
+	is.Equal(len(drift), 3)
+	is.Equal(live.HostErrors, 2)
+}
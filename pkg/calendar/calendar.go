@@ -0,0 +1,130 @@
+// Package calendar holds change freezes and holidays during which
+// certificates can't be renewed, so expiry warnings come early enough to
+// renew before a freeze rather than in the middle of one.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	day        = 24 * time.Hour
+	dateFormat = "2006-01-02"
+)
+
+// Freeze days on which no renewals are made, from the start of Start to the
+// end of End in UTC
+type Freeze struct {
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+// String describe the freeze by its name and dates
+func (freeze Freeze) String() string {
+	dates := freeze.Start.Format(dateFormat) + " to " + freeze.End.Format(dateFormat)
+	if freeze.Name == "" {
+		return dates
+	}
+
+	return freeze.Name + " " + dates
+}
+
+// Parse read freezes, one per line as a start date, an optional end date and
+// an optional name, as in
+//
+//	2026-12-18 2027-01-04 year end freeze
+//	2026-11-26 Thanksgiving
+//
+// A freeze without an end date is one day. Blank lines and lines starting
+// with # are skipped.
+func Parse(reader io.Reader) (freezes []Freeze, err error) {
+	scanner := bufio.NewScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var freeze Freeze
+		if freeze.Start, err = time.Parse(dateFormat, fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %s, expected a date such as 2026-12-18", line, fields[0])
+		}
+		freeze.End, fields = freeze.Start, fields[1:]
+		if len(fields) > 0 {
+			if end, endErr := time.Parse(dateFormat, fields[0]); endErr == nil {
+				freeze.End, fields = end, fields[1:]
+			}
+		}
+		if freeze.End.Before(freeze.Start) {
+			return nil, fmt.Errorf("line %d: freeze ends before it starts", line)
+		}
+		freeze.Name = strings.Join(fields, " ")
+		freezes = append(freezes, freeze)
+	}
+
+	return freezes, scanner.Err()
+}
+
+// Read read freezes from a file
+func Read(path string) (freezes []Freeze, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	if freezes, err = Parse(file); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return
+}
+
+// RenewBy get the day a cert must be renewed by, the start of the earliest
+// freeze that overlaps the warning period before it expires. Renewals that
+// would normally be made then can't be, so they have to be made before the
+// freeze. ok is false if no freeze is in the way.
+func RenewBy(notAfter time.Time, warnAtDays int, freezes []Freeze) (renewBy time.Time, freeze Freeze, ok bool) {
+	warnFrom := notAfter.Add(-time.Duration(warnAtDays) * day)
+	for _, f := range freezes {
+		if f.Start.After(notAfter) || !f.End.Add(day).After(warnFrom) {
+			continue
+		}
+		if !ok || f.Start.Before(renewBy) {
+			renewBy, freeze, ok = f.Start, f, true
+		}
+	}
+
+	return
+}
+
+// Apply set RenewBy and Freeze on results whose warning period a freeze
+// overlaps, and set ExpiryWarning on those where the warning period before
+// the freeze has begun, warning as long before the freeze as is normally
+// warned before expiry
+func Apply(certDataSet *model.CertDataSet, freezes []Freeze, now time.Time) {
+	for i, certData := range certDataSet.CertData {
+		notAfter, err := time.Parse(model.TimeFormat, certData.NotAfter)
+		if err != nil {
+			continue
+		}
+		renewBy, freeze, ok := RenewBy(notAfter, certData.WarnAtDays, freezes)
+		if !ok {
+			continue
+		}
+		certDataSet.CertData[i].RenewBy = renewBy.Format(model.TimeFormat)
+		certDataSet.CertData[i].Freeze = freeze.String()
+		if now.Add(time.Duration(certData.WarnAtDays) * day).After(renewBy) {
+			certDataSet.CertData[i].ExpiryWarning = true
+		}
+	}
+	certDataSet.Finalize()
+}
@@ -0,0 +1,88 @@
+package calendar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func date(s string) time.Time {
+	t, _ := time.Parse(dateFormat, s)
+	return t
+}
+
+func TestParse(t *testing.T) {
+	is := is.New(t)
+
+	freezes, err := Parse(strings.NewReader("# freezes\n\n2026-12-18 2027-01-04 year end freeze\n2026-11-26 Thanksgiving\n2026-07-01\n"))
+	is.NoErr(err)
+	is.Equal(len(freezes), 3)
+	is.Equal(freezes[0].String(), "year end freeze 2026-12-18 to 2027-01-04")
+	is.Equal(freezes[1].End, date("2026-11-26"))
+	is.Equal(freezes[1].Name, "Thanksgiving")
+	is.Equal(freezes[2].String(), "2026-07-01 to 2026-07-01")
+
+	_, err = Parse(strings.NewReader("next week\n"))
+	is.True(err != nil)
+	_, err = Parse(strings.NewReader("2027-01-04 2026-12-18\n"))
+	is.True(err != nil)
+}
+
+func TestRenewBy(t *testing.T) {
+	is := is.New(t)
+
+	freezes := []Freeze{
+		{Name: "year end", Start: date("2026-12-18"), End: date("2027-01-04")},
+		{Name: "audit", Start: date("2026-12-01"), End: date("2026-12-02")},
+	}
+
+	// Expiring in a freeze
+	renewBy, freeze, ok := RenewBy(date("2026-12-25"), 10, freezes)
+	is.True(ok)
+	is.Equal(renewBy, date("2026-12-18"))
+	is.Equal(freeze.Name, "year end")
+
+	// Expiring shortly after a freeze, so the warning period starts in it
+	renewBy, _, ok = RenewBy(date("2027-01-10"), 10, freezes)
+	is.True(ok)
+	is.Equal(renewBy, date("2026-12-18"))
+
+	// The earliest freeze in the warning period wins
+	renewBy, freeze, ok = RenewBy(date("2026-12-20"), 30, freezes)
+	is.True(ok)
+	is.Equal(freeze.Name, "audit")
+	is.Equal(renewBy, date("2026-12-01"))
+
+	// Well clear of any freeze
+	_, _, ok = RenewBy(date("2027-03-01"), 30, freezes)
+	is.True(!ok)
+	_, _, ok = RenewBy(date("2026-11-30"), 10, freezes)
+	is.True(!ok)
+}
+
+func TestApply(t *testing.T) {
+	is := is.New(t)
+
+	freezes := []Freeze{{Name: "year end", Start: date("2026-12-18"), End: date("2027-01-04")}}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "a.example.com", NotAfter: "2026-12-28T00:00:00Z", WarnAtDays: 30},
+		model.CertData{Host: "b.example.com", NotAfter: "2027-03-01T00:00:00Z", WarnAtDays: 30},
+		model.CertData{Host: "c.example.com", HostError: true},
+	)
+
+	// 30 days before expiry is after the freeze starts, so warn 30 days before it
+	Apply(certDataSet, freezes, date("2026-11-20"))
+	is.Equal(certDataSet.ExpiredWarnings, 1)
+	is.True(certDataSet.CertData[0].ExpiryWarning)
+	is.Equal(certDataSet.CertData[0].RenewBy, "2026-12-18T00:00:00Z")
+	is.Equal(certDataSet.CertData[0].Freeze, "year end 2026-12-18 to 2027-01-04")
+	is.Equal(certDataSet.CertData[1].Freeze, "")
+
+	certDataSet.CertData[0].ExpiryWarning = false
+	Apply(certDataSet, freezes, date("2026-11-10"))
+	is.True(!certDataSet.CertData[0].ExpiryWarning)
+}
@@ -0,0 +1,234 @@
+package cdn
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// EdgeGrid Akamai API client credentials as found in an .edgerc file
+type EdgeGrid struct {
+	Host         string
+	ClientToken  string
+	ClientSecret string
+	AccessToken  string
+}
+
+// ReadEdgeRC read a section of an .edgerc credentials file
+func ReadEdgeRC(path, section string) (edgeGrid EdgeGrid, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	return parseEdgeRC(file, section)
+}
+
+// parseEdgeRC parse the ini style .edgerc format
+func parseEdgeRC(reader io.Reader, section string) (edgeGrid EdgeGrid, err error) {
+	var (
+		scanner = bufio.NewScanner(reader)
+		current string
+		found   bool
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if current != section {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		found = true
+		value = strings.TrimSpace(value)
+		switch strings.TrimSpace(key) {
+		case "host":
+			edgeGrid.Host = value
+		case "client_token":
+			edgeGrid.ClientToken = value
+		case "client_secret":
+			edgeGrid.ClientSecret = value
+		case "access_token":
+			edgeGrid.AccessToken = value
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if !found {
+		err = fmt.Errorf("section %s not found in edgerc", section)
+	}
+
+	return
+}
+
+// hmacBase64 get the base64 encoded HMAC-SHA256 of data
+func hmacBase64(key, data string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(data))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// authorization make an EG1-HMAC-SHA256 authorization header for a request
+// with no body
+func (edgeGrid *EdgeGrid) authorization(request *http.Request, timestamp, nonce string) string {
+	authHeader := fmt.Sprintf("EG1-HMAC-SHA256 client_token=%s;access_token=%s;timestamp=%s;nonce=%s;",
+		edgeGrid.ClientToken, edgeGrid.AccessToken, timestamp, nonce)
+
+	pathAndQuery := request.URL.EscapedPath()
+	if request.URL.RawQuery != "" {
+		pathAndQuery += "?" + request.URL.RawQuery
+	}
+	// Headers are not signed and there is no body to hash
+	dataToSign := strings.Join([]string{
+		request.Method,
+		request.URL.Scheme,
+		request.URL.Host,
+		pathAndQuery,
+		"",
+		"",
+		authHeader,
+	}, "\t")
+	signingKey := hmacBase64(edgeGrid.ClientSecret, timestamp)
+
+	return authHeader + "signature=" + hmacBase64(signingKey, dataToSign)
+}
+
+// sign set the authorization header on a request
+func (edgeGrid *EdgeGrid) sign(request *http.Request) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := time.Now().UTC().Format("20060102T15:04:05+0000")
+	request.Header.Set("Authorization", edgeGrid.authorization(request, timestamp, hex.EncodeToString(nonce)))
+
+	return nil
+}
+
+// akamaiEnrollments a CPS enrollment listing
+type akamaiEnrollments struct {
+	Enrollments []struct {
+		Location string `json:"location"`
+		CSR      struct {
+			CN   string   `json:"cn"`
+			SANs []string `json:"sans"`
+		} `json:"csr"`
+	} `json:"enrollments"`
+}
+
+// akamaiDeployment a CPS production deployment
+type akamaiDeployment struct {
+	PrimaryCertificate struct {
+		Certificate string `json:"certificate"`
+	} `json:"primaryCertificate"`
+	MultiStackedCertificates []struct {
+		Certificate string `json:"certificate"`
+	} `json:"multiStackedCertificates"`
+}
+
+// parseAkamaiDeployment convert the certificates of a deployment to edge certs
+func parseAkamaiDeployment(body []byte, id string) (edgeCerts []EdgeCert, err error) {
+	var deployment akamaiDeployment
+	err = json.Unmarshal(body, &deployment)
+	if err != nil {
+		return
+	}
+
+	certificates := []string{deployment.PrimaryCertificate.Certificate}
+	for _, stacked := range deployment.MultiStackedCertificates {
+		certificates = append(certificates, stacked.Certificate)
+	}
+	for _, certificate := range certificates {
+		block, _ := pem.Decode([]byte(certificate))
+		if block == nil {
+			continue
+		}
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return
+		}
+		sum := sha256.Sum256(cert.Raw)
+		edgeCerts = append(edgeCerts, EdgeCert{
+			Provider:    "akamai",
+			ID:          id,
+			Hosts:       cert.DNSNames,
+			Issuer:      cert.Issuer.String(),
+			NotBefore:   cert.NotBefore,
+			NotAfter:    cert.NotAfter,
+			Fingerprint: hex.EncodeToString(sum[:]),
+		})
+	}
+	if len(edgeCerts) == 0 {
+		err = errors.New("no certificate deployed for enrollment " + id)
+	}
+
+	return
+}
+
+// Akamai list the production edge certificates of the CPS enrollments in a
+// contract. An enrollment whose deployment can't be read is returned as an
+// edge cert with Err set, so the others are still audited. Errors are
+// returned only if the enrollments can't be listed.
+func Akamai(edgeGrid EdgeGrid, contractID string, timeout time.Duration) (edgeCerts []EdgeCert, err error) {
+	base := "https://" + strings.TrimSuffix(strings.TrimPrefix(edgeGrid.Host, "https://"), "/")
+
+	listURL := base + "/cps/v2/enrollments?contractId=" + url.QueryEscape(contractID)
+	body, err := get(listURL, timeout, func(request *http.Request) error {
+		request.Header.Set("Accept", "application/vnd.akamai.cps.enrollments.v11+json")
+		return edgeGrid.sign(request)
+	})
+	if err != nil {
+		return
+	}
+	var enrollments akamaiEnrollments
+	err = json.Unmarshal(body, &enrollments)
+	if err != nil {
+		return
+	}
+
+	for _, enrollment := range enrollments.Enrollments {
+		id := enrollment.Location[strings.LastIndex(enrollment.Location, "/")+1:]
+		body, err = get(base+enrollment.Location+"/deployments/production", timeout, func(request *http.Request) error {
+			request.Header.Set("Accept", "application/vnd.akamai.cps.deployment.v8+json")
+			return edgeGrid.sign(request)
+		})
+		if err != nil {
+			edgeCerts = append(edgeCerts, EdgeCert{Provider: "akamai", ID: "enrollment " + id, Err: err})
+			continue
+		}
+		deployed, parseErr := parseAkamaiDeployment(body, id)
+		if parseErr != nil {
+			edgeCerts = append(edgeCerts, EdgeCert{Provider: "akamai", ID: "enrollment " + id, Err: parseErr})
+			continue
+		}
+		edgeCerts = append(edgeCerts, deployed...)
+	}
+
+	return edgeCerts, nil
+}
@@ -0,0 +1,134 @@
+// Package cdn lists edge certificates from CDN provider APIs and compares them
+// with the certificates that checked hosts present. Cloudflare and Akamai are
+// supported.
+package cdn
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// EdgeCert a certificate deployed at a CDN edge
+type EdgeCert struct {
+	Provider    string
+	ID          string
+	Hosts       []string
+	Issuer      string
+	NotBefore   time.Time // zero if the provider doesn't give it
+	NotAfter    time.Time
+	Fingerprint string // SHA-256 of the cert if the provider gives the cert itself
+	Err         error  // why the cert of one enrollment or pack could not be read
+}
+
+// get do a GET request with headers set by the caller and return the body
+func get(url string, timeout time.Duration, setHeaders func(*http.Request) error) (body []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	err = setHeaders(request)
+	if err != nil {
+		return
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("%s returned %s", request.URL.Host, response.Status)
+		return
+	}
+	body, err = io.ReadAll(response.Body)
+
+	return
+}
+
+// matches check if a host name is covered by a certificate name, which may be
+// a wildcard
+func matches(name, host string) bool {
+	name = strings.ToLower(name)
+	host = strings.ToLower(host)
+	if name == host {
+		return true
+	}
+	if strings.HasPrefix(name, "*.") {
+		suffix := name[1:]
+		return strings.HasSuffix(host, suffix) && !strings.Contains(strings.TrimSuffix(host, suffix), ".")
+	}
+
+	return false
+}
+
+// Audit compare edge certificates with the certificates checked hosts serve.
+// An edge certificate is a mismatch when a host it covers serves a different
+// certificate, by fingerprint if the provider gives the cert or else by
+// expiry, and orphaned when it covers none of the checked hosts. Edge certs
+// that could not be read are errors. Expiry is calculated at now.
+func Audit(edgeCerts []EdgeCert, checked *model.CertDataSet, warnAtDays int, now time.Time) *model.CertDataSet {
+	certDataSet := model.NewCertDataSet()
+
+	for _, edgeCert := range edgeCerts {
+		certData := model.CertData{}
+		certData.Host = strings.Join(edgeCert.Hosts, ", ")
+		certData.Issuer = edgeCert.Issuer
+		certData.WarnAtDays = warnAtDays
+		certData.CheckTime = now.Format(model.TimeFormat)
+		if edgeCert.Err != nil {
+			certData.Host = fmt.Sprintf("%s %s", edgeCert.Provider, edgeCert.ID)
+			certData.HostError = true
+			certData.Message = edgeCert.Err.Error()
+			certDataSet.Add(certData)
+			continue
+		}
+		certData.Fingerprint = edgeCert.Fingerprint
+		certData.SetExpiry(edgeCert.NotBefore, edgeCert.NotAfter, warnAtDays, now)
+
+		var covered, mismatched []string
+		for _, served := range checked.CertData {
+			if served.HostError {
+				continue
+			}
+			for _, name := range edgeCert.Hosts {
+				if !matches(name, served.Host) {
+					continue
+				}
+				covered = append(covered, served.Host)
+				if edgeCert.Fingerprint != "" && served.Fingerprint != "" {
+					if served.Fingerprint != edgeCert.Fingerprint {
+						mismatched = append(mismatched, fmt.Sprintf("%s serves %s", served.Host, served.Fingerprint))
+					}
+				} else if served.NotAfter != certData.NotAfter {
+					mismatched = append(mismatched, fmt.Sprintf("%s serves %s", served.Host, served.NotAfter))
+				}
+				break
+			}
+		}
+
+		switch {
+		case len(checked.CertData) > 0 && len(covered) == 0:
+			certData.HostError = true
+			certData.Message = fmt.Sprintf("orphaned %s edge certificate %s", edgeCert.Provider, edgeCert.ID)
+		case len(mismatched) > 0:
+			certData.HostError = true
+			certData.Message = fmt.Sprintf("%s edge certificate %s mismatch: %s",
+				edgeCert.Provider, edgeCert.ID, strings.Join(mismatched, ", "))
+		default:
+			certData.Message = fmt.Sprintf("OK %s %s", edgeCert.Provider, edgeCert.ID)
+		}
+
+		certDataSet.Add(certData)
+	}
+
+	return certDataSet
+}
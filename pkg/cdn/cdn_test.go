@@ -0,0 +1,170 @@
+package cdn
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+const cloudflareJSON = `{
+  "success": true,
+  "errors": [],
+  "result": [
+    {
+      "id": "pack-1",
+      "type": "universal",
+      "hosts": ["example.com", "*.example.com"],
+      "status": "active",
+      "certificates": [
+        {
+          "id": "cert-1",
+          "hosts": ["example.com", "*.example.com"],
+          "issuer": "LetsEncrypt",
+          "status": "active",
+          "uploaded_on": "2030-01-01T00:00:00Z",
+          "expires_on": "2030-04-01T00:00:00Z"
+        }
+      ]
+    },
+    {
+      "id": "pack-2",
+      "type": "advanced",
+      "hosts": ["old.example.org"],
+      "status": "active",
+      "certificates": [
+        {
+          "id": "cert-2",
+          "issuer": "GoogleTrust",
+          "status": "active",
+          "uploaded_on": "2030-01-01T00:00:00Z",
+          "expires_on": "2030-04-01T00:00:00Z"
+        }
+      ]
+    }
+  ],
+  "result_info": {"page": 2, "per_page": 50, "total_pages": 2}
+}`
+
+func TestMatches(t *testing.T) {
+	is := is.New(t)
+
+	is.True(matches("www.example.com", "WWW.example.com"))
+	is.True(matches("*.example.com", "www.example.com"))
+	is.True(!matches("*.example.com", "a.b.example.com"))
+	is.True(!matches("*.example.com", "example.com"))
+}
+
+func TestCloudflare(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		// The packs are on the second page
+		if r.URL.Query().Get("page") == "1" {
+			w.Write([]byte(`{"success": true, "result": [], "result_info": {"page": 1, "total_pages": 2}}`))
+			return
+		}
+		w.Write([]byte(cloudflareJSON))
+	}))
+	defer server.Close()
+	CloudflareAPI = server.URL
+
+	edgeCerts, err := Cloudflare("token", "zone", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(len(edgeCerts), 2)
+	is.Equal(edgeCerts[1].Hosts, []string{"old.example.org"}) // pack hosts used
+	is.True(edgeCerts[0].NotBefore.IsZero())                  // uploaded_on isn't validity
+
+	_, err = Cloudflare("wrong", "zone", 2*time.Second)
+	is.True(err != nil)
+}
+
+func TestAudit(t *testing.T) {
+	is := is.New(t)
+
+	edgeCerts, more, err := parseCloudflare([]byte(cloudflareJSON))
+	is.NoErr(err)
+	is.True(!more)
+
+	checked := model.NewCertDataSet()
+	checked.Add(model.CertData{Host: "www.example.com", NotAfter: "2030-05-01T00:00:00Z"})
+
+	certDataSet := Audit(edgeCerts, checked, 30, time.Now())
+	is.Equal(certDataSet.Total, 2)
+	is.Equal(certDataSet.HostErrors, 2)
+	for _, certData := range certDataSet.CertData {
+		switch certData.Host {
+		case "example.com, *.example.com":
+			is.True(strings.Contains(certData.Message, "mismatch"))
+		case "old.example.org":
+			is.True(strings.HasPrefix(certData.Message, "orphaned"))
+		default:
+			t.Fatal("unexpected host", certData.Host)
+		}
+	}
+
+	checked = model.NewCertDataSet()
+	checked.Add(model.CertData{Host: "www.example.com", NotAfter: "2030-04-01T00:00:00Z"})
+	certDataSet = Audit(edgeCerts[:1], checked, 30, time.Now())
+	is.Equal(certDataSet.HostErrors, 0)
+
+	// Certs given by the provider are compared by fingerprint, even with the
+	// same expiry, and enrollments that couldn't be read are reported alone
+	checked = model.NewCertDataSet()
+	checked.Add(model.CertData{Host: "www.example.com", NotAfter: "2030-04-01T00:00:00Z", Fingerprint: "bbbb"})
+	akamai := []EdgeCert{
+		{Provider: "akamai", ID: "1", Hosts: []string{"www.example.com"}, NotAfter: edgeCerts[0].NotAfter, Fingerprint: "aaaa"},
+		{Provider: "akamai", ID: "enrollment 2", Err: errors.New("akab-host returned 403 Forbidden")},
+	}
+	certDataSet = Audit(akamai, checked, 30, time.Now())
+	is.Equal(certDataSet.HostErrors, 2)
+	for _, certData := range certDataSet.CertData {
+		if certData.Host == "akamai enrollment 2" {
+			is.Equal(certData.Message, "akab-host returned 403 Forbidden")
+			is.True(certData.CheckTime != "")
+		} else {
+			is.True(strings.Contains(certData.Message, "www.example.com serves bbbb"))
+		}
+	}
+
+	checked.CertData[0].Fingerprint = "aaaa"
+	is.Equal(Audit(akamai[:1], checked, 30, time.Now()).HostErrors, 0)
+}
+
+func TestEdgeGrid(t *testing.T) {
+	is := is.New(t)
+
+	edgerc := `
+[default]
+client_secret = secret
+host = akab-host.luna.akamaiapis.net
+access_token = akab-access
+client_token = akab-client
+
+[other]
+host = other.luna.akamaiapis.net
+`
+	edgeGrid, err := parseEdgeRC(strings.NewReader(edgerc), "default")
+	is.NoErr(err)
+	is.Equal(edgeGrid.Host, "akab-host.luna.akamaiapis.net")
+	is.Equal(edgeGrid.ClientSecret, "secret")
+
+	_, err = parseEdgeRC(strings.NewReader(edgerc), "missing")
+	is.True(err != nil)
+
+	request, err := http.NewRequest(http.MethodGet, "https://akab-host.luna.akamaiapis.net/cps/v2/enrollments?contractId=1", nil)
+	is.NoErr(err)
+	header := edgeGrid.authorization(request, "20300101T00:00:00+0000", "nonce")
+	is.True(strings.HasPrefix(header, "EG1-HMAC-SHA256 client_token=akab-client;access_token=akab-access;"))
+	// Signing is deterministic for a fixed timestamp and nonce
+	is.Equal(header, edgeGrid.authorization(request, "20300101T00:00:00+0000", "nonce"))
+}
@@ -0,0 +1,109 @@
+package cdn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CloudflareAPI base URL of the Cloudflare v4 API
+var CloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflarePageSize certificate packs to ask for in each page of a listing
+const cloudflarePageSize = 50
+
+// cloudflareCert a certificate within a Cloudflare certificate pack. Its
+// uploaded_on time is when Cloudflare deployed it, not the start of its
+// validity, so it isn't used.
+type cloudflareCert struct {
+	ID        string    `json:"id"`
+	Hosts     []string  `json:"hosts"`
+	Issuer    string    `json:"issuer"`
+	Status    string    `json:"status"`
+	ExpiresOn time.Time `json:"expires_on"`
+}
+
+// cloudflarePack a Cloudflare certificate pack
+type cloudflarePack struct {
+	ID           string           `json:"id"`
+	Type         string           `json:"type"`
+	Hosts        []string         `json:"hosts"`
+	Status       string           `json:"status"`
+	Certificates []cloudflareCert `json:"certificates"`
+}
+
+// cloudflareResponse a Cloudflare API response listing certificate packs
+type cloudflareResponse struct {
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+	Result     []cloudflarePack `json:"result"`
+	ResultInfo struct {
+		Page       int `json:"page"`
+		TotalPages int `json:"total_pages"`
+	} `json:"result_info"`
+}
+
+// parseCloudflare convert a page of a certificate pack listing to edge certs,
+// with whether there are more pages
+func parseCloudflare(body []byte) (edgeCerts []EdgeCert, more bool, err error) {
+	var response cloudflareResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return
+	}
+	if !response.Success {
+		if len(response.Errors) > 0 {
+			err = errors.New(response.Errors[0].Message)
+			return
+		}
+		err = errors.New("cloudflare request failed")
+		return
+	}
+
+	for _, pack := range response.Result {
+		for _, cert := range pack.Certificates {
+			edgeCert := EdgeCert{
+				Provider: "cloudflare",
+				ID:       cert.ID,
+				Hosts:    cert.Hosts,
+				Issuer:   cert.Issuer,
+				NotAfter: cert.ExpiresOn,
+			}
+			if len(edgeCert.Hosts) == 0 {
+				edgeCert.Hosts = pack.Hosts
+			}
+			edgeCerts = append(edgeCerts, edgeCert)
+		}
+	}
+	more = response.ResultInfo.Page < response.ResultInfo.TotalPages
+
+	return
+}
+
+// Cloudflare list the edge certificates of a Cloudflare zone, every page of
+// its certificate packs
+func Cloudflare(token, zoneID string, timeout time.Duration) (edgeCerts []EdgeCert, err error) {
+	for page, more := 1, true; more; page++ {
+		url := fmt.Sprintf("%s/zones/%s/ssl/certificate_packs?status=all&page=%d&per_page=%d",
+			CloudflareAPI, zoneID, page, cloudflarePageSize)
+		body, err := get(url, timeout, func(request *http.Request) error {
+			request.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		var pageCerts []EdgeCert
+		pageCerts, more, err = parseCloudflare(body)
+		if err != nil {
+			return nil, err
+		}
+		edgeCerts = append(edgeCerts, pageCerts...)
+	}
+
+	return
+}
@@ -1,53 +1,178 @@
 package cert
 
 import (
+	"bytes"
 	"crypto/x509"
 	"encoding/pem"
 	"errors"
+	"fmt"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// Block statuses
+const (
+	BlockParsed  = "parsed"  // a certificate that was parsed
+	BlockSkipped = "skipped" // a block that isn't a certificate, such as a key, or text outside of blocks
+	BlockInvalid = "invalid" // a block that couldn't be read
 )
 
-// pemCertificateBlocks get first certificate in PEM
-// https://fale.io/blog/2017/12/21/walkthrough-a-pem-file-in-go
-func pemCertificateBlocks(PEMRest []byte) (blocks []*pem.Block) {
-	for {
-		block, rest := pem.Decode(PEMRest)
-		if block == nil {
+// Roles of certs in a bundle
+const (
+	RoleLeaf         = model.RoleLeaf
+	RoleIntermediate = model.RoleIntermediate
+	RoleRoot         = model.RoleRoot
+)
+
+var (
+	pemBegin = []byte("-----BEGIN ")
+	pemEnd   = []byte("-----END ")
+)
+
+// Block a PEM block in a file, or data outside of any block, and what became
+// of it
+type Block struct {
+	Line   int               // line the block or data starts on
+	Type   string            // PEM type such as CERTIFICATE, empty for data outside blocks
+	Status string            // BlockParsed, BlockSkipped or BlockInvalid
+	Reason string            // why the block was skipped or invalid
+	Cert   *x509.Certificate // the certificate if parsed
+}
+
+// lineAt the line number of an offset in input
+func lineAt(input []byte, offset int) int {
+	return bytes.Count(input[:offset], []byte("\n")) + 1
+}
+
+// pemType the type named in a BEGIN line, such as CERTIFICATE
+func pemType(begin []byte) string {
+	line := begin[len(pemBegin):]
+	if i := bytes.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	return string(bytes.TrimSuffix(bytes.TrimSpace(line), []byte("-----")))
+}
+
+// ReadBlocks read each PEM block in input, parsing certificates and noting
+// blocks that are skipped or can't be read, and any data outside of blocks, so
+// a file is only taken as good if all of it was
+func ReadBlocks(input []byte) (blocks []Block) {
+	for pos := 0; pos < len(input); {
+		i := bytes.Index(input[pos:], pemBegin)
+		stray := input[pos:]
+		if i >= 0 {
+			stray = input[pos : pos+i]
+		}
+		if trimmed := bytes.TrimLeft(stray, " \t\r\n"); len(bytes.TrimSpace(trimmed)) > 0 {
+			offset := pos + len(stray) - len(trimmed)
+			// Explanatory text is allowed outside of blocks, so isn't invalid
+			blocks = append(blocks, Block{Line: lineAt(input, offset), Status: BlockSkipped, Reason: "data outside of a PEM block"})
+		}
+		if i < 0 {
 			break
 		}
-		// Type is a simple extration of the word in a block after BEGIN
-		// e.g. -----BEGIN CERTIFICATE-----
-		if block.Type == `CERTIFICATE` {
+
+		// Each block is decoded on its own so a broken one can't hide the next
+		start := pos + i
+		block := Block{Line: lineAt(input, start), Type: pemType(input[start:])}
+		end := bytes.Index(input[start+len(pemBegin):], pemEnd)
+		if end < 0 {
+			block.Status, block.Reason = BlockInvalid, "no END line"
 			blocks = append(blocks, block)
-		}
-		if len(rest) == 0 {
 			break
 		}
-		PEMRest = rest
+		pos = start + len(pemBegin) + end
+		if eol := bytes.IndexByte(input[pos:], '\n'); eol >= 0 {
+			pos += eol + 1
+		} else {
+			pos = len(input)
+		}
+
+		decoded, _ := pem.Decode(input[start:pos])
+		switch {
+		case decoded == nil:
+			block.Status, block.Reason = BlockInvalid, "invalid PEM encoding"
+		case decoded.Type != "CERTIFICATE":
+			block.Status, block.Reason = BlockSkipped, "not a certificate"
+		default:
+			cert, err := x509.ParseCertificate(decoded.Bytes)
+			if err != nil {
+				block.Status, block.Reason = BlockInvalid, err.Error()
+			} else {
+				block.Status, block.Cert = BlockParsed, cert
+			}
+		}
+		blocks = append(blocks, block)
 	}
-	return blocks
+
+	return
 }
 
 // ReadCert read a PEM encoded X509 certificate file
 func ReadCert(input []byte) (cert *x509.Certificate, err error) {
-	blocks := pemCertificateBlocks(input)
+	cert, _, err = ReadCertBlocks(input)
 
-	// Bad input file
-	if len(blocks) == 0 {
-		err = errors.New("no pem blocks found")
-		return
+	return
+}
+
+// ReadCertBlocks read a PEM encoded X509 certificate file, returning the
+// server certificate along with what became of every block. Blocks that can't
+// be parsed are skipped, and an error is only returned if no certificate
+// could be.
+func ReadCertBlocks(input []byte) (cert *x509.Certificate, blocks []Block, err error) {
+	certs, blocks, err := ReadCerts(input)
+	for _, c := range certs {
+		// Server certificate should have 1 or more DNS names
+		if cert == nil || len(cert.DNSNames) == 0 {
+			cert = c
+		}
 	}
+
+	return
+}
+
+// ReadCerts read every certificate in a PEM encoded X509 certificate file, in
+// file order, such as a bundle of a leaf and its intermediates and root, along
+// with what became of every block. Blocks that can't be parsed are skipped,
+// and an error is only returned if no certificate could be.
+func ReadCerts(input []byte) (certs []*x509.Certificate, blocks []Block, err error) {
+	blocks = ReadBlocks(input)
+
+	var reason string
 	for _, block := range blocks {
-		cert, err = x509.ParseCertificate(block.Bytes)
-		if err != nil {
-			panic("failed to parse certificate: " + err.Error())
+		if block.Type == "CERTIFICATE" && reason == "" {
+			reason = block.Reason
 		}
-		// Server certificate should have 1 or more DNS names
-		// There may be > 1 of these in a PEM file but currently we are stopping
-		// at the first found
-		if len(cert.DNSNames) > 0 {
-			break
+		if block.Cert != nil {
+			certs = append(certs, block.Cert)
 		}
 	}
 
+	switch {
+	case len(certs) > 0:
+	case reason != "":
+		err = fmt.Errorf("failed to parse certificate: %v", reason)
+	default:
+		// Bad input file
+		err = errors.New("no pem blocks found")
+	}
+
 	return
 }
+
+// Role the role of a cert in a bundle, RoleRoot for a self-signed CA,
+// RoleIntermediate for another CA and RoleLeaf for anything else. The
+// signature is checked directly as CheckSignatureFrom rejects the SHA-1
+// signatures of older roots.
+func Role(cert *x509.Certificate) string {
+	switch {
+	case !cert.IsCA:
+		return RoleLeaf
+	case bytes.Equal(cert.RawIssuer, cert.RawSubject) &&
+		cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil:
+		return RoleRoot
+	}
+
+	return RoleIntermediate
+}
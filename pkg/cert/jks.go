@@ -0,0 +1,174 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Magic numbers that start Java keystore files
+const (
+	jksMagic   = 0xfeedfeed // JKS, the format of older Java cacerts files
+	jceksMagic = 0xcececece // JCEKS, which adds secret key entries
+)
+
+// Tags of Java keystore entries
+const (
+	jksPrivateKey  = 1
+	jksTrustedCert = 2
+	jksSecretKey   = 3
+)
+
+// jksWhitener text hashed after the password in a Java keystore digest
+const jksWhitener = "Mighty Aphrodite"
+
+// ErrJKSPassword the password given doesn't match a Java keystore's digest
+var ErrJKSPassword = errors.New("incorrect Java keystore password")
+
+// JKSEntry the certificates of an entry in a Java keystore, one for a trusted
+// cert or the chain of a private key
+type JKSEntry struct {
+	Alias string
+	Certs []*x509.Certificate
+}
+
+// IsJKS whether input looks like a JKS or JCEKS Java keystore, such as a
+// cacerts file
+func IsJKS(input []byte) bool {
+	if len(input) < 8 {
+		return false
+	}
+	magic := binary.BigEndian.Uint32(input)
+
+	return magic == jksMagic || magic == jceksMagic
+}
+
+// jksReader reads the big endian values of a Java keystore, keeping the first
+// error
+type jksReader struct {
+	data []byte
+	err  error
+}
+
+func (r *jksReader) next(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if size < 0 || size > len(r.data) {
+		r.err = errors.New("invalid Java keystore: truncated")
+		return nil
+	}
+	b := r.data[:size]
+	r.data = r.data[size:]
+
+	return b
+}
+
+func (r *jksReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+
+	return 0
+}
+
+// utf a string written by Java's DataOutput.writeUTF
+func (r *jksReader) utf() string {
+	if b := r.next(2); b != nil {
+		return string(r.next(int(binary.BigEndian.Uint16(b))))
+	}
+
+	return ""
+}
+
+// cert a certificate written with its type in version 2 keystores
+func (r *jksReader) cert(version uint32) (*x509.Certificate, error) {
+	if version == 2 {
+		if certType := r.utf(); r.err == nil && certType != "X.509" {
+			return nil, fmt.Errorf("unsupported certificate type %s", certType)
+		}
+	}
+	der := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil, r.err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	return cert, nil
+}
+
+// ReadJKS read the certificates of every entry in a JKS or JCEKS Java
+// keystore, in file order. Private keys are skipped as only certificates are
+// needed. The digest at the end of the file is checked only if a password is
+// given, as keytool does when listing.
+func ReadJKS(input []byte, password string) (entries []JKSEntry, err error) {
+	if !IsJKS(input) || len(input) < sha1.Size {
+		return nil, errors.New("not a Java keystore")
+	}
+	body := input[:len(input)-sha1.Size]
+	if password != "" {
+		digest := sha1.New()
+		for _, c := range utf16.Encode([]rune(password)) {
+			digest.Write([]byte{byte(c >> 8), byte(c)})
+		}
+		digest.Write([]byte(jksWhitener))
+		digest.Write(body)
+		if !bytes.Equal(digest.Sum(nil), input[len(body):]) {
+			return nil, ErrJKSPassword
+		}
+	}
+
+	r := &jksReader{data: body[4:]}
+	version := r.uint32()
+	if r.err == nil && version != 1 && version != 2 {
+		return nil, fmt.Errorf("unsupported Java keystore version %d", version)
+	}
+	count := r.uint32()
+	for i := uint32(0); i < count && r.err == nil; i++ {
+		tag := r.uint32()
+		entry := JKSEntry{Alias: r.utf()}
+		r.next(8) // creation time
+		switch tag {
+		case jksTrustedCert:
+			var cert *x509.Certificate
+			if cert, err = r.cert(version); err != nil {
+				return nil, err
+			}
+			entry.Certs = []*x509.Certificate{cert}
+		case jksPrivateKey:
+			r.next(int(r.uint32())) // encrypted key
+			chain := r.uint32()
+			for j := uint32(0); j < chain && r.err == nil; j++ {
+				var cert *x509.Certificate
+				if cert, err = r.cert(version); err != nil {
+					return nil, err
+				}
+				entry.Certs = append(entry.Certs, cert)
+			}
+		case jksSecretKey:
+			return nil, fmt.Errorf("secret key entry %s is not supported", entry.Alias)
+		default:
+			if r.err == nil {
+				return nil, fmt.Errorf("invalid Java keystore: unknown entry type %d", tag)
+			}
+		}
+		if r.err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no certificates in Java keystore")
+	}
+
+	return entries, nil
+}
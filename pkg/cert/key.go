@@ -0,0 +1,215 @@
+package cert
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// PBES2 object identifiers, for PKCS#8 keys as OpenSSL encrypts them
+var (
+	oidPBES2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidDESEDE3CBC   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidHMACWithSHA1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+)
+
+// prfs PBKDF2 pseudorandom functions by HMAC OID
+var prfs = map[string]func() hash.Hash{
+	oidHMACWithSHA1.String(): sha1.New,
+	"1.2.840.113549.2.9":     sha256.New,
+	"1.2.840.113549.2.10":    sha512.New384,
+	"1.2.840.113549.2.11":    sha512.New,
+}
+
+// ErrKeyPassword a private key is encrypted and the password is missing or
+// wrong
+var ErrKeyPassword = errors.New("private key is encrypted, wrong or missing password")
+
+// encryptedPrivateKeyInfo a PKCS#8 encrypted private key
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPBES2 decrypt a PKCS#8 key encrypted with PBKDF2 and AES or triple
+// DES in CBC mode
+func decryptPBES2(algorithm pkix.AlgorithmIdentifier, password string, data []byte) ([]byte, error) {
+	if !algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported encryption %v", algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation %v", params.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+	prf := sha1.New
+	if len(kdf.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = prfs[kdf.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("unsupported PRF %v", kdf.PRF.Algorithm)
+		}
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	scheme := params.EncryptionScheme.Algorithm
+	var keySize int
+	switch {
+	case scheme.Equal(oidAES128CBC):
+		keySize = 16
+	case scheme.Equal(oidAES192CBC), scheme.Equal(oidDESEDE3CBC):
+		keySize = 24
+	case scheme.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, fmt.Errorf("unsupported encryption %v", scheme)
+	}
+	key, err := pbkdf2.Key(prf, password, kdf.Salt, kdf.Iterations, keySize)
+	if err != nil {
+		return nil, err
+	}
+	var block cipher.Block
+	if scheme.Equal(oidDESEDE3CBC) {
+		block, err = des.NewTripleDESCipher(key)
+	} else {
+		block, err = aes.NewCipher(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	if len(data) == 0 || len(data)%size != 0 || len(iv) != size {
+		return nil, errors.New("invalid encrypted data length")
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+	padding := int(plain[len(plain)-1])
+	if padding == 0 || padding > size {
+		return nil, ErrKeyPassword
+	}
+	for _, b := range plain[len(plain)-padding:] {
+		if int(b) != padding {
+			return nil, ErrKeyPassword
+		}
+	}
+
+	return plain[:len(plain)-padding], nil
+}
+
+// parsePrivateKey parse a DER private key in PKCS#8, PKCS#1 or SEC 1 form
+func parsePrivateKey(der []byte) (key crypto.Signer, err error) {
+	if parsed, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if signer, ok := parsed.(crypto.Signer); ok {
+			return signer, nil
+		}
+		return nil, errors.New("unsupported private key type")
+	}
+	if rsaKey, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return rsaKey, nil
+	}
+	if ecKey, err := x509.ParseECPrivateKey(der); err == nil {
+		return ecKey, nil
+	}
+
+	return nil, errors.New("invalid private key")
+}
+
+// ReadPrivateKey get the public key of the first private key in PEM or DER
+// input. Keys encrypted as PKCS#8 with PBES2, as OpenSSL writes them, or with
+// OpenSSL's legacy PEM encryption are opened with password. The legacy form
+// is read only so keys already deployed that way can be matched to their
+// certs; it can't be relied on to detect a wrong password, which then gives an
+// invalid key error or at worst a public key matching no cert.
+func ReadPrivateKey(input []byte, password string) (public crypto.PublicKey, err error) {
+	var key crypto.Signer
+	rest := input
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			continue
+		}
+		der := block.Bytes
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			var info encryptedPrivateKeyInfo
+			if _, err = asn1.Unmarshal(der, &info); err != nil {
+				return nil, fmt.Errorf("invalid encrypted private key: %v", err)
+			}
+			if der, err = decryptPBES2(info.Algorithm, password, info.EncryptedData); err != nil {
+				return nil, ErrKeyPassword
+			}
+		case x509.IsEncryptedPEMBlock(block):
+			// Legacy Proc-Type (RFC 1423) encryption, still written by some
+			// tools. The x509 functions for it are deprecated as the format
+			// has no integrity check, but reading existing keys to get their
+			// public key only needs decryption, and nothing is written in it.
+			if der, err = x509.DecryptPEMBlock(block, []byte(password)); err != nil {
+				return nil, ErrKeyPassword
+			}
+		}
+		if key, err = parsePrivateKey(der); err != nil {
+			// Decryption with a wrong password can leave valid padding
+			if block.Type == "ENCRYPTED PRIVATE KEY" || block.Headers["Proc-Type"] != "" {
+				return nil, ErrKeyPassword
+			}
+			return nil, err
+		}
+		return key.Public(), nil
+	}
+
+	if key, err = parsePrivateKey(input); err != nil {
+		return nil, errors.New("no private key found")
+	}
+
+	return key.Public(), nil
+}
+
+// KeyMatches whether a public key is the one in a certificate, comparing the
+// RSA modulus and exponent, the EC point or the Ed25519 key
+func KeyMatches(cert *x509.Certificate, public crypto.PublicKey) bool {
+	key, ok := public.(interface{ Equal(crypto.PublicKey) bool })
+
+	return ok && key.Equal(cert.PublicKey)
+}
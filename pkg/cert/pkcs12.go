@@ -0,0 +1,54 @@
+package cert
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// oidData the PKCS#7 data content type of a password protected PKCS#12 file
+var oidData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+
+// ErrPKCS12Password the password given doesn't open a PKCS#12 file
+var ErrPKCS12Password = errors.New("incorrect PKCS#12 password")
+
+type pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+// IsPKCS12 whether input looks like a PKCS#12 file rather than PEM
+func IsPKCS12(input []byte) bool {
+	var p pfx
+	rest, err := asn1.Unmarshal(input, &p)
+
+	return err == nil && len(rest) == 0 && p.Version == 3 && p.AuthSafe.ContentType.Equal(oidData)
+}
+
+// ReadPKCS12 read every certificate in a PKCS#12 (.p12 or .pfx) file, the
+// leaf and CA certs of a bundle with a private key or the certs of a Java
+// trust store. The key is decrypted to find its cert but not returned.
+func ReadPKCS12(input []byte, password string) (certs []*x509.Certificate, err error) {
+	_, leaf, caCerts, err := pkcs12.DecodeChain(input, password)
+	if err == nil {
+		return append([]*x509.Certificate{leaf}, caCerts...), nil
+	}
+	if errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		return nil, ErrPKCS12Password
+	}
+	// A trust store has certs and no key
+	if certs, trustErr := pkcs12.DecodeTrustStore(input, password); trustErr == nil && len(certs) > 0 {
+		return certs, nil
+	}
+
+	return nil, fmt.Errorf("invalid PKCS#12 file: %v", err)
+}
@@ -0,0 +1,143 @@
+// Package clock measures how far the local clock is from a time source. A
+// skewed clock makes every expiry calculation wrong, so a scan is only as good
+// as the clock of the machine running it.
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultSource source used if none is given
+	DefaultSource  = "pool.ntp.org"
+	ntpDefaultPort = "123"
+	ntpPacketSize  = 48
+)
+
+// Clock tell the time expiry is calculated at, so it can be evaluated at any
+// time rather than only now
+type Clock interface {
+	Now() time.Time
+}
+
+// System the clock of the machine running the scan
+var System Clock = systemClock{}
+
+type systemClock struct{}
+
+// Now implement Clock with the local time
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Fixed a clock stopped at a time, to see what will have expired by then or
+// to get the same results each run
+type Fixed time.Time
+
+// Now implement Clock with the fixed time
+func (fixed Fixed) Now() time.Time {
+	return time.Time(fixed)
+}
+
+// ntpEpochOffset seconds from the NTP epoch in 1900 to the Unix epoch
+const ntpEpochOffset = 2208988800
+
+// Skew get how far the local clock is ahead of a source, negative if it is
+// behind. The source is an NTP server such as pool.ntp.org or time.google.com:123,
+// or an http or https URL whose Date header is used, for networks that block
+// NTP. Date headers only have second resolution.
+func Skew(ctx context.Context, source string, timeout time.Duration) (skew time.Duration, err error) {
+	if source == "" {
+		source = DefaultSource
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		return httpSkew(ctx, source)
+	}
+
+	return ntpSkew(ctx, source)
+}
+
+// ntpTime convert a 64 bit NTP timestamp
+func ntpTime(b []byte) time.Time {
+	seconds := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	fraction := int64(binary.BigEndian.Uint32(b[4:8]))
+
+	return time.Unix(seconds, fraction*int64(time.Second)>>32)
+}
+
+// ntpSkew get the clock offset from an NTP server with a single SNTP request
+func ntpSkew(ctx context.Context, server string) (skew time.Duration, err error) {
+	if _, _, splitErr := net.SplitHostPort(server); splitErr != nil {
+		server = net.JoinHostPort(server, ntpDefaultPort)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	request := make([]byte, ntpPacketSize)
+	request[0] = 0x23 // version 4, client mode
+	sent := time.Now()
+	if _, err = conn.Write(request); err != nil {
+		return
+	}
+	response := make([]byte, ntpPacketSize)
+	n, err := conn.Read(response)
+	received := time.Now()
+	if err != nil {
+		return
+	}
+	if n < ntpPacketSize || response[0]&0x07 != 4 {
+		return 0, errors.New("invalid NTP response")
+	}
+	if response[1] == 0 {
+		return 0, errors.New("NTP server is not synchronized")
+	}
+
+	// Offset of the server from the local clock, with network delay removed
+	serverReceived := ntpTime(response[32:40])
+	serverSent := ntpTime(response[40:48])
+	offset := (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+
+	return -offset, nil
+}
+
+// httpSkew get the clock offset from the Date header of a HEAD request,
+// comparing it with the middle of the request
+func httpSkew(ctx context.Context, url string) (skew time.Duration, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return
+	}
+	sent := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	response.Body.Close()
+	received := time.Now()
+
+	date, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		return 0, fmt.Errorf("no usable Date header from %s", url)
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+
+	// The header is truncated to the second so allow for the lost fraction
+	return local.Sub(date.Add(time.Second / 2)).Round(time.Second), nil
+}
@@ -0,0 +1,73 @@
+package clock
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// putNTPTime write a time as a 64 bit NTP timestamp
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:8], uint32((int64(t.Nanosecond())<<32)/int64(time.Second)))
+}
+
+func TestNTPSkew(t *testing.T) {
+	is := is.New(t)
+
+	// A server whose clock is an hour behind
+	packetConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	is.NoErr(err)
+	defer packetConn.Close()
+	go func() {
+		buf := make([]byte, ntpPacketSize)
+		for {
+			_, addr, err := packetConn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			response := make([]byte, ntpPacketSize)
+			response[0] = 0x24 // version 4, server mode
+			response[1] = 2
+			now := time.Now().Add(-time.Hour)
+			putNTPTime(response[32:40], now)
+			putNTPTime(response[40:48], now)
+			packetConn.WriteTo(response, addr)
+		}
+	}()
+
+	skew, err := Skew(context.Background(), packetConn.LocalAddr().String(), 2*time.Second)
+	is.NoErr(err)
+	is.True(skew > time.Hour-time.Second && skew < time.Hour+time.Second)
+}
+
+func TestHTTPSkew(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(10*time.Minute).UTC().Format(http.TimeFormat))
+	}))
+	defer server.Close()
+
+	skew, err := Skew(context.Background(), server.URL, 2*time.Second)
+	is.NoErr(err)
+	is.True(skew <= -10*time.Minute+time.Second && skew >= -10*time.Minute-2*time.Second)
+
+	_, err = Skew(context.Background(), "http://127.0.0.1:1", time.Second)
+	is.True(err != nil)
+}
+
+func TestFixed(t *testing.T) {
+	is := is.New(t)
+
+	at := time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)
+	var c Clock = Fixed(at)
+	is.True(c.Now().Equal(at))
+	is.True(!System.Now().Before(at))
+}
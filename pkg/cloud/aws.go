@@ -0,0 +1,230 @@
+package cloud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/acm"
+	acmtypes "github.com/aws/aws-sdk-go-v2/service/acm/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// iamRegion IAM is global and signed for this region
+const iamRegion = "us-east-1"
+
+// AWS the SDK configuration AWS API requests are made with
+type AWS struct {
+	Config   awssdk.Config
+	Region   string // region of the profile, environment or instance
+	Timeout  time.Duration
+	Endpoint string      // URL to send every request to instead of AWS, for testing
+	Clock    clock.Clock // time to calculate expiry at, clock.System if nil
+}
+
+// NewAWS load the AWS SDK's default configuration, with credentials found as
+// the AWS CLI finds them: keys in the environment, web identity tokens, SSO,
+// roles assumed from a profile, credential processes, container credentials
+// and the EC2 instance profile. A profile given is used as --profile is for
+// the CLI, otherwise AWS_PROFILE or default. The region is that of the
+// environment, the profile or else the instance. Credentials are retrieved
+// here so that a missing or broken setup is an error before any listing.
+func NewAWS(profile string, timeout time.Duration) (*AWS, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	options := []func(*config.LoadOptions) error{config.WithEC2IMDSRegion()}
+	if profile != "" {
+		options = append(options, config.WithSharedConfigProfile(profile))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("aws: %v", err)
+	}
+	if _, err = cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("aws: no credentials: %v", err)
+	}
+
+	return &AWS{Config: cfg, Region: cfg.Region, Timeout: timeout}, nil
+}
+
+// acmClient make an ACM client for a region
+func (aws *AWS) acmClient(region string) *acm.Client {
+	return acm.NewFromConfig(aws.Config, func(options *acm.Options) {
+		options.Region = region
+		if aws.Endpoint != "" {
+			options.BaseEndpoint = &aws.Endpoint
+		}
+	})
+}
+
+// iamClient make an IAM client
+func (aws *AWS) iamClient() *iam.Client {
+	return iam.NewFromConfig(aws.Config, func(options *iam.Options) {
+		options.Region = iamRegion
+		if aws.Endpoint != "" {
+			options.BaseEndpoint = &aws.Endpoint
+		}
+	})
+}
+
+// acmStatusErrors ACM statuses of certs that will never be usable
+var acmStatusErrors = map[acmtypes.CertificateStatus]bool{
+	acmtypes.CertificateStatusRevoked:            true,
+	acmtypes.CertificateStatusFailed:             true,
+	acmtypes.CertificateStatusValidationTimedOut: true,
+}
+
+// acmKeyStrength the key type and size of an ACM key algorithm such as
+// RSA_2048 or EC_prime256v1
+func acmKeyStrength(algorithm acmtypes.KeyAlgorithm) (keyType string, keyBits int) {
+	kind, size, _ := strings.Cut(string(algorithm), "_")
+	switch kind {
+	case "RSA":
+		keyBits, _ = strconv.Atoi(size)
+		return "RSA", keyBits
+	case "EC":
+		switch size {
+		case "prime256v1":
+			return "ECDSA", 256
+		case "secp384r1":
+			return "ECDSA", 384
+		case "secp521r1":
+			return "ECDSA", 521
+		}
+	}
+
+	return string(algorithm), 0
+}
+
+// acmCertData convert ACM certificate summaries to cert data
+func acmCertData(summaries []acmtypes.CertificateSummary, warnAtDays int, now time.Time) (certDataList []model.CertData) {
+	for _, item := range summaries {
+		certData := model.CertData{}
+		certData.Host = strings.Join(item.SubjectAlternativeNameSummaries, ", ")
+		if certData.Host == "" {
+			certData.Host = awssdk.ToString(item.DomainName)
+		}
+		certData.File = awssdk.ToString(item.CertificateArn)
+		certData.CheckTime = now.Format(model.TimeFormat)
+		certData.KeyType, certData.KeyBits = acmKeyStrength(item.KeyAlgorithm)
+		certData.WeakKey = certData.KeyType == "RSA" && certData.KeyBits > 0 && certData.KeyBits < 2048
+		certData.Renewal = model.RenewalManual
+		if item.RenewalEligibility == acmtypes.RenewalEligibilityEligible {
+			certData.Renewal = model.RenewalAuto
+		}
+		inUse := "not in use"
+		if awssdk.ToBool(item.InUse) {
+			inUse = "in use"
+		}
+
+		switch {
+		case acmStatusErrors[item.Status]:
+			certData.HostError = true
+			certData.Message = fmt.Sprintf("acm certificate %s", item.Status)
+		case item.NotAfter == nil:
+			// Requested certs have no dates until they are issued
+			certData.Message = fmt.Sprintf("acm certificate %s", item.Status)
+		default:
+			certData.Message = fmt.Sprintf("OK acm %s %s, %s", item.Type, item.Status, inUse)
+			certData.SetExpiry(awssdk.ToTime(item.NotBefore), awssdk.ToTime(item.NotAfter), warnAtDays, now)
+		}
+		certDataList = append(certDataList, certData)
+	}
+
+	return
+}
+
+// ACM list the certificates in AWS Certificate Manager in a region, with
+// Renewal set to auto for those ACM will renew itself, File set to the
+// certificate ARN and Host to its names. Revoked certs and those that failed
+// to be issued are errors, as is a listing that fails.
+func (aws *AWS) ACM(region string, warnAtDays int) *model.CertDataSet {
+	tRun := time.Now()
+	now := clockNow(aws.Clock)
+	name := "acm " + region
+	if region == "" {
+		return hostError("acm", errors.New("no AWS region given or configured"), warnAtDays, tRun)
+	}
+
+	// ACM lists only RSA 1024 and 2048 bit certs unless asked for others
+	input := &acm.ListCertificatesInput{
+		MaxItems: awssdk.Int32(1000),
+		Includes: &acmtypes.Filters{KeyTypes: acmtypes.KeyAlgorithm("").Values()},
+	}
+	paginator := acm.NewListCertificatesPaginator(aws.acmClient(region), input)
+	var certDataList []model.CertData
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(context.Background(), aws.Timeout)
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return hostError(name, err, warnAtDays, tRun)
+		}
+		certDataList = append(certDataList, acmCertData(page.CertificateSummaryList, warnAtDays, now)...)
+	}
+
+	fetchTime := time.Since(tRun).Round(time.Millisecond).String()
+	for i := range certDataList {
+		certDataList[i].FetchTime = fetchTime
+	}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(certDataList...)
+
+	return certDataSet
+}
+
+// iamCertData convert IAM server certificate metadata to cert data
+func iamCertData(certificates []iamtypes.ServerCertificateMetadata, warnAtDays int, now time.Time) (certDataList []model.CertData) {
+	for _, item := range certificates {
+		certData := model.CertData{}
+		certData.Host = awssdk.ToString(item.ServerCertificateName)
+		certData.File = awssdk.ToString(item.Arn)
+		certData.CheckTime = now.Format(model.TimeFormat)
+		// IAM only stores certs, so someone has to upload a new one
+		certData.Renewal = model.RenewalManual
+		certData.Message = "OK iam server certificate " + awssdk.ToString(item.Path) + certData.Host
+		certData.SetExpiry(time.Time{}, awssdk.ToTime(item.Expiration), warnAtDays, now)
+		certDataList = append(certDataList, certData)
+	}
+
+	return
+}
+
+// IAM list the server certificates uploaded to IAM, as used by older load
+// balancers and CloudFront distributions, with File set to the certificate
+// ARN and Host to its name. Their renewal is always manual.
+func (aws *AWS) IAM(warnAtDays int) *model.CertDataSet {
+	tRun := time.Now()
+	now := clockNow(aws.Clock)
+
+	paginator := iam.NewListServerCertificatesPaginator(aws.iamClient(), &iam.ListServerCertificatesInput{})
+	var certDataList []model.CertData
+	for paginator.HasMorePages() {
+		ctx, cancel := context.WithTimeout(context.Background(), aws.Timeout)
+		page, err := paginator.NextPage(ctx)
+		cancel()
+		if err != nil {
+			return hostError("iam", err, warnAtDays, tRun)
+		}
+		certDataList = append(certDataList, iamCertData(page.ServerCertificateMetadataList, warnAtDays, now)...)
+	}
+
+	fetchTime := time.Since(tRun).Round(time.Millisecond).String()
+	for i := range certDataList {
+		certDataList[i].FetchTime = fetchTime
+	}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(certDataList...)
+
+	return certDataSet
+}
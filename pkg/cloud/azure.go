@@ -0,0 +1,381 @@
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// azCommand Azure CLI used for a token when no service principal is set in
+// the environment, so that az login applies
+var azCommand = "az"
+
+const (
+	keyVaultResource   = "https://vault.azure.net"
+	keyVaultAPIVersion = "7.4"
+	defaultAuthority   = "https://login.microsoftonline.com"
+	// clientAssertionType how a federated token is given in place of a secret
+	clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+	// azureIMDSEndpoint Azure instance metadata service
+	azureIMDSEndpoint   = "http://169.254.169.254"
+	azureIMDSAPIVersion = "2018-02-01"
+	// appServiceAPIVersion version of the identity endpoint App Service and
+	// Container Apps give apps
+	appServiceAPIVersion = "2019-08-01"
+)
+
+// Azure a bearer token for Azure Key Vault requests
+type Azure struct {
+	Token   string
+	Timeout time.Duration
+	Clock   clock.Clock // time to calculate expiry at, clock.System if nil
+}
+
+// NewAzure get a Key Vault token as the Azure SDKs' default credential does:
+// for the service principal set in AZURE_TENANT_ID, AZURE_CLIENT_ID and
+// AZURE_CLIENT_SECRET, then for the app of a workload identity, proving itself
+// with the token in AZURE_FEDERATED_TOKEN_FILE as AKS sets it, then for the
+// managed identity of the VM, node or App Service app, AZURE_CLIENT_ID choosing
+// a user assigned one, and last from the Azure CLI for the account signed in
+// with az login. AZURE_AUTHORITY_HOST replaces the public cloud's sign in
+// endpoint. Certificate credentials are not supported.
+func NewAzure(timeout time.Duration) (azure *Azure, err error) {
+	azure = &Azure{Timeout: timeout}
+	tenant, clientID := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID")
+	secret, tokenFile := os.Getenv("AZURE_CLIENT_SECRET"), os.Getenv("AZURE_FEDERATED_TOKEN_FILE")
+	switch {
+	case tenant != "" && clientID != "" && secret != "":
+		form := url.Values{"client_id": {clientID}, "client_secret": {secret}}
+		if azure.Token, err = signIn(tenant, form, timeout); err != nil {
+			return nil, err
+		}
+	case tenant != "" && clientID != "" && tokenFile != "":
+		assertion, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("federated token: %v", err)
+		}
+		form := url.Values{
+			"client_id":             {clientID},
+			"client_assertion_type": {clientAssertionType},
+			"client_assertion":      {strings.TrimSpace(string(assertion))},
+		}
+		if azure.Token, err = signIn(tenant, form, timeout); err != nil {
+			return nil, err
+		}
+	default:
+		var identityErr error
+		if azure.Token, identityErr = managedIdentityToken(clientID, timeout); identityErr != nil {
+			if azure.Token, err = azToken(timeout); err != nil {
+				return nil, fmt.Errorf("%v, and %v", err, identityErr)
+			}
+		}
+	}
+	if azure.Token == "" {
+		return nil, errors.New("no Azure Key Vault token was given")
+	}
+
+	return
+}
+
+// signIn get a Key Vault token from Microsoft Entra ID for an app, which
+// proves itself with a secret or federated token in form
+func signIn(tenant string, form url.Values, timeout time.Duration) (token string, err error) {
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = defaultAuthority
+	}
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", keyVaultResource+"/.default")
+	tokenURL := strings.TrimSuffix(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+	body, err := send(http.MethodPost, tokenURL, []byte(form.Encode()), timeout, func(request *http.Request) error {
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("azure sign in: %v", err)
+	}
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("azure sign in: %v", err)
+	}
+
+	return response.AccessToken, nil
+}
+
+// managedIdentityToken get a Key Vault token for a managed identity, the user
+// assigned one with clientID if it is set. App Service and Container Apps give
+// their identity endpoint and its secret header in IDENTITY_ENDPOINT and
+// IDENTITY_HEADER. VMs and nodes have the instance metadata service, whose
+// address AZURE_POD_IDENTITY_AUTHORITY_HOST replaces, as for the Azure SDKs.
+func managedIdentityToken(clientID string, timeout time.Duration) (token string, err error) {
+	if endpoint, header := os.Getenv("IDENTITY_ENDPOINT"), os.Getenv("IDENTITY_HEADER"); endpoint != "" && header != "" {
+		query := url.Values{"api-version": {appServiceAPIVersion}, "resource": {keyVaultResource}}
+		if clientID != "" {
+			query.Set("client_id", clientID)
+		}
+		return identityToken(endpoint+"?"+query.Encode(), timeout, func(request *http.Request) error {
+			request.Header.Set("X-IDENTITY-HEADER", header)
+			return nil
+		})
+	}
+
+	endpoint := os.Getenv("AZURE_POD_IDENTITY_AUTHORITY_HOST")
+	if endpoint == "" {
+		endpoint = azureIMDSEndpoint
+	}
+	query := url.Values{"api-version": {azureIMDSAPIVersion}, "resource": {keyVaultResource}}
+	if clientID != "" {
+		query.Set("client_id", clientID)
+	}
+	// Off Azure nothing answers, so don't wait long
+	if timeout > imdsTimeout {
+		timeout = imdsTimeout
+	}
+	tokenURL := strings.TrimSuffix(endpoint, "/") + "/metadata/identity/oauth2/token?" + query.Encode()
+
+	return identityToken(tokenURL, timeout, func(request *http.Request) error {
+		request.Header.Set("Metadata", "true")
+		return nil
+	})
+}
+
+// identityToken get a token from a managed identity endpoint
+func identityToken(tokenURL string, timeout time.Duration, setHeaders func(*http.Request) error) (token string, err error) {
+	body, err := send(http.MethodGet, tokenURL, nil, timeout, setHeaders)
+	if err != nil {
+		return "", fmt.Errorf("managed identity: %v", err)
+	}
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("managed identity: %v", err)
+	}
+
+	return response.AccessToken, nil
+}
+
+// azToken get a Key Vault token from the Azure CLI
+func azToken(timeout time.Duration) (token string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, azCommand, "account", "get-access-token", "--resource", keyVaultResource, "--output", "json")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("az: %s", message)
+		}
+		return "", fmt.Errorf("az: %w", err)
+	}
+	var response struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err = json.Unmarshal(output, &response); err != nil {
+		return "", fmt.Errorf("az: invalid token: %v", err)
+	}
+
+	return response.AccessToken, nil
+}
+
+// VaultURL the URL of a Key Vault given by name, as in myvault, or by URL
+func VaultURL(vault string) string {
+	if strings.Contains(vault, "://") {
+		return strings.TrimSuffix(vault, "/")
+	}
+
+	return "https://" + vault + ".vault.azure.net"
+}
+
+// get send an authorized GET request to Key Vault
+func (azure *Azure) get(requestURL string) ([]byte, error) {
+	return send(http.MethodGet, requestURL, nil, azure.Timeout, func(request *http.Request) error {
+		request.Header.Set("Authorization", "Bearer "+azure.Token)
+		return nil
+	})
+}
+
+// policyOf a function getting the policies of certs in a vault
+func (azure *Azure) policyOf(vaultURL string) func(name string) (*keyVaultPolicy, error) {
+	return func(name string) (*keyVaultPolicy, error) {
+		body, err := azure.get(vaultURL + "/certificates/" + url.PathEscape(name) + "/policy?api-version=" + keyVaultAPIVersion)
+		if err != nil {
+			return nil, err
+		}
+		policy := &keyVaultPolicy{}
+		if err = json.Unmarshal(body, policy); err != nil {
+			return nil, fmt.Errorf("invalid policy of %s: %v", name, err)
+		}
+		return policy, nil
+	}
+}
+
+// keyVaultAttributes the attributes of a Key Vault certificate, with dates in
+// seconds since the epoch
+type keyVaultAttributes struct {
+	Enabled   bool    `json:"enabled"`
+	NotBefore float64 `json:"nbf"`
+	Expires   float64 `json:"exp"`
+}
+
+// keyVaultListResponse a page of a Key Vault certificate listing
+type keyVaultListResponse struct {
+	Value []struct {
+		ID         string             `json:"id"`
+		Attributes keyVaultAttributes `json:"attributes"`
+	} `json:"value"`
+	NextLink string `json:"nextLink"`
+}
+
+// keyVaultPolicy the parts of a certificate policy that decide rotation
+type keyVaultPolicy struct {
+	LifetimeActions []struct {
+		Trigger struct {
+			LifetimePercentage int `json:"lifetime_percentage"`
+			DaysBeforeExpiry   int `json:"days_before_expiry"`
+		} `json:"trigger"`
+		Action struct {
+			ActionType string `json:"action_type"`
+		} `json:"action"`
+	} `json:"lifetime_actions"`
+}
+
+// rotation whether a policy has Key Vault renew its cert and when, as in
+// auto-renew 30 days before expiry
+func (policy *keyVaultPolicy) rotation() (renewal, description string) {
+	for _, action := range policy.LifetimeActions {
+		if !strings.EqualFold(action.Action.ActionType, "AutoRenew") {
+			continue
+		}
+		switch {
+		case action.Trigger.DaysBeforeExpiry > 0:
+			description = fmt.Sprintf("auto-renew %d days before expiry", action.Trigger.DaysBeforeExpiry)
+		case action.Trigger.LifetimePercentage > 0:
+			description = fmt.Sprintf("auto-renew at %d%% of lifetime", action.Trigger.LifetimePercentage)
+		default:
+			description = "auto-renew"
+		}
+		return model.RenewalAuto, description
+	}
+
+	return model.RenewalManual, "no auto-renew"
+}
+
+// keyVaultName the name of a Key Vault cert, the last part of its ID
+func keyVaultName(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// onVault whether a link is on the vault's scheme and host, as nextLink
+// comes from the response and the token is sent with it
+func onVault(link, vaultURL string) bool {
+	linkURL, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	base, err := url.Parse(vaultURL)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(linkURL.Scheme, base.Scheme) && strings.EqualFold(linkURL.Host, base.Host)
+}
+
+// parseKeyVault convert a page of a Key Vault listing to cert data, getting
+// each cert's policy by name as listings leave rotation out
+func parseKeyVault(
+	body []byte,
+	policyOf func(name string) (*keyVaultPolicy, error),
+	warnAtDays int,
+	now time.Time) (certDataList []model.CertData, nextLink string, err error) {
+	var response keyVaultListResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return
+	}
+
+	for _, item := range response.Value {
+		certData := model.CertData{}
+		certData.Host = keyVaultName(item.ID)
+		certData.File = item.ID
+		certData.CheckTime = now.Format(model.TimeFormat)
+		policy, err := policyOf(certData.Host)
+		if err != nil {
+			return nil, "", err
+		}
+		var rotation string
+		certData.Renewal, rotation = policy.rotation()
+		state := "enabled"
+		if !item.Attributes.Enabled {
+			state = "disabled"
+		}
+
+		if item.Attributes.Expires == 0 {
+			// Certs whose first version is pending have no dates
+			certData.Message = fmt.Sprintf("key vault certificate %s, %s, pending", state, rotation)
+		} else {
+			certData.Message = fmt.Sprintf("OK key vault certificate %s, %s", state, rotation)
+			var notBefore time.Time
+			if item.Attributes.NotBefore > 0 {
+				notBefore = epochTime(item.Attributes.NotBefore)
+			}
+			certData.SetExpiry(notBefore, epochTime(item.Attributes.Expires), warnAtDays, now)
+		}
+		certDataList = append(certDataList, certData)
+	}
+
+	return certDataList, response.NextLink, nil
+}
+
+// KeyVault list the certificates in a Key Vault, given by name or URL, with
+// Renewal set to auto for those whose policy has Key Vault renew them, File
+// set to the certificate ID and Host to its name. The token needs the list
+// and get certificate permissions. A listing that fails is an error.
+func (azure *Azure) KeyVault(vault string, warnAtDays int) *model.CertDataSet {
+	tRun := time.Now()
+	now := clockNow(azure.Clock)
+	vaultURL := VaultURL(vault)
+	name := "key vault " + vault
+
+	var certDataList []model.CertData
+	next := vaultURL + "/certificates?api-version=" + keyVaultAPIVersion
+	for next != "" {
+		body, err := azure.get(next)
+		if err != nil {
+			return hostError(name, err, warnAtDays, tRun)
+		}
+		var page []model.CertData
+		page, next, err = parseKeyVault(body, azure.policyOf(vaultURL), warnAtDays, now)
+		if err != nil {
+			return hostError(name, err, warnAtDays, tRun)
+		}
+		certDataList = append(certDataList, page...)
+		if next != "" && !onVault(next, vaultURL) {
+			return hostError(name, fmt.Errorf("next page %s is not on %s", next, vaultURL), warnAtDays, tRun)
+		}
+	}
+
+	fetchTime := time.Since(tRun).Round(time.Millisecond).String()
+	for i := range certDataList {
+		certDataList[i].FetchTime = fetchTime
+	}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(certDataList...)
+
+	return certDataSet
+}
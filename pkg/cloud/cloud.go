@@ -0,0 +1,98 @@
+// Package cloud lists certificates held by cloud certificate services through
+// their APIs, reporting their expiry and whether the service renews them. AWS
+// Certificate Manager, IAM server certificates and Azure Key Vault
+// certificates are supported.
+package cloud
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	// maxErrorBody most of an error response to include in an error
+	maxErrorBody = 512
+	// imdsTimeout longest wait for a cloud's instance metadata service, which
+	// answers at once on its VMs and not at all elsewhere
+	imdsTimeout = time.Second
+)
+
+// send do a request with headers set by the caller and return the body of a
+// 200 response. Other responses are errors quoting the start of the body, as
+// cloud APIs explain missing permissions there.
+func send(
+	method, url string,
+	body []byte,
+	timeout time.Duration,
+	setHeaders func(*http.Request) error) (responseBody []byte, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	if err = setHeaders(request); err != nil {
+		return
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	responseBody, err = io.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(string(responseBody))
+		if len(message) > maxErrorBody {
+			message = message[:maxErrorBody]
+		}
+		return nil, fmt.Errorf("%s returned %s: %s", request.URL.Host, response.Status, message)
+	}
+
+	return
+}
+
+// clockNow the time of a service's clock, which is clock.System if nil
+func clockNow(c clock.Clock) time.Time {
+	if c == nil {
+		return clock.System.Now()
+	}
+
+	return c.Now()
+}
+
+// epochTime a time in fractional seconds since the epoch, as cloud JSON APIs
+// give them
+func epochTime(seconds float64) time.Time {
+	whole, fraction := math.Modf(seconds)
+
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+}
+
+// hostError make a cert data set with a single error for a service
+func hostError(name string, err error, warnAtDays int, tRun time.Time) *model.CertDataSet {
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(model.CertData{
+		Host:       name,
+		HostError:  true,
+		Message:    err.Error(),
+		WarnAtDays: warnAtDays,
+		CheckTime:  tRun.Format(model.TimeFormat),
+		FetchTime:  time.Since(tRun).Round(time.Millisecond).String(),
+	})
+
+	return certDataSet
+}
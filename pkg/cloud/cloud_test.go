@@ -0,0 +1,538 @@
+package cloud
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	awssdk "github.com/aws/aws-sdk-go-v2/aws"
+	awscredentials "github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+const acmJSON = `{
+  "CertificateSummaryList": [
+    {
+      "CertificateArn": "arn:aws:acm:us-east-1:123456789012:certificate/1111",
+      "DomainName": "www.example.com",
+      "SubjectAlternativeNameSummaries": ["www.example.com", "example.com"],
+      "Type": "AMAZON_ISSUED",
+      "Status": "ISSUED",
+      "KeyAlgorithm": "EC_prime256v1",
+      "InUse": true,
+      "RenewalEligibility": "ELIGIBLE",
+      "NotBefore": 1735689600.0,
+      "NotAfter": 1767225600.0
+    },
+    {
+      "CertificateArn": "arn:aws:acm:us-east-1:123456789012:certificate/2222",
+      "DomainName": "legacy.example.com",
+      "Type": "IMPORTED",
+      "Status": "ISSUED",
+      "KeyAlgorithm": "RSA_1024",
+      "InUse": false,
+      "RenewalEligibility": "INELIGIBLE",
+      "NotBefore": 1704067200.0,
+      "NotAfter": 1751328000.0
+    },
+    {
+      "CertificateArn": "arn:aws:acm:us-east-1:123456789012:certificate/3333",
+      "DomainName": "new.example.com",
+      "Type": "AMAZON_ISSUED",
+      "Status": "PENDING_VALIDATION",
+      "KeyAlgorithm": "RSA_2048",
+      "RenewalEligibility": "INELIGIBLE"
+    },
+    {
+      "CertificateArn": "arn:aws:acm:us-east-1:123456789012:certificate/4444",
+      "DomainName": "old.example.com",
+      "Type": "AMAZON_ISSUED",
+      "Status": "VALIDATION_TIMED_OUT",
+      "KeyAlgorithm": "RSA_2048"
+    }
+  ]
+}`
+
+const iamXML = `<ListServerCertificatesResponse xmlns="https://iam.amazonaws.com/doc/2010-05-08/">
+  <ListServerCertificatesResult>
+    <IsTruncated>false</IsTruncated>
+    <ServerCertificateMetadataList>
+      <member>
+        <ServerCertificateId>ASCACKCEVSQ6C2EXAMPLE</ServerCertificateId>
+        <ServerCertificateName>ProdServerCert</ServerCertificateName>
+        <Path>/company/servercerts/</Path>
+        <Arn>arn:aws:iam::123456789012:server-certificate/company/servercerts/ProdServerCert</Arn>
+        <UploadDate>2025-01-08T01:02:03.004Z</UploadDate>
+        <Expiration>2025-07-08T01:02:03.004Z</Expiration>
+      </member>
+    </ServerCertificateMetadataList>
+  </ListServerCertificatesResult>
+</ListServerCertificatesResponse>`
+
+func TestAWS(t *testing.T) {
+	is := is.New(t)
+
+	// A stand-in API pages ACM listings and checks requests are signed
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"UnrecognizedClientException","message":"The security token included in the request is invalid."}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		switch r.Header.Get("X-Amz-Target") {
+		case "CertificateManager.ListCertificates":
+			w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+			if !strings.Contains(string(body), "EC_prime256v1") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			if !strings.Contains(string(body), "page2") {
+				w.Write([]byte(`{"CertificateSummaryList": [], "NextToken": "page2"}`))
+				return
+			}
+			w.Write([]byte(acmJSON))
+		case "":
+			if !strings.Contains(string(body), "Action=ListServerCertificates") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(iamXML))
+		}
+	}))
+	defer server.Close()
+
+	// Expiry is calculated at the clock given
+	credentials := awssdk.NewCredentialsCache(awscredentials.NewStaticCredentialsProvider("AKID", "secret", ""))
+	aws := &AWS{
+		Config:   awssdk.Config{Credentials: credentials, Retryer: func() awssdk.Retryer { return awssdk.NopRetryer{} }},
+		Timeout:  2 * time.Second,
+		Endpoint: server.URL,
+		Clock:    clock.Fixed(time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)),
+	}
+	certDataSet := aws.ACM("us-east-1", 30)
+	is.Equal(certDataSet.Total, 4)
+	is.Equal(certDataSet.HostErrors, 1)
+	byARN := make(map[string]model.CertData)
+	for _, certData := range certDataSet.CertData {
+		byARN[strings.TrimPrefix(certData.File, "arn:aws:acm:us-east-1:123456789012:certificate/")] = certData
+	}
+
+	issued := byARN["1111"]
+	is.Equal(issued.Host, "www.example.com, example.com")
+	is.Equal(issued.File, "arn:aws:acm:us-east-1:123456789012:certificate/1111")
+	is.Equal(issued.Renewal, model.RenewalAuto)
+	is.Equal(issued.KeyType, "ECDSA")
+	is.Equal(issued.KeyBits, 256)
+	is.Equal(issued.NotAfter, "2026-01-01T00:00:00Z")
+	is.True(!issued.ExpiryWarning)
+	is.Equal(issued.Message, "OK acm AMAZON_ISSUED ISSUED, in use")
+
+	imported := byARN["2222"]
+	is.Equal(imported.Renewal, model.RenewalManual)
+	is.True(imported.ExpiryWarning)
+	is.True(imported.WeakKey)
+
+	// Pending certs have no dates, and certs that failed are errors
+	is.True(!byARN["3333"].HostError)
+	is.Equal(byARN["3333"].NotAfter, "")
+	is.True(byARN["4444"].HostError)
+	is.Equal(byARN["4444"].Message, "acm certificate VALIDATION_TIMED_OUT")
+
+	certDataSet = aws.IAM(30)
+	is.Equal(certDataSet.Total, 1)
+	is.Equal(certDataSet.CertData[0].Host, "ProdServerCert")
+	is.Equal(certDataSet.CertData[0].Renewal, model.RenewalManual)
+	is.Equal(certDataSet.CertData[0].NotAfter, "2025-07-08T01:02:03Z")
+	is.True(certDataSet.CertData[0].ExpiryWarning)
+
+	// Errors quote the service's explanation
+	aws.Config.Credentials = awscredentials.NewStaticCredentialsProvider("WRONG", "secret", "")
+	certDataSet = aws.ACM("us-east-1", 30)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.True(strings.Contains(certDataSet.CertData[0].Message, "security token included in the request is invalid"))
+	is.Equal(aws.ACM("", 30).HostErrors, 1)
+}
+
+func TestNewAWS(t *testing.T) {
+	is := is.New(t)
+
+	// A stand-in STS gives credentials for web identity tokens and roles
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "text/xml")
+		switch {
+		case r.Form.Get("Action") == "AssumeRoleWithWebIdentity" && r.Form.Get("WebIdentityToken") == "jwt":
+			w.Write([]byte(`<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>
+<AccessKeyId>ASIAWEB</AccessKeyId><SecretAccessKey>four</SecretAccessKey><SessionToken>session</SessionToken>
+<Expiration>2030-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`))
+		case r.Form.Get("Action") == "AssumeRole" && strings.Contains(r.Header.Get("Authorization"), "Credential=AKIDPROD/"):
+			w.Write([]byte(`<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>ASIAROLE</AccessKeyId><SecretAccessKey>seven</SecretAccessKey><SessionToken>role</SessionToken>
+<Expiration>2030-01-01T00:00:00Z</Expiration></Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`))
+		}
+	}))
+	defer sts.Close()
+
+	dir := t.TempDir()
+	process := filepath.Join(dir, "process")
+	is.NoErr(os.WriteFile(process, []byte("#!/bin/sh\necho '{\"Version\": 1, \"AccessKeyId\": \"AKIDPROCESS\", \"SecretAccessKey\": \"eight\"}'\n"), 0o755))
+	credentials := filepath.Join(dir, "credentials")
+	is.NoErr(os.WriteFile(credentials, []byte("[default]\naws_access_key_id = AKIDDEFAULT\naws_secret_access_key = one\n\n"+
+		"[prod]\naws_access_key_id = AKIDPROD\naws_secret_access_key = two\naws_session_token = token\n"), 0o600))
+	config := filepath.Join(dir, "config")
+	is.NoErr(os.WriteFile(config, []byte("[default]\nregion = us-east-1\n[profile prod]\nregion = eu-west-1\n"+
+		"[profile deploy]\nrole_arn = arn:aws:iam::123456789012:role/certcheck\nsource_profile = prod\nregion = eu-west-1\n"+
+		"[profile process]\ncredential_process = "+process+"\nregion = eu-west-1\n"), 0o600))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+	t.Setenv("AWS_CONFIG_FILE", config)
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "")
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+
+	// The environment is used unless a profile is asked for
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "three")
+	aws, err := NewAWS("", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "AKIDENV")
+	is.Equal(aws.Region, "us-east-1")
+
+	aws, err = NewAWS("prod", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "AKIDPROD")
+	is.Equal(aws.Region, "eu-west-1")
+
+	_, err = NewAWS("missing", 2*time.Second)
+	is.True(err != nil)
+
+	// Profiles assuming a role and credential processes are used as by the CLI
+	aws, err = NewAWS("deploy", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "ASIAROLE")
+	aws, err = NewAWS("process", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "AKIDPROCESS")
+
+	// Keys in the environment override AWS_PROFILE, which sets the region
+	t.Setenv("AWS_PROFILE", "prod")
+	aws, err = NewAWS("", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "AKIDENV")
+	is.Equal(aws.Region, "eu-west-1")
+	t.Setenv("AWS_PROFILE", "")
+
+	// A service account token is exchanged for a role's credentials
+	tokenFile := filepath.Join(dir, "token")
+	is.NoErr(os.WriteFile(tokenFile, []byte("jwt"), 0o600))
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/certcheck")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	aws, err = NewAWS("", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "ASIAWEB")
+
+	// Without keys an instance uses its instance profile, with IMDSv2
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			w.Header().Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+			w.Write([]byte("imds-token"))
+			return
+		}
+		if r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			w.Write([]byte("web-role"))
+		case "/latest/meta-data/iam/security-credentials/web-role":
+			w.Write([]byte(`{"Code": "Success", "AccessKeyId": "ASIAEC2", "SecretAccessKey": "five", "Token": "instance",
+  "Expiration": "2030-01-01T00:00:00Z"}`))
+		case "/latest/dynamic/instance-identity/document":
+			w.Write([]byte(`{"region": "ap-southeast-2", "instanceId": "i-0123456789abcdef0"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer imds.Close()
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	aws, err = NewAWS("", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "ASIAEC2")
+	is.Equal(aws.Region, "ap-southeast-2")
+
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	_, err = NewAWS("", 2*time.Second)
+	is.True(err != nil)
+
+	// A container gets its task role's credentials from the agent
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "pod-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"AccessKeyId": "ASIAPOD", "SecretAccessKey": "six", "Token": "pod", "Expiration": "2030-01-01T00:00:00Z"}`))
+	}))
+	defer agent.Close()
+	authorizationFile := filepath.Join(dir, "authorization")
+	is.NoErr(os.WriteFile(authorizationFile, []byte("pod-token"), 0o600))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", agent.URL+"/v1/credentials")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", authorizationFile)
+	t.Setenv("AWS_REGION", "us-east-1")
+	aws, err = NewAWS("", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(awsKey(t, aws), "ASIAPOD")
+
+	// The token is not sent in the clear to other hosts
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", "http://credentials.example.com/v1/credentials")
+	_, err = NewAWS("", 2*time.Second)
+	is.True(err != nil)
+}
+
+// awsKey the access key ID of the credentials an AWS config gives
+func awsKey(t *testing.T, aws *AWS) string {
+	t.Helper()
+	credentials, err := aws.Config.Credentials.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return credentials.AccessKeyID
+}
+
+const keyVaultJSON = `{
+  "value": [
+    {
+      "id": "https://myvault.vault.azure.net/certificates/web-tls",
+      "attributes": {"enabled": true, "nbf": 1735689600, "exp": 1767225600}
+    },
+    {
+      "id": "https://myvault.vault.azure.net/certificates/legacy",
+      "attributes": {"enabled": false, "nbf": 1704067200, "exp": 1751328000}
+    },
+    {
+      "id": "https://myvault.vault.azure.net/certificates/new",
+      "attributes": {"enabled": true}
+    }
+  ],
+  "nextLink": null
+}`
+
+const autoRenewPolicy = `{"issuer": {"name": "Self"}, "lifetime_actions": [
+  {"trigger": {"days_before_expiry": 30}, "action": {"action_type": "AutoRenew"}}]}`
+
+const emailPolicy = `{"issuer": {"name": "Unknown"}, "lifetime_actions": [
+  {"trigger": {"lifetime_percentage": 80}, "action": {"action_type": "EmailContacts"}}]}`
+
+func TestParseKeyVault(t *testing.T) {
+	is := is.New(t)
+
+	policyOf := func(name string) (*keyVaultPolicy, error) {
+		policy := &keyVaultPolicy{}
+		text := emailPolicy
+		if name == "web-tls" {
+			text = autoRenewPolicy
+		}
+		return policy, json.Unmarshal([]byte(text), policy)
+	}
+	now := time.Date(2025, time.June, 15, 0, 0, 0, 0, time.UTC)
+	certDataList, nextLink, err := parseKeyVault([]byte(keyVaultJSON), policyOf, 30, now)
+	is.NoErr(err)
+	is.Equal(nextLink, "")
+	is.Equal(len(certDataList), 3)
+
+	web := certDataList[0]
+	is.Equal(web.Host, "web-tls")
+	is.Equal(web.File, "https://myvault.vault.azure.net/certificates/web-tls")
+	is.Equal(web.Renewal, model.RenewalAuto)
+	is.Equal(web.NotAfter, "2026-01-01T00:00:00Z")
+	is.True(!web.ExpiryWarning)
+	is.Equal(web.Message, "OK key vault certificate enabled, auto-renew 30 days before expiry")
+
+	legacy := certDataList[1]
+	is.Equal(legacy.Renewal, model.RenewalManual)
+	is.True(legacy.ExpiryWarning)
+	is.Equal(legacy.Message, "OK key vault certificate disabled, no auto-renew")
+
+	// Pending certs have no dates
+	is.Equal(certDataList[2].NotAfter, "")
+	is.True(!certDataList[2].HostError)
+}
+
+func TestKeyVault(t *testing.T) {
+	is := is.New(t)
+
+	// A stand-in vault pages its listing and checks the token
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"code":"Unauthorized","message":"AKV10000: Request is missing a Bearer or PoP token."}}`))
+			return
+		}
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/policy"):
+			w.Write([]byte(autoRenewPolicy))
+		case r.URL.Query().Get("page") == "2":
+			w.Write([]byte(strings.Replace(keyVaultJSON, "myvault.vault.azure.net", "127.0.0.1", -1)))
+		default:
+			w.Write([]byte(`{"value": [], "nextLink": "` + server.URL + `/certificates?api-version=7.4&page=2"}`))
+		}
+	}))
+	defer server.Close()
+
+	azure := &Azure{Token: "token", Timeout: 2 * time.Second}
+	certDataSet := azure.KeyVault(server.URL+"/", 30)
+	is.Equal(certDataSet.Total, 3)
+	is.Equal(certDataSet.HostErrors, 0)
+	is.Equal(certDataSet.CertData[0].Renewal, model.RenewalAuto)
+
+	// A fixed clock calculates expiry at that time
+	azure.Clock = clock.Fixed(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC))
+	certDataSet = azure.KeyVault(server.URL, 30)
+	is.Equal(certDataSet.ExpiredWarnings, 0)
+	is.Equal(certDataSet.CertData[0].CheckTime, "2000-01-01T00:00:00Z")
+
+	// Errors quote the service's explanation
+	azure.Token = "wrong"
+	certDataSet = azure.KeyVault(server.URL, 30)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.True(strings.Contains(certDataSet.CertData[0].Message, "missing a Bearer or PoP token"))
+
+	// The token isn't sent to a next page on another host
+	var requests int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"value": []}`))
+	}))
+	defer other.Close()
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"value": [], "nextLink": "` + other.URL + `/certificates?api-version=7.4&page=2"}`))
+	}))
+	defer vault.Close()
+	certDataSet = azure.KeyVault(vault.URL, 30)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.True(strings.Contains(certDataSet.CertData[0].Message, "is not on"))
+	is.Equal(requests, 0)
+
+	is.Equal(VaultURL("myvault"), "https://myvault.vault.azure.net")
+}
+
+func TestNewAzure(t *testing.T) {
+	is := is.New(t)
+
+	// A stand-in sign in endpoint issues tokens for a service principal or a
+	// workload identity
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/v2.0/token" || r.FormValue("scope") != "https://vault.azure.net/.default" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch {
+		case r.FormValue("client_secret") == "secret":
+			w.Write([]byte(`{"token_type": "Bearer", "access_token": "sp-token"}`))
+		case r.FormValue("client_assertion") == "jwt" && r.FormValue("client_assertion_type") == clientAssertionType:
+			w.Write([]byte(`{"token_type": "Bearer", "access_token": "workload-token"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant")
+	t.Setenv("AZURE_CLIENT_ID", "client")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret")
+	t.Setenv("IDENTITY_ENDPOINT", "")
+	azure, err := NewAzure(2 * time.Second)
+	is.NoErr(err)
+	is.Equal(azure.Token, "sp-token")
+
+	t.Setenv("AZURE_CLIENT_SECRET", "wrong")
+	_, err = NewAzure(2 * time.Second)
+	is.True(err != nil)
+
+	// A federated token stands in for the secret
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	is.NoErr(os.WriteFile(tokenFile, []byte("jwt"), 0o600))
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", tokenFile)
+	azure, err = NewAzure(2 * time.Second)
+	is.NoErr(err)
+	is.Equal(azure.Token, "workload-token")
+
+	// Otherwise the VM's managed identity is used
+	var clientID string
+	imds := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metadata/identity/oauth2/token" || r.Header.Get("Metadata") != "true" ||
+			r.URL.Query().Get("resource") != "https://vault.azure.net" || r.URL.Query().Get("client_id") != clientID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token_type": "Bearer", "access_token": "identity-token"}`))
+	}))
+	defer imds.Close()
+	t.Setenv("AZURE_FEDERATED_TOKEN_FILE", "")
+	t.Setenv("AZURE_POD_IDENTITY_AUTHORITY_HOST", imds.URL)
+	clientID = "client"
+	azure, err = NewAzure(2 * time.Second)
+	is.NoErr(err)
+	is.Equal(azure.Token, "identity-token")
+
+	// App Service gives apps their own identity endpoint
+	appService := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-IDENTITY-HEADER") != "secret-header" || r.URL.Query().Get("api-version") != "2019-08-01" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token_type": "Bearer", "access_token": "app-token"}`))
+	}))
+	defer appService.Close()
+	t.Setenv("IDENTITY_ENDPOINT", appService.URL+"/msi/token")
+	t.Setenv("IDENTITY_HEADER", "secret-header")
+	azure, err = NewAzure(2 * time.Second)
+	is.NoErr(err)
+	is.Equal(azure.Token, "app-token")
+	t.Setenv("IDENTITY_ENDPOINT", "")
+
+	// Without a managed identity the Azure CLI's token is used
+	clientID = "none"
+	script := filepath.Join(dir, "az")
+	is.NoErr(os.WriteFile(script, []byte("#!/bin/sh\necho '{\"accessToken\": \"cli-token\", \"tokenType\": \"Bearer\"}'\n"), 0o755))
+	azCommand = script
+	defer func() { azCommand = "az" }()
+	azure, err = NewAzure(2 * time.Second)
+	is.NoErr(err)
+	is.Equal(azure.Token, "cli-token")
+
+	// A failing client is reported with what it wrote to stderr
+	azCommand = "false"
+	_, err = NewAzure(2 * time.Second)
+	is.True(err != nil)
+}
@@ -0,0 +1,193 @@
+// Package crl fetches certificate revocation lists from CRL distribution
+// points and checks certificates against them. Lists are cached in memory and
+// optionally on disk until their next update.
+package crl
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// maxCRLSize largest CRL read from a distribution point
+const maxCRLSize = 32 << 20
+
+// Cache CRLs by distribution point URL
+type Cache struct {
+	Dir    string       // directory to keep downloaded lists in, memory only if empty
+	Client *http.Client // client used to download lists
+
+	mu       sync.Mutex // guards entries and writeErr, not downloads
+	entries  map[string]*entry
+	writeErr error
+}
+
+// entry the list of one distribution point. Its lock is held while the list
+// is read or downloaded, so checks of other lists go ahead meanwhile and a
+// list is fetched once however many checks need it.
+type entry struct {
+	mu   sync.Mutex
+	list *x509.RevocationList
+}
+
+// NewCache make a cache for CRLs downloaded with the timeout. If dir is set
+// lists are also kept there between runs.
+func NewCache(dir string, timeout time.Duration) *Cache {
+	cache := new(Cache)
+	cache.Dir = dir
+	cache.Client = &http.Client{Timeout: timeout}
+	cache.entries = make(map[string]*entry)
+
+	return cache
+}
+
+// current check if a list has not passed its next update
+func current(list *x509.RevocationList, now time.Time) bool {
+	return list.NextUpdate.IsZero() || now.Before(list.NextUpdate)
+}
+
+// path get the file a list is kept in on disk
+func (cache *Cache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(cache.Dir, hex.EncodeToString(sum[:])+".crl")
+}
+
+// download fetch a list from a distribution point
+func (cache *Cache) download(ctx context.Context, url string) (der []byte, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return
+	}
+	response, err := cache.Client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("CRL distribution point returned %s", response.Status)
+		return
+	}
+
+	return io.ReadAll(io.LimitReader(response.Body, maxCRLSize))
+}
+
+// entry get the entry for a URL, adding it if there is none
+func (cache *Cache) entry(url string) *entry {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	e := cache.entries[url]
+	if e == nil {
+		e = new(entry)
+		cache.entries[url] = e
+	}
+
+	return e
+}
+
+// Get get the list at a URL, downloading it if there is no current copy. A
+// list that can't be kept in Dir is still returned, with the failure kept
+// for Err.
+func (cache *Cache) Get(ctx context.Context, url string) (list *x509.RevocationList, err error) {
+	now := time.Now()
+
+	e := cache.entry(url)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.list != nil && current(e.list, now) {
+		return e.list, nil
+	}
+	if cache.Dir != "" {
+		if der, readErr := os.ReadFile(cache.path(url)); readErr == nil {
+			if list, err = x509.ParseRevocationList(der); err == nil && current(list, now) {
+				e.list = list
+				return
+			}
+		}
+	}
+
+	der, err := cache.download(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	list, err = x509.ParseRevocationList(der)
+	if err != nil {
+		return nil, err
+	}
+	e.list = list
+	if cache.Dir != "" {
+		if writeErr := os.WriteFile(cache.path(url), der, 0o600); writeErr != nil {
+			cache.mu.Lock()
+			if cache.writeErr == nil {
+				cache.writeErr = fmt.Errorf("could not keep CRL %s: %v", url, writeErr)
+			}
+			cache.mu.Unlock()
+		}
+	}
+
+	return
+}
+
+// Err the first failure to keep a downloaded list in Dir, nil if there was
+// none. Lists that weren't kept are downloaded again by the next run.
+func (cache *Cache) Err() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.writeErr
+}
+
+// Check check if a certificate is on the CRL of any of its distribution
+// points. Each list must be signed by the issuer and current. Distribution
+// points are often mirrors of one list, so one that can't be fetched or whose
+// list isn't valid is passed over, and the first failure is returned only if
+// no list could be checked.
+func (cache *Cache) Check(ctx context.Context, cert, issuer *x509.Certificate) (revoked bool, revokedAt time.Time, err error) {
+	checked := false
+	for _, url := range cert.CRLDistributionPoints {
+		list, checkErr := cache.checked(ctx, url, issuer)
+		if checkErr != nil {
+			if err == nil {
+				err = checkErr
+			}
+			continue
+		}
+		checked = true
+		for _, entry := range list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return true, entry.RevocationTime, nil
+			}
+		}
+	}
+	if checked {
+		err = nil
+	}
+
+	return
+}
+
+// checked get the list at a distribution point, checking it is signed by the
+// issuer and current
+func (cache *Cache) checked(ctx context.Context, url string, issuer *x509.Certificate) (list *x509.RevocationList, err error) {
+	if list, err = cache.Get(ctx, url); err != nil {
+		return nil, err
+	}
+	if err = list.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("CRL %s not signed by %s: %v", url, issuer.Subject.CommonName, err)
+	}
+	if !current(list, time.Now()) {
+		return nil, fmt.Errorf("CRL %s is stale", url)
+	}
+
+	return list, nil
+}
@@ -0,0 +1,137 @@
+package crl
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// makeCert make a certificate with CRL distribution points signed by parent,
+// or self signed if parent is nil
+func makeCert(t *testing.T, serial int64, parent *x509.Certificate, parentKey crypto.Signer, crlURLs ...string) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		CRLDistributionPoints: crlURLs,
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+func TestCheck(t *testing.T) {
+	is := is.New(t)
+
+	issuer, issuerKey := makeCert(t, 1, nil, nil)
+	now := time.Now()
+	list, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: now.Add(-time.Hour),
+		NextUpdate: now.Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(3), RevocationTime: now.Add(-time.Minute)},
+		},
+	}, issuer, issuerKey)
+	is.NoErr(err)
+
+	downloads := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(list)
+	}))
+	defer server.Close()
+
+	good, _ := makeCert(t, 2, issuer, issuerKey, server.URL)
+	revoked, _ := makeCert(t, 3, issuer, issuerKey, server.URL)
+
+	dir, err := os.MkdirTemp("", "crl")
+	is.NoErr(err)
+	defer os.RemoveAll(dir)
+
+	cache := NewCache(dir, 2*time.Second)
+	isRevoked, _, err := cache.Check(context.Background(), good, issuer)
+	is.NoErr(err)
+	is.True(!isRevoked)
+
+	isRevoked, revokedAt, err := cache.Check(context.Background(), revoked, issuer)
+	is.NoErr(err)
+	is.True(isRevoked)
+	is.True(!revokedAt.IsZero())
+	is.Equal(downloads, 1) // second check used the cached list
+
+	// A new cache reads the list kept on disk
+	cache = NewCache(dir, 2*time.Second)
+	_, _, err = cache.Check(context.Background(), good, issuer)
+	is.NoErr(err)
+	is.Equal(downloads, 1)
+
+	is.NoErr(cache.Err())
+
+	// Checks of one list share a download, and a list that can't be kept on
+	// disk is still used
+	cache = NewCache(filepath.Join(dir, "missing"), 2*time.Second)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := cache.Check(context.Background(), revoked, issuer); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	is.Equal(downloads, 2)
+	is.True(cache.Err() != nil)
+
+	// A list not signed by the issuer is rejected
+	other, _ := makeCert(t, 4, nil, nil)
+	_, _, err = cache.Check(context.Background(), good, other)
+	is.True(err != nil)
+
+	// Distribution points that fail are passed over while another can be
+	// checked, and only when all fail is the check an error
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+	cache = NewCache("", 2*time.Second)
+	mirrored, _ := makeCert(t, 3, issuer, issuerKey, down.URL+"/issuer.crl", server.URL)
+	isRevoked, _, err = cache.Check(context.Background(), mirrored, issuer)
+	is.NoErr(err)
+	is.True(isRevoked)
+	unreachable, _ := makeCert(t, 5, issuer, issuerKey, down.URL+"/issuer.crl", down.URL+"/mirror.crl")
+	_, _, err = cache.Check(context.Background(), unreachable, issuer)
+	is.True(err != nil)
+}
@@ -0,0 +1,294 @@
+// Package ct looks up certificates logged in Certificate Transparency logs
+// using the crt.sh search service.
+package ct
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	crtShTimeFormat = "2006-01-02T15:04:05"
+	// LetsEncryptWeeklyLimit certificates per registered domain per week
+	LetsEncryptWeeklyLimit = 50
+	// LetsEncryptIssuer text found in the issuer of Let's Encrypt certificates
+	LetsEncryptIssuer = "Let's Encrypt"
+	// warnFraction fraction of a rate limit at which to warn
+	warnFraction = 0.8
+)
+
+// CT lookup values reported for a host
+const (
+	ctNone   = "none"
+	ctOthers = "others"
+	ctError  = "error"
+)
+
+// CrtShURL base URL of the crt.sh search service
+var CrtShURL = "https://crt.sh/"
+
+// Entry a logged certificate as reported by crt.sh
+type Entry struct {
+	ID           int64  `json:"id"`
+	IssuerName   string `json:"issuer_name"`
+	CommonName   string `json:"common_name"`
+	NameValue    string `json:"name_value"`
+	SerialNumber string `json:"serial_number"`
+	NotBefore    string `json:"not_before"`
+	NotAfter     string `json:"not_after"`
+}
+
+// Issued get the time the certificate became valid
+func (entry *Entry) Issued() (time.Time, error) {
+	return time.Parse(crtShTimeFormat, entry.NotBefore)
+}
+
+// Expires get the time the certificate expires
+func (entry *Entry) Expires() (time.Time, error) {
+	return time.Parse(crtShTimeFormat, entry.NotAfter)
+}
+
+// Names get the DNS names the certificate was issued for
+func (entry *Entry) Names() []string {
+	return strings.Fields(entry.NameValue)
+}
+
+// query run a single crt.sh search
+func query(q string, timeout time.Duration) (entries []Entry, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	values := url.Values{}
+	values.Set("q", q)
+	values.Set("output", "json")
+	values.Set("deduplicate", "Y")
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, CrtShURL+"?"+values.Encode(), nil)
+	if err != nil {
+		return
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("crt.sh returned %s", response.Status)
+		return
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(body, &entries)
+
+	return
+}
+
+// Search get the logged certificates for a domain and its subdomains. Entries
+// for the same serial number are only returned once.
+func Search(domain string, timeout time.Duration) (entries []Entry, err error) {
+	seen := make(map[string]bool)
+	for _, q := range []string{domain, "%." + domain} {
+		var found []Entry
+		found, err = query(q, timeout)
+		if err != nil {
+			return
+		}
+		for _, entry := range found {
+			if seen[entry.SerialNumber] {
+				continue
+			}
+			seen[entry.SerialNumber] = true
+			entries = append(entries, entry)
+		}
+	}
+
+	return
+}
+
+// secondLevel labels used under country code TLDs for registrations
+var secondLevel = map[string]bool{
+	"ac": true, "co": true, "com": true, "edu": true, "gov": true, "net": true, "org": true,
+}
+
+// RegisteredDomain get the registered domain for a host name. This is a short
+// approximation of the public suffix list covering names like example.co.uk.
+func RegisteredDomain(host string) string {
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(host), "."), ".")
+	if len(labels) <= 2 {
+		return strings.Join(labels, ".")
+	}
+	count := 2
+	tld, sld := labels[len(labels)-1], labels[len(labels)-2]
+	if len(tld) == 2 && secondLevel[sld] {
+		count = 3
+	}
+
+	return strings.Join(labels[len(labels)-count:], ".")
+}
+
+// letsEncryptUsage count Let's Encrypt certificates issued in the week before
+// now
+func letsEncryptUsage(domain string, entries []Entry, now time.Time) (rateLimit model.RateLimit) {
+	rateLimit.Domain = domain
+	rateLimit.Limit = LetsEncryptWeeklyLimit
+
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	for _, entry := range entries {
+		if !strings.Contains(entry.IssuerName, LetsEncryptIssuer) {
+			continue
+		}
+		issued, err := entry.Issued()
+		if err != nil || issued.Before(weekAgo) {
+			continue
+		}
+		rateLimit.Issued++
+	}
+	rateLimit.Warning = float64(rateLimit.Issued) >= float64(rateLimit.Limit)*warnFraction
+
+	return
+}
+
+// LetsEncryptRateLimits estimate weekly Let's Encrypt issuance for the
+// registered domains of checked hosts that use Let's Encrypt certificates
+func LetsEncryptRateLimits(certDataSet *model.CertDataSet, timeout time.Duration) (rateLimits []model.RateLimit) {
+	var (
+		now  = time.Now()
+		seen = make(map[string]bool)
+	)
+	for _, certData := range certDataSet.CertData {
+		if certData.HostError || !strings.Contains(certData.Issuer, LetsEncryptIssuer) {
+			continue
+		}
+		domain := RegisteredDomain(certData.Host)
+		if seen[domain] {
+			continue
+		}
+		seen[domain] = true
+
+		entries, err := Search(domain, timeout)
+		if err != nil {
+			rateLimits = append(rateLimits, model.RateLimit{Domain: domain, Limit: LetsEncryptWeeklyLimit, Message: err.Error()})
+			continue
+		}
+		rateLimits = append(rateLimits, letsEncryptUsage(domain, entries, now))
+	}
+
+	return
+}
+
+// covers check if a name in a certificate, which may be a wildcard, covers a
+// host name
+func covers(name, host string) bool {
+	name, host = strings.ToLower(name), strings.ToLower(host)
+	if name == host {
+		return true
+	}
+	if !strings.HasPrefix(name, "*.") {
+		return false
+	}
+	_, parent, found := strings.Cut(host, ".")
+
+	return found && name[2:] == parent
+}
+
+// lookupHost get the unexpired logged certificates covering a host name,
+// including wildcards for its parent domain
+func lookupHost(host string, timeout time.Duration, now time.Time) (entries []Entry, err error) {
+	queries := []string{host}
+	if _, parent, found := strings.Cut(host, "."); found && strings.Contains(parent, ".") {
+		queries = append(queries, "*."+parent)
+	}
+	seen := make(map[string]bool)
+	for _, q := range queries {
+		var found []Entry
+		found, err = query(q, timeout)
+		if err != nil {
+			return
+		}
+		for _, entry := range found {
+			expires, expiresErr := entry.Expires()
+			if seen[entry.SerialNumber] || expiresErr != nil || expires.Before(now) {
+				continue
+			}
+			for _, name := range entry.Names() {
+				if covers(name, host) {
+					seen[entry.SerialNumber] = true
+					entries = append(entries, entry)
+					break
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// otherCerts get the entries for certificates other than the one with serial
+func otherCerts(entries []Entry, serial string) (certs []model.CTCert) {
+	serial = strings.TrimLeft(strings.ToLower(serial), "0")
+	for _, entry := range entries {
+		if strings.TrimLeft(strings.ToLower(entry.SerialNumber), "0") == serial {
+			continue
+		}
+		certs = append(certs, model.CTCert{
+			ID:        entry.ID,
+			Issuer:    entry.IssuerName,
+			Serial:    entry.SerialNumber,
+			Names:     entry.Names(),
+			NotBefore: entry.NotBefore,
+			NotAfter:  entry.NotAfter,
+		})
+	}
+
+	return
+}
+
+// OtherCerts look up the unexpired certificates logged for the name of each
+// checked host and list those other than the one it serves, to find forgotten
+// or rogue issuance. CTStatus is set to none, others or error. Each name is
+// looked up once. Cert files and failed checks are skipped.
+func OtherCerts(certDataSet *model.CertDataSet, timeout time.Duration) {
+	type lookup struct {
+		entries []Entry
+		err     error
+	}
+	var (
+		now     = time.Now()
+		lookups = make(map[string]lookup)
+	)
+	for i := range certDataSet.CertData {
+		certData := &certDataSet.CertData[i]
+		if certData.HostError || certData.File != "" || certData.Serial == "" {
+			continue
+		}
+		host := strings.ToLower(certData.Host)
+		result, ok := lookups[host]
+		if !ok {
+			result.entries, result.err = lookupHost(host, timeout, now)
+			lookups[host] = result
+		}
+		if result.err != nil {
+			certData.CTStatus = ctError
+			if certData.Message == "" {
+				certData.Message = result.err.Error()
+			}
+			continue
+		}
+		certData.CTCerts = otherCerts(result.entries, certData.Serial)
+		certData.CTStatus = ctNone
+		if len(certData.CTCerts) > 0 {
+			certData.CTStatus = ctOthers
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package ct
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestRegisteredDomain(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(RegisteredDomain("www.example.com"), "example.com")
+	is.Equal(RegisteredDomain("example.com"), "example.com")
+	is.Equal(RegisteredDomain("a.b.example.co.uk"), "example.co.uk")
+	is.Equal(RegisteredDomain("www.example.de."), "example.de")
+}
+
+func TestLetsEncryptRateLimits(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now().UTC()
+	recent := now.Add(-24 * time.Hour).Format(crtShTimeFormat)
+	old := now.Add(-30 * 24 * time.Hour).Format(crtShTimeFormat)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.Equal(r.URL.Query().Get("output"), "json")
+		// The same serial is returned for both the domain and wildcard query
+		w.Write([]byte(`[
+			{"id": 1, "issuer_name": "C=US, O=Let's Encrypt, CN=R3", "name_value": "example.com", "serial_number": "01", "not_before": "` + recent + `"},
+			{"id": 2, "issuer_name": "C=US, O=Let's Encrypt, CN=R3", "name_value": "www.example.com", "serial_number": "02", "not_before": "` + old + `"},
+			{"id": 3, "issuer_name": "C=US, O=DigiCert Inc, CN=DigiCert", "name_value": "api.example.com", "serial_number": "03", "not_before": "` + recent + `"}
+		]`))
+	}))
+	defer server.Close()
+	CrtShURL = server.URL + "/"
+
+	entries, err := Search("example.com", 2*time.Second)
+	is.NoErr(err)
+	is.Equal(len(entries), 3)
+
+	rateLimit := letsEncryptUsage("example.com", entries, now)
+	is.Equal(rateLimit.Issued, 1)
+	is.True(!rateLimit.Warning)
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "www.example.com", Issuer: "CN=R3,O=Let's Encrypt,C=US"},
+		model.CertData{Host: "example.com", Issuer: "CN=R3,O=Let's Encrypt,C=US"},
+		model.CertData{Host: "other.org", Issuer: "CN=DigiCert"},
+	)
+	rateLimits := LetsEncryptRateLimits(certDataSet, 2*time.Second)
+	is.Equal(len(rateLimits), 1)
+	is.Equal(rateLimits[0].Domain, "example.com")
+}
+
+func TestOtherCerts(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now().UTC()
+	issued := now.Add(-24 * time.Hour).Format(crtShTimeFormat)
+	valid := now.Add(60 * 24 * time.Hour).Format(crtShTimeFormat)
+	expired := now.Add(-time.Hour).Format(crtShTimeFormat)
+
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+		if r.URL.Query().Get("q") == "*.example.com" {
+			w.Write([]byte(`[
+				{"id": 3, "issuer_name": "CN=Rogue CA", "name_value": "*.example.com", "serial_number": "03", "not_before": "` + issued + `", "not_after": "` + valid + `"}
+			]`))
+			return
+		}
+		w.Write([]byte(`[
+			{"id": 1, "issuer_name": "CN=R3", "name_value": "www.example.com", "serial_number": "00ab01", "not_before": "` + issued + `", "not_after": "` + valid + `"},
+			{"id": 2, "issuer_name": "CN=R3", "name_value": "www.example.com", "serial_number": "02", "not_before": "` + issued + `", "not_after": "` + expired + `"},
+			{"id": 4, "issuer_name": "CN=R3", "name_value": "api.example.com", "serial_number": "04", "not_before": "` + issued + `", "not_after": "` + valid + `"}
+		]`))
+	}))
+	defer server.Close()
+	CrtShURL = server.URL + "/"
+
+	is.True(covers("*.example.com", "www.example.com"))
+	is.True(!covers("*.example.com", "a.www.example.com"))
+	is.True(covers("WWW.example.com", "www.example.com"))
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "www.example.com", Serial: "ab01"},
+		model.CertData{Host: "www.example.com", Serial: "ab01", IP: "192.0.2.2"},
+		model.CertData{Host: "broken.example.com", HostError: true},
+	)
+	OtherCerts(certDataSet, 2*time.Second)
+	// The name is looked up once, with the wildcard for its parent
+	is.Equal(queries, []string{"www.example.com", "*.example.com"})
+	for _, certData := range certDataSet.CertData {
+		if certData.HostError {
+			is.Equal(certData.CTStatus, "")
+			continue
+		}
+		// The served cert, expired certs and other names are left out
+		is.Equal(certData.CTStatus, "others")
+		is.Equal(len(certData.CTCerts), 1)
+		is.Equal(certData.CTCerts[0].Issuer, "CN=Rogue CA")
+	}
+}
@@ -0,0 +1,168 @@
+// Package envoy reads certificate details from the Envoy admin /certs endpoint.
+// Istio sidecars run Envoy with the admin interface on port 15000, so the same
+// lookup covers mesh certificates that are never served on an external port.
+package envoy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const certsPath = "/certs"
+
+// subjectAltName a single SAN entry as reported by the admin API
+type subjectAltName struct {
+	DNS       string `json:"dns"`
+	URI       string `json:"uri"`
+	IPAddress string `json:"ip_address"`
+}
+
+// certificateDetails details of one certificate as reported by the admin API
+type certificateDetails struct {
+	Path            string           `json:"path"`
+	SerialNumber    string           `json:"serial_number"`
+	SubjectAltNames []subjectAltName `json:"subject_alt_names"`
+	ValidFrom       string           `json:"valid_from"`
+	ExpirationTime  string           `json:"expiration_time"`
+}
+
+// certificates a TLS context's CA and chain certificates
+type certificates struct {
+	CACert    []certificateDetails `json:"ca_cert"`
+	CertChain []certificateDetails `json:"cert_chain"`
+}
+
+// certsResponse the full /certs response body
+type certsResponse struct {
+	Certificates []certificates `json:"certificates"`
+}
+
+// name get the best identifier for a certificate, preferring SAN entries
+func (details *certificateDetails) name() string {
+	for _, san := range details.SubjectAltNames {
+		switch {
+		case san.URI != "":
+			return san.URI
+		case san.DNS != "":
+			return san.DNS
+		case san.IPAddress != "":
+			return san.IPAddress
+		}
+	}
+
+	return details.Path
+}
+
+// certData convert admin API certificate details to cert data
+func (details *certificateDetails) certData(warnAtDays int, now time.Time) (certData model.CertData) {
+	certData.Host = details.name()
+	certData.WarnAtDays = warnAtDays
+	certData.CheckTime = now.Format(model.TimeFormat)
+
+	notBefore, err := time.Parse(time.RFC3339, details.ValidFrom)
+	if err != nil {
+		certData.HostError = true
+		certData.Message = fmt.Sprintf("invalid valid_from %q", details.ValidFrom)
+		return
+	}
+	notAfter, err := time.Parse(time.RFC3339, details.ExpirationTime)
+	if err != nil {
+		certData.HostError = true
+		certData.Message = fmt.Sprintf("invalid expiration_time %q", details.ExpirationTime)
+		return
+	}
+	// Envoy's own days_until_expiration is left out as it counts from Envoy's
+	// clock rather than the time expiry is calculated at
+	certData.SetExpiry(notBefore, notAfter, warnAtDays, now)
+	certData.Message = "OK envoy " + details.Path
+
+	return
+}
+
+// parse convert a /certs response body to a list of cert data. Certificates
+// shared by several listeners are only reported once.
+func parse(body []byte, warnAtDays int, now time.Time) (certDataList []model.CertData, err error) {
+	var response certsResponse
+	err = json.Unmarshal(body, &response)
+	if err != nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, tlsContext := range response.Certificates {
+		all := append(append([]certificateDetails{}, tlsContext.CertChain...), tlsContext.CACert...)
+		for _, details := range all {
+			key := details.SerialNumber + details.Path
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			certDataList = append(certDataList, details.certData(warnAtDays, now))
+		}
+	}
+
+	return
+}
+
+// Lookup get the certificates known to an Envoy admin interface. The admin URL
+// is the base address, such as http://localhost:15000. Expiry is calculated
+// at now.
+func Lookup(adminURL string, warnAtDays int, timeout time.Duration, now time.Time) (certDataSet *model.CertDataSet) {
+	certDataSet = model.NewCertDataSet()
+	tRun := time.Now()
+
+	hostError := func(err error) *model.CertDataSet {
+		certData := model.CertData{
+			Host:       adminURL,
+			HostError:  true,
+			Message:    err.Error(),
+			WarnAtDays: warnAtDays,
+			CheckTime:  tRun.Format(model.TimeFormat),
+			FetchTime:  time.Since(tRun).Round(time.Millisecond).String(),
+		}
+		certDataSet.Add(certData)
+
+		return certDataSet
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(adminURL, "/") + certsPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return hostError(err)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return hostError(err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return hostError(fmt.Errorf("envoy admin returned %s", response.Status))
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return hostError(err)
+	}
+	certDataList, err := parse(body, warnAtDays, now)
+	if err != nil {
+		return hostError(err)
+	}
+
+	fetchTime := time.Since(tRun).Round(time.Millisecond).String()
+	for i := range certDataList {
+		certDataList[i].FetchTime = fetchTime
+	}
+	certDataSet.Add(certDataList...)
+
+	return certDataSet
+}
@@ -0,0 +1,97 @@
+package envoy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+const certsJSON = `{
+ "certificates": [
+  {
+   "ca_cert": [
+    {
+     "path": "<inline>",
+     "serial_number": "1a2b",
+     "subject_alt_names": [],
+     "days_until_expiration": "3600",
+     "valid_from": "2022-01-01T00:00:00Z",
+     "expiration_time": "2032-01-01T00:00:00Z"
+    }
+   ],
+   "cert_chain": [
+    {
+     "path": "/etc/certs/cert-chain.pem",
+     "serial_number": "3c4d",
+     "subject_alt_names": [
+      {
+       "uri": "spiffe://cluster.local/ns/default/sa/frontend"
+      }
+     ],
+     "days_until_expiration": "0",
+     "valid_from": "2022-01-01T00:00:00Z",
+     "expiration_time": "2022-01-02T00:00:00Z"
+    }
+   ]
+  },
+  {
+   "ca_cert": [],
+   "cert_chain": [
+    {
+     "path": "/etc/certs/cert-chain.pem",
+     "serial_number": "3c4d",
+     "subject_alt_names": [
+      {
+       "uri": "spiffe://cluster.local/ns/default/sa/frontend"
+      }
+     ],
+     "days_until_expiration": "0",
+     "valid_from": "2022-01-01T00:00:00Z",
+     "expiration_time": "2022-01-02T00:00:00Z"
+    }
+   ]
+  }
+ ]
+}`
+
+func TestParse(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC)
+	certDataList, err := parse([]byte(certsJSON), 30, now)
+	is.NoErr(err)
+	is.Equal(len(certDataList), 2) // duplicate chain only reported once
+
+	is.Equal(certDataList[0].Host, "spiffe://cluster.local/ns/default/sa/frontend")
+	is.True(certDataList[0].ExpiryWarning)
+	is.Equal(certDataList[0].TotalDays, 1)
+
+	is.Equal(certDataList[1].Host, "<inline>")
+	is.True(!certDataList[1].ExpiryWarning)
+	is.Equal(certDataList[1].DaysToExpiry, 3593) // counted from now, not Envoy's clock
+	is.Equal(certDataList[1].CheckTime, "2022-03-01T00:00:00Z")
+}
+
+func TestLookup(t *testing.T) {
+	is := is.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != certsPath {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(certsJSON))
+	}))
+	defer server.Close()
+
+	certDataSet := Lookup(server.URL, 30, 2*time.Second, time.Now())
+	is.Equal(certDataSet.Total, 2)
+	is.Equal(certDataSet.HostErrors, 0)
+	is.Equal(certDataSet.ExpiredWarnings, 1)
+
+	certDataSet = Lookup(server.URL+"/missing", 30, 2*time.Second, time.Now())
+	is.Equal(certDataSet.HostErrors, 1)
+}
@@ -0,0 +1,121 @@
+// Package forecast projects how many certificates expire each week so
+// renewal work can be planned ahead.
+package forecast
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// dateFormat format for the start of a week
+const dateFormat = "2006-01-02"
+
+// Week certificates expiring in the week starting on a Monday
+type Week struct {
+	Start    string         `json:"start" yaml:"start"`
+	Expiring int            `json:"expiring" yaml:"expiring"`
+	Issuers  map[string]int `json:"issuers,omitempty" yaml:"issuers,omitempty"`
+}
+
+// Forecast expiring certificates per week over a horizon
+type Forecast struct {
+	Generated string `json:"generated" yaml:"generated"`
+	Horizon   string `json:"horizon" yaml:"horizon"`
+	Expired   int    `json:"expired" yaml:"expired"`
+	Weeks     []Week `json:"weeks" yaml:"weeks"`
+}
+
+// ParseHorizon get a horizon such as 90d, 12w or a Go duration like 720h
+func ParseHorizon(horizon string) (duration time.Duration, err error) {
+	horizon = strings.TrimSpace(horizon)
+	unit := day
+	switch {
+	case strings.HasSuffix(horizon, "d"):
+	case strings.HasSuffix(horizon, "w"):
+		unit = week
+	default:
+		return time.ParseDuration(horizon)
+	}
+	count, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSuffix(horizon, "d"), "w"))
+	if err != nil || count < 1 {
+		return 0, fmt.Errorf("invalid horizon %s", horizon)
+	}
+
+	return time.Duration(count) * unit, nil
+}
+
+// issuerName get the common name of an issuer, or the whole name if it has no
+// common name
+func issuerName(issuer string) string {
+	for _, part := range strings.Split(issuer, ",") {
+		if strings.HasPrefix(part, "CN=") {
+			return strings.TrimPrefix(part, "CN=")
+		}
+	}
+	if issuer == "" {
+		return "unknown"
+	}
+
+	return issuer
+}
+
+// New forecast expiry of the certificates in a set from now until the end of
+// the horizon. A certificate served by several hosts or addresses is counted
+// once and results with no certificate are skipped.
+func New(certDataSet *model.CertDataSet, now time.Time, horizon time.Duration) *Forecast {
+	now = now.UTC()
+	forecast := &Forecast{
+		Generated: now.Format(model.TimeFormat),
+		Horizon:   fmt.Sprintf("%dd", horizon/day),
+	}
+
+	// Weeks start on the Monday on or before today
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	first := today.AddDate(0, 0, -((int(today.Weekday()) + 6) % 7))
+	end := now.Add(horizon)
+	for start := first; start.Before(end); start = start.AddDate(0, 0, 7) {
+		forecast.Weeks = append(forecast.Weeks, Week{Start: start.Format(dateFormat)})
+	}
+
+	seen := make(map[string]bool)
+	for _, certData := range certDataSet.CertData {
+		notAfter, err := time.Parse(model.TimeFormat, certData.NotAfter)
+		if err != nil {
+			continue
+		}
+		if certData.Fingerprint != "" {
+			if seen[certData.Fingerprint] {
+				continue
+			}
+			seen[certData.Fingerprint] = true
+		}
+		if notAfter.Before(now) {
+			forecast.Expired++
+			continue
+		}
+		if !notAfter.Before(end) {
+			continue
+		}
+		index := int(notAfter.Sub(first) / week)
+		if index >= len(forecast.Weeks) {
+			continue
+		}
+		w := &forecast.Weeks[index]
+		w.Expiring++
+		if w.Issuers == nil {
+			w.Issuers = make(map[string]int)
+		}
+		w.Issuers[issuerName(certData.Issuer)]++
+	}
+
+	return forecast
+}
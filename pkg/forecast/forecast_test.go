@@ -0,0 +1,57 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestParseHorizon(t *testing.T) {
+	is := is.New(t)
+
+	horizon, err := ParseHorizon("90d")
+	is.NoErr(err)
+	is.Equal(horizon, 90*day)
+	horizon, err = ParseHorizon("2w")
+	is.NoErr(err)
+	is.Equal(horizon, 2*week)
+	horizon, err = ParseHorizon("48h")
+	is.NoErr(err)
+	is.Equal(horizon, 2*day)
+	_, err = ParseHorizon("0d")
+	is.True(err != nil)
+	_, err = ParseHorizon("soon")
+	is.True(err != nil)
+}
+
+func TestNew(t *testing.T) {
+	is := is.New(t)
+
+	// A Wednesday
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	at := func(days int) string {
+		return now.AddDate(0, 0, days).Format(model.TimeFormat)
+	}
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "a.example.com", Fingerprint: "a", Issuer: "CN=R3,O=Let's Encrypt,C=US", NotAfter: at(2)},
+		model.CertData{Host: "a.example.com", IP: "192.0.2.2", Fingerprint: "a", Issuer: "CN=R3,O=Let's Encrypt,C=US", NotAfter: at(2)},
+		model.CertData{Host: "b.example.com", Fingerprint: "b", Issuer: "CN=R3,O=Let's Encrypt,C=US", NotAfter: at(13)},
+		model.CertData{Host: "c.example.com", Fingerprint: "c", Issuer: "O=Example CA", NotAfter: at(14)},
+		model.CertData{Host: "d.example.com", Fingerprint: "d", NotAfter: at(-1)},
+		model.CertData{Host: "e.example.com", Fingerprint: "e", NotAfter: at(60)},
+		model.CertData{Host: "f.example.com", HostError: true},
+	)
+
+	forecast := New(certDataSet, now, 3*week)
+	is.Equal(forecast.Horizon, "21d")
+	is.Equal(forecast.Expired, 1)
+	is.Equal(len(forecast.Weeks), 4)
+	is.Equal(forecast.Weeks[0].Start, "2026-10-12")
+	is.Equal(forecast.Weeks[0].Expiring, 1)
+	is.Equal(forecast.Weeks[1].Expiring, 0)
+	is.Equal(forecast.Weeks[2].Expiring, 2)
+	is.Equal(forecast.Weeks[2].Issuers, map[string]int{"R3": 1, "O=Example CA": 1})
+}
@@ -0,0 +1,70 @@
+// Package geoip annotates results with the country and autonomous system
+// (ASN) of the address each host was reached at, from local MaxMind DB files
+// such as GeoLite2-Country.mmdb and GeoLite2-ASN.mmdb. Reports can then be
+// grouped by provider, as when one CDN or hoster is behind many warnings.
+// Nothing is looked up over the network.
+package geoip
+
+import (
+	"net"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// Info what the databases have for an address
+type Info struct {
+	ASN     uint64
+	ASOrg   string
+	Country string // ISO 3166-1 code
+}
+
+// LookupAll get what any of the databases have for an address, the first to
+// have a value winning, so an ASN database and a country database can be used
+// together
+func LookupAll(ip net.IP, dbs []*DB) (info Info, err error) {
+	for _, db := range dbs {
+		value, err := db.Lookup(ip)
+		if err != nil {
+			return info, err
+		}
+		fields, _ := value.(map[string]any)
+		if info.ASN == 0 {
+			info.ASN = toUint(fields["autonomous_system_number"])
+		}
+		if info.ASOrg == "" {
+			info.ASOrg, _ = fields["autonomous_system_organization"].(string)
+		}
+		// The country a network is registered in stands in for where it is
+		for _, key := range []string{"country", "registered_country"} {
+			if country, ok := fields[key].(map[string]any); ok && info.Country == "" {
+				info.Country, _ = country["iso_code"].(string)
+			}
+		}
+	}
+
+	return
+}
+
+// Annotate set the ASN, AS organization and country of each result with an
+// IP address. The first lookup error, from a corrupt database, is returned
+// after the rest are annotated.
+func Annotate(certDataSet *model.CertDataSet, dbs []*DB) (err error) {
+	for i, certData := range certDataSet.CertData {
+		ip := net.ParseIP(certData.IP)
+		if ip == nil {
+			continue
+		}
+		info, lookupErr := LookupAll(ip, dbs)
+		if lookupErr != nil {
+			if err == nil {
+				err = lookupErr
+			}
+			continue
+		}
+		certDataSet.CertData[i].ASN = info.ASN
+		certDataSet.CertData[i].ASOrg = info.ASOrg
+		certDataSet.CertData[i].Country = info.Country
+	}
+
+	return
+}
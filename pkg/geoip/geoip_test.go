@@ -0,0 +1,203 @@
+package geoip
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+// encodeValue encode strings, numbers as uint32, pointers and maps in the
+// data section format
+func encodeValue(value any) []byte {
+	control := func(kind, size int) []byte {
+		var extra []byte
+		if size >= 29 {
+			size, extra = 29, []byte{byte(size - 29)}
+		}
+		if kind < 8 {
+			return append([]byte{byte(kind<<5 | size)}, extra...)
+		}
+		return append([]byte{byte(size), byte(kind - 7)}, extra...)
+	}
+	switch v := value.(type) {
+	case string:
+		return append(control(typeString, len(v)), v...)
+	case uint32:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, v)
+		return append(control(typeUint32, 4), b...)
+	case uint16:
+		return append(control(typeUint16, 2), byte(v>>8), byte(v))
+	case pointer:
+		return []byte{byte(typePointer<<5 | int(v)>>8), byte(v)}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		encoded := control(typeMap, len(v))
+		for _, key := range keys {
+			encoded = append(encoded, encodeValue(key)...)
+			encoded = append(encoded, encodeValue(v[key])...)
+		}
+		return encoded
+	}
+	panic("unsupported value")
+}
+
+// pointer a pointer to an offset under 2048 in the data section
+type pointer uint16
+
+// network a prefix of an IPv6 tree and the offset of its data
+type network struct {
+	cidr   string
+	offset int
+}
+
+// writeDB write an IPv6 MMDB file with 28 bit records holding networks
+func writeDB(t *testing.T, data []byte, networks []network) string {
+	type node struct {
+		children [2]*node
+		data     [2]int
+	}
+	root := &node{data: [2]int{-1, -1}}
+	for _, n := range networks {
+		_, ipNet, err := net.ParseCIDR(n.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ip := ipNet.IP.To16()
+		ones, _ := ipNet.Mask.Size()
+		// IPv4 networks are under ::/96
+		if ip4 := ipNet.IP.To4(); ip4 != nil {
+			ip = append(make(net.IP, 12), ip4...)
+			ones += 96
+		}
+		current := root
+		for i := 0; i < ones; i++ {
+			bit := ip[i/8] >> (7 - i%8) & 1
+			if i == ones-1 {
+				current.data[bit] = n.offset
+				break
+			}
+			if current.children[bit] == nil {
+				current.children[bit] = &node{data: [2]int{-1, -1}}
+			}
+			current = current.children[bit]
+		}
+	}
+
+	// Number the nodes breadth first, the root being 0
+	nodes := []*node{root}
+	index := map[*node]int{root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, child := range nodes[i].children {
+			if child != nil {
+				index[child] = len(nodes)
+				nodes = append(nodes, child)
+			}
+		}
+	}
+	count := len(nodes)
+	var tree []byte
+	for _, n := range nodes {
+		var records [2]int
+		for bit := 0; bit < 2; bit++ {
+			switch {
+			case n.children[bit] != nil:
+				records[bit] = index[n.children[bit]]
+			case n.data[bit] >= 0:
+				records[bit] = count + dataSeparator + n.data[bit]
+			default:
+				records[bit] = count
+			}
+		}
+		left, right := records[0], records[1]
+		tree = append(tree, byte(left>>16), byte(left>>8), byte(left),
+			byte(left>>24)<<4|byte(right>>24), byte(right>>16), byte(right>>8), byte(right))
+	}
+
+	contents := append(tree, make([]byte, dataSeparator)...)
+	contents = append(contents, data...)
+	contents = append(contents, metadataMarker...)
+	contents = append(contents, encodeValue(map[string]any{
+		"database_type": "Test-ASN-Country",
+		"node_count":    uint32(count),
+		"record_size":   uint16(28),
+		"ip_version":    uint16(6),
+	})...)
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, contents, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+// testDB write a database with an ASN for 192.0.2.0/24 and a country by
+// pointer for 2001:db8::/32
+func testDB(t *testing.T) string {
+	asn := encodeValue(map[string]any{
+		"autonomous_system_number":       uint32(64500),
+		"autonomous_system_organization": "Example Hosting",
+	})
+	country := encodeValue("CA")
+	located := encodeValue(map[string]any{"country": map[string]any{"iso_code": pointer(len(asn))}})
+	data := append(append(append([]byte{}, asn...), country...), located...)
+
+	return writeDB(t, data, []network{
+		{cidr: "192.0.2.0/24", offset: 0},
+		{cidr: "2001:db8::/32", offset: len(asn) + len(country)},
+	})
+}
+
+func TestLookup(t *testing.T) {
+	is := is.New(t)
+
+	db, err := Open(testDB(t))
+	is.NoErr(err)
+	is.Equal(db.Type, "Test-ASN-Country")
+
+	value, err := db.Lookup(net.ParseIP("192.0.2.10"))
+	is.NoErr(err)
+	fields := value.(map[string]any)
+	is.Equal(fields["autonomous_system_number"], uint64(64500))
+	is.Equal(fields["autonomous_system_organization"], "Example Hosting")
+
+	info, err := LookupAll(net.ParseIP("2001:db8::1"), []*DB{db})
+	is.NoErr(err)
+	is.Equal(info, Info{Country: "CA"})
+
+	value, err = db.Lookup(net.ParseIP("198.51.100.1"))
+	is.NoErr(err)
+	is.True(value == nil)
+
+	_, err = Open(filepath.Join("..", "..", "go.mod"))
+	is.True(err != nil)
+}
+
+func TestAnnotate(t *testing.T) {
+	is := is.New(t)
+
+	db, err := Open(testDB(t))
+	is.NoErr(err)
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "a.example.com", IP: "192.0.2.1"},
+		model.CertData{Host: "b.example.com", IP: "2001:db8::2"},
+		model.CertData{Host: "c.example.com", HostError: true},
+	)
+	is.NoErr(Annotate(certDataSet, []*DB{db}))
+	is.Equal(certDataSet.CertData[0].ASN, uint64(64500))
+	is.Equal(certDataSet.CertData[0].ASOrg, "Example Hosting")
+	is.Equal(certDataSet.CertData[1].Country, "CA")
+	is.Equal(certDataSet.CertData[2].ASN, uint64(0))
+}
@@ -0,0 +1,305 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"os"
+)
+
+// MaxMind DB (MMDB) files are a binary search tree over the bits of an
+// address whose leaves point into a data section of typed values. See
+// https://maxmind.github.io/MaxMind-DB/ for the format.
+
+// metadataMarker start of the metadata at the end of the file
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// dataSeparator zero bytes between the search tree and the data section
+const dataSeparator = 16
+
+// Data types of the data section
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// maxDepth deepest nesting of maps and arrays decoded, so a corrupt file
+// can't recurse forever
+const maxDepth = 32
+
+// DB an MMDB file, such as GeoLite2-ASN.mmdb or GeoLite2-Country.mmdb, read
+// into memory
+type DB struct {
+	Path       string
+	Type       string // database_type from the metadata, such as GeoLite2-ASN
+	buffer     []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	data       []byte // data section
+	ipv4Start  uint   // node IPv4 addresses start at in an IPv6 tree
+}
+
+// Open read an MMDB file
+func Open(path string) (db *DB, err error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	db, err = newDB(buffer)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	db.Path = path
+
+	return
+}
+
+// newDB read the metadata and find the sections of an MMDB file's contents
+func newDB(buffer []byte) (db *DB, err error) {
+	start := bytes.LastIndex(buffer, metadataMarker)
+	if start < 0 {
+		return nil, errors.New("not a MaxMind DB file")
+	}
+	metadata := buffer[start+len(metadataMarker):]
+	value, _, err := decode(metadata, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, errors.New("invalid metadata")
+	}
+
+	db = &DB{buffer: buffer}
+	db.Type, _ = fields["database_type"].(string)
+	db.nodeCount = uint(toUint(fields["node_count"]))
+	db.recordSize = uint(toUint(fields["record_size"]))
+	db.ipVersion = uint(toUint(fields["ip_version"]))
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.recordSize * 2 / 8 * db.nodeCount
+	if treeSize+dataSeparator > uint(start) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	db.data = buffer[treeSize+dataSeparator : start]
+
+	// IPv4 addresses are found under ::/96 in an IPv6 tree
+	if db.ipVersion == 6 {
+		for i := 0; i < 96 && db.ipv4Start < db.nodeCount; i++ {
+			db.ipv4Start = db.record(db.ipv4Start, 0)
+		}
+	}
+
+	return
+}
+
+// record read the left (0) or right (1) record of a node
+func (db *DB) record(node uint, bit uint) uint {
+	size := db.recordSize * 2 / 8
+	b := db.buffer[node*size : node*size+size]
+	switch db.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// Lookup get the data for the network an address is in, nil if it is in none
+func (db *DB) Lookup(ip net.IP) (value any, err error) {
+	node, bits := uint(0), ip.To4()
+	if bits != nil {
+		if db.ipVersion == 6 {
+			node = db.ipv4Start
+		}
+	} else if bits = ip.To16(); bits == nil {
+		return nil, fmt.Errorf("invalid IP address %v", ip)
+	} else if db.ipVersion == 4 {
+		// An IPv4 database has no IPv6 networks
+		return nil, nil
+	}
+
+	for i := 0; i < len(bits)*8 && node < db.nodeCount; i++ {
+		node = db.record(node, uint(bits[i/8]>>(7-i%8))&1)
+	}
+	if node <= db.nodeCount {
+		return nil, nil
+	}
+	offset := node - db.nodeCount - dataSeparator
+	if offset >= uint(len(db.data)) {
+		return nil, errors.New("invalid search tree record")
+	}
+	value, _, err = decode(db.data, offset, 0)
+
+	return
+}
+
+// decode read the value at an offset in a data section, returning it and the
+// offset after it. Maps decode to map[string]any, arrays to []any and
+// numbers to uint64, int32, float64 or *big.Int.
+func decode(data []byte, offset uint, depth int) (value any, next uint, err error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	truncated := errors.New("data section is truncated")
+	read := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(data)) {
+			return nil, truncated
+		}
+		b := data[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	control, err := read(1)
+	if err != nil {
+		return
+	}
+	kind := uint(control[0] >> 5)
+
+	if kind == typePointer {
+		size := uint(control[0]>>3) & 0x3
+		b, err := read(size + 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		var pointer uint
+		if size < 3 {
+			pointer = uint(control[0] & 0x7)
+		}
+		for _, c := range b {
+			pointer = pointer<<8 | uint(c)
+		}
+		pointer += [...]uint{0, 2048, 526336, 0}[size]
+		value, _, err = decode(data, pointer, depth+1)
+		return value, offset, err
+	}
+
+	if kind == typeExtended {
+		b, err := read(1)
+		if err != nil {
+			return nil, 0, err
+		}
+		kind = 7 + uint(b[0])
+	}
+	size := uint(control[0] & 0x1f)
+	if size >= 29 {
+		b, err := read(size - 28)
+		if err != nil {
+			return nil, 0, err
+		}
+		extra := uint(0)
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		size = [...]uint{29, 285, 65821}[size-29] + extra
+	}
+
+	switch kind {
+	case typeMap:
+		fields := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			var key, item any
+			if key, offset, err = decode(data, offset, depth+1); err != nil {
+				return
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if item, offset, err = decode(data, offset, depth+1); err != nil {
+				return
+			}
+			fields[name] = item
+		}
+		return fields, offset, nil
+	case typeArray:
+		items := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			var item any
+			if item, offset, err = decode(data, offset, depth+1); err != nil {
+				return
+			}
+			items = append(items, item)
+		}
+		return items, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	case typeContainer, typeEndMarker:
+		return nil, offset, nil
+	}
+
+	b, err := read(size)
+	if err != nil {
+		return
+	}
+	switch kind {
+	case typeString:
+		value = string(b)
+	case typeBytes:
+		value = append([]byte(nil), b...)
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		value = math.Float64frombits(binary.BigEndian.Uint64(b))
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+	case typeUint16, typeUint32, typeUint64:
+		n := uint64(0)
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		value = n
+	case typeInt32:
+		n := uint32(0)
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		value = int32(n)
+	case typeUint128:
+		value = new(big.Int).SetBytes(b)
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", kind)
+	}
+
+	return value, offset, nil
+}
+
+// toUint get an unsigned number decoded from a data section, 0 for other
+// values
+func toUint(value any) uint64 {
+	n, _ := value.(uint64)
+	return n
+}
@@ -0,0 +1,134 @@
+package hosts
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ACME DNS-01 values reported for a host when there is no CNAME target
+const (
+	acmeNone  = "none"
+	acmeError = "error"
+
+	dnsTypeCNAME = 5
+	dnsTypeTXT   = 16
+
+	acmeChallengeLabel = "_acme-challenge"
+)
+
+// readName read a possibly compressed name at an offset in a DNS message
+func readName(message []byte, offset int) (name string, err error) {
+	var labels []string
+	for jumps := 0; jumps < 16; {
+		if offset >= len(message) {
+			break
+		}
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return strings.Join(labels, "."), nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(message) {
+				return "", errors.New("short DNS message")
+			}
+			offset = int(binary.BigEndian.Uint16(message[offset:]) & 0x3fff)
+			jumps++
+		default:
+			if offset+1+length > len(message) {
+				return "", errors.New("short DNS message")
+			}
+			labels = append(labels, string(message[offset+1:offset+1+length]))
+			offset += length + 1
+		}
+	}
+
+	return "", errors.New("invalid DNS name")
+}
+
+// parseCNAME get the target of the first CNAME answer in a DNS response
+func parseCNAME(message []byte) (target string, rcode int, err error) {
+	if len(message) < 12 {
+		return "", 0, errors.New("short DNS message")
+	}
+	rcode = int(message[3] & 0x0f)
+	questions := int(binary.BigEndian.Uint16(message[4:]))
+	answers := int(binary.BigEndian.Uint16(message[6:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return
+		}
+		offset += 4
+	}
+	for i := 0; i < answers; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return
+		}
+		if offset+10 > len(message) {
+			return "", rcode, errors.New("short DNS message")
+		}
+		rtype := binary.BigEndian.Uint16(message[offset:])
+		length := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10
+		if offset+length > len(message) {
+			return "", rcode, errors.New("short DNS message")
+		}
+		if rtype == dnsTypeCNAME {
+			target, err = readName(message, offset)
+			return
+		}
+		offset += length
+	}
+
+	return
+}
+
+// inZone check if a name is a zone or one of its subdomains
+func inZone(name, zone string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+
+	return name == zone || strings.HasSuffix(name, "."+zone)
+}
+
+// checkACMEDNS check the _acme-challenge name for a host, which DNS-01
+// automation often delegates with a CNAME to a zone a DNS provider's API can
+// update. The status is the CNAME target, none if there is no CNAME or error
+// if the lookup failed. A CNAME to a name that does not exist is an error, as
+// is a missing or wrong CNAME when options.ACMETarget is set.
+func (options *Options) checkACMEDNS(ctx context.Context, host string) (status string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	name := acmeChallengeLabel + "." + strings.TrimPrefix(host, "*.")
+	response, lookupErr := options.dnsExchange(ctx, name, dnsTypeCNAME)
+	if lookupErr != nil {
+		return acmeError, nil
+	}
+	target, rcode, parseErr := parseCNAME(response)
+	if parseErr != nil || (rcode != 0 && rcode != dnsRcodeNX) {
+		return acmeError, nil
+	}
+
+	if target == "" {
+		if options.ACMETarget != "" {
+			return acmeNone, fmt.Errorf("%s has no CNAME to %s", name, options.ACMETarget)
+		}
+		return acmeNone, nil
+	}
+	if options.ACMETarget != "" && !inZone(target, options.ACMETarget) {
+		return target, fmt.Errorf("%s points to %s, not %s", name, target, options.ACMETarget)
+	}
+
+	// A dangling CNAME makes every DNS-01 validation fail
+	response, lookupErr = options.dnsExchange(ctx, target, dnsTypeTXT)
+	if lookupErr == nil && len(response) > 3 && int(response[3]&0x0f) == dnsRcodeNX {
+		return target, fmt.Errorf("%s points to %s, which does not exist", name, target)
+	}
+
+	return target, nil
+}
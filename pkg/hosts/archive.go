@@ -0,0 +1,97 @@
+package hosts
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// isCertPath check if a path in an archive has a certificate file extension
+func isCertPath(name string) bool {
+	return isListed(rootExtensions, path.Ext(name))
+}
+
+// ProcessCertArchive check every .pem, .crt and .cer file in a tar, gzipped
+// tar or zip archive, found by its extension. Each result has File set to the
+// path inside the archive. Errors are returned only for an archive that can't
+// be read at all.
+func (hostSet *HostSet) ProcessCertArchive(archive string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	certDataSet = NewCertDataSet()
+	name := strings.ToLower(archive)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = options.readZip(archive, warnAtDays, certDataSet)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"), strings.HasSuffix(name, ".tar"):
+		err = options.readTar(archive, warnAtDays, certDataSet)
+	default:
+		err = fmt.Errorf("unknown archive type for %s, expected .tar, .tar.gz, .tgz or .zip", archive)
+	}
+	certDataSet.Finalize()
+
+	return
+}
+
+// readTar add the certs in a tar file, gzipped if its name says so
+func (options *Options) readTar(archive string, warnAtDays int, certDataSet *CertDataSet) (err error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if !strings.HasSuffix(strings.ToLower(archive), ".tar") {
+		gzipReader, gzipErr := gzip.NewReader(file)
+		if gzipErr != nil {
+			return gzipErr
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			return
+		}
+		if nextErr != nil {
+			return nextErr
+		}
+		if header.Typeflag != tar.TypeReg || !isCertPath(header.Name) {
+			continue
+		}
+		contents, readErr := readLimited(tarReader, options.MaxCertSize)
+		certDataSet.CertData = append(certDataSet.CertData, options.certFileResults(header.Name, contents, readErr, warnAtDays)...)
+	}
+}
+
+// readZip add the certs in a zip file
+func (options *Options) readZip(archive string, warnAtDays int, certDataSet *CertDataSet) (err error) {
+	zipReader, err := zip.OpenReader(archive)
+	if err != nil {
+		return
+	}
+	defer zipReader.Close()
+
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() || !isCertPath(file.Name) {
+			continue
+		}
+		var contents []byte
+		entry, openErr := file.Open()
+		if openErr == nil {
+			contents, openErr = readLimited(entry, options.MaxCertSize)
+			entry.Close()
+		}
+		certDataSet.CertData = append(certDataSet.CertData, options.certFileResults(file.Name, contents, openErr, warnAtDays)...)
+	}
+
+	return
+}
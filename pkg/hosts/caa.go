@@ -0,0 +1,317 @@
+package hosts
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+)
+
+// CAA values reported for a host
+const (
+	caaAuthorized   = "authorized"
+	caaUnauthorized = "unauthorized"
+	caaNone         = "none"
+	caaUnknown      = "unknown"
+	caaError        = "error"
+
+	dnsTypeCAA     = 257
+	dnsClassIN     = 1
+	dnsRcodeNX     = 3
+	dnsMaxUDPSize  = 4096
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+// caaIssuers CAA issuer domains used by CAs, keyed by text found in the issuer
+// names of the certificates they sign
+var caaIssuers = map[string][]string{
+	"Let's Encrypt":         {"letsencrypt.org"},
+	"DigiCert":              {"digicert.com", "symantec.com", "geotrust.com", "thawte.com", "rapidssl.com"},
+	"RapidSSL":              {"digicert.com", "rapidssl.com"},
+	"GeoTrust":              {"digicert.com", "geotrust.com"},
+	"Thawte":                {"digicert.com", "thawte.com"},
+	"Google Trust Services": {"pki.goog"},
+	"Sectigo":               {"sectigo.com", "comodoca.com"},
+	"COMODO":                {"sectigo.com", "comodoca.com", "comodo.com"},
+	"ZeroSSL":               {"sectigo.com", "zerossl.com"},
+	"Amazon":                {"amazon.com", "amazontrust.com", "awstrust.com", "amazonaws.com"},
+	"GlobalSign":            {"globalsign.com"},
+	"GoDaddy":               {"godaddy.com", "starfieldtech.com"},
+	"Starfield":             {"godaddy.com", "starfieldtech.com"},
+	"Entrust":               {"entrust.net", "affirmtrust.com"},
+	"Microsoft":             {"microsoft.com"},
+	"Buypass":               {"buypass.com", "buypass.no"},
+	"SSL.com":               {"ssl.com"},
+}
+
+// caaRecord a CAA resource record (RFC 8659)
+type caaRecord struct {
+	Flags uint8
+	Tag   string
+	Value string
+}
+
+// dnsQuery make a DNS query message asking recursively for a record type
+func dnsQuery(name string, qtype uint16) (message []byte, err error) {
+	message = make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(message[0:], uint16(rand.Intn(1<<16)))
+	binary.BigEndian.PutUint16(message[2:], 0x0100) // recursion desired
+	binary.BigEndian.PutUint16(message[4:], 1)      // one question
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(label) == 0 || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %s", name)
+		}
+		message = append(message, byte(len(label)))
+		message = append(message, label...)
+	}
+	message = append(message, 0, byte(qtype>>8), byte(qtype), 0, dnsClassIN)
+
+	return
+}
+
+// skipName get the offset just past a possibly compressed name
+func skipName(message []byte, offset int) (int, error) {
+	for offset < len(message) {
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			return offset + 1, nil
+		case length&0xc0 == 0xc0:
+			return offset + 2, nil
+		default:
+			offset += length + 1
+		}
+	}
+
+	return 0, errors.New("short DNS message")
+}
+
+// parseCAA get the CAA records in the answers of a DNS response. Answers
+// for the CNAME targets of a name are included, as resolvers follow them.
+func parseCAA(message []byte) (records []caaRecord, rcode int, err error) {
+	if len(message) < 12 {
+		return nil, 0, errors.New("short DNS message")
+	}
+	rcode = int(message[3] & 0x0f)
+	questions := int(binary.BigEndian.Uint16(message[4:]))
+	answers := int(binary.BigEndian.Uint16(message[6:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return
+		}
+		offset += 4
+	}
+	for i := 0; i < answers; i++ {
+		if offset, err = skipName(message, offset); err != nil {
+			return
+		}
+		if offset+10 > len(message) {
+			return nil, rcode, errors.New("short DNS message")
+		}
+		rtype := binary.BigEndian.Uint16(message[offset:])
+		length := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10
+		if offset+length > len(message) {
+			return nil, rcode, errors.New("short DNS message")
+		}
+		data := message[offset : offset+length]
+		offset += length
+		if rtype != dnsTypeCAA || len(data) < 2 || len(data) < 2+int(data[1]) {
+			continue
+		}
+		tagEnd := 2 + int(data[1])
+		records = append(records, caaRecord{
+			Flags: data[0],
+			Tag:   strings.ToLower(string(data[2:tagEnd])),
+			Value: string(data[tagEnd:]),
+		})
+	}
+
+	return
+}
+
+// systemNameserver get the first name server in resolv.conf
+func systemNameserver() string {
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return net.JoinHostPort("127.0.0.1", dnsDefaultPort)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], dnsDefaultPort)
+		}
+	}
+
+	return net.JoinHostPort("127.0.0.1", dnsDefaultPort)
+}
+
+// dnsConn connect to the configured resolver, or the system name server.
+// Resolvers for --dns dial their own server, but others such as the one
+// counting queries for --cost dial the address they are given.
+func (options *Options) dnsConn(ctx context.Context, network string) (net.Conn, error) {
+	if options.Resolver != nil && options.Resolver.Dial != nil {
+		return options.Resolver.Dial(ctx, network, systemNameserver())
+	}
+	dialer := &net.Dialer{Timeout: options.Timeout}
+
+	return dialer.DialContext(ctx, network, systemNameserver())
+}
+
+// exchange send a DNS query and read the response. Connections that are not
+// packet based carry messages with a two byte length prefix.
+func exchange(conn net.Conn, query []byte) (response []byte, err error) {
+	if _, ok := conn.(net.PacketConn); ok {
+		if _, err = conn.Write(query); err != nil {
+			return
+		}
+		response = make([]byte, dnsMaxUDPSize)
+		n, err := conn.Read(response)
+		return response[:n], err
+	}
+
+	framed := make([]byte, 2, len(query)+2)
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	if _, err = conn.Write(append(framed, query...)); err != nil {
+		return
+	}
+	length := make([]byte, 2)
+	if _, err = io.ReadFull(conn, length); err != nil {
+		return
+	}
+	response = make([]byte, binary.BigEndian.Uint16(length))
+	_, err = io.ReadFull(conn, response)
+
+	return
+}
+
+// dnsExchange query the configured resolver, or the system name server, for
+// a record type at a name
+func (options *Options) dnsExchange(ctx context.Context, name string, qtype uint16) (response []byte, err error) {
+	query, err := dnsQuery(name, qtype)
+	if err != nil {
+		return
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		var conn net.Conn
+		conn, err = options.dnsConn(ctx, network)
+		if err != nil {
+			return
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		response, err = exchange(conn, query)
+		conn.Close()
+		if err != nil {
+			return
+		}
+		// Retry over TCP if the answer was truncated
+		if len(response) < 3 || response[2]&0x02 == 0 {
+			break
+		}
+	}
+
+	return
+}
+
+// queryCAA get the CAA records at a name. An empty list means there are none.
+func (options *Options) queryCAA(ctx context.Context, name string) (records []caaRecord, err error) {
+	response, err := options.dnsExchange(ctx, name, dnsTypeCAA)
+	if err != nil {
+		return
+	}
+
+	records, rcode, err := parseCAA(response)
+	if err == nil && rcode != 0 && rcode != dnsRcodeNX {
+		err = fmt.Errorf("CAA lookup for %s failed with rcode %d", name, rcode)
+	}
+
+	return
+}
+
+// relevantCAA find the CAA records that apply to a host by climbing from the
+// host name towards the top level domain until a name has records
+func (options *Options) relevantCAA(ctx context.Context, host string) (name string, records []caaRecord, err error) {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for i := 0; i+1 < len(labels); i++ {
+		name = strings.Join(labels[i:], ".")
+		records, err = options.queryCAA(ctx, name)
+		if err != nil || len(records) > 0 {
+			return
+		}
+	}
+
+	return "", nil, nil
+}
+
+// caaDomain get the issuer domain name from a CAA issue value, which can be
+// followed by parameters
+func caaDomain(value string) string {
+	domain := strings.TrimSpace(strings.SplitN(value, ";", 2)[0])
+
+	return strings.ToLower(domain)
+}
+
+// checkCAA check if the issuer of a host's cert is authorized by the CAA
+// records for the host. An unauthorized issuer is an error. Issuers not known
+// to certcheck and failed lookups are reported in the status only.
+func (options *Options) checkCAA(ctx context.Context, host, issuer string, wildcard bool) (status string, err error) {
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+
+	name, records, lookupErr := options.relevantCAA(ctx, host)
+	if lookupErr != nil {
+		return caaError, nil
+	}
+
+	// issuewild replaces issue for wildcard certs if present
+	tag := "issue"
+	if wildcard {
+		for _, record := range records {
+			if record.Tag == "issuewild" {
+				tag = "issuewild"
+			}
+		}
+	}
+	var allowed []string
+	for _, record := range records {
+		if record.Tag == tag {
+			allowed = append(allowed, caaDomain(record.Value))
+		}
+	}
+	if len(allowed) == 0 {
+		return caaNone, nil
+	}
+
+	var domains []string
+	for text, issuerDomains := range caaIssuers {
+		if strings.Contains(issuer, text) {
+			domains = append(domains, issuerDomains...)
+		}
+	}
+	if len(domains) == 0 {
+		return caaUnknown, nil
+	}
+	for _, domain := range domains {
+		for _, allowedDomain := range allowed {
+			if domain == allowedDomain {
+				return caaAuthorized, nil
+			}
+		}
+	}
+
+	return caaUnauthorized, fmt.Errorf("issuer not authorized by CAA for %s (%s)", name, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,160 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/imarsman/certcheck/v2/pkg/cert"
+	"github.com/imarsman/certcheck/v2/pkg/gcon"
+	"golang.org/x/sync/semaphore"
+)
+
+// pemCertBegin start of a PEM certificate block
+var pemCertBegin = []byte("-----BEGIN CERTIFICATE-----")
+
+// dirFiles find the regular files under a directory of up to maxSize bytes.
+// Links to a file already found, as /etc/ssl/certs is full of, are left out
+// so each is read once.
+// Directories that can't be read, such as /etc/ssl/private, are listed in
+// unreadable rather than stopping the walk.
+func dirFiles(dir string, maxSize int64) (paths []string, unreadable map[string]error, err error) {
+	seen := make(map[string]bool)
+	unreadable = make(map[string]error)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			unreadable[path] = err
+			return nil
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		target, linkErr := filepath.EvalSymlinks(path)
+		if linkErr != nil {
+			// A dangling link isn't a file to check
+			return nil
+		}
+		info, statErr := os.Stat(target)
+		if statErr != nil || !info.Mode().IsRegular() || info.Size() > maxSize || seen[target] {
+			return nil
+		}
+		seen[target] = true
+		paths = append(paths, path)
+		return nil
+	})
+
+	return
+}
+
+// certDirResults check every cert in a file, found by its contents as PEM,
+// PKCS#12 or DER. Files holding no cert give no results.
+func (options *Options) certDirResults(path string, warnAtDays int) []CertData {
+	file, err := os.Open(path)
+	if err != nil {
+		return options.certResults(path, nil, err, warnAtDays)
+	}
+	defer file.Close()
+	contents, err := readLimited(file, options.MaxCertSize)
+
+	return options.certResults(path, contents, err, warnAtDays)
+}
+
+// certResults make a result for each cert in contents found as PEM, PKCS#12
+// or DER, with File set to name, or one for the error reading them
+func (options *Options) certResults(name string, contents []byte, err error, warnAtDays int) (results []CertData) {
+	result := func(leaf *x509.Certificate, err error) {
+		certData := newCertData()
+		if err != nil {
+			certData.HostError = true
+			certData.Message = err.Error()
+		} else {
+			options.describeCert(&certData, leaf, warnAtDays)
+			certData.Message = "OK"
+		}
+		certData.File = name
+		results = append(results, certData)
+	}
+	if err != nil {
+		result(nil, err)
+		return
+	}
+
+	switch {
+	case bytes.Contains(contents, pemCertBegin):
+		for _, block := range cert.ReadBlocks(contents) {
+			switch {
+			case block.Cert != nil:
+				result(block.Cert, nil)
+			case block.Type == "CERTIFICATE" && block.Status == cert.BlockInvalid:
+				result(nil, fmt.Errorf("invalid certificate at line %d: %s", block.Line, block.Reason))
+			}
+		}
+	case cert.IsPKCS12(contents):
+		bundle, err := cert.ReadPKCS12(contents, options.Password)
+		if err != nil {
+			result(nil, err)
+			return
+		}
+		for _, leaf := range leafFirst(bundle) {
+			result(leaf, nil)
+		}
+	default:
+		if leaf, err := x509.ParseCertificate(contents); err == nil {
+			result(leaf, nil)
+		}
+	}
+
+	return
+}
+
+// ProcessCertDir check every cert in the files under a directory, such as
+// /etc/ssl or /etc/pki. Files are recognized by their contents as PEM, DER or
+// PKCS#12 rather than by their names, and each cert in them gives a result
+// with File set to the path of the file it is in. Up to Options.Concurrency
+// files are read at once. Errors are returned only for a directory that can't
+// be walked.
+func (hostSet *HostSet) ProcessCertDir(dir string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	paths, unreadable, err := dirFiles(dir, options.MaxCertSize)
+	if err != nil {
+		return
+	}
+	sem := semaphore.NewWeighted(int64(options.Concurrency))
+
+	processFile := func(ctx context.Context, path string) ([]CertData, error) {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+		defer sem.Release(1)
+
+		return options.certDirResults(path, warnAtDays), nil
+	}
+
+	promiseSet := gcon.NewPromiseSet[[]CertData]()
+	for _, path := range paths {
+		promiseSet.Add(gcon.Run(context.Background(), path, processFile))
+	}
+	promiseSet.Wait()
+
+	certDataSet = NewCertDataSet()
+	for i, promise := range promiseSet.Promises {
+		results, resultErr := promise.Get()
+		if resultErr != nil {
+			results = []CertData{{File: paths[i], HostError: true, Message: resultErr.Error()}}
+		}
+		certDataSet.CertData = append(certDataSet.CertData, results...)
+	}
+	for path, walkErr := range unreadable {
+		certDataSet.CertData = append(certDataSet.CertData, CertData{File: path, HostError: true, Message: walkErr.Error()})
+	}
+	certDataSet.Finalize()
+
+	return
+}
@@ -0,0 +1,261 @@
+package hosts
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/cert"
+	"github.com/imarsman/certcheck/v2/pkg/gcon"
+	"golang.org/x/sync/semaphore"
+)
+
+// readLimited read all of a certificate file, failing rather than parsing a
+// truncated file if it is larger than maxSize
+func readLimited(reader io.Reader, maxSize int64) ([]byte, error) {
+	contents, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err == nil && int64(len(contents)) > maxSize {
+		return nil, fmt.Errorf("larger than the limit of %d bytes for certificate files", maxSize)
+	}
+
+	return contents, err
+}
+
+// certFileData get cert data for each cert in PEM contents, or in a PKCS#12
+// bundle or Java keystore opened with Options.Password, with Alias set to the
+// keystore entry of each cert. The server cert comes first, with what
+// became of each PEM block, or every cert in a PKCS#12 bundle in Chain. Each
+// cert after it, such as the intermediates and root of a bundle, gives its own
+// result. If no cert can be read the result holding the PEM blocks is
+// returned with the error.
+func (options *Options) certFileData(contents []byte, warnAtDays int) (results []CertData, err error) {
+	certData := newCertData()
+	var bundle []*x509.Certificate
+	aliases := make(map[*x509.Certificate]string)
+	if cert.IsJKS(contents) {
+		var entries []cert.JKSEntry
+		if entries, err = cert.ReadJKS(contents, options.Password); err != nil {
+			return []CertData{certData}, err
+		}
+		for _, entry := range entries {
+			for _, entryCert := range entry.Certs {
+				aliases[entryCert] = entry.Alias
+				bundle = append(bundle, entryCert)
+			}
+		}
+		if len(bundle) == 0 {
+			return []CertData{certData}, errors.New("no certificates in Java keystore")
+		}
+		bundle = leafFirst(bundle)
+	} else if cert.IsPKCS12(contents) {
+		if bundle, err = cert.ReadPKCS12(contents, options.Password); err != nil {
+			return []CertData{certData}, err
+		}
+		bundle = leafFirst(bundle)
+		certData.Chain = chainCerts(bundle)
+		certData.ChainExpiry, certData.EarlyExpiry = chainExpiry(bundle)
+		certData.Warnings = servedWarnings(bundle, options.now())
+	} else {
+		var blocks []cert.Block
+		bundle, blocks, err = cert.ReadCerts(contents)
+		var invalid int
+		certData.PEMBlocks, invalid = pemBlocks(blocks)
+		if err != nil {
+			return []CertData{certData}, err
+		}
+		bundle = leafFirst(bundle)
+		// A cert was found, but the file as a whole isn't good
+		if invalid > 0 {
+			certData.HostError = true
+			certData.Message = fmt.Sprintf("%d of %d PEM blocks invalid", invalid, len(blocks))
+		}
+	}
+	options.describeCert(&certData, bundle[0], warnAtDays)
+	certData.Alias = aliases[bundle[0]]
+	results = append(results, certData)
+	for _, other := range bundle[1:] {
+		otherData := newCertData()
+		options.describeCert(&otherData, other, warnAtDays)
+		otherData.Alias = aliases[other]
+		results = append(results, otherData)
+	}
+
+	return
+}
+
+// describeCert set the fields of cert data that come from a cert read from a
+// file, with expiry calculated at the time of Options.Clock
+func (options *Options) describeCert(certData *CertData, leaf *x509.Certificate, warnAtDays int) {
+	certData.Host = strings.Join(leaf.DNSNames, ", ")
+	certData.Subject = leaf.Subject.String()
+	certData.Role = cert.Role(leaf)
+	certData.Issuer = leaf.Issuer.String()
+	certData.Serial = serialNumber(leaf)
+	certData.Fingerprint, _ = fingerprints([]*x509.Certificate{leaf})
+	certData.KeyType, certData.KeyBits = keyStrength(leaf)
+	certData.WeakKey = weakKey(certData.KeyType, certData.KeyBits)
+	certData.WeakSignature = weakSignatures([]*x509.Certificate{leaf})
+	certData.Validation = validationLevel(leaf)
+	options.matchKey(certData, leaf)
+
+	// Files hold no chain, so only self-signed certs can be classified
+	if isSelfSigned(leaf) {
+		certData.SelfSigned = true
+		certData.IssuerType = issuerSelfSigned
+	}
+	certData.IssuanceSource = issuanceSource(leaf, certData.IssuerType)
+	certData.Distrusted = distrustedIssuer([]*x509.Certificate{leaf}, DefaultDistrusted)
+
+	certData.SetExpiry(leaf.NotBefore, leaf.NotAfter, warnAtDays, options.now())
+}
+
+// leafFirst order the certs of a bundle with the one a server would present
+// first, the first with DNS names that isn't a CA, then the first that isn't a
+// CA, then the first
+func leafFirst(certs []*x509.Certificate) []*x509.Certificate {
+	leaf := -1
+	for i, cert := range certs {
+		if cert.IsCA {
+			continue
+		}
+		if len(cert.DNSNames) > 0 {
+			leaf = i
+			break
+		}
+		if leaf < 0 {
+			leaf = i
+		}
+	}
+	if leaf <= 0 {
+		return certs
+	}
+	ordered := append([]*x509.Certificate{certs[leaf]}, certs[:leaf]...)
+
+	return append(ordered, certs[leaf+1:]...)
+}
+
+// pemBlocks report what became of each block in a file, counting those that
+// are invalid
+func pemBlocks(blocks []cert.Block) (pemBlocks []PEMBlock, invalid int) {
+	for _, block := range blocks {
+		pemBlock := PEMBlock{Line: block.Line, Type: block.Type, Status: block.Status, Reason: block.Reason}
+		if block.Cert != nil {
+			pemBlock.Subject = block.Cert.Subject.String()
+		}
+		if block.Status == cert.BlockInvalid {
+			invalid++
+		}
+		pemBlocks = append(pemBlocks, pemBlock)
+	}
+
+	return
+}
+
+// readCertFile check the certs in a file. A file that can't be read or holds
+// no cert gives a result with HostError set.
+func (options *Options) readCertFile(path string, warnAtDays int) []CertData {
+	file, err := os.Open(path)
+	if err != nil {
+		return options.certFileResults(path, nil, err, warnAtDays)
+	}
+	defer file.Close()
+	contents, err := readLimited(file, options.MaxCertSize)
+
+	return options.certFileResults(path, contents, err, warnAtDays)
+}
+
+// ProcessCertReader check the certs in what a reader gives, such as PEM piped
+// from another tool, as if it were a file. The results have File set to name.
+func (hostSet *HostSet) ProcessCertReader(name string, reader io.Reader, warnAtDays int) *CertDataSet {
+	options := hostSet.Options.withDefaults()
+	contents, err := readLimited(reader, options.MaxCertSize)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(options.certFileResults(name, contents, err, warnAtDays)...)
+
+	return certDataSet
+}
+
+// certFileResults make a result for each cert in the contents of a file, or
+// one for the error reading them
+func (options *Options) certFileResults(path string, contents []byte, err error, warnAtDays int) (results []CertData) {
+	if err == nil {
+		results, err = options.certFileData(contents, warnAtDays)
+	}
+	if err != nil {
+		var certData CertData
+		if len(results) > 0 {
+			certData = results[0]
+		}
+		certData.Message = err.Error()
+		certData.HostError = true
+		results = []CertData{certData}
+	}
+	for i := range results {
+		if results[i].Message == "" {
+			results[i].Message = "OK"
+		}
+		results[i].File = path
+	}
+
+	return
+}
+
+// CertFiles find the files under a directory with extensions used for PEM
+// certificates, .pem, .crt and .cer
+func CertFiles(dir string) (paths []string, err error) {
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && isListed(rootExtensions, filepath.Ext(path)) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return
+}
+
+// ProcessCertFiles check the certs in each file concurrently, with up to
+// Options.Concurrency files read at once. Each cert in a bundle gives a result
+// with Role set, and each result has File set to the path it came from.
+// Failures are reported as HostError results.
+func (hostSet *HostSet) ProcessCertFiles(paths []string, warnAtDays int) *CertDataSet {
+	options := hostSet.Options.withDefaults()
+	sem := semaphore.NewWeighted(int64(options.Concurrency))
+
+	processFile := func(ctx context.Context, path string) ([]CertData, error) {
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return []CertData{{File: path}}, err
+		}
+		defer sem.Release(1)
+
+		return options.readCertFile(path, warnAtDays), nil
+	}
+
+	promiseSet := gcon.NewPromiseSet[[]CertData]()
+	for _, path := range paths {
+		promiseSet.Add(gcon.Run(context.Background(), path, processFile))
+	}
+	promiseSet.Wait()
+
+	certDataSet := NewCertDataSet()
+	for _, promise := range promiseSet.Promises {
+		results, err := promise.Get()
+		if err != nil {
+			results[0].HostError = true
+			results[0].Message = err.Error()
+		}
+		certDataSet.CertData = append(certDataSet.CertData, results...)
+	}
+	certDataSet.Finalize()
+
+	return certDataSet
+}
@@ -0,0 +1,156 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Chain status values
+const (
+	chainComplete   = "complete"
+	chainIncomplete = "incomplete"
+)
+
+// maxAIAFetches most issuers fetched to complete a chain
+const maxAIAFetches = 4
+
+// verifyServed verify the leaf using only the certs the server sent plus any
+// extra intermediates, as clients that neither fetch nor cache intermediates
+// do. Roots are the system roots if nil.
+func verifyServed(host string, certs []*x509.Certificate, roots *x509.CertPool, extra ...*x509.Certificate) (err error) {
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	for _, cert := range extra {
+		intermediates.AddCert(cert)
+	}
+	_, err = certs[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Roots:         roots,
+		Intermediates: intermediates,
+	})
+
+	return
+}
+
+// fetchIssuer download the issuer of a cert from the CA issuers URL in its
+// authority information access extension
+func (options *Options) fetchIssuer(ctx context.Context, cert *x509.Certificate) (issuer *x509.Certificate, err error) {
+	if len(cert.IssuingCertificateURL) == 0 {
+		err = fmt.Errorf("%s names no issuer URL", cert.Subject)
+		return
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, cert.IssuingCertificateURL[0], nil)
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: options.Timeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("issuer URL %s returned status %d", cert.IssuingCertificateURL[0], response.StatusCode)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<16))
+	if err != nil {
+		return
+	}
+
+	// Issuers are usually DER but some CAs publish PEM
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+
+	return x509.ParseCertificate(body)
+}
+
+// checkChain check that the certs a verified server sent chain to a root on
+// their own. Platform verifiers that fetch missing intermediates can hide an
+// incomplete chain that fails on mobile clients and curl.
+func checkChain(host string, certs []*x509.Certificate, roots *x509.CertPool) (status string, err error) {
+	err = verifyServed(host, certs, roots)
+	if err != nil {
+		last := certs[len(certs)-1]
+		return chainIncomplete, fmt.Errorf("incomplete chain, server does not send the intermediate that issued %s", last.Subject)
+	}
+
+	return chainComplete, nil
+}
+
+// diagnoseChain find out if a handshake failed on an unknown authority because
+// the server left out an intermediate. If fetching the missing issuer lets the
+// chain verify the error says so, otherwise the handshake error is kept.
+func (options *Options) diagnoseChain(ctx context.Context, host, address, port, protocol string, roots *x509.CertPool, handshakeErr error) (status string, err error) {
+	err = handshakeErr
+	var unknown x509.UnknownAuthorityError
+	if !errors.As(handshakeErr, &unknown) {
+		return
+	}
+
+	config := options.tlsConfig(host)
+	config.InsecureSkipVerify = true
+	conn, dialErr := options.dialTLS(ctx, address, port, protocol, config)
+	if dialErr != nil {
+		return
+	}
+	defer conn.Close()
+	certs := conn.ConnectionState().PeerCertificates
+
+	last := certs[len(certs)-1]
+	issuer, fetchErr := options.fetchIssuer(ctx, last)
+	if fetchErr != nil {
+		return
+	}
+	if verifyServed(host, certs, roots, issuer) != nil {
+		return
+	}
+
+	return chainIncomplete, fmt.Errorf("incomplete chain, server does not send intermediate %s", issuer.Subject)
+}
+
+// chaseAIA verify the certs a server sent, fetching issuers from their AIA
+// URLs in turn when the chain doesn't reach a root, as browsers do. chased is
+// true if fetched intermediates were needed. The original error is returned
+// if fetching doesn't help.
+func (options *Options) chaseAIA(ctx context.Context, host string, certs []*x509.Certificate) (chased bool, err error) {
+	err = verifyServed(host, certs, options.Roots)
+	var unknown x509.UnknownAuthorityError
+	if err == nil || !errors.As(err, &unknown) {
+		return
+	}
+
+	var fetched []*x509.Certificate
+	last := certs[len(certs)-1]
+	for i := 0; i < maxAIAFetches; i++ {
+		issuer, fetchErr := options.fetchIssuer(ctx, last)
+		if fetchErr != nil {
+			return
+		}
+		fetched = append(fetched, issuer)
+		if verifyServed(host, certs, options.Roots, fetched...) == nil {
+			return true, nil
+		}
+		last = issuer
+	}
+
+	return
+}
+
+// verifyChasingAIA get a VerifyConnection callback for a handshake that
+// verifies with chaseAIA, setting chased if it needed fetched intermediates
+func (options *Options) verifyChasingAIA(ctx context.Context, host string, chased *bool) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) (err error) {
+		*chased, err = options.chaseAIA(ctx, host, state.PeerCertificates)
+		return
+	}
+}
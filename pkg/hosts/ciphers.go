@@ -0,0 +1,29 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+)
+
+// probeWeakCiphers try a handshake offering each cipher suite Go considers
+// insecure on its own and return the suites the server accepts. Export grade
+// suites cannot be offered by crypto/tls and are not probed. TLS 1.3 suites
+// are all strong so handshakes are limited to TLS 1.2 and below.
+func (options *Options) probeWeakCiphers(ctx context.Context, host, address, port, protocol string) (accepted []string) {
+	for _, suite := range tls.InsecureCipherSuites() {
+		config := options.tlsConfig(host)
+		config.MinVersion = tls.VersionTLS10
+		config.MaxVersion = tls.VersionTLS12
+		config.CipherSuites = []uint16{suite.ID}
+		config.InsecureSkipVerify = true
+
+		conn, err := options.dialTLS(ctx, address, port, protocol, config)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		accepted = append(accepted, suite.Name)
+	}
+
+	return
+}
@@ -0,0 +1,165 @@
+package hosts
+
+import (
+	"context"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// Prefix lengths of the networks costs are grouped by
+const (
+	costIPv4Bits = 24
+	costIPv6Bits = 64
+)
+
+// Cost connections, bytes and DNS queries of a run
+type Cost = model.Cost
+
+// costCount counters for a run or one network
+type costCount struct {
+	connections int64
+	sent        int64
+	received    int64
+}
+
+// CostMeter count the connections and bytes sent to checked hosts and the DNS
+// queries made for them, so the impact of a scan can be judged. A meter is
+// safe to share between checks.
+type CostMeter struct {
+	ByNetwork bool // also count connections and bytes for each /24 or /64 network
+
+	dnsQueries int64
+	total      costCount
+	mu         sync.Mutex
+	networks   map[string]*costCount
+}
+
+// NewCostMeter make a meter, counting by network if byNetwork is set
+func NewCostMeter(byNetwork bool) *CostMeter {
+	return &CostMeter{ByNetwork: byNetwork, networks: make(map[string]*costCount)}
+}
+
+// network get the counters for the network of an address
+func (meter *CostMeter) network(address string) *costCount {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return nil
+	}
+	mask := net.CIDRMask(costIPv6Bits, 8*net.IPv6len)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip, mask = ip4, net.CIDRMask(costIPv4Bits, 8*net.IPv4len)
+	}
+	prefix := (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	count, ok := meter.networks[prefix]
+	if !ok {
+		count = new(costCount)
+		meter.networks[prefix] = count
+	}
+
+	return count
+}
+
+// countedConn count the bytes read and written on a connection
+type countedConn struct {
+	net.Conn
+	counts []*costCount
+}
+
+// Read read and count the bytes received
+func (conn *countedConn) Read(p []byte) (n int, err error) {
+	n, err = conn.Conn.Read(p)
+	for _, count := range conn.counts {
+		atomic.AddInt64(&count.received, int64(n))
+	}
+
+	return
+}
+
+// Write write and count the bytes sent
+func (conn *countedConn) Write(p []byte) (n int, err error) {
+	n, err = conn.Conn.Write(p)
+	for _, count := range conn.counts {
+		atomic.AddInt64(&count.sent, int64(n))
+	}
+
+	return
+}
+
+// conn count a connection to a checked host and the bytes sent over it. A nil
+// meter counts nothing.
+func (meter *CostMeter) conn(conn net.Conn) net.Conn {
+	if meter == nil {
+		return conn
+	}
+	counts := []*costCount{&meter.total}
+	if meter.ByNetwork {
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if count := meter.network(host); count != nil {
+			counts = append(counts, count)
+		}
+	}
+	for _, count := range counts {
+		atomic.AddInt64(&count.connections, 1)
+	}
+
+	return &countedConn{Conn: conn, counts: counts}
+}
+
+// Resolver get a resolver that counts each DNS query it sends, including
+// retries. The resolver is used in place of the given one, which may be nil
+// for the system name servers. Queries are always sent by the Go resolver so
+// they can be counted.
+func (meter *CostMeter) Resolver(resolver *net.Resolver) *net.Resolver {
+	counted := &net.Resolver{PreferGo: true}
+	var dial func(ctx context.Context, network, address string) (net.Conn, error)
+	if resolver != nil {
+		counted.StrictErrors = resolver.StrictErrors
+		dial = resolver.Dial
+	}
+	if dial == nil {
+		dialer := new(net.Dialer)
+		dial = dialer.DialContext
+	}
+	counted.Dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+		atomic.AddInt64(&meter.dnsQueries, 1)
+		return dial(ctx, network, address)
+	}
+
+	return counted
+}
+
+// Report get the counts so far, with networks in order of connections made
+func (meter *CostMeter) Report() *Cost {
+	cost := &Cost{
+		Connections:   atomic.LoadInt64(&meter.total.connections),
+		BytesSent:     atomic.LoadInt64(&meter.total.sent),
+		BytesReceived: atomic.LoadInt64(&meter.total.received),
+		DNSQueries:    atomic.LoadInt64(&meter.dnsQueries),
+	}
+
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	for prefix, count := range meter.networks {
+		cost.Networks = append(cost.Networks, model.NetworkCost{
+			Network:       prefix,
+			Connections:   atomic.LoadInt64(&count.connections),
+			BytesSent:     atomic.LoadInt64(&count.sent),
+			BytesReceived: atomic.LoadInt64(&count.received),
+		})
+	}
+	sort.Slice(cost.Networks, func(i, j int) bool {
+		if cost.Networks[i].Connections != cost.Networks[j].Connections {
+			return cost.Networks[i].Connections > cost.Networks[j].Connections
+		}
+		return cost.Networks[i].Network < cost.Networks[j].Network
+	})
+
+	return cost
+}
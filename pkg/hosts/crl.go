@@ -0,0 +1,54 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+)
+
+// CRL status values
+const (
+	crlGood        = "good"
+	crlRevoked     = "revoked"
+	crlNone        = "none"
+	crlUnavailable = "unavailable"
+)
+
+// chainOf get the certificate chain from a handshake, preferring the verified
+// chain
+func chainOf(state tls.ConnectionState) []*x509.Certificate {
+	if len(state.VerifiedChains) > 0 {
+		return state.VerifiedChains[0]
+	}
+
+	return state.PeerCertificates
+}
+
+// checkCRLs check the leaf and each intermediate against the CRLs of their
+// distribution points. A revoked certificate is an error. CRLs that can't be
+// fetched or verified are reported in the status only.
+func (options *Options) checkCRLs(ctx context.Context, state tls.ConnectionState) (status, revokedAt string, err error) {
+	chain := chainOf(state)
+	status = crlNone
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		if len(cert.CRLDistributionPoints) == 0 {
+			continue
+		}
+		revoked, at, checkErr := options.CRLCache.Check(ctx, cert, issuer)
+		switch {
+		case checkErr != nil:
+			status = crlUnavailable
+		case revoked:
+			status = crlRevoked
+			revokedAt = at.UTC().Format(timeFormat)
+			err = fmt.Errorf("certificate %s revoked by CRL at %s", cert.Subject.CommonName, revokedAt)
+			return
+		case status == crlNone:
+			status = crlGood
+		}
+	}
+
+	return
+}
@@ -0,0 +1,120 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// csrBlockTypes PEM block types used for certificate signing requests, the
+// second by older versions of Netscape and Microsoft tools
+var csrBlockTypes = map[string]bool{
+	"CERTIFICATE REQUEST":     true,
+	"NEW CERTIFICATE REQUEST": true,
+}
+
+// ReadCSR read a PEM or DER certificate signing request file and summarize
+// it. A file that can't be read or parsed, or is larger than MaxCertSize, is
+// reported with Error set.
+func (options *Options) ReadCSR(path string) (csrData CSRData) {
+	csrData.File = path
+	file, err := os.Open(path)
+	if err == nil {
+		defer file.Close()
+		var contents []byte
+		contents, err = readLimited(file, options.withDefaults().MaxCertSize)
+		if err == nil {
+			var csr *x509.CertificateRequest
+			if csr, err = parseCSR(contents); err == nil {
+				describeCSR(&csrData, csr)
+			}
+		}
+	}
+	if err != nil {
+		csrData.Error = true
+		csrData.Message = err.Error()
+	}
+
+	return
+}
+
+// parseCSR get the first certificate signing request in PEM data, or the data
+// itself as DER if it has no PEM blocks
+func parseCSR(contents []byte) (*x509.CertificateRequest, error) {
+	rest := contents
+	sawPEM := false
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		sawPEM = true
+		if csrBlockTypes[block.Type] {
+			return x509.ParseCertificateRequest(block.Bytes)
+		}
+	}
+	if sawPEM {
+		return nil, errors.New("no certificate request found")
+	}
+
+	return x509.ParseCertificateRequest(contents)
+}
+
+// describeCSR set the fields of CSR data from a parsed request, listing in
+// Problems what a CA would likely reject it for
+func describeCSR(csrData *CSRData, csr *x509.CertificateRequest) {
+	csrData.Subject = csr.Subject.String()
+	csrData.DNSNames = csr.DNSNames
+	for _, ip := range csr.IPAddresses {
+		csrData.IPAddresses = append(csrData.IPAddresses, ip.String())
+	}
+	csrData.EmailAddresses = csr.EmailAddresses
+	for _, uri := range csr.URIs {
+		csrData.URIs = append(csrData.URIs, uri.String())
+	}
+	csrData.KeyType, csrData.KeyBits = publicKeyStrength(csr.PublicKey, csr.PublicKeyAlgorithm)
+	csrData.WeakKey = weakKey(csrData.KeyType, csrData.KeyBits)
+	csrData.SignatureAlgorithm = csr.SignatureAlgorithm.String()
+
+	if err := csr.CheckSignature(); err != nil {
+		csrData.Problems = append(csrData.Problems, fmt.Sprintf("signature does not verify: %v", err))
+	}
+	if csrData.WeakKey {
+		csrData.Problems = append(csrData.Problems, fmt.Sprintf("%s key of %d bits is too small", csrData.KeyType, csrData.KeyBits))
+	}
+	if weakSignatureAlgorithms[csr.SignatureAlgorithm] {
+		csrData.Problems = append(csrData.Problems, fmt.Sprintf("signed with %s", csr.SignatureAlgorithm))
+	}
+	// CAs issue only for the names in SANs, ignoring the common name
+	if len(csr.DNSNames) == 0 && len(csr.IPAddresses) == 0 {
+		csrData.Problems = append(csrData.Problems, "no DNS names or IP addresses in subject alternative names")
+	} else if name := csr.Subject.CommonName; name != "" && !csrNamed(csr, name) {
+		csrData.Problems = append(csrData.Problems, fmt.Sprintf("common name %s is not in subject alternative names", name))
+	}
+
+	csrData.Message = "OK"
+	if len(csrData.Problems) > 0 {
+		csrData.Message = strings.Join(csrData.Problems, "; ")
+	}
+}
+
+// csrNamed whether a request lists a name among its DNS names or IP
+// addresses
+func csrNamed(csr *x509.CertificateRequest, name string) bool {
+	for _, dnsName := range csr.DNSNames {
+		if strings.EqualFold(dnsName, name) {
+			return true
+		}
+	}
+	for _, ip := range csr.IPAddresses {
+		if ip.String() == name {
+			return true
+		}
+	}
+
+	return false
+}
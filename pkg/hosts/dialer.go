@@ -0,0 +1,182 @@
+package hosts
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// sourceIP get the local address to connect to an address from,
+// Options.SourceIP or an address of Options.Interface of the same family, or
+// nil to let the system choose. Host names are reached over IPv4 from an
+// interface that has an IPv4 address.
+func (options *Options) sourceIP(address string) (source net.IP, err error) {
+	if options.SourceIP != nil {
+		return options.SourceIP, nil
+	}
+	if options.Interface == "" {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(options.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %v", options.Interface, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %v", options.Interface, err)
+	}
+
+	target := net.ParseIP(address)
+	var fallback net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ip := ipNet.IP
+		isV4 := ip.To4() != nil
+		switch {
+		case target != nil && isV4 == (target.To4() != nil):
+			return ip, nil
+		case target == nil && isV4:
+			return ip, nil
+		case fallback == nil && target == nil:
+			fallback = ip
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+
+	return nil, fmt.Errorf("interface %s has no address to reach %s from", options.Interface, address)
+}
+
+// dialer get a dialer for connections to an address, from the source address
+// or interface set in Options if any
+func (options *Options) dialer(address string) (dialer *net.Dialer, err error) {
+	dialer = &net.Dialer{Timeout: options.Timeout, Resolver: options.Resolver}
+	source, err := options.sourceIP(address)
+	if err != nil {
+		return nil, err
+	}
+	if source != nil {
+		dialer.LocalAddr = &net.TCPAddr{IP: source}
+	}
+
+	return
+}
+
+// dial connect to an address and port, through Options.Proxy if set, counting
+// what is sent if Options.Cost is set
+func (options *Options) dial(ctx context.Context, address, port string) (conn net.Conn, err error) {
+	if options.Proxy != nil {
+		conn, err = options.dialProxy(ctx, net.JoinHostPort(address, port))
+	} else {
+		var dialer *net.Dialer
+		if dialer, err = options.dialer(address); err != nil {
+			return
+		}
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, port))
+	}
+	if err != nil {
+		return
+	}
+
+	return options.Cost.conn(conn), nil
+}
+
+// proxyConn a connection tunnelled through a proxy, reading first what was
+// buffered while reading the proxy's response
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	remote net.Addr
+}
+
+// Read implement net.Conn
+func (conn *proxyConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
+
+// RemoteAddr implement net.Conn with the address the proxy connected to
+// rather than the proxy's own, if it is known
+func (conn *proxyConn) RemoteAddr() net.Addr {
+	return conn.remote
+}
+
+// proxyAddr the address of a tunnel to a host name, which only the proxy
+// resolved
+type proxyAddr string
+
+// Network implement net.Addr
+func (addr proxyAddr) Network() string {
+	return "tcp"
+}
+
+// String implement net.Addr
+func (addr proxyAddr) String() string {
+	return string(addr)
+}
+
+// dialProxy connect to an address through the HTTP proxy in Options.Proxy
+// with a CONNECT request
+func (options *Options) dialProxy(ctx context.Context, address string) (conn net.Conn, err error) {
+	proxy := options.Proxy
+	if proxy.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported proxy scheme %s, expected http", proxy.Scheme)
+	}
+	proxyAddress := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddress = net.JoinHostPort(proxy.Hostname(), httpDefaultPort)
+	}
+	dialer, err := options.dialer(proxy.Hostname())
+	if err != nil {
+		return
+	}
+	conn, err = dialer.DialContext(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return
+	}
+	conn.SetDeadline(time.Now().Add(options.Timeout))
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err = request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused to connect to %s: %s", proxy.Host, address, response.Status)
+	}
+
+	var remote net.Addr = proxyAddr(address)
+	if host, port, _ := net.SplitHostPort(address); net.ParseIP(host) != nil {
+		portNumber, _ := strconv.Atoi(port)
+		remote = &net.TCPAddr{IP: net.ParseIP(host), Port: portNumber}
+	}
+
+	return &proxyConn{Conn: conn, reader: reader, remote: remote}, nil
+}
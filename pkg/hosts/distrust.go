@@ -0,0 +1,129 @@
+package hosts
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// DistrustedCA a CA that browsers no longer trust, found in a chain by its
+// common name or the pin of its key
+type DistrustedCA struct {
+	Name  string    // common name of the CA, matched as a subject or issuer
+	Pin   string    // base64 SHA-256 hash of the CA's SubjectPublicKeyInfo, if not matched by name
+	Since time.Time // only leaf certs issued after this are distrusted, all if zero
+}
+
+// distrustDate a date a partial distrust applies from
+func distrustDate(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// DefaultDistrusted roots removed from browser trust stores, for chains that
+// still end in them. Entrust, Chunghwa and NetLock roots are only distrusted
+// for certs issued after browsers stopped accepting new ones.
+var DefaultDistrusted = []DistrustedCA{
+	// Legacy Symantec PKI, including GeoTrust, thawte and VeriSign roots
+	{Name: "VeriSign Class 3 Public Primary Certification Authority - G4"},
+	{Name: "VeriSign Class 3 Public Primary Certification Authority - G5"},
+	{Name: "VeriSign Universal Root Certification Authority"},
+	{Name: "Symantec Class 3 Public Primary Certification Authority - G4"},
+	{Name: "Symantec Class 3 Public Primary Certification Authority - G6"},
+	{Name: "GeoTrust Global CA"},
+	{Name: "GeoTrust Primary Certification Authority"},
+	{Name: "GeoTrust Primary Certification Authority - G2"},
+	{Name: "GeoTrust Primary Certification Authority - G3"},
+	{Name: "GeoTrust Universal CA"},
+	{Name: "GeoTrust Universal CA 2"},
+	{Name: "thawte Primary Root CA"},
+	{Name: "thawte Primary Root CA - G2"},
+	{Name: "thawte Primary Root CA - G3"},
+	// WoSign, StartCom, CNNIC, DigiNotar, Certinomis, Camerfirma, TrustCor and e-Tugra
+	{Name: "Certification Authority of WoSign"},
+	{Name: "Certification Authority of WoSign G2"},
+	{Name: "CA WoSign ECC Root"},
+	{Name: "StartCom Certification Authority"},
+	{Name: "StartCom Certification Authority G2"},
+	{Name: "CNNIC ROOT"},
+	{Name: "China Internet Network Information Center EV Certificates Root"},
+	{Name: "DigiNotar Root CA"},
+	{Name: "Certinomis - Root CA"},
+	{Name: "Chambers of Commerce Root - 2008"},
+	{Name: "Global Chambersign Root - 2008"},
+	{Name: "TrustCor RootCert CA-1"},
+	{Name: "TrustCor RootCert CA-2"},
+	{Name: "TrustCor ECA-1"},
+	{Name: "E-Tugra Certification Authority"},
+	{Name: "E-Tugra Global Root CA RSA v3"},
+	{Name: "E-Tugra Global Root CA ECC v3"},
+	// Distrusted for new certs only
+	{Name: "Entrust Root Certification Authority", Since: distrustDate(2024, time.November, 12)},
+	{Name: "Entrust Root Certification Authority - G2", Since: distrustDate(2024, time.November, 12)},
+	{Name: "Entrust Root Certification Authority - EC1", Since: distrustDate(2024, time.November, 12)},
+	{Name: "Entrust.net Certification Authority (2048)", Since: distrustDate(2024, time.November, 12)},
+	{Name: "AffirmTrust Commercial", Since: distrustDate(2024, time.November, 12)},
+	{Name: "AffirmTrust Networking", Since: distrustDate(2024, time.November, 12)},
+	{Name: "AffirmTrust Premium", Since: distrustDate(2024, time.November, 12)},
+	{Name: "AffirmTrust Premium ECC", Since: distrustDate(2024, time.November, 12)},
+	{Name: "ePKI Root Certification Authority", Since: distrustDate(2025, time.August, 1)},
+	{Name: "HiPKI Root CA - G1", Since: distrustDate(2025, time.August, 1)},
+	{Name: "NetLock Arany (Class Gold) Főtanúsítvány", Since: distrustDate(2025, time.August, 1)},
+}
+
+// ReadDistrusted read a list of distrusted CAs. Each line is a CA common name
+// or a base64 SHA-256 hash of its SubjectPublicKeyInfo with a sha256/ prefix
+// as in HPKP. Blank lines and lines starting with # are skipped.
+func ReadDistrusted(reader io.Reader) (distrusted []DistrustedCA, err error) {
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !strings.HasPrefix(text, "sha256/") {
+			distrusted = append(distrusted, DistrustedCA{Name: text})
+			continue
+		}
+		pin := strings.TrimPrefix(text, "sha256/")
+		decoded, decodeErr := base64.StdEncoding.DecodeString(pin)
+		if decodeErr != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("line %d: invalid pin %s", line, pin)
+		}
+		distrusted = append(distrusted, DistrustedCA{Pin: pin})
+	}
+	err = scanner.Err()
+
+	return
+}
+
+// distrustedIssuer find a distrusted CA that the chain of a leaf goes through
+// or ends in, naming it by common name. The root itself is often not sent,
+// so issuer names are checked as well as the certs in the chain.
+func distrustedIssuer(chain []*x509.Certificate, distrusted []DistrustedCA) string {
+	if len(chain) == 0 {
+		return ""
+	}
+	issued := chain[0].NotBefore
+	for _, ca := range distrusted {
+		if !ca.Since.IsZero() && issued.Before(ca.Since) {
+			continue
+		}
+		for i, cert := range chain {
+			switch {
+			case ca.Pin != "" && i > 0 && spkiPin(cert) == ca.Pin:
+				return cert.Subject.CommonName
+			case ca.Name != "" && i > 0 && cert.Subject.CommonName == ca.Name:
+				return ca.Name
+			case ca.Name != "" && cert.Issuer.CommonName == ca.Name:
+				return ca.Name
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,175 @@
+package hosts
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/crl"
+)
+
+// Features optional checks that can be enabled together. Each one adds
+// connections or lookups to the check of a host.
+type Features uint
+
+// Optional checks
+const (
+	FeatureProbeTLS      Features = 1 << iota // Options.ProbeTLS
+	FeatureProbeSession                       // Options.ProbeSession
+	FeatureCheckOCSP                          // Options.CheckOCSP
+	FeatureCheckCRL                           // Options.CRLCache, with a memory only cache
+	FeatureCheckCAA                           // Options.CheckCAA
+	FeatureHTTPProbe                          // Options.HTTPProbe
+	FeatureAllIPs                             // Options.AllIPs
+	FeatureProbeCiphers                       // Options.ProbeCiphers
+	FeatureCheckChain                         // Options.CheckChain
+	FeatureCheckACMEDNS                       // Options.CheckACMEDNS
+	FeatureProbeKeyTypes                      // Options.ProbeKeyTypes
+)
+
+// featureNames names of features in bit order
+var featureNames = []string{"probetls", "probesession", "checkocsp", "checkcrl", "checkcaa", "httpprobe", "allips", "probeciphers", "checkchain", "checkacmedns", "probekeytypes"}
+
+// Has check if every feature in other is set
+func (features Features) Has(other Features) bool {
+	return features&other == other
+}
+
+// String get the names of the features separated by commas
+func (features Features) String() string {
+	var names []string
+	for i, name := range featureNames {
+		if features.Has(1 << i) {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ",")
+}
+
+// ParseFeatures get features from names separated by commas
+func ParseFeatures(names string) (features Features, err error) {
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, featureName := range featureNames {
+			if name == featureName {
+				features |= 1 << i
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown feature %s", name)
+		}
+	}
+
+	return
+}
+
+// Features get the optional checks enabled in options
+func (options *Options) Features() (features Features) {
+	enabled := []bool{
+		options.ProbeTLS, options.ProbeSession, options.CheckOCSP, options.CRLCache != nil,
+		options.CheckCAA, options.HTTPProbe, options.AllIPs, options.ProbeCiphers,
+		options.CheckChain, options.CheckACMEDNS, options.ProbeKeyTypes,
+	}
+	for i, on := range enabled {
+		if on {
+			features |= 1 << i
+		}
+	}
+
+	return
+}
+
+// Enable turn on optional checks. Checks already on stay on.
+func (options *Options) Enable(features Features) {
+	options.ProbeTLS = options.ProbeTLS || features.Has(FeatureProbeTLS)
+	options.ProbeSession = options.ProbeSession || features.Has(FeatureProbeSession)
+	options.CheckOCSP = options.CheckOCSP || features.Has(FeatureCheckOCSP)
+	options.CheckCAA = options.CheckCAA || features.Has(FeatureCheckCAA)
+	options.HTTPProbe = options.HTTPProbe || features.Has(FeatureHTTPProbe)
+	options.AllIPs = options.AllIPs || features.Has(FeatureAllIPs)
+	options.ProbeCiphers = options.ProbeCiphers || features.Has(FeatureProbeCiphers)
+	options.CheckChain = options.CheckChain || features.Has(FeatureCheckChain)
+	options.CheckACMEDNS = options.CheckACMEDNS || features.Has(FeatureCheckACMEDNS)
+	options.ProbeKeyTypes = options.ProbeKeyTypes || features.Has(FeatureProbeKeyTypes)
+	if features.Has(FeatureCheckCRL) && options.CRLCache == nil {
+		options.CRLCache = crl.NewCache("", options.withDefaults().Timeout)
+	}
+}
+
+// Disable turn off optional checks
+func (options *Options) Disable(features Features) {
+	options.ProbeTLS = options.ProbeTLS && !features.Has(FeatureProbeTLS)
+	options.ProbeSession = options.ProbeSession && !features.Has(FeatureProbeSession)
+	options.CheckOCSP = options.CheckOCSP && !features.Has(FeatureCheckOCSP)
+	options.CheckCAA = options.CheckCAA && !features.Has(FeatureCheckCAA)
+	options.HTTPProbe = options.HTTPProbe && !features.Has(FeatureHTTPProbe)
+	options.AllIPs = options.AllIPs && !features.Has(FeatureAllIPs)
+	options.ProbeCiphers = options.ProbeCiphers && !features.Has(FeatureProbeCiphers)
+	options.CheckChain = options.CheckChain && !features.Has(FeatureCheckChain)
+	options.CheckACMEDNS = options.CheckACMEDNS && !features.Has(FeatureCheckACMEDNS)
+	options.ProbeKeyTypes = options.ProbeKeyTypes && !features.Has(FeatureProbeKeyTypes)
+	if features.Has(FeatureCheckCRL) {
+		options.CRLCache = nil
+	}
+}
+
+// Profile a preset of optional checks and settings for a kind of scan
+type Profile struct {
+	Timeout  time.Duration
+	Retries  int
+	Features Features
+}
+
+// Profiles scan presets by name
+var Profiles = map[string]Profile{
+	// fast checks expiry only and gives up quickly
+	"fast": {Timeout: 3 * time.Second},
+	// thorough adds protocol and revocation checks and retries
+	"thorough": {
+		Timeout:  15 * time.Second,
+		Retries:  1,
+		Features: FeatureProbeTLS | FeatureProbeSession | FeatureCheckOCSP | FeatureCheckCRL | FeatureCheckChain,
+	},
+	// audit adds issuance policy, cipher and HTTP checks of every address
+	"audit": {
+		Timeout: 20 * time.Second,
+		Retries: 2,
+		Features: FeatureProbeTLS | FeatureProbeSession | FeatureCheckOCSP | FeatureCheckCRL | FeatureCheckChain |
+			FeatureCheckCAA | FeatureHTTPProbe | FeatureAllIPs | FeatureProbeCiphers | FeatureProbeKeyTypes,
+	},
+}
+
+// ProfileNames names of the profiles in order
+func ProfileNames() (names []string) {
+	for name := range Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// ApplyProfile enable the checks of a named profile, using its timeout and
+// retries where options has none
+func (options *Options) ApplyProfile(name string) (err error) {
+	profile, ok := Profiles[name]
+	if !ok {
+		return fmt.Errorf("unknown profile %s", name)
+	}
+	if options.Timeout == 0 {
+		options.Timeout = profile.Timeout
+	}
+	if options.Retries == 0 {
+		options.Retries = profile.Retries
+	}
+	options.Enable(profile.Features)
+
+	return
+}
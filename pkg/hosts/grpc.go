@@ -0,0 +1,158 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// alpnH2 the ALPN protocol gRPC runs over
+const alpnH2 = "h2"
+
+// grpcHealthPath the method of the standard gRPC health checking protocol
+const grpcHealthPath = "/grpc.health.v1.Health/Check"
+
+// grpcServingStatus names for the HealthCheckResponse ServingStatus enum
+var grpcServingStatus = map[uint64]string{
+	0: "unknown",
+	1: "serving",
+	2: "not_serving",
+	3: "service_unknown",
+}
+
+// grpcHealthRequest make a length prefixed HealthCheckRequest message for a
+// service, with the empty name asking about the server as a whole
+func grpcHealthRequest(service string) []byte {
+	var message []byte
+	if service != "" {
+		length := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(length, uint64(len(service)))
+		message = append([]byte{0x0a}, length[:n]...)
+		message = append(message, service...)
+	}
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+
+	return append(frame, message...)
+}
+
+// parseGRPCHealth get the status from a length prefixed HealthCheckResponse
+func parseGRPCHealth(body []byte) (status string, err error) {
+	if len(body) < 5 || body[0] != 0 {
+		err = errors.New("invalid gRPC health response")
+		return
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint32(len(body)-5) < length {
+		err = errors.New("truncated gRPC health response")
+		return
+	}
+	message := body[5 : 5+length]
+
+	// An empty message has the default status of unknown
+	var value uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 || key&7 != 0 {
+			err = errors.New("invalid gRPC health response")
+			return
+		}
+		message = message[n:]
+		var v uint64
+		v, n = binary.Uvarint(message)
+		if n <= 0 {
+			err = errors.New("invalid gRPC health response")
+			return
+		}
+		message = message[n:]
+		if key>>3 == 1 {
+			value = v
+		}
+	}
+	status, ok := grpcServingStatus[value]
+	if !ok {
+		status = fmt.Sprintf("status %d", value)
+	}
+
+	return
+}
+
+// grpcHealth call the gRPC health service over HTTP/2 at the address the TLS
+// check connected to and return the serving status
+func (options *Options) grpcHealth(ctx context.Context, host, address, port string) (status string, err error) {
+	if address == "" {
+		address = host
+	}
+	client := options.httpClient(address)
+	client.Transport.(*http.Transport).ForceAttemptHTTP2 = true
+
+	url := "https://" + net.JoinHostPort(host, port) + grpcHealthPath
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(grpcHealthRequest(options.GRPCService)))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<16))
+	if err != nil {
+		return
+	}
+	if response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("gRPC health check got HTTP status %d", response.StatusCode)
+		return
+	}
+
+	// A call that fails at once may send its status in the headers
+	grpcStatus := response.Trailer.Get("Grpc-Status")
+	grpcMessage := response.Trailer.Get("Grpc-Message")
+	if grpcStatus == "" {
+		grpcStatus = response.Header.Get("Grpc-Status")
+		grpcMessage = response.Header.Get("Grpc-Message")
+	}
+	if grpcStatus != "0" {
+		err = fmt.Errorf("gRPC health check failed with status %s %s", grpcStatus, grpcMessage)
+		return
+	}
+
+	return parseGRPCHealth(body)
+}
+
+// checkGRPC check that the server negotiated HTTP/2 and, if asked, that its
+// health service reports it is serving. The status is unreachable if the
+// health check could not be made.
+func (options *Options) checkGRPC(ctx context.Context, host, address, port, alpn string) (status string, err error) {
+	if alpn != alpnH2 {
+		err = fmt.Errorf("server did not negotiate %s with ALPN for gRPC", alpnH2)
+		return
+	}
+	if !options.GRPCHealth {
+		return
+	}
+	status, err = options.grpcHealth(ctx, host, address, port)
+	if err != nil {
+		status = "unreachable"
+		return
+	}
+	if status != "serving" {
+		err = fmt.Errorf("gRPC health check reports %s", strings.ReplaceAll(status, "_", " "))
+	}
+
+	return
+}
@@ -0,0 +1,72 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"net"
+	"strings"
+)
+
+// Ways a host name can match a cert
+const (
+	matchExact    = "exact"    // a DNS name in the SANs
+	matchWildcard = "wildcard" // a wildcard DNS name in the SANs
+	matchIP       = "ip"       // an IP address in the SANs
+	matchCN       = "cn"       // the subject common name, which clients no longer use
+	matchNone     = "none"
+)
+
+// wildcardMatch check if a wildcard name such as *.example.com covers a host,
+// which it does for exactly one label in place of the *
+func wildcardMatch(pattern, host string) bool {
+	if !strings.HasPrefix(pattern, "*.") {
+		return false
+	}
+	label, rest, found := strings.Cut(host, ".")
+
+	return found && label != "" && strings.EqualFold(rest, pattern[2:])
+}
+
+// hostnameMatch find how a host matches a cert and the name that matched.
+// Exact SANs are preferred over wildcards. The common name is only considered
+// when the cert has no DNS or IP SANs, as with old certs.
+func hostnameMatch(cert *x509.Certificate, host string) (match, name string) {
+	host = strings.TrimSuffix(host, ".")
+	if ip := net.ParseIP(host); ip != nil {
+		for _, certIP := range cert.IPAddresses {
+			if certIP.Equal(ip) {
+				return matchIP, certIP.String()
+			}
+		}
+		return matchNone, ""
+	}
+	for _, dnsName := range cert.DNSNames {
+		if strings.EqualFold(strings.TrimSuffix(dnsName, "."), host) {
+			return matchExact, dnsName
+		}
+	}
+	for _, dnsName := range cert.DNSNames {
+		if wildcardMatch(strings.TrimSuffix(dnsName, "."), host) {
+			return matchWildcard, dnsName
+		}
+	}
+	commonName := cert.Subject.CommonName
+	if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 && commonName != "" {
+		if strings.EqualFold(commonName, host) || wildcardMatch(commonName, host) {
+			return matchCN, commonName
+		}
+	}
+
+	return matchNone, ""
+}
+
+// missingNames get the required names that a cert's SANs do not cover. A
+// name only in the common name is missing, as clients no longer use it.
+func missingNames(cert *x509.Certificate, required []string) (missing []string) {
+	for _, name := range required {
+		if match, _ := hostnameMatch(cert, name); match == matchNone || match == matchCN {
+			missing = append(missing, name)
+		}
+	}
+
+	return
+}
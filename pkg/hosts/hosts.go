@@ -1,16 +1,26 @@
-package hosts
-
 // Package hosts is standalone and as such allows hosts to be looked up separate
 // from the main package.
+//
+// Options, Lookup, HostSet and its Add, Process and ProcessStream methods are
+// the stable API of this package. Their signatures will not change within
+// major version 2 of the module and new settings are only added as Options
+// fields whose zero value keeps the existing behaviour.
+package hosts
 
 import (
+	"bytes"
 	"context"
-	"crypto/tls"
-	"encoding/json"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"math/rand"
 	"net"
-	"os"
+	"net/url"
 	"regexp"
 	"runtime"
 	"sort"
@@ -18,14 +28,15 @@ import (
 	"sync"
 	"time"
 
-	"github.com/imarsman/certcheck/pkg/cert"
-	"github.com/imarsman/certcheck/pkg/gcon"
+	"github.com/imarsman/certcheck/v2/pkg/clock"
+	"github.com/imarsman/certcheck/v2/pkg/crl"
+	"github.com/imarsman/certcheck/v2/pkg/gcon"
+	"github.com/imarsman/certcheck/v2/pkg/model"
 	"golang.org/x/sync/semaphore"
-	"gopkg.in/yaml.v3"
 )
 
 const (
-	timeFormat     = "2006-01-02T15:04:05Z"
+	timeFormat     = model.TimeFormat
 	tlsDefaultPort = "443"
 )
 
@@ -83,21 +94,49 @@ func (e *hostSkipError) Error() string {
 // }
 
 // CertData values for a TLS certificate
-type CertData struct {
-	// ID            int    `json:"-" yaml:"-"`
-	Host          string `json:"host" yaml:"host"`
-	HostError     bool   `json:"hosterror" yaml:"hosterror"`
-	Message       string `json:"message" yaml:"message"`
-	ExpiryWarning bool   `json:"expirywarning" yaml:"expirywarning"`
-	Issuer        string `json:"issuer" yaml:"issuer"`
-	Port          string `json:"port" yaml:"port"`
-	TotalDays     int    `json:"totaldays" yaml:"totaldays"`
-	DaysToExpiry  int    `json:"daystoexpiry" yaml:"daystoexpiry"`
-	WarnAtDays    int    `json:"warnatdays" yaml:"warnatdays"`
-	CheckTime     string `json:"checktime" yaml:"checktime"`
-	NotBefore     string `json:"notbefore" yaml:"notbefore"`
-	NotAfter      string `json:"notafter" yaml:"notafter"`
-	FetchTime     string `json:"fetchtime" yaml:"fetchtime"`
+type CertData = model.CertData
+
+// CertDataSet a set of TLS certificate data for a list of hosts plus summary
+type CertDataSet = model.CertDataSet
+
+// CSRData a certificate signing request read from a file
+type CSRData = model.CSRData
+
+// ChainCert a certificate in the chain a server sent
+type ChainCert = model.ChainCert
+
+// LeafCert the leaf certificate a server has for one key type
+type LeafCert = model.LeafCert
+
+// BeforeCheckFunc called before a host is checked, with the host and port
+type BeforeCheckFunc func(ctx context.Context, host, port string) error
+
+// AfterCheckFunc called with each result of checking a host
+type AfterCheckFunc func(ctx context.Context, certData CertData)
+
+// Session session resumption and renegotiation support of a server
+type Session = model.Session
+
+// HTTPProbe results of HTTP requests made to a host after its TLS check
+type HTTPProbe = model.HTTPProbe
+
+// RateLimit certificate issuance for a registered domain compared to a CA's
+// issuance rate limit
+type RateLimit = model.RateLimit
+
+// CTCert a certificate logged in Certificate Transparency logs
+type CTCert = model.CTCert
+
+// CertGroup hosts serving the same certificate, or certificates sharing a
+// serial number
+type CertGroup = model.CertGroup
+
+// PEMBlock what became of a PEM block in a certificate file
+type PEMBlock = model.PEMBlock
+
+// NewCertDataSet new cert data set
+func NewCertDataSet() *CertDataSet {
+	return model.NewCertDataSet()
 }
 
 // Get new CertData instance with default values
@@ -110,84 +149,126 @@ func newCertData() CertData {
 	return certData
 }
 
-// CertDataSet a set of TLS certificate data for a list of hosts plus summary
-type CertDataSet struct {
-	Total           int        `json:"total" yaml:"total"`
-	HostErrors      int        `json:"hosterrors" yaml:"hosterrors"`
-	ExpiredWarnings int        `json:"expirywarnings" yaml:"expirywarnings"`
-	CertData        []CertData `json:"certdata" yaml:"certdata"`
-}
-
-// NewCertDataSet new cert data set
-func NewCertDataSet() *CertDataSet {
-	certDataSet := new(CertDataSet)
-	certDataSet.CertData = make([]CertData, 0, 0)
+const (
+	// DefaultWarnAtDays days before expiry to warn at if Options.WarnAtDays is 0
+	DefaultWarnAtDays = 30
+	// DefaultTimeout connection timeout if Options.Timeout is 0
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxCertSize largest certificate file read if Options.MaxCertSize
+	// is 0. Bundles of many certs can be far larger than a single cert.
+	DefaultMaxCertSize = 8 << 20
+)
 
-	return certDataSet
+// Options settings used to check hosts. The zero value checks hosts with
+// implicit TLS or the protocol for well-known ports, the system resolver and
+// the default warning period and timeout.
+type Options struct {
+	WarnAtDays    int                 // warn if a cert expires within this many days
+	Timeout       time.Duration       // timeout for each connection
+	Protocol      string              // protocol to negotiate TLS with, detected from the port if empty
+	AllIPs        bool                // check every address a host resolves to instead of one
+	Resolver      *net.Resolver       // resolver for host names, the system resolver if nil
+	Cost          *CostMeter          // counts connections and bytes sent to hosts if set
+	Roots         *x509.CertPool      // roots to verify certs with, the system roots if nil
+	Insecure      bool                // report certs that fail verification, with the reason in VerifyError
+	MinTLS        uint16              // lowest TLS version to offer, the Go default if 0
+	MaxTLS        uint16              // highest TLS version to offer, the Go default if 0
+	ProbeTLS      bool                // report every TLS version the server accepts
+	ProbeCiphers  bool                // report weak cipher suites the server accepts
+	ProbeSession  bool                // report session resumption and secure renegotiation support
+	ProbeKeyTypes bool                // report the leaf cert served for RSA and for ECDSA, to find dual certs
+	CheckChain    bool                // check that the certs served chain to a root without fetching intermediates
+	Strict        bool                // list anything short of a clean result in Anomalies, checking the chain and OCSP responder
+	ChaseAIA      bool                // fetch intermediates a server leaves out from AIA issuer URLs to verify, setting AIAChased
+	CheckOCSP     bool                // ask the leaf cert's OCSP responder for its revocation status
+	CRLCache      *crl.Cache          // check the chain against CRLs fetched through the cache if set
+	HTTPProbe     bool                // make HEAD requests to record HSTS and HTTP to HTTPS redirects
+	UserAgent     string              // user agent for HTTP requests, DefaultUserAgent if empty
+	Pins          map[string][]string // expected SPKI hashes by host or host:port, from ReadPins
+	Distrusted    []DistrustedCA      // CAs to flag chains through, DefaultDistrusted if nil
+	RequireNames  []string            // names the leaf's SANs must all cover, an error naming any that are missing
+	GRPCHealth    bool                // call the gRPC health service when checking with ProtocolGRPC
+	GRPCService   string              // service to ask the gRPC health service about, the server if empty
+	Retries       int                 // times to try again if no TLS connection could be made
+	CheckCAA      bool                // check that CAA records for the host authorize its cert's issuer
+	CheckACMEDNS  bool                // check the _acme-challenge CNAME used for DNS-01 validation
+	ACMETarget    string              // zone _acme-challenge names must point into, any if empty
+	BeforeCheck   BeforeCheckFunc     // called before each host is checked, which is skipped with an error if it fails
+	AfterCheck    AfterCheckFunc      // called with each result, such as to record it elsewhere
+	Concurrency   int                 // hosts to check at once, the number of CPUs if 0
+	Jitter        time.Duration       // wait a random time up to this long before checking each host
+	Password      string              // password to open PKCS#12 (.p12, .pfx) certificate files and encrypted keys with
+	Keys          []KeyFile           // private keys to match certs read from files against, setting KeyMatch
+	MaxCertSize   int64               // largest certificate file to read, DefaultMaxCertSize if 0, larger files are an error
+	Clock         clock.Clock         // time to calculate expiry at, clock.System if nil
+	SourceIP      net.IP              // local address to connect to hosts from, chosen by the system if nil
+	Interface     string              // network interface to connect to hosts from, by its address, if SourceIP is nil
+	Proxy         *url.URL            // HTTP proxy to connect to hosts through with CONNECT, direct if nil
+	PublicScan    bool                // skip hosts that opted out of scans, setting ScanPolicy on each result
 }
 
-// finalize metadata about the cert data set and sort
-func (certDataSet *CertDataSet) finalize() {
-	for _, v := range certDataSet.CertData {
-		certDataSet.Total++
-		if v.HostError {
-			certDataSet.HostErrors++
-		}
-		if v.ExpiryWarning {
-			certDataSet.ExpiredWarnings++
-		}
+// withDefaults get a copy of options with defaults set for unset values
+func (options Options) withDefaults() Options {
+	if options.WarnAtDays == 0 {
+		options.WarnAtDays = DefaultWarnAtDays
 	}
-	sort.Slice(certDataSet.CertData, func(i, j int) bool {
-		return certDataSet.CertData[i].Host < certDataSet.CertData[j].Host
-	})
-}
-
-// JSON get JSON representation of data for a host certificate
-func (certData *CertData) JSON() (bytes []byte, err error) {
-	// Do JSON output by default
-	bytes, err = json.MarshalIndent(&certData, "", "  ")
-	if err != nil {
-		return
+	if options.Timeout == 0 {
+		options.Timeout = DefaultTimeout
 	}
-	return
+	if options.Concurrency < 1 {
+		options.Concurrency = runtime.NumCPU()
+	}
+	if options.MaxCertSize <= 0 {
+		options.MaxCertSize = DefaultMaxCertSize
+	}
+	if options.Distrusted == nil {
+		options.Distrusted = DefaultDistrusted
+	}
+	// Strict results need the chain and OCSP responder checked
+	if options.Strict {
+		options.CheckChain = true
+		options.CheckOCSP = true
+	}
+
+	return options
 }
 
-// YAML get YAML representation of data for a host certificate
-func (certData *CertData) YAML() (bytes []byte, err error) {
-	bytes, err = yaml.Marshal(&certData)
-	if err != nil {
-		return
+// now get the time expiry is calculated at
+func (options *Options) now() time.Time {
+	if options.Clock == nil {
+		return clock.System.Now()
 	}
-	return
+
+	return options.Clock.Now()
 }
 
-// JSON get JSON representation of data for a set of host certificates
-func (certDataSet *CertDataSet) JSON() (bytes []byte, err error) {
-	// Do JSON output by default
-	bytes, err = json.MarshalIndent(&certDataSet, "", "  ")
-	if err != nil {
+// wait sleep for a random part of the jitter so checks of many hosts are
+// spread out, returning early if ctx is done
+func (options *Options) wait(ctx context.Context) {
+	if options.Jitter <= 0 {
 		return
 	}
-	return
-}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(options.Jitter))))
+	defer timer.Stop()
 
-// YAML get YAML representation of data for a set of host certificates
-func (certDataSet *CertDataSet) YAML() (bytes []byte, err error) {
-	bytes, err = yaml.Marshal(&certDataSet)
-	if err != nil {
-		return
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
 	}
-	return
 }
 
 // HostSet hosts to process into cert value set
 type HostSet struct {
 	Hosts []string
+	Options
 }
 
-// Add add hosts to HostDataSet
+// Add add hosts to HostDataSet. Hosts given with a list or range of ports are
+// added once for each port.
 func (hostSet *HostSet) Add(items ...string) {
-	hostSet.Hosts = append(hostSet.Hosts, items...)
+	for _, item := range items {
+		hostSet.Hosts = append(hostSet.Hosts, ExpandPorts(item)...)
+	}
 }
 
 // NewHostSet hosts struct containing a list of hosts
@@ -197,58 +278,202 @@ func NewHostSet() *HostSet {
 	return hostSet
 }
 
-// ProcessCertFile process a certificate file
+// ProcessCertFile process the contents of a certificate file, giving a result
+// for each cert. Contents with no readable cert give a result with HostError
+// set and the error as its message, so the caller decides the exit status.
 func (hostSet *HostSet) ProcessCertFile(bytes []byte, warnAtDays int, timeout time.Duration) *CertDataSet {
-	var (
-		certDataSet = NewCertDataSet()
-	)
+	options := hostSet.Options.withDefaults()
 
-	certData := newCertData()
-	cert, err := cert.ReadCert(bytes)
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(options.certFileResults("", bytes, nil, warnAtDays)...)
+
+	return certDataSet
+}
+
+// isListed check if a host name is listed exactly, rather than covered by a
+// wildcard
+func isListed(names []string, host string) bool {
+	for _, name := range names {
+		if strings.EqualFold(name, host) {
+			return true
+		}
 	}
-	if err == nil {
-		certData.Host = strings.Join(cert.DNSNames, ", ")
-		daysLeft := 0
-		certData.Issuer = cert.Issuer.String()
 
-		now := time.Now()
-		nanosToExpiry := cert.NotAfter.UnixNano() - now.UnixNano()
+	return false
+}
+
+// serialNumber get the serial number of a cert in hex, without leading zeros
+func serialNumber(cert *x509.Certificate) string {
+	return fmt.Sprintf("%x", cert.SerialNumber)
+}
+
+// fingerprints get the SHA-256 fingerprint of the leaf cert and a SHA-256 hash
+// of every cert the server sent, in order, to compare what servers present
+func fingerprints(certs []*x509.Certificate) (leaf, chain string) {
+	if len(certs) == 0 {
+		return
+	}
+	sum := sha256.Sum256(certs[0].Raw)
+	leaf = hex.EncodeToString(sum[:])
 
-		// // If > one day left report that integer
-		if nanosToExpiry > int64(time.Hour+24) {
-			daysLeft = int((cert.NotAfter.UnixNano() - now.UnixNano()) / int64(time.Hour*24))
+	hash := sha256.New()
+	for _, cert := range certs {
+		hash.Write(cert.Raw)
+	}
+	chain = hex.EncodeToString(hash.Sum(nil))
+
+	return
+}
+
+// chainCerts describe every cert the server sent, leaf first, so expiring
+// intermediates are reported too. The SPKI hash of each can be used as a pin.
+func chainCerts(certs []*x509.Certificate) (chain []ChainCert) {
+	for _, cert := range certs {
+		sum := sha256.Sum256(cert.Raw)
+		chain = append(chain, ChainCert{
+			Subject:     cert.Subject.String(),
+			Issuer:      cert.Issuer.String(),
+			NotBefore:   cert.NotBefore.Format(timeFormat),
+			NotAfter:    cert.NotAfter.Format(timeFormat),
+			Fingerprint: hex.EncodeToString(sum[:]),
+			SPKISHA256:  spkiPin(cert),
+		})
+	}
+
+	return
+}
+
+// chainExpiry get the earliest expiry of every cert the server sent and the
+// subjects of those expiring before the leaf, which break the chain while the
+// leaf still looks valid
+func chainExpiry(certs []*x509.Certificate) (earliest string, beforeLeaf []string) {
+	if len(certs) == 0 {
+		return
+	}
+	first := certs[0].NotAfter
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(first) {
+			first = cert.NotAfter
+		}
+		if cert.NotAfter.Before(certs[0].NotAfter) {
+			beforeLeaf = append(beforeLeaf, cert.Subject.String())
 		}
-		certData.DaysToExpiry = daysLeft // set days left to expiry
-		certData.WarnAtDays = warnAtDays
-		certData.NotBefore = cert.NotBefore.Format(timeFormat)
-		certData.NotAfter = cert.NotAfter.Format(timeFormat)
+	}
 
-		warnAt := warnAtDays * 24 * int(time.Hour)
+	return first.Format(timeFormat), beforeLeaf
+}
 
-		isExpired := (time.Now().Add(time.Duration(warnAt)).UnixNano() > cert.NotAfter.UnixNano())
-		certData.ExpiryWarning = isExpired
+// keyStrength get the public key algorithm of a cert and its size in bits
+func keyStrength(cert *x509.Certificate) (keyType string, bits int) {
+	return publicKeyStrength(cert.PublicKey, cert.PublicKeyAlgorithm)
+}
 
-		certData.TotalDays = int((cert.NotAfter.UnixNano() - cert.NotBefore.UnixNano()) / int64(time.Hour*24))
-		certDataSet.CertData = append(certDataSet.CertData, certData)
-	} else {
-		certData.Host = ""
-		certData.Message = err.Error()
-		certData.HostError = true
-		certDataSet.CertData = append(certDataSet.CertData, certData)
-		certDataSet.finalize()
+// publicKeyStrength get the algorithm of a public key and its size in bits,
+// naming other algorithms by the one given
+func publicKeyStrength(public any, algorithm x509.PublicKeyAlgorithm) (keyType string, bits int) {
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		return "RSA", key.N.BitLen()
+	case *ecdsa.PublicKey:
+		return "ECDSA", key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return "Ed25519", 256
+	}
+
+	return algorithm.String(), 0
+}
 
-		return certDataSet
+// weakKey check if a key is too small to be trusted, RSA under 2048 bits or
+// an ECDSA curve smaller than P-256
+func weakKey(keyType string, bits int) bool {
+	switch keyType {
+	case "RSA":
+		return bits < 2048
+	case "ECDSA":
+		return bits < 256
 	}
 
-	certDataSet.finalize()
-	return certDataSet
+	return false
 }
 
-// Extract host and port from incoming host string
+// extKeyUsageNames names of extended key usages found on misused certs
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// usageProblems describe why a leaf cert can't be used by a TLS server. An
+// extended key usage list must include serverAuth and key usage bits must
+// allow the key to be used for TLS. Certs without either extension are not
+// restricted by it.
+func usageProblems(cert *x509.Certificate) (problems []string) {
+	if len(cert.ExtKeyUsage) > 0 || len(cert.UnknownExtKeyUsage) > 0 {
+		serverAuth := false
+		var others []string
+		for _, usage := range cert.ExtKeyUsage {
+			if usage == x509.ExtKeyUsageServerAuth || usage == x509.ExtKeyUsageAny {
+				serverAuth = true
+			}
+			if name, ok := extKeyUsageNames[usage]; ok {
+				others = append(others, name)
+			}
+		}
+		if !serverAuth {
+			problem := "extended key usage does not include serverAuth"
+			if len(others) > 0 {
+				problem += ", only " + strings.Join(others, ", ")
+			}
+			problems = append(problems, problem)
+		}
+	}
+
+	if cert.KeyUsage != 0 {
+		keyType, _ := keyStrength(cert)
+		switch {
+		case keyType == "RSA" && cert.KeyUsage&(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment) == 0:
+			problems = append(problems, "key usage allows neither digitalSignature nor keyEncipherment")
+		case keyType != "RSA" && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0:
+			problems = append(problems, "key usage does not allow digitalSignature")
+		}
+	}
+
+	return
+}
+
+// weakSignatureAlgorithms signature algorithms using the broken MD2, MD5 and
+// SHA-1 hashes
+var weakSignatureAlgorithms = map[x509.SignatureAlgorithm]bool{
+	x509.MD2WithRSA:    true,
+	x509.MD5WithRSA:    true,
+	x509.SHA1WithRSA:   true,
+	x509.DSAWithSHA1:   true,
+	x509.ECDSAWithSHA1: true,
+}
+
+// weakSignatures describe each cert in a chain signed with a weak algorithm.
+// The signature on a root sent after the leaf is skipped, as a root is
+// trusted for itself rather than its signature.
+func weakSignatures(certs []*x509.Certificate) (weak []string) {
+	for i, cert := range certs {
+		if i > 0 && bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+			continue
+		}
+		if weakSignatureAlgorithms[cert.SignatureAlgorithm] {
+			weak = append(weak, fmt.Sprintf("%s signed with %s", cert.Subject, cert.SignatureAlgorithm))
+		}
+	}
+
+	return
+}
+
+// Extract host and port from incoming host string, which may be a URL
 func domainAndPort(input string) (host string, port string, err error) {
+	if strings.Contains(input, "://") {
+		return urlHostAndPort(input)
+	}
 	if strings.Contains(input, ":") {
 		parts := strings.Split(input, ":")
 		if len(parts) == 1 {
@@ -266,7 +491,7 @@ func domainAndPort(input string) (host string, port string, err error) {
 		port = tlsDefaultPort
 	}
 	var matched bool
-	matched, err = regexp.MatchString(`\d+`, port)
+	matched, err = regexp.MatchString(`^\d+$`, port)
 	if err != nil {
 		return
 	}
@@ -277,143 +502,345 @@ func domainAndPort(input string) (host string, port string, err error) {
 	return
 }
 
-// Do check of cert from remote host and populate CertData
-func lookupCertData(host, port string, warnAtDays int, timeout time.Duration) (certData CertData, err error) {
+// Do check of cert from remote host and populate CertData. If ip is set that
+// address is dialed and host is only used for SNI and verification.
+func (options *Options) lookupCertData(ctx context.Context, host, ip, port string) (certData CertData, err error) {
 	tRun := time.Now()
 
 	certData.Host = host
 	certData.Port = port
-	certData.WarnAtDays = warnAtDays
-
-	hostAndPort := fmt.Sprintf("%s:%s", host, port)
+	certData.WarnAtDays = options.WarnAtDays
 
-	warnAt := warnAtDays * 24 * int(time.Hour)
-
-	dialer := &net.Dialer{Timeout: timeout}
-	conn, err := tls.DialWithDialer(
-		dialer,
-		"tcp",
-		hostAndPort, nil)
+	protocol, err := protocolForPort(port, options.Protocol)
 	if err != nil {
-		certData.FetchTime = time.Since(tRun).Round(time.Millisecond).String()
 		return
 	}
+	certData.Protocol = protocol
 
-	err = conn.VerifyHostname(host)
+	address := host
+	if ip != "" {
+		address = ip
+	}
+	config := options.tlsConfig(host)
+	config.InsecureSkipVerify = options.Insecure
+	if options.ChaseAIA && !options.Insecure {
+		// Verify in the handshake with a callback that can fetch intermediates
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = options.verifyChasingAIA(ctx, host, &certData.AIAChased)
+	}
+	if protocol == ProtocolGRPC {
+		config.NextProtos = []string{alpnH2}
+	}
+	conn, err := options.dialTLS(ctx, address, port, protocol, config)
 	if err != nil {
+		if options.CheckChain {
+			certData.ChainStatus, err = options.diagnoseChain(ctx, host, address, port, protocol, options.Roots, err)
+		}
+		certData.IP = ip
 		certData.FetchTime = time.Since(tRun).Round(time.Millisecond).String()
 		return
 	}
+	defer conn.Close()
 
-	// Set issuer
-	certData.Issuer = conn.ConnectionState().PeerCertificates[0].Issuer.String()
-
-	// Set cert not before date
-	notBefore := conn.ConnectionState().PeerCertificates[0].NotBefore
-	certData.NotBefore = notBefore.Format(timeFormat)
+	// Record the address actually connected to, and from if one was chosen
+	if tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		certData.IP = tcpAddr.IP.String()
+	}
+	if tcpAddr, ok := conn.LocalAddr().(*net.TCPAddr); ok && (options.SourceIP != nil || options.Interface != "") {
+		certData.SourceIP = tcpAddr.IP.String()
+		certData.Interface = options.Interface
+	}
+	certData.TLSVersion = tlsVersionName(conn.ConnectionState().Version)
+	certData.ALPN = conn.ConnectionState().NegotiatedProtocol
+	certData.Serial = serialNumber(conn.ConnectionState().PeerCertificates[0])
+	certData.Fingerprint, certData.ChainHash = fingerprints(conn.ConnectionState().PeerCertificates)
+	certData.Chain = chainCerts(conn.ConnectionState().PeerCertificates)
+	certData.ChainExpiry, certData.EarlyExpiry = chainExpiry(conn.ConnectionState().PeerCertificates)
+	certData.KeyType, certData.KeyBits = keyStrength(conn.ConnectionState().PeerCertificates[0])
+	certData.WeakKey = weakKey(certData.KeyType, certData.KeyBits)
+	certData.UsageProblems = usageProblems(conn.ConnectionState().PeerCertificates[0])
+	certData.WeakSignature = weakSignatures(conn.ConnectionState().PeerCertificates)
+	certData.HostnameMatch, certData.MatchedName = hostnameMatch(conn.ConnectionState().PeerCertificates[0], host)
+	certData.IssuerType = issuerType(conn.ConnectionState().PeerCertificates)
+	certData.SelfSigned = certData.IssuerType == issuerSelfSigned
+	certData.Distrusted = distrustedIssuer(chainOf(conn.ConnectionState()), options.Distrusted)
+	certData.IssuanceSource = issuanceSource(conn.ConnectionState().PeerCertificates[0], certData.IssuerType)
+	certData.Validation = validationLevel(conn.ConnectionState().PeerCertificates[0])
+
+	// Verify as the handshake would have and carry on with what was served
+	if options.Insecure {
+		var verifyErr error
+		if options.ChaseAIA {
+			certData.AIAChased, verifyErr = options.chaseAIA(ctx, host, conn.ConnectionState().PeerCertificates)
+		} else {
+			verifyErr = verifyServed(host, conn.ConnectionState().PeerCertificates, options.Roots)
+		}
+		if verifyErr != nil {
+			certData.VerifyError = verifyErr.Error()
+		}
+	} else if !options.ChaseAIA {
+		// The callback has already checked the name when chasing
+		err = conn.VerifyHostname(host)
+		if err != nil {
+			certData.FetchTime = time.Since(tRun).Round(time.Millisecond).String()
+			return
+		}
+	}
 
-	// Set cert not after date
-	notAfter := conn.ConnectionState().PeerCertificates[0].NotAfter
-	certData.NotAfter = notAfter.Format(timeFormat)
+	// Probe the same address so every version reported is from one server,
+	// and only once it is known to be the host asked for
+	if options.ProbeTLS {
+		certData.TLSVersions = options.probeTLSVersions(ctx, host, certData.IP, port, protocol)
+		for _, name := range certData.TLSVersions {
+			version, _ := ParseTLSVersion(name)
+			if deprecatedTLS(version) {
+				certData.DeprecatedTLS = true
+			}
+		}
+	}
 
-	now := time.Now()
-	// nanoseconds to expiry of certificate
-	nanosToExpiry := notAfter.UnixNano() - now.UnixNano()
+	if options.ProbeCiphers {
+		certData.WeakCiphers = options.probeWeakCiphers(ctx, host, certData.IP, port, protocol)
+	}
 
-	daysLeft := 0
+	if options.ProbeKeyTypes {
+		certData.LeafCerts, certData.DualCert = options.probeKeyTypes(ctx, host, certData.IP, port, protocol)
+	}
 
-	// If > one day left report that integer
-	if nanosToExpiry > int64(time.Hour+24) {
-		daysLeft = int((notAfter.UnixNano() - now.UnixNano()) / int64(time.Hour*24))
+	if options.ProbeSession {
+		certData.Session = options.probeSession(ctx, host, certData.IP, port, protocol)
 	}
-	certData.DaysToExpiry = daysLeft // set days left to expiry
 
-	certData.TotalDays = int((notAfter.UnixNano() - notBefore.UnixNano()) / int64(time.Hour*24))
+	// Set issuer
+	certData.Issuer = conn.ConnectionState().PeerCertificates[0].Issuer.String()
+
+	// Set validity, days to expiry and the expiry warning
+	now := options.now()
+	leaf := conn.ConnectionState().PeerCertificates[0]
+	certData.SetExpiry(leaf.NotBefore, leaf.NotAfter, options.WarnAtDays, now)
 
 	certData.Message = "OK"
 	certData.CheckTime = now.Format(timeFormat) // set time cert was checked
 
-	// Set expiry flag and fetch time
-	isExpired := (time.Now().Add(time.Duration(warnAt)).UnixNano() > notAfter.UnixNano())
-	certData.ExpiryWarning = isExpired
+	// The first check to fail gives the error and any after it are listed in
+	// errors, so none overwrite the others
+	addErr := func(checkErr error) {
+		switch {
+		case checkErr == nil:
+		case err == nil:
+			err = checkErr
+		default:
+			certData.Errors = append(certData.Errors, checkErr.Error())
+		}
+	}
+
+	// Check any stapled OCSP response
+	certData.OCSPStapled, certData.OCSPStatus, err = stapledOCSP(conn.ConnectionState(), now)
+	if options.CheckChain && certData.VerifyError == "" {
+		var chainErr error
+		certData.ChainStatus, chainErr = checkChain(host, conn.ConnectionState().PeerCertificates, options.Roots)
+		addErr(chainErr)
+	}
+	if options.CheckOCSP {
+		var responderErr error
+		certData.OCSPResponder, certData.RevokedAt, responderErr = options.responderOCSP(ctx, conn.ConnectionState())
+		addErr(responderErr)
+	}
+	if options.CRLCache != nil {
+		var crlErr error
+		var revokedAt string
+		certData.CRLStatus, revokedAt, crlErr = options.checkCRLs(ctx, conn.ConnectionState())
+		addErr(crlErr)
+		if certData.RevokedAt == "" {
+			certData.RevokedAt = revokedAt
+		}
+	}
+	if len(options.Pins) > 0 {
+		var pinErr error
+		certData.Pin, pinErr = options.checkPins(host, port, chainOf(conn.ConnectionState()))
+		addErr(pinErr)
+	}
+	if len(options.RequireNames) > 0 {
+		certData.MissingNames = missingNames(conn.ConnectionState().PeerCertificates[0], options.RequireNames)
+		if len(certData.MissingNames) > 0 {
+			addErr(fmt.Errorf("certificate does not cover %s", strings.Join(certData.MissingNames, ", ")))
+		}
+	}
+	if options.HTTPProbe && protocol == ProtocolTLS {
+		certData.HTTP = options.probeHTTP(ctx, host, certData.IP, port)
+	}
+	if protocol == ProtocolGRPC {
+		var grpcErr error
+		certData.GRPCHealth, grpcErr = options.checkGRPC(ctx, host, certData.IP, port, certData.ALPN)
+		addErr(grpcErr)
+	}
+	if options.CheckCAA {
+		var caaErr error
+		wildcard := certData.HostnameMatch == matchWildcard
+		certData.CAA, caaErr = options.checkCAA(ctx, host, certData.Issuer, wildcard)
+		addErr(caaErr)
+	}
+	if options.CheckACMEDNS {
+		var acmeErr error
+		certData.ACMEDNS, acmeErr = options.checkACMEDNS(ctx, host)
+		addErr(acmeErr)
+	}
+
+	// Problems that leave the result standing
+	certData.Warnings = append(certData.Warnings, servedWarnings(conn.ConnectionState().PeerCertificates, now)...)
+	certData.Warnings = append(certData.Warnings, checkWarnings(certData)...)
+	if options.Strict {
+		certData.Anomalies = anomalies(certData)
+	}
 	certData.FetchTime = time.Since(tRun).Round(time.Millisecond).String()
 
 	return
 }
 
-var mu = new(sync.Mutex)
-
-// Process process list of hosts and for each get back cert values
-func (hostSet *HostSet) Process(warnAtDays int, timeout time.Duration) *CertDataSet {
-	var (
-		certDataSet = NewCertDataSet()
-		hostMap     = make(map[string]bool)                          // map of hosts to avoid duplicates
-		sem         = semaphore.NewWeighted(int64(runtime.NumCPU())) // Set semaphore with capacity
-		ch          = make(chan CertData, 2)
-		wg          = new(sync.WaitGroup)
-	)
-
-	wg.Add(len(hostSet.Hosts))
-
-	processHost := func(item string) {
-		var skip bool
+// lookupCertDataRetry check the cert from a remote host, trying again up to
+// options.Retries times if no TLS connection could be made
+func (options *Options) lookupCertDataRetry(ctx context.Context, host, ip, port string) (certData CertData, err error) {
+	for attempt := 0; ; attempt++ {
+		certData, err = options.lookupCertData(ctx, host, ip, port)
+		if err == nil || certData.Fingerprint != "" || attempt >= options.Retries || ctx.Err() != nil {
+			return
+		}
+	}
+}
 
-		defer wg.Done()
-		var certData = CertData{}
-		defer func() {
-			if !skip {
-				ch <- certData
-			}
-		}()
+// lookupAll check the cert served on every address a host resolves to. Load
+// balanced pools can have a single backend serving a stale cert.
+func (options *Options) lookupAll(ctx context.Context, host, port string) (certDataList []CertData, err error) {
+	resolveCtx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
 
-		sem.Acquire(context.Background(), 1)
-		defer sem.Release(1)
-		host, port, err := domainAndPort(item)
+	resolver := options.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(resolveCtx, host)
+	if err != nil {
+		return
+	}
+	for _, addr := range addrs {
+		certData, err := options.lookupCertDataRetry(ctx, host, addr.IP.String(), port)
 		if err != nil {
-			certData.Host = item
 			certData.Message = err.Error()
 			certData.HostError = true
-
-			return
 		}
-		hostAndPort := fmt.Sprintf("%s:%s", host, port)
+		certDataList = append(certDataList, certData)
+	}
 
-		var foundHostAndPort = func(string) (found bool) {
-			mu.Lock()
-			defer mu.Unlock()
+	return
+}
 
-			if hostMap[hostAndPort] {
-				found = true
-				return
-			}
-			hostMap[hostAndPort] = true
+// Lookup check the cert for a host given as host or host:port. One result is
+// returned, or one for each address if options.AllIPs is set. A failed check
+// is reported in a result with HostError and Message set. Options.BeforeCheck
+// and Options.AfterCheck are called around the check if set.
+func Lookup(ctx context.Context, item string, options Options) (certDataList []CertData) {
+	options = options.withDefaults()
 
-			return
+	host, port, err := domainAndPort(item)
+	if err != nil {
+		return []CertData{{Host: item, Message: err.Error(), HostError: true}}
+	}
+
+	// A failed before hook is reported instead of checking the host
+	if options.BeforeCheck != nil {
+		if err = options.BeforeCheck(ctx, host, port); err != nil {
+			certDataList = []CertData{{Host: host, Port: port, Message: fmt.Sprintf("before check: %v", err), HostError: true}}
+		}
+	}
+	// Third-party hosts that opted out of scans are left alone
+	var policy, message, warning string
+	if certDataList == nil && options.PublicScan {
+		policy, message, warning = options.scanPolicy(ctx, host, port)
+		if message != "" {
+			certDataList = []CertData{{Host: host, Port: port, Message: message, ScanPolicy: policy}}
 		}
+	}
+	if certDataList == nil {
+		certDataList = options.lookupHost(ctx, host, port)
+		for i := range certDataList {
+			certDataList[i].ScanPolicy = policy
+			if warning != "" {
+				certDataList[i].Warnings = append(certDataList[i].Warnings, warning)
+			}
+		}
+	}
+	if options.AfterCheck != nil {
+		for _, certData := range certDataList {
+			options.AfterCheck(ctx, certData)
+		}
+	}
 
-		// Set skipError for duplicate host
-		if foundHostAndPort(hostAndPort) {
-			skip = true
+	return
+}
 
-			return
+// lookupHost check the cert for a host, or for each of its addresses if
+// options.AllIPs is set
+func (options *Options) lookupHost(ctx context.Context, host, port string) []CertData {
+	// Get cert data for every address of the host
+	if options.AllIPs {
+		certDataList, err := options.lookupAll(ctx, host, port)
+		if err != nil {
+			return []CertData{{Host: host, Port: port, Message: err.Error(), HostError: true}}
 		}
+		return certDataList
+	}
 
-		certData.Host = host
+	// Get cert data for host
+	certData, err := options.lookupCertDataRetry(ctx, host, "", port)
+	if err != nil {
+		certData.Message = err.Error()
+		certData.HostError = true
+	}
 
-		// Add cert data for host to channel
-		certData, err = lookupCertData(host, port, warnAtDays, timeout)
-		if err != nil {
-			certData.Message = err.Error()
-			certData.HostError = true
+	return []CertData{certData}
+}
+
+// ProcessStream check every host using the HostSet options and send each
+// result as it is ready. Hosts listed more than once are only checked once.
+// The channel is closed when all hosts are checked or ctx is done.
+func (hostSet *HostSet) ProcessStream(ctx context.Context) <-chan CertData {
+	var (
+		options = hostSet.Options.withDefaults()
+		hostMap = make(map[string]bool)                             // map of hosts to avoid duplicates
+		sem     = semaphore.NewWeighted(int64(options.Concurrency)) // Set semaphore with capacity
+		ch      = make(chan CertData, 2)
+		wg      = new(sync.WaitGroup)
+	)
+
+	processHost := func(item string) {
+		defer wg.Done()
 
+		if sem.Acquire(ctx, 1) != nil {
 			return
 		}
+		defer sem.Release(1)
 
-		return
+		options.wait(ctx)
+		for _, certData := range Lookup(ctx, item, options) {
+			select {
+			case ch <- certData:
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
 
-	for _, host := range hostSet.Hosts {
-		go processHost(host)
+	for _, item := range hostSet.Hosts {
+		// Skip duplicate hosts, leaving invalid ones for Lookup to report
+		if host, port, err := domainAndPort(item); err == nil {
+			hostAndPort := fmt.Sprintf("%s:%s", host, port)
+			if hostMap[hostAndPort] {
+				continue
+			}
+			hostMap[hostAndPort] = true
+		}
+		wg.Add(1)
+		go processHost(item)
 	}
 
 	go func() {
@@ -421,11 +848,22 @@ func (hostSet *HostSet) Process(warnAtDays int, timeout time.Duration) *CertData
 		close(ch)
 	}()
 
-	for certData := range ch {
+	return ch
+}
+
+// Process process list of hosts and for each get back cert values. The
+// warnAtDays and timeout arguments replace those in the HostSet options.
+func (hostSet *HostSet) Process(warnAtDays int, timeout time.Duration) *CertDataSet {
+	var certDataSet = NewCertDataSet()
+
+	hostSet.WarnAtDays = warnAtDays
+	hostSet.Timeout = timeout
+
+	for certData := range hostSet.ProcessStream(context.Background()) {
 		certDataSet.CertData = append(certDataSet.CertData, certData)
 	}
 
-	certDataSet.finalize() // Produce summary values and sort
+	certDataSet.Finalize() // Produce summary values and sort
 
 	cd := certDataSet.CertData
 	sort.SliceStable(cd, func(i, j int) bool {
@@ -434,60 +872,57 @@ func (hostSet *HostSet) Process(warnAtDays int, timeout time.Duration) *CertData
 	return certDataSet
 }
 
+var mu = new(sync.Mutex)
+
 // ProcessFuture process list of hosts and for each get back cert values
 func (hostSet *HostSet) ProcessFuture(warnAtDays int, timeout time.Duration) *CertDataSet {
+	options := hostSet.Options
+	options.WarnAtDays = warnAtDays
+	options.Timeout = timeout
+	options = options.withDefaults()
+
 	var (
 		certDataSet = NewCertDataSet()
-		hostMap     = make(map[string]bool)                          // map of hosts to avoid duplicates
-		sem         = semaphore.NewWeighted(int64(runtime.NumCPU())) // Set semaphore with capacity
+		hostMap     = make(map[string]bool)                             // map of hosts to avoid duplicates
+		sem         = semaphore.NewWeighted(int64(options.Concurrency)) // Set semaphore with capacity
 	)
 
-	processHost := func(ctx context.Context, item string) (certData CertData, err error) {
+	processHost := func(ctx context.Context, item string) (certDataList []CertData, err error) {
 		sem.Acquire(context.Background(), 1)
 		defer sem.Release(1)
 		host, port, err := domainAndPort(item)
-		if err != nil {
-			certData.Host = item
+		if err == nil {
+			hostAndPort := fmt.Sprintf("%s:%s", host, port)
 
-			return
-		}
-		hostAndPort := fmt.Sprintf("%s:%s", host, port)
+			var foundHostAndPort = func(string) (found bool) {
+				mu.Lock()
+				defer mu.Unlock()
 
-		var foundHostAndPort = func(string) (found bool) {
-			mu.Lock()
-			defer mu.Unlock()
+				if hostMap[hostAndPort] {
+					found = true
+					return
+				}
+				hostMap[hostAndPort] = true
 
-			if hostMap[hostAndPort] {
-				found = true
 				return
 			}
-			hostMap[hostAndPort] = true
 
-			return
-		}
-
-		// Set skipError for duplicate host
-		if foundHostAndPort(hostAndPort) {
-			// Later code will skip adding this to output
-			err = newHostSkipError("already processed")
-
-			return
-		}
+			// Set skipError for duplicate host
+			if foundHostAndPort(hostAndPort) {
+				// Later code will skip adding this to output
+				err = newHostSkipError("already processed")
 
-		certData.Host = host
-
-		// Add cert data for host to channel
-		certData, err = lookupCertData(host, port, warnAtDays, timeout)
-		if err != nil {
-			return
+				return
+			}
 		}
 
-		return
+		options.wait(ctx)
+		return Lookup(ctx, item, options), nil
 	}
 
 	// Make a list of promises and let them start running
 	// var runList = []*gcon.Promise[CertData]{}
-	var promiseSet = gcon.NewPromiseSet[CertData]()
+	var promiseSet = gcon.NewPromiseSet[[]CertData]()
 
 	for _, host := range hostSet.Hosts {
 		ctx := context.Background()
@@ -504,20 +939,22 @@ func (hostSet *HostSet) ProcessFuture(warnAtDays int, timeout time.Duration) *Ce
 
 	// Go through the Run list, waiting for all that are not finished
 	for _, p := range promiseSet.Promises {
-		certData, err := p.Get()
+		certDataList, err := p.Get()
 		// If there is an error make a minimal error result
 		if err != nil {
 			var skipError *hostSkipError
 			if errors.As(err, &skipError) {
 				continue
 			}
-			certData.HostError = true
-			certData.Message = err.Error()
+			for i := range certDataList {
+				certDataList[i].HostError = true
+				certDataList[i].Message = err.Error()
+			}
 		}
-		certDataSet.CertData = append(certDataSet.CertData, certData)
+		certDataSet.CertData = append(certDataSet.CertData, certDataList...)
 	}
 
-	certDataSet.finalize() // Produce summary values and sort
+	certDataSet.Finalize() // Produce summary values and sort
 
 	return certDataSet
 }
@@ -0,0 +1,112 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultUserAgent user agent sent with HTTP probes if Options.UserAgent is
+	// empty
+	DefaultUserAgent = "certcheck"
+	httpDefaultPort  = "80"
+)
+
+// httpClient make a client that connects to address for every request and
+// does not follow redirects
+func (options *Options) httpClient(address string) *http.Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			return options.dial(ctx, address, port)
+		},
+		// The certificate has already been checked
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   options.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// head make a HEAD request and return the response with its body closed
+func (options *Options) head(ctx context.Context, client *http.Client, url string) (response *http.Response, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return
+	}
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+
+	response, err = client.Do(request)
+	if err != nil {
+		return
+	}
+	response.Body.Close()
+
+	return
+}
+
+// parseHSTS read the max-age, includeSubDomains and preload directives of a
+// Strict-Transport-Security header
+func parseHSTS(header string, probe *HTTPProbe) {
+	for _, directive := range strings.Split(header, ";") {
+		directive = strings.TrimSpace(directive)
+		name, value, _ := strings.Cut(directive, "=")
+		switch strings.ToLower(name) {
+		case "max-age":
+			probe.HSTSMaxAge, _ = strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		case "includesubdomains":
+			probe.HSTSIncludeSubdomains = true
+		case "preload":
+			probe.HSTSPreload = true
+		}
+	}
+}
+
+// probeHTTP make a HEAD request over HTTPS to record HSTS, and one over plain
+// HTTP on port 80 to see if it redirects to HTTPS. Requests go to the address
+// the TLS check connected to.
+func (options *Options) probeHTTP(ctx context.Context, host, address, port string) *HTTPProbe {
+	probe := new(HTTPProbe)
+	if address == "" {
+		address = host
+	}
+	client := options.httpClient(address)
+
+	response, err := options.head(ctx, client, "https://"+net.JoinHostPort(host, port)+"/")
+	if err != nil {
+		probe.Message = err.Error()
+		return probe
+	}
+	probe.Status = response.StatusCode
+	if hsts := response.Header.Get("Strict-Transport-Security"); hsts != "" {
+		probe.HSTS = true
+		parseHSTS(hsts, probe)
+	}
+
+	response, err = options.head(ctx, client, "http://"+net.JoinHostPort(host, httpDefaultPort)+"/")
+	if err != nil {
+		probe.Message = err.Error()
+		return probe
+	}
+	location := response.Header.Get("Location")
+	probe.RedirectsToHTTPS = response.StatusCode >= 300 && response.StatusCode < 400 && strings.HasPrefix(strings.ToLower(location), "https://")
+
+	return probe
+}
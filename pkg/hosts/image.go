@@ -0,0 +1,31 @@
+package hosts
+
+import (
+	"context"
+
+	"github.com/imarsman/certcheck/v2/pkg/image"
+)
+
+// ProcessImage check the .pem, .crt and .cer files in a container image, such
+// as certs and trust store bundles baked into it. The image is pulled from its
+// registry, or read from a local tar written by docker save or holding an OCI
+// layout. platform picks the image from a multi-platform index, the platform
+// of this machine if empty. Each result has File set to the path in the
+// image. Errors are returned only if the image can't be read.
+func (hostSet *HostSet) ProcessImage(ref, platform string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	client := image.NewClient(options.Timeout)
+	client.Platform = platform
+
+	files, err := client.Files(context.Background(), ref, isCertPath)
+	if err != nil {
+		return
+	}
+	certDataSet = NewCertDataSet()
+	for name, contents := range files {
+		certDataSet.CertData = append(certDataSet.CertData, hostSet.certFileResults(name, contents, nil, warnAtDays)...)
+	}
+	certDataSet.Finalize()
+
+	return
+}
@@ -0,0 +1,61 @@
+package hosts
+
+import (
+	"bytes"
+	"crypto/x509"
+	"sync"
+
+	"github.com/imarsman/certcheck/v2/pkg/trust"
+)
+
+// Issuer types
+const (
+	issuerPublic     = "public"      // chains to a root in the Mozilla store
+	issuerPrivate    = "private"     // issued by a CA that is not publicly trusted
+	issuerSelfSigned = "self-signed" // signed by its own key
+)
+
+var (
+	publicRootsOnce sync.Once
+	publicRoots     *x509.CertPool
+)
+
+// isSelfSigned check if a cert names itself as issuer and is signed by its own
+// key
+func isSelfSigned(cert *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, cert.RawSubject) {
+		return false
+	}
+
+	return cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+// issuerType classify the issuer of a served chain. The Mozilla roots decide
+// what is public so the result is the same whatever the local trust store
+// holds. Validity is checked as of the middle of the leaf's lifetime so an
+// expired public cert is still public.
+func issuerType(certs []*x509.Certificate) string {
+	leaf := certs[0]
+	if isSelfSigned(leaf) {
+		return issuerSelfSigned
+	}
+	publicRootsOnce.Do(func() {
+		publicRoots, _ = trust.Pool(trust.StoreMozilla)
+	})
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         publicRoots,
+		Intermediates: intermediates,
+		CurrentTime:   leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return issuerPrivate
+	}
+
+	return issuerPublic
+}
@@ -0,0 +1,62 @@
+package hosts
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/imarsman/certcheck/v2/pkg/cert"
+)
+
+// Key match values reported for certs read from files
+const (
+	KeyMatched    = "match"    // one of the keys given is the cert's private key
+	KeyMismatched = "mismatch" // none of the keys given is
+)
+
+// KeyFile the public key of a private key file, to match certs against
+type KeyFile struct {
+	Path   string
+	Public crypto.PublicKey
+}
+
+// ReadKeyFile read a PEM or DER private key file, opening an encrypted key
+// with password. Files larger than MaxCertSize are an error.
+func (options *Options) ReadKeyFile(path, password string) (keyFile KeyFile, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	contents, err := readLimited(file, options.withDefaults().MaxCertSize)
+	if err != nil {
+		return
+	}
+	public, err := cert.ReadPrivateKey(contents, password)
+	if err != nil {
+		return keyFile, fmt.Errorf("%s: %v", path, err)
+	}
+
+	return KeyFile{Path: path, Public: public}, nil
+}
+
+// matchKey set KeyMatch to whether one of Options.Keys is the private key of
+// a cert, and KeyFile to the one that is. Nothing is set if there are no keys,
+// or for a CA cert no key matches, as bundles hold the intermediates and root
+// of a leaf without their keys.
+func (options *Options) matchKey(certData *CertData, leaf *x509.Certificate) {
+	if len(options.Keys) == 0 {
+		return
+	}
+	for _, key := range options.Keys {
+		if cert.KeyMatches(leaf, key.Public) {
+			certData.KeyMatch = KeyMatched
+			certData.KeyFile = key.Path
+			return
+		}
+	}
+	if !leaf.IsCA {
+		certData.KeyMatch = KeyMismatched
+	}
+}
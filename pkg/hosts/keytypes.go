@@ -0,0 +1,69 @@
+package hosts
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+)
+
+// keyTypeSuites TLS 1.2 cipher suites usable only with an RSA or only with
+// an ECDSA cert. Offering one group asks a server for its cert of that type.
+// Ed25519 certs are served for the ECDSA suites.
+var keyTypeSuites = []struct {
+	keyType string
+	suites  []uint16
+}{
+	{"RSA", []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_AES_128_CBC_SHA, tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	}},
+	{"ECDSA", []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	}},
+}
+
+// probeKeyTypes get the leaf cert a server has for each key type by offering
+// only the TLS 1.2 suites for that type. dual is true if it serves more than
+// one leaf. Servers that only accept TLS 1.3 choose a cert by signature
+// algorithm, which crypto/tls can't restrict, and are not probed.
+func (options *Options) probeKeyTypes(ctx context.Context, host, address, port, protocol string) (leaves []LeafCert, dual bool) {
+	seen := make(map[string]bool)
+	for _, group := range keyTypeSuites {
+		config := options.tlsConfig(host)
+		config.MinVersion = tls.VersionTLS12
+		config.MaxVersion = tls.VersionTLS12
+		config.CipherSuites = group.suites
+		config.InsecureSkipVerify = true
+
+		conn, err := options.dialTLS(ctx, address, port, protocol, config)
+		if err != nil {
+			continue
+		}
+		cert := conn.ConnectionState().PeerCertificates[0]
+		conn.Close()
+
+		sum := sha256.Sum256(cert.Raw)
+		fingerprint := hex.EncodeToString(sum[:])
+		if seen[fingerprint] {
+			continue
+		}
+		seen[fingerprint] = true
+		keyType, bits := keyStrength(cert)
+		leaves = append(leaves, LeafCert{
+			KeyType:     keyType,
+			KeyBits:     bits,
+			Subject:     cert.Subject.String(),
+			Issuer:      cert.Issuer.String(),
+			NotBefore:   cert.NotBefore.Format(timeFormat),
+			NotAfter:    cert.NotAfter.Format(timeFormat),
+			Fingerprint: fingerprint,
+		})
+	}
+
+	return leaves, len(leaves) > 1
+}
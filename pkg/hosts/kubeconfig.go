@@ -0,0 +1,95 @@
+package hosts
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kubeconfig the parts of a kubeconfig file holding certificates
+type kubeconfig struct {
+	Clusters []struct {
+		Name    string `json:"name" yaml:"name"`
+		Cluster struct {
+			CAData string `json:"certificate-authority-data" yaml:"certificate-authority-data"`
+			CAFile string `json:"certificate-authority" yaml:"certificate-authority"`
+		} `json:"cluster" yaml:"cluster"`
+	} `json:"clusters" yaml:"clusters"`
+	Users []struct {
+		Name string `json:"name" yaml:"name"`
+		User struct {
+			CertData string `json:"client-certificate-data" yaml:"client-certificate-data"`
+			CertFile string `json:"client-certificate" yaml:"client-certificate"`
+		} `json:"user" yaml:"user"`
+	} `json:"users" yaml:"users"`
+}
+
+// kubeconfigCert get a cert given in a kubeconfig as base64 data or as a
+// file, which is relative to the kubeconfig's directory and read up to
+// maxSize bytes. ok is false if neither is set.
+func kubeconfigCert(dir, data, file string, maxSize int64) (contents []byte, ok bool, err error) {
+	switch {
+	case data != "":
+		contents, err = base64.StdEncoding.DecodeString(data)
+		return contents, true, err
+	case file != "":
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		reader, err := os.Open(file)
+		if err != nil {
+			return nil, true, err
+		}
+		defer reader.Close()
+		contents, err = readLimited(reader, maxSize)
+		return contents, true, err
+	}
+
+	return nil, false, nil
+}
+
+// ProcessKubeconfig check the cluster CA certs and client certs in a
+// kubeconfig file, whether given inline as base64 data or as files. Each
+// result has File set to the kubeconfig path and the cluster or user it came
+// from, as in ~/.kube/config:user/admin. An expired client cert locks its
+// user out of the cluster. Errors are returned only for a kubeconfig that
+// can't be read.
+func (hostSet *HostSet) ProcessKubeconfig(path string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	var config kubeconfig
+	if err = yaml.Unmarshal(contents, &config); err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig %s: %v", path, err)
+	}
+
+	dir := filepath.Dir(path)
+	certDataSet = NewCertDataSet()
+	add := func(kind, name, data, file string) {
+		certContents, ok, readErr := kubeconfigCert(dir, data, file, options.MaxCertSize)
+		if !ok {
+			return
+		}
+		entry := fmt.Sprintf("%s:%s/%s", path, kind, name)
+		results := options.certResults(entry, certContents, readErr, warnAtDays)
+		if len(results) == 0 {
+			results = options.certResults(entry, nil, errors.New("no certificate found"), warnAtDays)
+		}
+		certDataSet.CertData = append(certDataSet.CertData, results...)
+	}
+	for _, cluster := range config.Clusters {
+		add("cluster", cluster.Name, cluster.Cluster.CAData, cluster.Cluster.CAFile)
+	}
+	for _, user := range config.Users {
+		add("user", user.Name, user.User.CertData, user.User.CertFile)
+	}
+	certDataSet.Finalize()
+
+	return
+}
@@ -0,0 +1,107 @@
+package hosts
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetPath a named way of reaching hosts, such as from a management network or
+// from the public internet. Unset parts are taken from the options of the
+// host set.
+type NetPath struct {
+	Name      string
+	SourceIP  net.IP        // local address to connect from
+	Interface string        // network interface to connect from
+	DNS       string        // DNS server to resolve host names with, as for NewResolver
+	Resolver  *net.Resolver // resolver for DNS
+	Proxy     *url.URL      // HTTP proxy to connect through
+}
+
+// ParseNetPath parse a path given as a name, an equals sign and comma
+// separated settings, such as mgmt=source=10.0.0.5,dns=10.0.0.53 or
+// public=interface=eth0,proxy=http://proxy:3128. The settings are source,
+// interface, dns and proxy.
+func ParseNetPath(spec string, timeout time.Duration) (path NetPath, err error) {
+	name, settings, ok := strings.Cut(spec, "=")
+	path.Name = strings.TrimSpace(name)
+	if !ok || path.Name == "" {
+		return path, fmt.Errorf("invalid network path %s, expected NAME=SETTING=VALUE,...", spec)
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(setting), "=")
+		if !ok || value == "" {
+			return path, fmt.Errorf("network path %s: invalid setting %q", path.Name, setting)
+		}
+		switch key {
+		case "source":
+			if path.SourceIP = net.ParseIP(value); path.SourceIP == nil {
+				return path, fmt.Errorf("network path %s: invalid source IP %s", path.Name, value)
+			}
+		case "interface":
+			path.Interface = value
+		case "dns":
+			path.DNS = value
+			if path.Resolver, err = NewResolver(value, timeout); err != nil {
+				return path, fmt.Errorf("network path %s: %v", path.Name, err)
+			}
+		case "proxy":
+			if path.Proxy, err = url.Parse(value); err != nil || path.Proxy.Host == "" {
+				return path, fmt.Errorf("network path %s: invalid proxy %s", path.Name, value)
+			}
+		default:
+			return path, fmt.Errorf("network path %s: unknown setting %s, expected source, interface, dns or proxy", path.Name, key)
+		}
+	}
+
+	return
+}
+
+// apply get options that reach hosts over the path
+func (path NetPath) apply(options Options) Options {
+	if path.SourceIP != nil || path.Interface != "" {
+		options.SourceIP, options.Interface = path.SourceIP, path.Interface
+	}
+	if path.Resolver != nil {
+		options.Resolver = path.Resolver
+	}
+	if path.Proxy != nil {
+		options.Proxy = path.Proxy
+	}
+
+	return options
+}
+
+// ProcessPaths check every host over each network path at once, setting
+// NetPath on each result, and compare what each host served over the paths
+// in Paths. Hosts that serve different certificates depending on
+// where they are reached from, such as with split horizon DNS, are found this
+// way.
+func (hostSet *HostSet) ProcessPaths(paths []NetPath, warnAtDays int, timeout time.Duration) *CertDataSet {
+	results := make([]*CertDataSet, len(paths))
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		go func(i int, path NetPath) {
+			defer wg.Done()
+			pathSet := &HostSet{Hosts: hostSet.Hosts, Options: path.apply(hostSet.Options)}
+			results[i] = pathSet.Process(warnAtDays, timeout)
+			for j := range results[i].CertData {
+				results[i].CertData[j].NetPath = path.Name
+			}
+		}(i, path)
+	}
+	wg.Wait()
+
+	certDataSet := NewCertDataSet()
+	for _, result := range results {
+		certDataSet.CertData = append(certDataSet.CertData, result.CertData...)
+	}
+	certDataSet.Finalize()
+	certDataSet.ComparePaths()
+
+	return certDataSet
+}
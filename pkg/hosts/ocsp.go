@@ -0,0 +1,114 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/imarsman/certcheck/v2/pkg/ocsp"
+)
+
+// OCSP status values reported in addition to good, revoked and unknown
+const (
+	ocspStale       = "stale"
+	ocspInvalid     = "invalid"
+	ocspNone        = "none"
+	ocspUnreachable = "unreachable"
+)
+
+// issuerOf get the issuer of the leaf certificate from a handshake, preferring
+// the verified chain
+func issuerOf(state tls.ConnectionState) *x509.Certificate {
+	if len(state.VerifiedChains) > 0 && len(state.VerifiedChains[0]) > 1 {
+		return state.VerifiedChains[0][1]
+	}
+	if len(state.PeerCertificates) > 1 {
+		return state.PeerCertificates[1]
+	}
+
+	return nil
+}
+
+// stapledOCSP check the OCSP response stapled in a handshake. A revoked
+// certificate is an error, as is a must-staple certificate without a good
+// stapled response since clients that honour must-staple will refuse it.
+func stapledOCSP(state tls.ConnectionState, now time.Time) (stapled bool, status string, err error) {
+	leaf := state.PeerCertificates[0]
+	mustStaple := ocsp.MustStaple(leaf)
+
+	if len(state.OCSPResponse) == 0 {
+		if mustStaple {
+			err = errors.New("must-staple certificate without stapled OCSP response")
+		}
+		return
+	}
+	stapled = true
+
+	response, checkErr := ocsp.ParseResponse(state.OCSPResponse)
+	if checkErr == nil {
+		issuer := issuerOf(state)
+		if issuer == nil {
+			checkErr = errors.New("no issuer to verify OCSP response")
+		} else {
+			checkErr = response.Check(leaf, issuer, now)
+		}
+	}
+
+	switch {
+	case checkErr != nil && response != nil && !response.NextUpdate.IsZero() && now.After(response.NextUpdate):
+		status = ocspStale
+	case checkErr != nil:
+		status = ocspInvalid
+	default:
+		status = response.Status
+	}
+
+	switch {
+	case status == ocsp.Revoked:
+		err = fmt.Errorf("certificate revoked at %s", response.RevokedAt.UTC().Format(timeFormat))
+	case mustStaple && status != ocsp.Good:
+		err = fmt.Errorf("must-staple certificate with %s stapled OCSP response", status)
+	}
+
+	return
+}
+
+// responderOCSP ask the OCSP responder named in the leaf cert's authority
+// information access extension for its status. A revoked certificate is an
+// error. A responder that can't be reached or gives an invalid answer is
+// reported in the status only, since that says nothing about the host.
+func (options *Options) responderOCSP(ctx context.Context, state tls.ConnectionState) (status, revokedAt string, err error) {
+	leaf := state.PeerCertificates[0]
+	issuer := issuerOf(state)
+	if len(leaf.OCSPServer) == 0 {
+		status = ocspNone
+		return
+	}
+	if issuer == nil {
+		status = ocspInvalid
+		return
+	}
+
+	client := &http.Client{Timeout: options.Timeout}
+	response, queryErr := ocsp.Query(ctx, client, leaf.OCSPServer[0], leaf, issuer)
+	if queryErr != nil {
+		status = ocspInvalid
+		var urlErr *url.Error
+		if errors.As(queryErr, &urlErr) {
+			status = ocspUnreachable
+		}
+		return
+	}
+	status = response.Status
+	if status == ocsp.Revoked {
+		revokedAt = response.RevokedAt.UTC().Format(timeFormat)
+		err = fmt.Errorf("certificate revoked at %s", revokedAt)
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+package hosts
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	// OptOutTXT DNS TXT record a domain publishes to opt its hosts out of
+	// public scans
+	OptOutTXT = "certcheck=opt-out"
+	// OptOutField security.txt (RFC 9116) field that opts a host out of
+	// public scans with a value of opt-out
+	OptOutField = "Scan-Policy"
+
+	securityTxtPath = "/.well-known/security.txt"
+	maxSecurityTxt  = 32 * 1024
+)
+
+// optOutNames get the names to look for an opt-out TXT record at, the host
+// and each parent domain above the top level
+func optOutNames(host string) (names []string) {
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		names = append(names, strings.Join(labels[i:], "."))
+	}
+
+	return
+}
+
+// optOutDNS look for an opt-out TXT record at a host or a parent domain,
+// returning the name it was found at
+func (options *Options) optOutDNS(ctx context.Context, host string) (name string, err error) {
+	if net.ParseIP(host) != nil {
+		return
+	}
+	resolver := options.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	for _, candidate := range optOutNames(host) {
+		records, err := resolver.LookupTXT(ctx, candidate)
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, record := range records {
+			if strings.EqualFold(strings.TrimSpace(record), OptOutTXT) {
+				return candidate, nil
+			}
+		}
+	}
+
+	return
+}
+
+// optOutHTTPS look for an opt-out field in the security.txt a host serves,
+// from the port being checked if it is plain TLS and from 443 otherwise. A
+// host that serves none hasn't opted out.
+func (options *Options) optOutHTTPS(ctx context.Context, host, port string) (optOut bool, err error) {
+	if protocol, _ := protocolForPort(port, options.Protocol); protocol != ProtocolTLS {
+		port = "443"
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://"+net.JoinHostPort(host, port)+securityTxtPath, nil)
+	if err != nil {
+		return
+	}
+	userAgent := options.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	request.Header.Set("User-Agent", userAgent)
+	request.Host = host
+
+	response, err := options.httpClient(host).Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return
+	}
+
+	return securityTxtOptOut(io.LimitReader(response.Body, maxSecurityTxt)), nil
+}
+
+// securityTxtOptOut get whether a security.txt has an opt-out field
+func securityTxtOptOut(reader io.Reader) bool {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), OptOutField) &&
+			strings.EqualFold(strings.TrimSpace(value), "opt-out") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scanPolicy find whether a host has opted out of public scans, by a DNS TXT
+// record of OptOutTXT at it or a parent domain or by an OptOutField in its
+// security.txt. A DNS error is returned as a warning, the host being checked
+// as if it had not opted out, while a security.txt that can't be fetched is
+// taken as none.
+func (options *Options) scanPolicy(ctx context.Context, host, port string) (policy, message, warning string) {
+	name, err := options.optOutDNS(ctx, host)
+	if err != nil {
+		warning = fmt.Sprintf("scan opt-out TXT record not checked: %v", err)
+	}
+	if name != "" {
+		return model.ScanPolicyOptOutDNS, fmt.Sprintf("not checked, opted out of scans with a TXT record at %s", name), ""
+	}
+	if optOut, _ := options.optOutHTTPS(ctx, host, port); optOut {
+		return model.ScanPolicyOptOutHTTPS, fmt.Sprintf("not checked, opted out of scans in %s", securityTxtPath), ""
+	}
+
+	return model.ScanPolicyNone, "", warning
+}
@@ -0,0 +1,76 @@
+package hosts
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Pin status values
+const (
+	pinMatch    = "match"
+	pinMismatch = "mismatch"
+)
+
+// ReadPins read a pin list. Each line has a host or host:port followed by one
+// or more base64 SHA-256 hashes of a SubjectPublicKeyInfo, optionally written
+// with a sha256/ prefix as in HPKP. Blank lines and lines starting with # are
+// skipped.
+func ReadPins(reader io.Reader) (pins map[string][]string, err error) {
+	pins = make(map[string][]string)
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: no pins for %s", line, fields[0])
+		}
+		host := strings.ToLower(fields[0])
+		for _, pin := range fields[1:] {
+			pin = strings.TrimPrefix(pin, "sha256/")
+			decoded, decodeErr := base64.StdEncoding.DecodeString(pin)
+			if decodeErr != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("line %d: invalid pin %s", line, pin)
+			}
+			pins[host] = append(pins[host], pin)
+		}
+	}
+	err = scanner.Err()
+
+	return
+}
+
+// spkiPin get the base64 SHA-256 hash of a certificate's SubjectPublicKeyInfo
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// checkPins check that a key in the chain matches a pin for the host, looking
+// for pins for host:port and then host. Hosts without pins are not checked.
+func (options *Options) checkPins(host, port string, chain []*x509.Certificate) (status string, err error) {
+	pins, ok := options.Pins[strings.ToLower(host+":"+port)]
+	if !ok {
+		pins, ok = options.Pins[strings.ToLower(host)]
+	}
+	if !ok {
+		return
+	}
+	for _, cert := range chain {
+		pin := spkiPin(cert)
+		for _, expected := range pins {
+			if pin == expected {
+				return pinMatch, nil
+			}
+		}
+	}
+
+	return pinMismatch, fmt.Errorf("no key in the chain matches the pins for %s, leaf key is %s", host, spkiPin(chain[0]))
+}
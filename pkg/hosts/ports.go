@@ -0,0 +1,101 @@
+package hosts
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// schemePorts default ports of URL schemes served over TLS or upgraded to it
+var schemePorts = map[string]string{
+	"https":      "443",
+	"wss":        "443",
+	"smtps":      "465",
+	"smtp":       "25",
+	"submission": "587",
+	"imaps":      "993",
+	"imap":       "143",
+	"pop3s":      "995",
+	"pop3":       "110",
+	"ldaps":      "636",
+	"ldap":       "389",
+	"ftps":       "990",
+	"ftp":        "21",
+	"postgres":   "5432",
+	"postgresql": "5432",
+}
+
+// maxExpandedPorts most ports one host entry can expand to, so a mistyped
+// range doesn't start a port scan
+const maxExpandedPorts = 1024
+
+// ExpandPorts expand a host given with a list or range of ports, such as
+// host:443,8443 or host:8000-8010, into one host:port item per port. Items
+// with a single port or none are returned as they are, as are items whose
+// ports can't be parsed, leaving them for Lookup to report.
+func ExpandPorts(item string) []string {
+	i := strings.LastIndex(item, ":")
+	if i < 0 || !strings.ContainsAny(item[i+1:], ",-") {
+		return []string{item}
+	}
+	host := item[:i]
+
+	var items []string
+	for _, part := range strings.Split(item[i+1:], ",") {
+		first, last, err := portRange(part)
+		if err != nil || len(items)+last-first >= maxExpandedPorts {
+			return []string{item}
+		}
+		for port := first; port <= last; port++ {
+			items = append(items, fmt.Sprintf("%s:%d", host, port))
+		}
+	}
+
+	return items
+}
+
+// portRange get the first and last port of a port or a range of them
+func portRange(part string) (first, last int, err error) {
+	low, high, isRange := strings.Cut(strings.TrimSpace(part), "-")
+	if first, err = strconv.Atoi(low); err != nil {
+		return
+	}
+	last = first
+	if isRange {
+		if last, err = strconv.Atoi(high); err != nil {
+			return
+		}
+	}
+	if first < 1 || last > 65535 || first > last {
+		err = fmt.Errorf("invalid port range %s", part)
+	}
+
+	return
+}
+
+// urlHostAndPort get the host and port of a URL, such as one pasted from a
+// browser, using the default port of its scheme if it has none. The path and
+// anything after it are ignored.
+func urlHostAndPort(input string) (host, port string, err error) {
+	u, err := url.Parse(input)
+	if err != nil {
+		return
+	}
+	host = u.Hostname()
+	if host == "" {
+		err = fmt.Errorf("no host in %s", input)
+		return
+	}
+	defaultPort, ok := schemePorts[strings.ToLower(u.Scheme)]
+	if !ok {
+		err = fmt.Errorf("%s URLs are not served over TLS", u.Scheme)
+		return
+	}
+	port = u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+
+	return
+}
@@ -0,0 +1,243 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitCommand client used to read the history of a repository
+var gitCommand = "git"
+
+// PEM markers looked for in repository files
+var (
+	pemBegin        = []byte("-----BEGIN ")
+	certBegin       = []byte("-----BEGIN CERTIFICATE-----")
+	privateKeyBegin = regexp.MustCompile(`-----BEGIN [A-Z0-9 ]*PRIVATE KEY-----`)
+)
+
+// pemDigest hash the certificate and private key blocks in contents, to find
+// the same material in more than one place. ok is false if there are none.
+func pemDigest(contents []byte) (digest string, ok bool) {
+	hash := sha256.New()
+	for {
+		block, rest := pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" || strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			hash.Write(block.Bytes)
+			ok = true
+		}
+		contents = rest
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), ok
+}
+
+// repoResults check a file from a repository. Certs are checked as for cert
+// files and PrivateKey is set if the file holds a private key. A file with
+// neither gives no results.
+func (options *Options) repoResults(name string, contents []byte, warnAtDays int) (results []CertData) {
+	hasKey := privateKeyBegin.Match(contents)
+	switch {
+	case bytes.Contains(contents, certBegin):
+		results = options.certFileResults(name, contents, nil, warnAtDays)
+	case hasKey:
+		certData := newCertData()
+		certData.File = name
+		certData.Message = "private key"
+		results = []CertData{certData}
+	}
+	for i := range results {
+		results[i].PrivateKey = hasKey
+	}
+
+	return
+}
+
+// historyFile text added to a file in a commit
+type historyFile struct {
+	commit   string
+	path     string
+	contents []byte
+}
+
+// readDiffLine read a line without its line ending. Lines longer than max bytes
+// are read to their end but returned empty with long set.
+func readDiffLine(reader *bufio.Reader, max int64) (line []byte, long bool, err error) {
+	for {
+		chunk, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, false, err
+		}
+		if !long {
+			if int64(len(line)+len(chunk)) > max {
+				line, long = nil, true
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if !isPrefix {
+			return line, long, nil
+		}
+	}
+}
+
+// parseHistory get the text added to each file in each commit from the
+// output of git log -p, keeping only additions that contain PEM blocks and
+// up to about maxSize bytes of each. Lines longer than maxSize, as in
+// minified files and lockfiles, can't be part of a cert file and are skipped.
+func parseHistory(input io.Reader, maxSize int64) (files []historyFile, err error) {
+	var current historyFile
+	var added bytes.Buffer
+	inHeader := false
+	flush := func() {
+		if current.path != "" && bytes.Contains(added.Bytes(), pemBegin) {
+			current.contents = append([]byte(nil), added.Bytes()...)
+			files = append(files, current)
+		}
+		added.Reset()
+		current.path = ""
+	}
+
+	reader := bufio.NewReader(input)
+	for {
+		raw, long, readErr := readDiffLine(reader, maxSize)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return nil, readErr
+		}
+		if long {
+			continue
+		}
+		line := string(raw)
+		switch {
+		case strings.HasPrefix(line, "commit "):
+			flush()
+			current.commit = strings.TrimPrefix(line, "commit ")
+		case strings.HasPrefix(line, "diff --git "):
+			flush()
+			inHeader = true
+		case inHeader && strings.HasPrefix(line, "+++ "):
+			// Deleted files are /dev/null and add nothing
+			current.path = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+			if current.path == "/dev/null" {
+				current.path = ""
+			}
+		case inHeader && strings.HasPrefix(line, "@@"):
+			inHeader = false
+		case !inHeader && strings.HasPrefix(line, "+") && int64(added.Len()) < maxSize:
+			added.WriteString(line[1:])
+			added.WriteByte('\n')
+		}
+	}
+	flush()
+
+	return files, nil
+}
+
+// repoHistory get the PEM text added in every commit on every branch
+func repoHistory(dir string, maxSize int64) (files []historyFile, err error) {
+	cmd := exec.Command(gitCommand, "-C", dir, "log", "--all", "-p", "--no-color", "--no-ext-diff",
+		"--no-renames", "--format=commit %H")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	files, err = parseHistory(output, maxSize)
+	// Read the rest of the log so git can exit if parsing stopped early
+	io.Copy(io.Discard, output)
+	if waitErr := cmd.Wait(); waitErr != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git log: %s", message)
+		}
+		return nil, fmt.Errorf("git log: %w", waitErr)
+	}
+
+	return
+}
+
+// ProcessRepo check the PEM certs and private keys in a repository working
+// tree, found by their contents rather than file extension, skipping the
+// .git directory. Results for files holding a private key have PrivateKey
+// set. With history, certs and keys added in any commit on any branch are
+// also reported once each, with File set to the path and the commit. History
+// is read with the git command.
+func (hostSet *HostSet) ProcessRepo(dir string, history bool, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	certDataSet = NewCertDataSet()
+	maxSize := hostSet.Options.withDefaults().MaxCertSize
+	seen := make(map[string]bool)
+	add := func(name string, contents []byte) {
+		digest, ok := pemDigest(contents)
+		if !ok || seen[digest] {
+			return
+		}
+		seen[digest] = true
+		certDataSet.CertData = append(certDataSet.CertData, hostSet.repoResults(name, contents, warnAtDays)...)
+	}
+
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		// Files are searched for PEM, so a large one is searched in part
+		contents, err := io.ReadAll(io.LimitReader(file, maxSize))
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(contents, pemBegin) {
+			name, _ := filepath.Rel(dir, path)
+			add(filepath.ToSlash(name), contents)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	if history {
+		files, historyErr := repoHistory(dir, maxSize)
+		if historyErr != nil {
+			return certDataSet, historyErr
+		}
+		for _, file := range files {
+			commit := file.commit
+			if len(commit) > 12 {
+				commit = commit[:12]
+			}
+			add(file.path+"@"+commit, file.contents)
+		}
+	}
+	certDataSet.Finalize()
+
+	return
+}
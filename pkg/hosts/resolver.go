@@ -0,0 +1,166 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	dnsDefaultPort = "53"
+	dotDefaultPort = "853"
+	dohContentType = "application/dns-message"
+)
+
+// NewResolver make a resolver that sends all queries to a DNS server. The
+// server can be a plain address such as 1.1.1.1:53, a DNS over TLS address
+// such as tls://1.1.1.1:853 or a DNS over HTTPS URL such as
+// https://cloudflare-dns.com/dns-query.
+func NewResolver(server string, timeout time.Duration) (resolver *net.Resolver, err error) {
+	var dial func(ctx context.Context, network, address string) (net.Conn, error)
+
+	switch {
+	case strings.HasPrefix(server, "https://"):
+		client := &http.Client{Timeout: timeout}
+		dial = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return &dohConn{ctx: ctx, url: server, client: client}, nil
+		}
+	case strings.HasPrefix(server, "tls://"):
+		address := withDefaultPort(strings.TrimPrefix(server, "tls://"), dotDefaultPort)
+		host, _, _ := net.SplitHostPort(address)
+		dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dialer := &tls.Dialer{
+				NetDialer: &net.Dialer{Timeout: timeout},
+				Config:    &tls.Config{ServerName: host},
+			}
+			return dialer.DialContext(ctx, "tcp", address)
+		}
+	default:
+		forced := ""
+		for _, scheme := range []string{"udp", "tcp"} {
+			if strings.HasPrefix(server, scheme+"://") {
+				forced = scheme
+				server = strings.TrimPrefix(server, scheme+"://")
+			}
+		}
+		address := withDefaultPort(server, dnsDefaultPort)
+		host, _, splitErr := net.SplitHostPort(address)
+		if splitErr != nil || host == "" || strings.ContainsAny(host, " \t") {
+			err = fmt.Errorf("invalid DNS server %s", server)
+			return
+		}
+		dial = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			if forced != "" {
+				network = forced
+			}
+			dialer := &net.Dialer{Timeout: timeout}
+			return dialer.DialContext(ctx, network, address)
+		}
+	}
+
+	resolver = &net.Resolver{PreferGo: true, Dial: dial}
+
+	return
+}
+
+// withDefaultPort add a port to an address that doesn't have one
+func withDefaultPort(address, port string) string {
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return address
+	}
+
+	return net.JoinHostPort(strings.Trim(address, "[]"), port)
+}
+
+// dohConn a connection that carries DNS over HTTPS. The Go resolver treats any
+// connection that is not a PacketConn as a stream, so each message written is
+// prefixed with a two byte length, as is each message it reads back.
+type dohConn struct {
+	ctx      context.Context
+	url      string
+	client   *http.Client
+	written  bytes.Buffer
+	response bytes.Buffer
+}
+
+// Write collect a length prefixed query and send it once it is complete
+func (conn *dohConn) Write(b []byte) (n int, err error) {
+	n, _ = conn.written.Write(b)
+	if conn.written.Len() < 2 {
+		return
+	}
+	length := int(binary.BigEndian.Uint16(conn.written.Bytes()[:2]))
+	if conn.written.Len() < length+2 {
+		return
+	}
+	message := make([]byte, length)
+	copy(message, conn.written.Bytes()[2:length+2])
+	conn.written.Next(length + 2)
+
+	err = conn.exchange(message)
+
+	return
+}
+
+// exchange post a DNS message and queue the length prefixed answer for Read
+func (conn *dohConn) exchange(message []byte) (err error) {
+	request, err := http.NewRequestWithContext(conn.ctx, http.MethodPost, conn.url, bytes.NewReader(message))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", dohContentType)
+	request.Header.Set("Accept", dohContentType)
+
+	response, err := conn.client.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("DNS over HTTPS server returned %s", response.Status)
+	}
+	answer, err := io.ReadAll(io.LimitReader(response.Body, 65535))
+	if err != nil {
+		return
+	}
+	binary.Write(&conn.response, binary.BigEndian, uint16(len(answer)))
+	conn.response.Write(answer)
+
+	return
+}
+
+// Read read queued answers
+func (conn *dohConn) Read(b []byte) (n int, err error) {
+	if conn.response.Len() == 0 {
+		return 0, errors.New("no DNS over HTTPS response")
+	}
+
+	return conn.response.Read(b)
+}
+
+// Close nothing to close as each exchange is its own request
+func (conn *dohConn) Close() error { return nil }
+
+// LocalAddr not meaningful for DNS over HTTPS
+func (conn *dohConn) LocalAddr() net.Addr { return nil }
+
+// RemoteAddr not meaningful for DNS over HTTPS
+func (conn *dohConn) RemoteAddr() net.Addr { return nil }
+
+// SetDeadline deadlines are handled by the HTTP client timeout
+func (conn *dohConn) SetDeadline(t time.Time) error { return nil }
+
+// SetReadDeadline deadlines are handled by the HTTP client timeout
+func (conn *dohConn) SetReadDeadline(t time.Time) error { return nil }
+
+// SetWriteDeadline deadlines are handled by the HTTP client timeout
+func (conn *dohConn) SetWriteDeadline(t time.Time) error { return nil }
@@ -0,0 +1,53 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// rootExtensions extensions of files read from a CA directory
+var rootExtensions = []string{".pem", ".crt", ".cer"}
+
+// AppendRoots add the PEM certificates in a file and in the .pem, .crt and .cer
+// files of a directory to a pool. Either path can be empty. A file or
+// directory with no certificates is an error.
+func AppendRoots(pool *x509.CertPool, file, dir string) (err error) {
+	if file != "" {
+		var contents []byte
+		contents, err = os.ReadFile(file)
+		if err != nil {
+			return
+		}
+		if !pool.AppendCertsFromPEM(contents) {
+			return fmt.Errorf("no certificates found in %s", file)
+		}
+	}
+	if dir != "" {
+		var entries []os.DirEntry
+		entries, err = os.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.IsDir() || !isListed(rootExtensions, filepath.Ext(entry.Name())) {
+				continue
+			}
+			var contents []byte
+			contents, err = os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return
+			}
+			if pool.AppendCertsFromPEM(contents) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("no certificates found in %s", dir)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,227 @@
+package hosts
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeDepth deepest nesting of included config files followed, so an
+// include loop ends
+const maxIncludeDepth = 16
+
+// Directives naming cert files and included config files. nginx directives
+// end with a semicolon, Apache directives are one per line and any case, and
+// haproxy names certs with crt on bind lines.
+var (
+	nginxCertDirective   = regexp.MustCompile(`(?:^|[\s;{])(ssl_certificate|include)\s+("[^"]*"|'[^']*'|[^\s;]+)\s*;`)
+	apacheCertDirective  = regexp.MustCompile(`(?i)^\s*(SSLCertificateFile|SSLCertificateChainFile|Include|IncludeOptional)\s+("[^"]*"|\S+)`)
+	haproxyCrtBase       = regexp.MustCompile(`^\s*crt-base\s+(\S+)`)
+	haproxyBindDirective = regexp.MustCompile(`^\s*bind\s`)
+	haproxyCrtOption     = regexp.MustCompile(`\scrt\s+(\S+)`)
+)
+
+// certRef a cert file named in a server config
+type certRef struct {
+	path         string
+	referencedBy string // config file and line naming the cert
+}
+
+// configScanner find the cert files named in nginx, Apache and haproxy
+// configs, following includes. Relative paths are taken from the directory
+// of the top config, as nginx does from its prefix and Apache from
+// ServerRoot when these are where the main config is.
+type configScanner struct {
+	root    string
+	seen    map[string]bool
+	refs    []certRef
+	crtBase string
+}
+
+// resolve make a path from a config absolute
+func (scanner *configScanner) resolve(path, base string) string {
+	path = strings.Trim(path, `"'`)
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(base, path)
+}
+
+// include scan the config files matching a path pattern
+func (scanner *configScanner) include(pattern string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("includes nested more than %d deep at %s", maxIncludeDepth, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	// A missing file that isn't a pattern is an error, as for the server
+	if len(paths) == 0 && !HasGlob(pattern) {
+		return fmt.Errorf("no such config file %s", pattern)
+	}
+	for _, path := range paths {
+		if err := scanner.scan(path, depth); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HasGlob whether a path has glob pattern characters, rather than naming one
+// file
+func HasGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// scan find cert files and includes in a config file, or in every file under
+// a config directory
+func (scanner *configScanner) scan(path string, depth int) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		paths, _, err := dirFiles(path, DefaultMaxCertSize)
+		if err != nil {
+			return err
+		}
+		for _, file := range paths {
+			if err := scanner.scan(file, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if scanner.seen[path] {
+		return nil
+	}
+	scanner.seen[path] = true
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	lines := bufio.NewScanner(file)
+	for line := 1; lines.Scan(); line++ {
+		text := lines.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		at := fmt.Sprintf("%s:%d", path, line)
+		addCert := func(cert, base string) {
+			scanner.refs = append(scanner.refs, certRef{path: scanner.resolve(cert, base), referencedBy: at})
+		}
+
+		// nginx includes end in a semicolon, which tells them from Apache's
+		if matches := nginxCertDirective.FindAllStringSubmatch(text, -1); matches != nil {
+			for _, match := range matches {
+				if match[1] == "include" {
+					if err := scanner.include(scanner.resolve(match[2], scanner.root), depth+1); err != nil {
+						return err
+					}
+					continue
+				}
+				addCert(match[2], scanner.root)
+			}
+			continue
+		}
+		if match := apacheCertDirective.FindStringSubmatch(text); match != nil {
+			switch strings.ToLower(match[1]) {
+			case "include":
+				if err := scanner.include(scanner.resolve(match[2], scanner.root), depth+1); err != nil {
+					return err
+				}
+			case "includeoptional":
+				// Missing optional includes are fine
+				scanner.include(scanner.resolve(match[2], scanner.root), depth+1)
+			default:
+				addCert(match[2], scanner.root)
+			}
+		}
+		if match := haproxyCrtBase.FindStringSubmatch(text); match != nil {
+			scanner.crtBase = scanner.resolve(match[1], scanner.root)
+		}
+		if haproxyBindDirective.MatchString(text) {
+			base := scanner.crtBase
+			if base == "" {
+				base = scanner.root
+			}
+			for _, match := range haproxyCrtOption.FindAllStringSubmatch(text, -1) {
+				addCert(match[1], base)
+			}
+		}
+	}
+
+	return lines.Err()
+}
+
+// serverConfigRefs find the cert files named in a server config file or
+// directory and the configs it includes
+func serverConfigRefs(path string) (refs []certRef, err error) {
+	root := path
+	if info, statErr := os.Stat(path); statErr == nil && !info.IsDir() {
+		root = filepath.Dir(path)
+	}
+	scanner := &configScanner{root: root, seen: make(map[string]bool)}
+	err = scanner.scan(path, 0)
+
+	return scanner.refs, err
+}
+
+// ProcessServerConfig check the cert files named in nginx ssl_certificate,
+// Apache SSLCertificateFile and SSLCertificateChainFile and haproxy bind crt
+// directives of a config file, or of every file under a config directory such
+// as /etc/nginx/sites-enabled, following includes. These are the certs actually
+// deployed, whatever else is on disk. A haproxy crt naming a directory has each
+// cert in it checked. Each result has File set to the cert file and
+// ReferencedBy to the config file and line naming it. Cert paths holding nginx
+// variables can't be resolved and are reported as errors. Errors are returned
+// only for a config that can't be read.
+func (hostSet *HostSet) ProcessServerConfig(path string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	refs, err := serverConfigRefs(path)
+	if err != nil {
+		return
+	}
+
+	certDataSet = NewCertDataSet()
+	checked := make(map[string]bool)
+	for _, ref := range refs {
+		if checked[ref.path] {
+			continue
+		}
+		checked[ref.path] = true
+
+		var results []CertData
+		info, statErr := os.Stat(ref.path)
+		switch {
+		case strings.Contains(ref.path, "$"):
+			results = options.certResults(ref.path, nil, fmt.Errorf("cert path %s uses variables", ref.path), warnAtDays)
+		case statErr == nil && info.IsDir():
+			files, _, dirErr := dirFiles(ref.path, options.MaxCertSize)
+			if dirErr != nil {
+				results = options.certResults(ref.path, nil, dirErr, warnAtDays)
+			}
+			// Key and OCSP files kept alongside are skipped
+			for _, file := range files {
+				results = append(results, options.certDirResults(file, warnAtDays)...)
+			}
+		default:
+			results = options.readCertFile(ref.path, warnAtDays)
+		}
+		for i := range results {
+			results[i].ReferencedBy = ref.referencedBy
+		}
+		certDataSet.CertData = append(certDataSet.CertData, results...)
+	}
+	certDataSet.Finalize()
+
+	return
+}
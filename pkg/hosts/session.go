@@ -0,0 +1,136 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	// sessionTicketWait longest wait for TLS 1.3 tickets sent after the handshake
+	sessionTicketWait = 500 * time.Millisecond
+	// maxRecorded bytes of a handshake kept to find the server hello
+	maxRecorded = 16 * 1024
+
+	recordTypeHandshake      = 22
+	handshakeTypeServerHello = 2
+	extensionRenegotiation   = 0xff01
+)
+
+// recordingConn a connection that keeps the first bytes read from it
+type recordingConn struct {
+	net.Conn
+	read bytes.Buffer
+}
+
+// Read read from the connection and record what was read
+func (conn *recordingConn) Read(b []byte) (n int, err error) {
+	n, err = conn.Conn.Read(b)
+	if conn.read.Len() < maxRecorded {
+		conn.read.Write(b[:n])
+	}
+
+	return
+}
+
+// serverHelloExtensions get the extension types in the server hello at the
+// start of a server handshake flight
+func serverHelloExtensions(data []byte) (extensions map[uint16]bool, err error) {
+	var message []byte
+	for len(data) >= 5 && data[0] == recordTypeHandshake {
+		length := int(binary.BigEndian.Uint16(data[3:5]))
+		if len(data) < 5+length {
+			break
+		}
+		message = append(message, data[5:5+length]...)
+		data = data[5+length:]
+	}
+	if len(message) < 4 || message[0] != handshakeTypeServerHello {
+		err = errors.New("no server hello")
+		return
+	}
+	length := int(message[1])<<16 | int(message[2])<<8 | int(message[3])
+	if len(message) < 4+length {
+		err = errors.New("short server hello")
+		return
+	}
+	body := message[4 : 4+length]
+
+	// Skip version and random, then session ID, cipher suite and compression
+	if len(body) < 35 {
+		err = errors.New("short server hello")
+		return
+	}
+	offset := 35 + int(body[34]) + 3
+	extensions = make(map[uint16]bool)
+	if len(body) < offset+2 {
+		return
+	}
+	end := offset + 2 + int(binary.BigEndian.Uint16(body[offset:]))
+	if end > len(body) {
+		err = errors.New("short server hello extensions")
+		return
+	}
+	for offset += 2; offset+4 <= end; {
+		extensions[binary.BigEndian.Uint16(body[offset:])] = true
+		offset += 4 + int(binary.BigEndian.Uint16(body[offset+2:]))
+	}
+
+	return
+}
+
+// probeSession check if the server resumes sessions and supports secure
+// renegotiation (RFC 5746). Certificates are not verified as only the session
+// behaviour matters.
+func (options *Options) probeSession(ctx context.Context, host, address, port, protocol string) *Session {
+	session := new(Session)
+
+	// Resume using a ticket from a first handshake
+	config := options.tlsConfig(host)
+	config.InsecureSkipVerify = true
+	config.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	for i := 0; i < 2; i++ {
+		conn, err := options.dialTLS(ctx, address, port, protocol, config)
+		if err != nil {
+			break
+		}
+		if i == 1 && conn.ConnectionState().DidResume {
+			session.Resumption = true
+			session.ResumedTLSVersion = tlsVersionName(conn.ConnectionState().Version)
+		}
+		// TLS 1.3 tickets arrive after the handshake and are handled on read
+		wait := sessionTicketWait
+		if options.Timeout < wait {
+			wait = options.Timeout
+		}
+		conn.SetReadDeadline(time.Now().Add(wait))
+		conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	// Renegotiation is not part of TLS 1.3 so check a TLS 1.2 server hello
+	config = options.tlsConfig(host)
+	config.InsecureSkipVerify = true
+	config.MinVersion = tls.VersionTLS10
+	config.MaxVersion = tls.VersionTLS12
+	rawConn, err := options.dialConn(ctx, address, port, protocol)
+	if err != nil {
+		return session
+	}
+	recorded := &recordingConn{Conn: rawConn}
+	conn, err := handshake(ctx, recorded, config)
+	if err != nil {
+		return session
+	}
+	conn.Close()
+	extensions, err := serverHelloExtensions(recorded.read.Bytes())
+	if err == nil {
+		session.SecureRenegotiation = extensions[extensionRenegotiation]
+	}
+
+	return session
+}
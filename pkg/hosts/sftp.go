@@ -0,0 +1,139 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sftpCommand client used to fetch remote cert files. It runs in batch mode,
+// so authentication must not prompt, as with keys in an agent.
+var sftpCommand = "sftp"
+
+// parseSSHTarget split a target such as user@host:/etc/ssl/certs/*.pem into
+// the remote to connect to and the path pattern on it. A remote starting with
+// - would be taken as an sftp option, and a line break would end the batch
+// command, so both are refused.
+func parseSSHTarget(target string) (remote, pattern string, err error) {
+	remote, pattern, found := strings.Cut(target, ":")
+	if !found || remote == "" || pattern == "" {
+		return "", "", fmt.Errorf("ssh target %q is not in the form [user@]host:path", target)
+	}
+	if strings.HasPrefix(remote, "-") {
+		return "", "", fmt.Errorf("ssh target %q starts with -", target)
+	}
+	if strings.ContainsAny(target, "\r\n") {
+		return "", "", fmt.Errorf("ssh target %q has a line break", target)
+	}
+
+	return
+}
+
+// sftpQuote quote an argument to an sftp batch command. Quoted paths are
+// taken as they are rather than expanded as globs by sftp.
+func sftpQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// sftpGlob escape a path pattern for an sftp batch command, leaving its glob
+// characters for sftp to expand. Spaces, quotes, backslashes and # would
+// otherwise split the argument, quote it or start a comment.
+func sftpGlob(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `'`, `\'`, `#`, `\#`, " ", `\ `, "\t", "\\\t").Replace(pattern)
+}
+
+// parseListing get the cert file paths from the output of sftp ls -1, which
+// echoes each batch command before its output
+func parseListing(output []byte) (paths []string) {
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "sftp>") || !isCertPath(line) {
+			continue
+		}
+		paths = append(paths, line)
+	}
+
+	return
+}
+
+// runSFTP run batch commands against a remote and return their output
+func (options *Options) runSFTP(ctx context.Context, remote string, commands ...string) (output []byte, err error) {
+	connectTimeout := "ConnectTimeout=" + strconv.Itoa(int(options.Timeout.Seconds()))
+	cmd := exec.CommandContext(ctx, sftpCommand, "-q", "-o", connectTimeout, "-b", "-", "--", remote)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	output, err = cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return output, fmt.Errorf("sftp %s: %s", remote, message)
+		}
+		return output, fmt.Errorf("sftp %s: %w", remote, err)
+	}
+
+	return
+}
+
+// ProcessSSHTarget check the .pem, .crt and .cer files matching a path pattern
+// on a remote server, as in user@host:/etc/ssl/certs/*.pem. Files are listed
+// and fetched over SFTP with the system sftp client, so its ssh config and
+// keys apply. Each result has File set to the remote and path it came from.
+// Errors are returned only if the files can't be listed.
+func (hostSet *HostSet) ProcessSSHTarget(target string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	remote, pattern, err := parseSSHTarget(target)
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	output, err := options.runSFTP(ctx, remote, "ls -1 -- "+sftpGlob(pattern))
+	if err != nil {
+		return
+	}
+	paths := parseListing(output)
+
+	dir, err := os.MkdirTemp("", "certcheck-sftp-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	// Fetch each file to a numbered local file, as names may repeat across
+	// remote directories. A leading - keeps going past a file that fails.
+	commands := make([]string, 0, len(paths))
+	for i, path := range paths {
+		local := filepath.Join(dir, strconv.Itoa(i))
+		commands = append(commands, "-get -- "+sftpQuote(path)+" "+sftpQuote(local))
+	}
+	if len(commands) > 0 {
+		if _, err = options.runSFTP(ctx, remote, commands...); err != nil {
+			return
+		}
+	}
+
+	certDataSet = NewCertDataSet()
+	for i, path := range paths {
+		var contents []byte
+		file, openErr := os.Open(filepath.Join(dir, strconv.Itoa(i)))
+		if errors.Is(openErr, fs.ErrNotExist) {
+			openErr = fmt.Errorf("could not fetch %s", path)
+		}
+		if openErr == nil {
+			contents, openErr = readLimited(file, options.MaxCertSize)
+			file.Close()
+		}
+		certDataSet.CertData = append(certDataSet.CertData, hostSet.certFileResults(remote+":"+path, contents, openErr, warnAtDays)...)
+	}
+	certDataSet.Finalize()
+
+	return
+}
@@ -0,0 +1,74 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"strings"
+	"time"
+)
+
+// Issuance sources
+const (
+	sourceACME       = "acme"              // issued through ACME by a public CA
+	sourcePublic     = "public-ca"         // issued by a public CA some other way
+	sourceInternal   = "internal-ca"       // issued by a CA that is not publicly trusted
+	sourceAppliance  = "appliance-default" // a vendor's default cert, never replaced
+	sourceSelfSigned = "self-signed"
+)
+
+// acmeMaxLifetime longest lifetime of a publicly trusted cert taken to be
+// renewed automatically, as ACME CAs issue for 90 days or less
+const acmeMaxLifetime = 90 * 24 * time.Hour
+
+// acmeIssuers text found in the issuer organization of CAs that only or
+// mostly issue through ACME
+var acmeIssuers = []string{"let's encrypt", "zerossl", "buypass go"}
+
+// applianceDefaults text found in the subject or issuer of default certs
+// generated by appliances and software, in lower case
+var applianceDefaults = []string{
+	"netscaler", "citrix", "ubnt", "ubiquiti", "fortinet", "fortigate", "sophos", "pfsense", "mikrotik", "sonicwall",
+	"palo alto", "synology", "qnap", "idrac", "vmware", "plesk", "openwrt", "ios-self-signed", "localhost.localdomain",
+	"default company ltd", "someorganization",
+}
+
+// containsAny check if s contains any of the lower case substrings
+func containsAny(s string, substrings []string) bool {
+	s = strings.ToLower(s)
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// issuanceSource guess where a leaf cert came from, given its issuer type.
+// Vendor default certs are recognised by name, whether self-signed or from a
+// vendor CA. Publicly trusted certs are taken to be from ACME if the CA is
+// known for it or the cert lasts 90 days or less. An empty source means
+// there is no guess, as for cert files not issued by an ACME CA.
+func issuanceSource(leaf *x509.Certificate, issuerType string) string {
+	names := leaf.Subject.String() + " " + leaf.Issuer.String()
+	acme := containsAny(strings.Join(leaf.Issuer.Organization, " "), acmeIssuers)
+	switch issuerType {
+	case issuerSelfSigned, issuerPrivate:
+		if containsAny(names, applianceDefaults) {
+			return sourceAppliance
+		}
+		if issuerType == issuerSelfSigned {
+			return sourceSelfSigned
+		}
+		return sourceInternal
+	case issuerPublic:
+		if acme || leaf.NotAfter.Sub(leaf.NotBefore) <= acmeMaxLifetime {
+			return sourceACME
+		}
+		return sourcePublic
+	}
+	if acme {
+		return sourceACME
+	}
+
+	return ""
+}
@@ -0,0 +1,268 @@
+package hosts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/gcon"
+	"github.com/imarsman/certcheck/v2/pkg/sshcert"
+	"golang.org/x/sync/semaphore"
+)
+
+// sshKeyscanCommand program used to fetch host certificates
+var sshKeyscanCommand = "ssh-keyscan"
+
+// defaultSSHPort port known_hosts names are for unless given as [host]:port
+const defaultSSHPort = "22"
+
+// sshCertData get cert data for an OpenSSH certificate. Host is set to its
+// principals and the CA signature is checked.
+func (options *Options) sshCertData(cert *sshcert.Cert, warnAtDays int) CertData {
+	certData := newCertData()
+	certData.Host = strings.Join(cert.Principals, ", ")
+	certData.Principals = cert.Principals
+	certData.SSHCertType = cert.TypeName()
+	certData.Subject = cert.KeyID
+	certData.Issuer = cert.Signer()
+	certData.Serial = strconv.FormatUint(cert.Serial, 10)
+	certData.Fingerprint = cert.Fingerprint()
+	certData.KeyType, certData.KeyBits = cert.KeyType, cert.KeyBits
+	certData.WeakKey = cert.KeyType == "ssh-dss" || cert.KeyType == "ssh-rsa" && cert.KeyBits < 2048
+
+	certData.SetExpiry(cert.NotBefore(), cert.NotAfter(), warnAtDays, options.now())
+
+	certData.Message = "OK"
+	if err := cert.Verify(); err != nil {
+		certData.HostError = true
+		certData.Message = "CA signature: " + err.Error()
+	}
+
+	return certData
+}
+
+// readSSHCertFile check the OpenSSH certs in a file. A file that can't be
+// read or holds no cert gives a result with HostError set.
+func (options *Options) readSSHCertFile(path string, warnAtDays int) (results []CertData) {
+	file, err := os.Open(path)
+	var certs []*sshcert.Cert
+	if err == nil {
+		defer file.Close()
+		var contents []byte
+		if contents, err = readLimited(file, options.MaxCertSize); err == nil {
+			certs, err = sshcert.Read(bytes.NewReader(contents))
+		}
+	}
+	if err != nil {
+		return []CertData{{File: path, HostError: true, Message: err.Error()}}
+	}
+	for _, cert := range certs {
+		certData := options.sshCertData(cert, warnAtDays)
+		certData.File = path
+		results = append(results, certData)
+	}
+
+	return
+}
+
+// ProcessSSHCerts check the OpenSSH host and user certificates in each file,
+// such as the -cert.pub files ssh-keygen -s writes, with SSHCertType and
+// Principals set and Host set to the principals. Each result has File set to
+// the path it came from, and failures, including a CA signature that doesn't
+// verify, are reported as HostError results.
+func (hostSet *HostSet) ProcessSSHCerts(paths []string, warnAtDays int) *CertDataSet {
+	options := hostSet.Options.withDefaults()
+	certDataSet := NewCertDataSet()
+	for _, path := range paths {
+		certDataSet.CertData = append(certDataSet.CertData, options.readSSHCertFile(path, warnAtDays)...)
+	}
+	certDataSet.Finalize()
+
+	return certDataSet
+}
+
+// knownHostTargets the hosts named in plain known_hosts lines, as host and
+// port, each once. Hashed names and patterns can't be connected to and are
+// left out, as are @cert-authority and @revoked lines.
+func knownHostTargets(knownHosts []sshcert.KnownHost) (targets [][2]string) {
+	seen := make(map[[2]string]bool)
+	for _, knownHost := range knownHosts {
+		if knownHost.Marker != "" {
+			continue
+		}
+		for _, name := range knownHost.Hosts {
+			if strings.HasPrefix(name, "|") || strings.ContainsAny(name, "*?!") {
+				continue
+			}
+			target := [2]string{name, defaultSSHPort}
+			if host, port, err := net.SplitHostPort(name); err == nil && strings.HasPrefix(name, "[") {
+				target = [2]string{host, port}
+			}
+			if !seen[target] {
+				seen[target] = true
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	return
+}
+
+// knownHostName the name of a host as written in known_hosts, with the port
+// only if it isn't 22
+func knownHostName(host, port string) string {
+	if port == defaultSSHPort {
+		return host
+	}
+
+	return "[" + host + "]:" + port
+}
+
+// runKeyscan fetch the host certificates of a host with ssh-keyscan -c.
+// connected is false if no SSH server answered.
+func (options *Options) runKeyscan(ctx context.Context, host, port string) (certs []*sshcert.Cert, connected bool, err error) {
+	cmd := exec.CommandContext(ctx, sshKeyscanCommand, "-c", "-p", port,
+		"-T", strconv.Itoa(int(options.Timeout.Seconds())), host)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, false, fmt.Errorf("ssh-keyscan: %s", message)
+		}
+		return nil, false, fmt.Errorf("ssh-keyscan: %w", err)
+	}
+
+	// The server's banner is written to stderr as a comment once connected
+	connected = strings.Contains(stderr.String(), " SSH-")
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "#") || !sshcert.IsCert(fields[1]) {
+			continue
+		}
+		cert, parseErr := sshcert.ParseLine(strings.Join(fields[1:], " "))
+		if parseErr != nil {
+			return nil, true, parseErr
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		connected = true
+	}
+
+	return
+}
+
+// checkKnownHost check that a host cert is one ssh would accept for a host
+// given what a known_hosts file trusts and revokes. The CA is only checked
+// if the file trusts any CA.
+func checkKnownHost(cert *sshcert.Cert, host, port string, knownHosts []sshcert.KnownHost) error {
+	if cert.CertType != sshcert.HostCert {
+		return fmt.Errorf("%s certificate served as a host certificate", cert.TypeName())
+	}
+	if len(cert.Principals) > 0 && !isListed(cert.Principals, host) {
+		return fmt.Errorf("certificate is for %s, not %s", strings.Join(cert.Principals, ", "), host)
+	}
+
+	name := knownHostName(host, port)
+	hasCA, trusted := false, false
+	for _, knownHost := range knownHosts {
+		switch knownHost.Marker {
+		case sshcert.MarkerRevoked:
+			if bytes.Equal(knownHost.Key, cert.SignatureKey) || bytes.Equal(knownHost.Key, cert.Key) {
+				return fmt.Errorf("key revoked at line %d of known_hosts", knownHost.Line)
+			}
+		case sshcert.MarkerCertAuthority:
+			hasCA = true
+			if bytes.Equal(knownHost.Key, cert.SignatureKey) && knownHost.Matches(name) {
+				trusted = true
+			}
+		}
+	}
+	if hasCA && !trusted {
+		return fmt.Errorf("CA %s is not trusted for %s in known_hosts", cert.Signer(), name)
+	}
+
+	return nil
+}
+
+// ProcessKnownHosts check the host certificates of the hosts named in a
+// known_hosts file, fetched with ssh-keyscan -c. Hashed names and patterns
+// can't be checked and are skipped. Each cert gives a result with Host and
+// Port set to the host it came from. It is an error if the cert isn't a host
+// cert for the host, if its key or CA is revoked, or if the file trusts CAs
+// with @cert-authority lines but not the one that signed it. A host that
+// serves no certificate is reported without an error, as plain host keys are
+// still common. Up to Options.Concurrency hosts are checked at once. Errors
+// are returned only for a file that can't be read.
+func (hostSet *HostSet) ProcessKnownHosts(path string, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	knownHosts, err := sshcert.ReadKnownHosts(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	sem := semaphore.NewWeighted(int64(options.Concurrency))
+	checkHost := func(ctx context.Context, target [2]string) ([]CertData, error) {
+		host, port := target[0], target[1]
+		result := func(certData CertData) CertData {
+			certData.Host, certData.Port, certData.File = host, port, path
+			return certData
+		}
+		if err := sem.Acquire(ctx, 1); err != nil {
+			return []CertData{result(CertData{})}, err
+		}
+		defer sem.Release(1)
+
+		certs, connected, err := options.runKeyscan(ctx, host, port)
+		switch {
+		case err != nil:
+			return []CertData{result(CertData{})}, err
+		case !connected:
+			return []CertData{result(CertData{})}, fmt.Errorf("no SSH server answered on %s", net.JoinHostPort(host, port))
+		case len(certs) == 0:
+			certData := newCertData()
+			certData.Message = "no host certificate"
+			return []CertData{result(certData)}, nil
+		}
+		var results []CertData
+		for _, cert := range certs {
+			certData := options.sshCertData(cert, warnAtDays)
+			if err := checkKnownHost(cert, host, port, knownHosts); err != nil && !certData.HostError {
+				certData.HostError = true
+				certData.Message = err.Error()
+			}
+			results = append(results, result(certData))
+		}
+		return results, nil
+	}
+
+	promiseSet := gcon.NewPromiseSet[[]CertData]()
+	for _, target := range knownHostTargets(knownHosts) {
+		promiseSet.Add(gcon.Run(context.Background(), target, checkHost))
+	}
+	promiseSet.Wait()
+
+	certDataSet = NewCertDataSet()
+	for _, promise := range promiseSet.Promises {
+		results, err := promise.Get()
+		if err != nil {
+			results[0].HostError = true
+			results[0].Message = err.Error()
+		}
+		certDataSet.CertData = append(certDataSet.CertData, results...)
+	}
+	certDataSet.Finalize()
+
+	return certDataSet, nil
+}
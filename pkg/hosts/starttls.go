@@ -0,0 +1,312 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// Protocols that TLS can be negotiated with
+const (
+	ProtocolTLS      = "tls" // implicit TLS from the first byte
+	ProtocolSMTP     = "smtp"
+	ProtocolPOP3     = "pop3"
+	ProtocolIMAP     = "imap"
+	ProtocolFTP      = "ftp"
+	ProtocolLDAP     = "ldap"
+	ProtocolPostgres = "postgres"
+	ProtocolGRPC     = "grpc" // implicit TLS with ALPN h2
+)
+
+// Protocols list of protocols that can be requested
+var Protocols = []string{
+	ProtocolTLS,
+	ProtocolSMTP,
+	ProtocolPOP3,
+	ProtocolIMAP,
+	ProtocolFTP,
+	ProtocolLDAP,
+	ProtocolPostgres,
+	ProtocolGRPC,
+}
+
+// wellKnownPorts ports that use STARTTLS style negotiation. Any port not in
+// this list is treated as implicit TLS.
+var wellKnownPorts = map[string]string{
+	"21":   ProtocolFTP,
+	"25":   ProtocolSMTP,
+	"110":  ProtocolPOP3,
+	"143":  ProtocolIMAP,
+	"389":  ProtocolLDAP,
+	"587":  ProtocolSMTP,
+	"2525": ProtocolSMTP,
+	"5432": ProtocolPostgres,
+}
+
+// ldapStartTLS a BER encoded LDAP extended request for StartTLS with message ID 1
+var ldapStartTLS = append([]byte{
+	0x30, 0x1d, // LDAPMessage sequence
+	0x02, 0x01, 0x01, // messageID 1
+	0x77, 0x18, // extendedReq
+	0x80, 0x16, // requestName
+}, []byte("1.3.6.1.4.1.1466.20037")...)
+
+// postgresSSLRequest the 8 byte SSLRequest message
+var postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+// protocolForPort get the protocol to use for a port, with a requested protocol
+// overriding detection
+func protocolForPort(port, requested string) (protocol string, err error) {
+	if requested != "" && requested != "auto" {
+		for _, p := range Protocols {
+			if requested == p {
+				protocol = p
+				return
+			}
+		}
+		err = fmt.Errorf("unknown protocol %s", requested)
+		return
+	}
+	protocol, found := wellKnownPorts[port]
+	if !found {
+		protocol = ProtocolTLS
+	}
+
+	return
+}
+
+// readReply read a possibly multi-line numeric reply as used by SMTP and FTP
+// and check the code. Continuation lines have a dash after the code.
+func readReply(reader *bufio.Reader, code string) (err error) {
+	for {
+		var line string
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if !strings.HasPrefix(line, code) {
+			err = fmt.Errorf("unexpected reply %q", strings.TrimSpace(line))
+			return
+		}
+		if len(line) > len(code) && line[len(code)] == '-' {
+			continue
+		}
+		return
+	}
+}
+
+// readLine read a single line and check the prefix
+func readLine(reader *bufio.Reader, prefix string) (err error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return
+	}
+	if !strings.HasPrefix(line, prefix) {
+		err = fmt.Errorf("unexpected reply %q", strings.TrimSpace(line))
+	}
+
+	return
+}
+
+// readTagged read lines until the tagged IMAP response is found
+func readTagged(reader *bufio.Reader, tag string) (err error) {
+	for {
+		var line string
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.HasPrefix(line, tag+" ") {
+			if !strings.HasPrefix(line, tag+" OK") {
+				err = fmt.Errorf("unexpected reply %q", strings.TrimSpace(line))
+			}
+			return
+		}
+	}
+}
+
+// berLength read a BER length
+func berLength(reader io.ByteReader) (length int, err error) {
+	b, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+	if b&0x80 == 0 {
+		length = int(b)
+		return
+	}
+	for i := 0; i < int(b&0x7f); i++ {
+		var next byte
+		next, err = reader.ReadByte()
+		if err != nil {
+			return
+		}
+		length = length<<8 | int(next)
+	}
+
+	return
+}
+
+// readLDAPResult read an LDAP extended response and check the result code
+func readLDAPResult(reader *bufio.Reader) (err error) {
+	// LDAPMessage sequence
+	tag, err := reader.ReadByte()
+	if err != nil {
+		return
+	}
+	if tag != 0x30 {
+		return errors.New("invalid LDAP response")
+	}
+	if _, err = berLength(reader); err != nil {
+		return
+	}
+	// messageID
+	if tag, err = reader.ReadByte(); err != nil || tag != 0x02 {
+		return errors.New("invalid LDAP response")
+	}
+	length, err := berLength(reader)
+	if err != nil {
+		return
+	}
+	if _, err = reader.Discard(length); err != nil {
+		return
+	}
+	// extendedResp
+	if tag, err = reader.ReadByte(); err != nil || tag != 0x78 {
+		return errors.New("invalid LDAP response")
+	}
+	if _, err = berLength(reader); err != nil {
+		return
+	}
+	// resultCode enumerated
+	if tag, err = reader.ReadByte(); err != nil || tag != 0x0a {
+		return errors.New("invalid LDAP response")
+	}
+	if length, err = berLength(reader); err != nil {
+		return
+	}
+	result := make([]byte, length)
+	if _, err = io.ReadFull(reader, result); err != nil {
+		return
+	}
+	if !bytes.Equal(result, []byte{0x00}) {
+		err = fmt.Errorf("LDAP StartTLS refused with result code %v", result)
+	}
+
+	return
+}
+
+// startTLS run the plain text negotiation that precedes the TLS handshake for
+// protocols using STARTTLS
+func startTLS(conn net.Conn, protocol string) (err error) {
+	reader := bufio.NewReader(conn)
+
+	switch protocol {
+	case ProtocolSMTP:
+		if err = readReply(reader, "220"); err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, "EHLO certcheck\r\n"); err != nil {
+			return
+		}
+		if err = readReply(reader, "250"); err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+			return
+		}
+		err = readReply(reader, "220")
+	case ProtocolPOP3:
+		if err = readLine(reader, "+OK"); err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, "STLS\r\n"); err != nil {
+			return
+		}
+		err = readLine(reader, "+OK")
+	case ProtocolIMAP:
+		if err = readLine(reader, "* OK"); err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+			return
+		}
+		err = readTagged(reader, "a001")
+	case ProtocolFTP:
+		if err = readReply(reader, "220"); err != nil {
+			return
+		}
+		if _, err = io.WriteString(conn, "AUTH TLS\r\n"); err != nil {
+			return
+		}
+		err = readReply(reader, "234")
+	case ProtocolLDAP:
+		if _, err = conn.Write(ldapStartTLS); err != nil {
+			return
+		}
+		err = readLDAPResult(reader)
+	case ProtocolPostgres:
+		if _, err = conn.Write(postgresSSLRequest); err != nil {
+			return
+		}
+		var b byte
+		if b, err = reader.ReadByte(); err != nil {
+			return
+		}
+		if b != 'S' {
+			err = errors.New("postgres server does not support SSL")
+		}
+	}
+
+	return
+}
+
+// dialConn connect to an address and negotiate TLS using the protocol. The
+// connection deadline is set for the handshake that follows.
+func (options *Options) dialConn(ctx context.Context, address, port, protocol string) (rawConn net.Conn, err error) {
+	rawConn, err = options.dial(ctx, address, port)
+	if err != nil {
+		return
+	}
+	rawConn.SetDeadline(time.Now().Add(options.Timeout))
+
+	err = startTLS(rawConn, protocol)
+	if err != nil {
+		rawConn.Close()
+		return
+	}
+
+	return
+}
+
+// dialTLS connect to an address, negotiate TLS using the protocol and complete
+// the handshake using the config
+func (options *Options) dialTLS(ctx context.Context, address, port, protocol string, config *tls.Config) (conn *tls.Conn, err error) {
+	rawConn, err := options.dialConn(ctx, address, port, protocol)
+	if err != nil {
+		return
+	}
+
+	return handshake(ctx, rawConn, config)
+}
+
+// handshake complete a client handshake over a connection, closing it on
+// failure
+func handshake(ctx context.Context, rawConn net.Conn, config *tls.Config) (conn *tls.Conn, err error) {
+	conn = tls.Client(rawConn, config)
+	err = conn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return
+}
@@ -0,0 +1,53 @@
+package hosts
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/ocsp"
+)
+
+// anomalies list everything short of a clean result for a host, for strict
+// mode. Checks that were not run, such as probing TLS versions, add nothing.
+// A cert without an OCSP responder is not an anomaly, as CAs are dropping
+// OCSP, but a responder that cannot be reached is.
+func anomalies(certData CertData) (found []string) {
+	if certData.VerifyError != "" {
+		found = append(found, "verification failed: "+certData.VerifyError)
+	}
+	if certData.ExpiryWarning {
+		found = append(found, fmt.Sprintf("expires in %d days", certData.DaysToExpiry))
+	}
+	if certData.ChainStatus != "" && certData.ChainStatus != chainComplete {
+		found = append(found, "chain "+certData.ChainStatus)
+	}
+	if len(certData.EarlyExpiry) > 0 {
+		found = append(found, "intermediates expire before the leaf: "+strings.Join(certData.EarlyExpiry, ", "))
+	}
+	if len(certData.WeakSignature) > 0 {
+		found = append(found, "weak signatures: "+strings.Join(certData.WeakSignature, ", "))
+	}
+	if certData.WeakKey {
+		found = append(found, fmt.Sprintf("weak %s key of %d bits", certData.KeyType, certData.KeyBits))
+	}
+	if certData.HostnameMatch == matchCN || certData.HostnameMatch == matchNone {
+		found = append(found, "host name not in the SANs")
+	}
+	if len(certData.UsageProblems) > 0 {
+		found = append(found, "key usage: "+strings.Join(certData.UsageProblems, ", "))
+	}
+	if certData.OCSPResponder != "" && certData.OCSPResponder != ocsp.Good && certData.OCSPResponder != ocspNone {
+		found = append(found, "OCSP responder "+certData.OCSPResponder)
+	}
+	if certData.CRLStatus == crlRevoked || certData.CRLStatus == crlUnavailable {
+		found = append(found, "CRL "+certData.CRLStatus)
+	}
+	if certData.DeprecatedTLS {
+		found = append(found, "deprecated TLS versions accepted")
+	}
+	if len(certData.WeakCiphers) > 0 {
+		found = append(found, "weak ciphers accepted")
+	}
+
+	return
+}
@@ -0,0 +1,83 @@
+package hosts
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// tlsVersions versions that can be requested or probed in ascending order
+var tlsVersions = []uint16{
+	tls.VersionTLS10,
+	tls.VersionTLS11,
+	tls.VersionTLS12,
+	tls.VersionTLS13,
+}
+
+// TLSVersionNames names of versions that can be requested
+var TLSVersionNames = []string{"1.0", "1.1", "1.2", "1.3"}
+
+// ParseTLSVersion get the TLS version for a name such as 1.2 or TLS1.2
+func ParseTLSVersion(name string) (version uint16, err error) {
+	name = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(name)), "tls")
+	name = strings.TrimPrefix(name, "v")
+	for i, versionName := range TLSVersionNames {
+		if name == versionName {
+			version = tlsVersions[i]
+			return
+		}
+	}
+	err = fmt.Errorf("unknown TLS version %s", name)
+
+	return
+}
+
+// tlsVersionName get the display name for a TLS version
+func tlsVersionName(version uint16) string {
+	for i, v := range tlsVersions {
+		if v == version {
+			return TLSVersionNames[i]
+		}
+	}
+
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// deprecatedTLS check if a version is deprecated by RFC 8996
+func deprecatedTLS(version uint16) bool {
+	return version < tls.VersionTLS12
+}
+
+// tlsConfig make the TLS config used to check a host
+func (options *Options) tlsConfig(host string) *tls.Config {
+	config := &tls.Config{
+		ServerName: host,
+		RootCAs:    options.Roots,
+		MinVersion: options.MinTLS,
+		MaxVersion: options.MaxTLS,
+	}
+
+	return config
+}
+
+// probeTLSVersions try a handshake with each TLS version on its own and return
+// the versions the server accepts. Certificates are not verified as only the
+// protocol version matters.
+func (options *Options) probeTLSVersions(ctx context.Context, host, address, port, protocol string) (accepted []string) {
+	for _, version := range tlsVersions {
+		config := options.tlsConfig(host)
+		config.MinVersion = version
+		config.MaxVersion = version
+		config.InsecureSkipVerify = true
+
+		conn, err := options.dialTLS(ctx, address, port, protocol, config)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		accepted = append(accepted, tlsVersionName(version))
+	}
+
+	return
+}
@@ -0,0 +1,51 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/imarsman/certcheck/v2/pkg/trust"
+)
+
+// ProcessTrustStore check the roots in a trust store: a JVM cacerts file or
+// other Java keystore opened with Options.Password, a PKCS#12 file, or a PEM
+// bundle. If path is empty the bundle of the operating system is read. Only
+// the roots expiring within warnAtDays are kept, or every one if all is set,
+// so trust store updates can be planned. Each result has File set to the
+// trust store and Alias set to its keystore entry. Errors are returned only
+// if the trust store can't be read.
+func (hostSet *HostSet) ProcessTrustStore(path string, all bool, warnAtDays int) (certDataSet *CertDataSet, err error) {
+	options := hostSet.Options.withDefaults()
+	if path == "" {
+		if path, err = trust.SystemFile(); err != nil {
+			return
+		}
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	contents, err := readLimited(file, options.MaxCertSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	results, err := options.certFileData(contents, warnAtDays)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	certDataSet = NewCertDataSet()
+	for _, certData := range results {
+		if all || certData.ExpiryWarning {
+			certData.File = path
+			if certData.Message == "" {
+				certData.Message = "OK"
+			}
+			certDataSet.CertData = append(certDataSet.CertData, certData)
+		}
+	}
+	certDataSet.Finalize()
+
+	return
+}
@@ -0,0 +1,111 @@
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ReadURLHosts read the hosts of the URLs in a sitemap, sitemap index or file
+// of URLs one per line with # comments, each once in the order first seen.
+// Gzipped sitemaps are read as they are. Hosts are given as host:port if the
+// URL has a port other than the default of its scheme. http URLs give the
+// host on the HTTPS port, as it is the site's certificate being checked, and
+// lines without a scheme are taken to be https URLs.
+func ReadURLHosts(reader io.Reader) (hostList []string, err error) {
+	buffered := bufio.NewReader(reader)
+	if magic, _ := buffered.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		buffered = bufio.NewReader(gz)
+	}
+	contents, err := io.ReadAll(buffered)
+	if err != nil {
+		return
+	}
+
+	var urls []string
+	if bytes.HasPrefix(bytes.TrimSpace(contents), []byte("<")) {
+		if urls, err = sitemapLocations(contents); err != nil {
+			return nil, fmt.Errorf("invalid sitemap: %v", err)
+		}
+	} else {
+		for _, line := range strings.Split(string(contents), "\n") {
+			line, _, _ = strings.Cut(line, "#")
+			urls = append(urls, strings.Fields(line)...)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, rawURL := range urls {
+		if !strings.Contains(rawURL, "://") {
+			rawURL = "https://" + rawURL
+		}
+		if u, parseErr := url.Parse(rawURL); parseErr == nil && strings.EqualFold(u.Scheme, "http") {
+			// The port is for plain HTTP, so the site is checked on the HTTPS port
+			u.Scheme, u.Host = "https", u.Hostname()
+			if strings.Contains(u.Host, ":") {
+				u.Host = "[" + u.Host + "]"
+			}
+			rawURL = u.String()
+		}
+		host, port, urlErr := urlHostAndPort(rawURL)
+		if urlErr != nil {
+			return nil, urlErr
+		}
+		item := strings.ToLower(host)
+		if port != tlsDefaultPort {
+			item = net.JoinHostPort(item, port)
+		}
+		if !seen[item] {
+			seen[item] = true
+			hostList = append(hostList, item)
+		}
+	}
+
+	return
+}
+
+// sitemapLocations the text of every loc element in a sitemap or sitemap
+// index, whatever namespace it is in
+func sitemapLocations(contents []byte) (locations []string, err error) {
+	decoder := xml.NewDecoder(bytes.NewReader(contents))
+	inLoc := false
+	var loc strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return locations, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "loc" {
+				inLoc = true
+				loc.Reset()
+			}
+		case xml.CharData:
+			if inLoc {
+				loc.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Local == "loc" && inLoc {
+				inLoc = false
+				if location := strings.TrimSpace(loc.String()); location != "" {
+					locations = append(locations, location)
+				}
+			}
+		}
+	}
+}
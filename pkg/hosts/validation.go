@@ -0,0 +1,52 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+)
+
+// Validation levels of certs
+const (
+	validationDV = "DV" // domain validated
+	validationOV = "OV" // organization validated
+	validationIV = "IV" // individual validated
+	validationEV = "EV" // extended validation
+)
+
+// CA/Browser Forum certificate policy OIDs for each validation level
+var validationPolicies = []struct {
+	oid        asn1.ObjectIdentifier
+	validation string
+}{
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 1}, validationEV},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 2}, validationOV},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 3}, validationIV},
+	{asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}, validationDV},
+}
+
+// oidJurisdictionCountry subject attribute only found in EV certs
+var oidJurisdictionCountry = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 60, 2, 1, 3}
+
+// validationLevel classify a leaf as DV, OV, IV or EV by the CA/Browser Forum
+// policy it asserts. Certs from CAs that only use their own policy OIDs are
+// classified by their subject instead, EV if it has a jurisdiction of
+// incorporation, OV if it names an organization and DV otherwise.
+func validationLevel(cert *x509.Certificate) string {
+	for _, policy := range validationPolicies {
+		for _, oid := range cert.PolicyIdentifiers {
+			if oid.Equal(policy.oid) {
+				return policy.validation
+			}
+		}
+	}
+	for _, name := range cert.Subject.Names {
+		if name.Type.Equal(oidJurisdictionCountry) {
+			return validationEV
+		}
+	}
+	if len(cert.Subject.Organization) > 0 {
+		return validationOV
+	}
+
+	return validationDV
+}
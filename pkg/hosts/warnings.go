@@ -0,0 +1,37 @@
+package hosts
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+// servedWarnings warn of certs after the leaf that have expired. Clients that
+// build their own path past them still connect, but others fail.
+func servedWarnings(certs []*x509.Certificate, now time.Time) (warnings []string) {
+	for i := 1; i < len(certs); i++ {
+		if now.After(certs[i].NotAfter) {
+			warnings = append(warnings, fmt.Sprintf("sends expired certificate %s, expired %s",
+				certs[i].Subject.String(), certs[i].NotAfter.Format(timeFormat)))
+		}
+	}
+
+	return
+}
+
+// checkWarnings warn of checks that could not be completed, which leave the
+// result as it would be without them rather than failing it
+func checkWarnings(certData CertData) (warnings []string) {
+	switch certData.OCSPResponder {
+	case ocspUnreachable, ocspInvalid:
+		warnings = append(warnings, "OCSP responder "+certData.OCSPResponder)
+	}
+	if certData.CRLStatus == crlUnavailable {
+		warnings = append(warnings, "CRL unavailable")
+	}
+	if certData.HTTP != nil && certData.HTTP.Message != "" {
+		warnings = append(warnings, "HTTP probe failed: "+certData.HTTP.Message)
+	}
+
+	return
+}
@@ -0,0 +1,166 @@
+// Package image reads files from container images. Images are read from a
+// local tar written by docker save or holding an OCI image layout, or pulled
+// from a registry. Layers are applied in order, with whiteouts, so only files
+// present in the final filesystem are returned.
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// Limits on what is read into memory
+const (
+	maxFileSize     = 1 << 20 // largest file returned from an image
+	maxManifestSize = 4 << 20 // largest manifest or index read
+	maxIndexDepth   = 4       // most indexes followed to reach an image manifest
+)
+
+// Prefixes of whiteout entries, which remove files in lower layers
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// DefaultPlatform platform chosen from multi-platform images
+var DefaultPlatform = "linux/" + runtime.GOARCH
+
+// platform os and architecture of an image in an index
+type platform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+}
+
+// descriptor reference to a manifest or layer by digest
+type descriptor struct {
+	MediaType string    `json:"mediaType"`
+	Digest    string    `json:"digest"`
+	Platform  *platform `json:"platform,omitempty"`
+}
+
+// manifest an image manifest, or an index of manifests for each platform.
+// Docker manifest lists use the same fields as OCI indexes.
+type manifest struct {
+	MediaType string       `json:"mediaType"`
+	Manifests []descriptor `json:"manifests"`
+	Layers    []descriptor `json:"layers"`
+}
+
+// selectManifest choose the manifest for a platform such as linux/amd64 from
+// an index
+func selectManifest(manifests []descriptor, want string) (selected descriptor, err error) {
+	for _, candidate := range manifests {
+		if candidate.Platform == nil {
+			continue
+		}
+		if candidate.Platform.OS+"/"+candidate.Platform.Architecture == want {
+			return candidate, nil
+		}
+	}
+	// An index without platforms, as in a local OCI layout, holds one image
+	if len(manifests) == 1 && manifests[0].Platform == nil {
+		return manifests[0], nil
+	}
+
+	return selected, fmt.Errorf("no %s image in index", want)
+}
+
+// layer matching files in one layer and what it removes from layers below
+type layer struct {
+	files   map[string][]byte
+	deleted []string // files and directories removed by whiteouts or replaced
+	opaque  []string // directories whose earlier contents are hidden
+}
+
+// readLayer read the matching files and whiteouts from a layer tar, which may
+// be gzipped
+func readLayer(reader io.Reader, match func(string) bool) (result layer, err error) {
+	buffered := bufio.NewReader(reader)
+	magic, _ := buffered.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gzipReader, gzipErr := gzip.NewReader(buffered)
+		if gzipErr != nil {
+			return result, gzipErr
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return result, errors.New("zstd compressed layers are not supported")
+	default:
+		reader = buffered
+	}
+
+	result.files = make(map[string][]byte)
+	tarReader := tar.NewReader(reader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			return
+		}
+		if nextErr != nil {
+			return result, nextErr
+		}
+		name := path.Clean("/" + header.Name)
+		dir, base := path.Split(name)
+		switch {
+		case base == whiteoutOpaque:
+			result.opaque = append(result.opaque, path.Clean(dir))
+		case strings.HasPrefix(base, whiteoutPrefix):
+			result.deleted = append(result.deleted, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		case !match(name):
+		case header.Typeflag != tar.TypeReg:
+			// A link or directory replaces a matching file below it
+			result.deleted = append(result.deleted, name)
+		default:
+			contents, readErr := io.ReadAll(io.LimitReader(tarReader, maxFileSize))
+			if readErr != nil {
+				return result, readErr
+			}
+			result.files[name] = contents
+		}
+	}
+}
+
+// under check if a path is a directory or within it
+func under(name, dir string) bool {
+	return name == dir || dir == "/" || strings.HasPrefix(name, dir+"/")
+}
+
+// apply add a layer on top of the files from the layers below it
+func apply(files map[string][]byte, upper layer) {
+	for name := range files {
+		for _, dir := range upper.opaque {
+			if name != dir && under(name, dir) {
+				delete(files, name)
+			}
+		}
+		for _, deleted := range upper.deleted {
+			if under(name, deleted) {
+				delete(files, name)
+			}
+		}
+	}
+	for name, contents := range upper.files {
+		files[name] = contents
+	}
+}
+
+// readJSON decode a manifest or index, limiting its size
+func readJSON(reader io.Reader, v any) error {
+	contents, err := io.ReadAll(io.LimitReader(reader, maxManifestSize))
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(contents, v)
+}
@@ -0,0 +1,228 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/matryer/is"
+)
+
+// isPEM match files with a .pem extension
+func isPEM(name string) bool {
+	return strings.HasSuffix(name, ".pem")
+}
+
+// makeTar make a tar holding files by name, gzipped if asked
+func makeTar(t *testing.T, files map[string]string, gzipped bool) []byte {
+	var buffer bytes.Buffer
+	tarWriter := tar.NewWriter(&buffer)
+	for name, contents := range files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(contents))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tarWriter.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !gzipped {
+		return buffer.Bytes()
+	}
+
+	var compressed bytes.Buffer
+	gzipWriter := gzip.NewWriter(&compressed)
+	gzipWriter.Write(buffer.Bytes())
+	gzipWriter.Close()
+
+	return compressed.Bytes()
+}
+
+// digestOf get the sha256 digest of a blob
+func digestOf(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// testLayers two layers, the second removing some files of the first
+func testLayers(t *testing.T) [][]byte {
+	lower := makeTar(t, map[string]string{
+		"etc/ssl/a.pem":  "a",
+		"etc/ssl/b.pem":  "b",
+		"etc/old/c.pem":  "c",
+		"etc/old/README": "readme",
+	}, false)
+	upper := makeTar(t, map[string]string{
+		"etc/ssl/.wh.b.pem":        "",
+		"etc/old/.wh..wh..opq":     "",
+		"etc/ssl/d.pem":            "d",
+		"usr/share/ca/bundle.pem":  "bundle",
+		"usr/share/ca/bundle.json": "{}",
+	}, true)
+
+	return [][]byte{lower, upper}
+}
+
+// checkFiles check the files left after applying the test layers
+func checkFiles(is *is.I, files map[string][]byte) {
+	is.Equal(len(files), 3)
+	is.Equal(string(files["/etc/ssl/a.pem"]), "a")
+	is.Equal(string(files["/etc/ssl/d.pem"]), "d")
+	is.Equal(string(files["/usr/share/ca/bundle.pem"]), "bundle")
+}
+
+func TestParseReference(t *testing.T) {
+	is := is.New(t)
+
+	tests := []struct {
+		ref        string
+		registry   string
+		repository string
+		tag        string
+	}{
+		{"nginx", dockerHubRegistry, "library/nginx", "latest"},
+		{"nginx:1.27", dockerHubRegistry, "library/nginx", "1.27"},
+		{"docker.io/bitnami/redis:7", dockerHubRegistry, "bitnami/redis", "7"},
+		{"ghcr.io/org/app@sha256:abc", "ghcr.io", "org/app", "sha256:abc"},
+		{"localhost:5000/app", "localhost:5000", "app", "latest"},
+		{"registry.example.com:5000/team/app:v2", "registry.example.com:5000", "team/app", "v2"},
+	}
+	for _, test := range tests {
+		ref, err := parseReference(test.ref)
+		is.NoErr(err)
+		is.Equal(ref.registry, test.registry)
+		is.Equal(ref.repository, test.repository)
+		is.Equal(ref.tag, test.tag)
+	}
+
+	_, err := parseReference("nginx:")
+	is.True(err != nil)
+}
+
+func TestLocalFiles(t *testing.T) {
+	is := is.New(t)
+	dir := t.TempDir()
+	layers := testLayers(t)
+
+	// docker save writes a manifest.json listing layer files
+	manifestJSON, _ := json.Marshal([]dockerManifest{{RepoTags: []string{"test:latest"}, Layers: []string{"1/layer.tar", "2/layer.tar"}}})
+	saved := filepath.Join(dir, "saved.tar")
+	err := os.WriteFile(saved, makeTar(t, map[string]string{
+		"manifest.json": string(manifestJSON),
+		"1/layer.tar":   string(layers[0]),
+		"2/layer.tar":   string(layers[1]),
+	}, false), 0o644)
+	is.NoErr(err)
+
+	client := NewClient(0)
+	files, err := client.Files(context.Background(), saved, isPEM)
+	is.NoErr(err)
+	checkFiles(is, files)
+
+	// An OCI layout has an index.json leading to blobs by digest
+	image := manifest{Layers: []descriptor{{Digest: digestOf(layers[0])}, {Digest: digestOf(layers[1])}}}
+	imageJSON, _ := json.Marshal(image)
+	indexJSON, _ := json.Marshal(manifest{Manifests: []descriptor{{Digest: digestOf(imageJSON)}}})
+	layout := filepath.Join(dir, "layout.tar")
+	err = os.WriteFile(layout, makeTar(t, map[string]string{
+		"oci-layout":                  `{"imageLayoutVersion": "1.0.0"}`,
+		"index.json":                  string(indexJSON),
+		blobPath(digestOf(imageJSON)): string(imageJSON),
+		blobPath(digestOf(layers[0])): string(layers[0]),
+		blobPath(digestOf(layers[1])): string(layers[1]),
+	}, false), 0o644)
+	is.NoErr(err)
+
+	files, err = client.Files(context.Background(), layout, isPEM)
+	is.NoErr(err)
+	checkFiles(is, files)
+
+	// A tar that is not an image
+	other := filepath.Join(dir, "other.tar")
+	err = os.WriteFile(other, layers[0], 0o644)
+	is.NoErr(err)
+	_, err = client.Files(context.Background(), other, isPEM)
+	is.True(err != nil)
+}
+
+func TestPull(t *testing.T) {
+	is := is.New(t)
+	layers := testLayers(t)
+
+	image := manifest{Layers: []descriptor{{Digest: digestOf(layers[0])}, {Digest: digestOf(layers[1])}}}
+	imageJSON, _ := json.Marshal(image)
+	indexJSON, _ := json.Marshal(manifest{Manifests: []descriptor{
+		{Digest: "sha256:other", Platform: &platform{OS: "linux", Architecture: "s390x"}},
+		{Digest: digestOf(imageJSON), Platform: &platform{OS: "linux", Architecture: "amd64"}},
+	}})
+	blobs := map[string][]byte{
+		"/v2/team/app/manifests/v1":                        indexJSON,
+		"/v2/team/app/manifests/" + digestOf(imageJSON):    imageJSON,
+		"/v2/team/app/blobs/" + digestOf(layers[0]):        layers[0],
+		"/v2/team/app/blobs/" + digestOf(layers[1]):        layers[1],
+		"/v2/team/app/blobs/sha256:0000000000000000000000": layers[0],
+	}
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate",
+				fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:team/app:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		blob, ok := blobs[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(blob)
+	}))
+	defer server.Close()
+
+	client := NewClient(0)
+	client.HTTP = server.Client()
+	client.Platform = "linux/amd64"
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	files, err := client.Files(context.Background(), registry+"/team/app:v1", isPEM)
+	is.NoErr(err)
+	checkFiles(is, files)
+
+	// No image for the platform
+	client.Platform = "windows/amd64"
+	_, err = client.Files(context.Background(), registry+"/team/app:v1", isPEM)
+	is.True(err != nil)
+
+	// Unknown tag
+	client.Platform = "linux/amd64"
+	_, err = client.Files(context.Background(), registry+"/team/app:v2", isPEM)
+	is.True(err != nil)
+
+	// A blob that doesn't match its digest
+	blobs["/v2/team/app/manifests/v3"], _ = json.Marshal(manifest{Layers: []descriptor{{Digest: "sha256:0000000000000000000000"}}})
+	_, err = client.Files(context.Background(), registry+"/team/app:v3", isPEM)
+	is.True(err != nil)
+}
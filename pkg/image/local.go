@@ -0,0 +1,160 @@
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// dockerManifest an entry in the manifest.json written by docker save
+type dockerManifest struct {
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// blobPath get the path of a blob in an OCI image layout
+func blobPath(digest string) string {
+	return path.Join("blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+// tarEntries read every small entry of a tar file into memory, by name, to
+// find the manifests describing the image
+func tarEntries(file string) (entries map[string][]byte, err error) {
+	reader, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+
+	entries = make(map[string][]byte)
+	tarReader := tar.NewReader(reader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			return
+		}
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		if header.Typeflag != tar.TypeReg || header.Size > maxManifestSize {
+			continue
+		}
+		contents, readErr := io.ReadAll(tarReader)
+		if readErr != nil {
+			return nil, readErr
+		}
+		entries[path.Clean(header.Name)] = contents
+	}
+}
+
+// localLayers get the paths in a local image tar of its layers, in order,
+// from a docker save manifest.json or an OCI layout index.json
+func localLayers(entries map[string][]byte, want string) (layers []string, err error) {
+	if contents, ok := entries["manifest.json"]; ok {
+		var manifests []dockerManifest
+		if err = readJSON(bytes.NewReader(contents), &manifests); err != nil {
+			return
+		}
+		if len(manifests) != 1 {
+			return nil, fmt.Errorf("expected one image in manifest.json, found %d", len(manifests))
+		}
+		for _, layer := range manifests[0].Layers {
+			layers = append(layers, path.Clean(layer))
+		}
+		return
+	}
+
+	contents, ok := entries["index.json"]
+	if !ok {
+		return nil, fmt.Errorf("no manifest.json or index.json found, not an image tar")
+	}
+	var current manifest
+	if err = readJSON(bytes.NewReader(contents), &current); err != nil {
+		return
+	}
+	// Follow indexes down to the image manifest
+	for depth := 0; len(current.Manifests) > 0; depth++ {
+		if depth > maxIndexDepth {
+			return nil, fmt.Errorf("image indexes nested too deeply")
+		}
+		selected, selectErr := selectManifest(current.Manifests, want)
+		if selectErr != nil {
+			return nil, selectErr
+		}
+		contents, ok = entries[blobPath(selected.Digest)]
+		if !ok {
+			return nil, fmt.Errorf("manifest %s not found", selected.Digest)
+		}
+		current = manifest{}
+		if err = readJSON(bytes.NewReader(contents), &current); err != nil {
+			return
+		}
+	}
+	for _, layer := range current.Layers {
+		layers = append(layers, blobPath(layer.Digest))
+	}
+
+	return
+}
+
+// localFiles get the matching files from an image tar written by docker save
+// or holding an OCI image layout
+func localFiles(file, want string, match func(string) bool) (files map[string][]byte, err error) {
+	entries, err := tarEntries(file)
+	if err != nil {
+		return
+	}
+	layerPaths, err := localLayers(entries, want)
+	if err != nil {
+		return
+	}
+
+	// Layers are read in tar order and applied in image order. The same
+	// layer can appear more than once.
+	order := make(map[string][]int, len(layerPaths))
+	for i, layerPath := range layerPaths {
+		order[layerPath] = append(order[layerPath], i)
+	}
+	layers := make([]*layer, len(layerPaths))
+
+	reader, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer reader.Close()
+	tarReader := tar.NewReader(reader)
+	for {
+		header, nextErr := tarReader.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nil, nextErr
+		}
+		indexes, ok := order[path.Clean(header.Name)]
+		if !ok || layers[indexes[0]] != nil {
+			continue
+		}
+		result, readErr := readLayer(tarReader, match)
+		if readErr != nil {
+			return nil, fmt.Errorf("layer %s: %w", header.Name, readErr)
+		}
+		for _, i := range indexes {
+			layers[i] = &result
+		}
+	}
+
+	files = make(map[string][]byte)
+	for i, result := range layers {
+		if result == nil {
+			return nil, fmt.Errorf("layer %s not found", layerPaths[i])
+		}
+		apply(files, *result)
+	}
+
+	return
+}
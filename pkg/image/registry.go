@@ -0,0 +1,284 @@
+package image
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Docker Hub names and the registry host serving them
+const (
+	dockerHub         = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+)
+
+// manifestTypes media types accepted for manifests and indexes
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// challengeParam a key="value" parameter of a WWW-Authenticate challenge
+var challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Client read images, pulling them from registries with anonymous access
+type Client struct {
+	HTTP     *http.Client // client used for registry requests
+	Platform string       // platform chosen from multi-platform images, DefaultPlatform if empty
+
+	token string // bearer token for the repository being pulled
+}
+
+// NewClient make a client whose registry requests time out if a connection or
+// response headers take longer than timeout. Layer downloads can take longer.
+func NewClient(timeout time.Duration) *Client {
+	client := new(Client)
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	client.HTTP = &http.Client{Transport: transport}
+
+	return client
+}
+
+// reference an image in a registry, by tag or digest
+type reference struct {
+	registry   string
+	repository string
+	tag        string // tag or digest
+}
+
+// parseReference split an image reference such as nginx:1.27 or
+// ghcr.io/org/app@sha256:... into its registry, repository and tag or digest.
+// Names without a registry are on Docker Hub.
+func parseReference(ref string) (parsed reference, err error) {
+	name, digest, isDigest := strings.Cut(ref, "@")
+	parsed.tag = "latest"
+	if isDigest {
+		parsed.tag = digest
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, parsed.tag = name[:i], name[i+1:]
+	}
+
+	parsed.registry = dockerHub
+	first, rest, found := strings.Cut(name, "/")
+	if found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		parsed.registry, name = first, rest
+	}
+	if parsed.registry == dockerHub {
+		parsed.registry = dockerHubRegistry
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	parsed.repository = name
+	if name == "" || parsed.tag == "" {
+		return parsed, fmt.Errorf("invalid image reference %q", ref)
+	}
+
+	return
+}
+
+// authorize get a bearer token for a Bearer challenge from a registry
+func (client *Client) authorize(ctx context.Context, challenge string) (err error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("unsupported registry authentication %s", scheme)
+	}
+	values := make(map[string]string)
+	for _, match := range challengeParam.FindAllStringSubmatch(params, -1) {
+		values[match[1]] = match[2]
+	}
+	realm, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return fmt.Errorf("registry challenge has no realm")
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if values[key] != "" {
+			query.Set(key, values[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return
+	}
+	response, err := client.HTTP.Do(request)
+	if err != nil {
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("registry token request failed with status %s", response.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = readJSON(response.Body, &token); err != nil {
+		return
+	}
+	client.token = token.Token
+	if client.token == "" {
+		client.token = token.AccessToken
+	}
+
+	return
+}
+
+// get request a manifest or blob from a registry, authorizing if challenged
+func (client *Client) get(ctx context.Context, ref reference, kind, digest string) (response *http.Response, err error) {
+	address := fmt.Sprintf("https://%s/v2/%s/%s/%s", ref.registry, ref.repository, kind, digest)
+	for attempt := 0; ; attempt++ {
+		request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+		if requestErr != nil {
+			return nil, requestErr
+		}
+		request.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+		if client.token != "" {
+			request.Header.Set("Authorization", "Bearer "+client.token)
+		}
+		response, err = client.HTTP.Do(request)
+		if err != nil {
+			return
+		}
+		if response.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := response.Header.Get("WWW-Authenticate")
+			response.Body.Close()
+			if err = client.authorize(ctx, challenge); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return nil, fmt.Errorf("%s %s: registry returned status %s", kind, digest, response.Status)
+		}
+		return
+	}
+}
+
+// digestReader check that what is read has the expected digest
+type digestReader struct {
+	reader io.Reader
+	hash   hash.Hash
+	digest string
+}
+
+// newDigestReader verify a blob as it is read. Digests other than sha256 are
+// not checked.
+func newDigestReader(reader io.Reader, digest string) *digestReader {
+	verifier := &digestReader{reader: reader, digest: digest}
+	if strings.HasPrefix(digest, "sha256:") {
+		verifier.hash = sha256.New()
+		verifier.reader = io.TeeReader(reader, verifier.hash)
+	}
+
+	return verifier
+}
+
+// Read read through to the blob
+func (verifier *digestReader) Read(p []byte) (int, error) {
+	return verifier.reader.Read(p)
+}
+
+// verify read the rest of the blob and compare its digest
+func (verifier *digestReader) verify() error {
+	if _, err := io.Copy(io.Discard, verifier.reader); err != nil {
+		return err
+	}
+	if verifier.hash == nil {
+		return nil
+	}
+	if sum := "sha256:" + hex.EncodeToString(verifier.hash.Sum(nil)); sum != verifier.digest {
+		return fmt.Errorf("blob %s has digest %s", verifier.digest, sum)
+	}
+
+	return nil
+}
+
+// pullFiles get the matching files from an image in a registry
+func (client *Client) pullFiles(ctx context.Context, ref reference, want string, match func(string) bool) (files map[string][]byte, err error) {
+	var current manifest
+	tag := ref.tag
+	// Follow indexes down to the image manifest
+	for depth := 0; ; depth++ {
+		if depth > maxIndexDepth {
+			return nil, fmt.Errorf("image indexes nested too deeply")
+		}
+		response, getErr := client.get(ctx, ref, "manifests", tag)
+		if getErr != nil {
+			return nil, getErr
+		}
+		current = manifest{}
+		err = readJSON(response.Body, &current)
+		response.Body.Close()
+		if err != nil {
+			return
+		}
+		if len(current.Manifests) == 0 {
+			break
+		}
+		selected, selectErr := selectManifest(current.Manifests, want)
+		if selectErr != nil {
+			return nil, selectErr
+		}
+		tag = selected.Digest
+	}
+
+	files = make(map[string][]byte)
+	for _, blob := range current.Layers {
+		response, getErr := client.get(ctx, ref, "blobs", blob.Digest)
+		if getErr != nil {
+			return nil, getErr
+		}
+		verifier := newDigestReader(response.Body, blob.Digest)
+		result, readErr := readLayer(verifier, match)
+		if readErr == nil {
+			readErr = verifier.verify()
+		}
+		response.Body.Close()
+		if readErr != nil {
+			return nil, fmt.Errorf("layer %s: %w", blob.Digest, readErr)
+		}
+		apply(files, result)
+	}
+
+	return
+}
+
+// Files get the contents of the files in an image for which match is true,
+// by their absolute paths in the image. An image that names a local file is
+// read from it, as written by docker save or holding an OCI image layout.
+// Otherwise the image is pulled from its registry.
+func (client *Client) Files(ctx context.Context, image string, match func(string) bool) (files map[string][]byte, err error) {
+	want := client.Platform
+	if want == "" {
+		want = DefaultPlatform
+	}
+	if info, statErr := os.Stat(image); statErr == nil && info.Mode().IsRegular() {
+		return localFiles(image, want, match)
+	}
+	ref, err := parseReference(image)
+	if err != nil {
+		return
+	}
+	client.token = ""
+
+	return client.pullFiles(ctx, ref, want, match)
+}
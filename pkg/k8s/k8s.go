@@ -0,0 +1,104 @@
+// Package k8s lists the kubernetes.io/tls secrets of a Kubernetes cluster with
+// client-go, for their certificate chains to be checked as files are. It is
+// kept apart from pkg/hosts so programs embedding that package don't build
+// client-go and the Kubernetes API types.
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	_ "k8s.io/client-go/plugin/pkg/client/auth" // auth-provider users
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// secretPageSize most secrets asked for in one request, as for kubectl
+const secretPageSize = 500
+
+// userAgent user agent sent to the API server
+const userAgent = "certcheck"
+
+// Query the TLS secrets to list in a Kubernetes cluster
+type Query struct {
+	Namespaces []string // namespaces to list secrets in, all if empty
+	Selector   string   // label selector secrets must match, as for kubectl -l
+	Context    string   // kubeconfig context to use, the current one if empty
+}
+
+// Secret the certificate chain of a TLS secret
+type Secret struct {
+	Name string // namespace and name, as in ingress-nginx/example-tls
+	Cert []byte // contents of tls.crt, empty if the secret has none
+}
+
+// newClient make a client for the API server of a kubeconfig context, the
+// current one if contextName is empty. Kubeconfigs are found and merged as
+// kubectl does, and without one the pod's service account is used in a
+// cluster.
+func newClient(contextName string, timeout time.Duration) (kubernetes.Interface, error) {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: contextName},
+	)
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: %v", err)
+	}
+	config.Timeout = timeout
+	config.UserAgent = userAgent
+
+	return kubernetes.NewForConfig(config)
+}
+
+// listTLSSecrets list the TLS secrets in a namespace, or in all namespaces if
+// namespace is empty, following continue tokens until the last page
+func listTLSSecrets(ctx context.Context, client kubernetes.Interface, namespace, selector string) (secrets []corev1.Secret, err error) {
+	listOptions := metav1.ListOptions{
+		FieldSelector: "type=" + string(corev1.SecretTypeTLS),
+		LabelSelector: selector,
+		Limit:         secretPageSize,
+	}
+	for {
+		list, err := client.CoreV1().Secrets(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, fmt.Errorf("kubernetes: %v", err)
+		}
+		secrets = append(secrets, list.Items...)
+		if list.Continue == "" {
+			return secrets, nil
+		}
+		listOptions.Continue = list.Continue
+	}
+}
+
+// TLSSecrets list the kubernetes.io/tls secrets a query matches, an inventory
+// of the certs a cluster serves with. Secrets are listed from the API server
+// of the kubeconfig context, or else with the pod's service account when run
+// in a cluster. The account needs to be able to list secrets.
+func TLSSecrets(query Query, timeout time.Duration) (secrets []Secret, err error) {
+	namespaces := query.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	ctx := context.Background()
+	client, err := newClient(query.Context, timeout)
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaces {
+		listed, err := listTLSSecrets(ctx, client, namespace, query.Selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range listed {
+			secrets = append(secrets, Secret{Name: secret.Namespace + "/" + secret.Name, Cert: secret.Data[corev1.TLSCertKey]})
+		}
+	}
+
+	return
+}
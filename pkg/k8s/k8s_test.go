@@ -0,0 +1,110 @@
+package k8s
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestTLSSecrets(t *testing.T) {
+	is := is.New(t)
+
+	// A stand-in API server pages its listing and checks the token
+	item := func(name, data string) string {
+		return `{"metadata": {"name": "` + name + `", "namespace": "prod"}, "type": "kubernetes.io/tls", "data": ` + data + `}`
+	}
+	var queries []url.Values
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Forbidden", "code": 403,
+  "message": "secrets is forbidden: User \"system:anonymous\" cannot list resource \"secrets\""}`))
+			return
+		}
+		queries = append(queries, r.URL.Query())
+		switch {
+		case r.URL.Path == "/api/v1/secrets":
+			w.Write([]byte(`{"kind": "SecretList", "apiVersion": "v1", "metadata": {}, "items": []}`))
+		case r.URL.Path != "/api/v1/namespaces/prod/secrets":
+			http.NotFound(w, r)
+		case r.URL.Query().Get("continue") == "":
+			w.Write([]byte(`{"kind": "SecretList", "apiVersion": "v1", "metadata": {"continue": "page2"}, "items": [` +
+				item("web-tls", `{"tls.crt": "`+base64.StdEncoding.EncodeToString([]byte("chain"))+`", "tls.key": ""}`) + `]}`))
+		default:
+			w.Write([]byte(`{"kind": "SecretList", "apiVersion": "v1", "metadata": {}, "items": [` + item("empty-tls", `{}`) + `]}`))
+		}
+	}))
+	defer server.Close()
+	caData := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}))
+
+	// Contexts for a token, a credential plugin and a user the server refuses
+	dir := t.TempDir()
+	plugin := filepath.Join(dir, "plugin")
+	is.NoErr(os.WriteFile(plugin, []byte("#!/bin/sh\necho '{\"apiVersion\": \"client.authentication.k8s.io/v1beta1\", \"kind\": \"ExecCredential\", \"status\": {\"token\": \"'$TOKEN'\"}}'\n"), 0o755))
+	kubeconfigPath := filepath.Join(dir, "config")
+	is.NoErr(os.WriteFile(kubeconfigPath, []byte(`{
+  "apiVersion": "v1",
+  "kind": "Config",
+  "current-context": "anonymous",
+  "contexts": [
+    {"name": "staging", "context": {"cluster": "test", "user": "admin"}},
+    {"name": "exec", "context": {"cluster": "test", "user": "plugin"}},
+    {"name": "gcp", "context": {"cluster": "test", "user": "legacy"}},
+    {"name": "anonymous", "context": {"cluster": "test"}}
+  ],
+  "clusters": [
+    {"name": "test", "cluster": {"server": "`+server.URL+`", "certificate-authority-data": "`+caData+`"}}
+  ],
+  "users": [
+    {"name": "admin", "user": {"token": "token"}},
+    {"name": "plugin", "user": {"exec": {"apiVersion": "client.authentication.k8s.io/v1beta1",
+      "command": "./plugin", "env": [{"name": "TOKEN", "value": "token"}]}}},
+    {"name": "legacy", "user": {"auth-provider": {"name": "gcp"}}}
+  ]
+}`), 0o600))
+	t.Setenv("KUBECONFIG", kubeconfigPath)
+
+	query := Query{Namespaces: []string{"prod"}, Selector: "app=web", Context: "staging"}
+	secrets, err := TLSSecrets(query, 30*time.Second)
+	is.NoErr(err)
+	is.Equal(len(secrets), 2)
+	is.Equal(secrets[0].Name, "prod/web-tls")
+	is.Equal(string(secrets[0].Cert), "chain")
+	is.Equal(secrets[1].Name, "prod/empty-tls")
+	is.Equal(len(secrets[1].Cert), 0)
+	is.Equal(len(queries), 2)
+	is.Equal(queries[0].Get("fieldSelector"), "type=kubernetes.io/tls")
+	is.Equal(queries[0].Get("labelSelector"), "app=web")
+	is.Equal(queries[1].Get("continue"), "page2")
+
+	// A credential plugin gives the token
+	secrets, err = TLSSecrets(Query{Context: "exec"}, 30*time.Second)
+	is.NoErr(err)
+	is.Equal(len(secrets), 0)
+
+	// Refusals are reported with the API server's message
+	_, err = TLSSecrets(Query{}, 30*time.Second)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "secrets is forbidden"))
+	_, err = TLSSecrets(Query{Context: "missing"}, 30*time.Second)
+	is.True(err != nil)
+	_, err = TLSSecrets(Query{Context: "gcp"}, 30*time.Second)
+	is.True(err != nil)
+	is.True(strings.Contains(err.Error(), "gke-gcloud-auth-plugin"))
+
+	// Without a kubeconfig only a cluster's service account can be used
+	t.Setenv("KUBECONFIG", filepath.Join(dir, "missing"))
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	_, err = TLSSecrets(Query{}, 30*time.Second)
+	is.True(err != nil)
+}
@@ -0,0 +1,628 @@
+// Package model holds the output types of certcheck. It depends only on the
+// standard library and yaml.v3 so other programs can read certcheck JSON and
+// YAML output using the same types without building the TLS lookup code.
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// TimeFormat format used for all times in output
+const TimeFormat = "2006-01-02T15:04:05Z"
+
+// Sources of results, as set in CertData.Source when results from several
+// sources are merged
+const (
+	SourceHost      = "host"      // a TLS connection to a host
+	SourceFile      = "file"      // a certificate file or directory of them
+	SourceArchive   = "archive"   // a file in a tar or zip archive
+	SourceSSH       = "ssh"       // a file fetched over SFTP
+	SourceEnvoy     = "envoy"     // an Envoy admin endpoint
+	SourceAppliance = "appliance" // a load balancer appliance API
+	SourceCDN       = "cdn"       // a CDN edge certificate API
+	SourceKube      = "kube"      // a kubeconfig file
+	SourceSSHCert   = "sshcert"   // an OpenSSH certificate file or host
+	SourceCloud     = "cloud"     // a cloud certificate service API
+)
+
+// Roles of certs read from files, as set in CertData.Role
+const (
+	RoleLeaf         = "leaf"         // a cert that isn't a CA, such as a server's
+	RoleIntermediate = "intermediate" // a CA cert issued by another CA
+	RoleRoot         = "root"         // a self-signed CA cert
+)
+
+// Renewal of certs held by cloud certificate services, as set in
+// CertData.Renewal
+const (
+	RenewalAuto   = "auto"   // the service renews the cert before it expires
+	RenewalManual = "manual" // someone has to renew or reimport the cert
+)
+
+// Scan policies of hosts checked in a public scan, as set in
+// CertData.ScanPolicy
+const (
+	ScanPolicyNone        = "none"         // no opt-out was published
+	ScanPolicyOptOutDNS   = "opt-out dns"  // opted out with a DNS TXT record
+	ScanPolicyOptOutHTTPS = "opt-out http" // opted out in security.txt
+)
+
+// CertData values for a TLS certificate
+type CertData struct {
+	// ID            int    `json:"-" yaml:"-"`
+	Host           string      `json:"host" yaml:"host"`
+	File           string      `json:"file,omitempty" yaml:"file,omitempty"`
+	ReferencedBy   string      `json:"referencedby,omitempty" yaml:"referencedby,omitempty"`
+	Subject        string      `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Role           string      `json:"role,omitempty" yaml:"role,omitempty"`
+	Alias          string      `json:"alias,omitempty" yaml:"alias,omitempty"`
+	Renewal        string      `json:"renewal,omitempty" yaml:"renewal,omitempty"`
+	SSHCertType    string      `json:"sshcerttype,omitempty" yaml:"sshcerttype,omitempty"`
+	Principals     []string    `json:"principals,omitempty" yaml:"principals,omitempty"`
+	Source         string      `json:"source,omitempty" yaml:"source,omitempty"`
+	PEMBlocks      []PEMBlock  `json:"pemblocks,omitempty" yaml:"pemblocks,omitempty"`
+	PrivateKey     bool        `json:"privatekey,omitempty" yaml:"privatekey,omitempty"`
+	KeyMatch       string      `json:"keymatch,omitempty" yaml:"keymatch,omitempty"`
+	KeyFile        string      `json:"keyfile,omitempty" yaml:"keyfile,omitempty"`
+	HostError      bool        `json:"hosterror" yaml:"hosterror"`
+	Message        string      `json:"message" yaml:"message"`
+	Errors         []string    `json:"errors,omitempty" yaml:"errors,omitempty"`
+	ScanPolicy     string      `json:"scanpolicy,omitempty" yaml:"scanpolicy,omitempty"`
+	VerifyError    string      `json:"verifyerror,omitempty" yaml:"verifyerror,omitempty"`
+	Anomalies      []string    `json:"anomalies,omitempty" yaml:"anomalies,omitempty"`
+	Warnings       []string    `json:"warnings,omitempty" yaml:"warnings,omitempty"`
+	ExpiryWarning  bool        `json:"expirywarning" yaml:"expirywarning"`
+	RenewBy        string      `json:"renewby,omitempty" yaml:"renewby,omitempty"`
+	Freeze         string      `json:"freeze,omitempty" yaml:"freeze,omitempty"`
+	NewlyIssued    bool        `json:"newlyissued,omitempty" yaml:"newlyissued,omitempty"`
+	LongLifetime   bool        `json:"longlifetime,omitempty" yaml:"longlifetime,omitempty"`
+	Issuer         string      `json:"issuer" yaml:"issuer"`
+	IssuerType     string      `json:"issuertype,omitempty" yaml:"issuertype,omitempty"`
+	SelfSigned     bool        `json:"selfsigned" yaml:"selfsigned"`
+	IssuanceSource string      `json:"issuancesource,omitempty" yaml:"issuancesource,omitempty"`
+	Distrusted     string      `json:"distrustedissuer,omitempty" yaml:"distrustedissuer,omitempty"`
+	Validation     string      `json:"validation,omitempty" yaml:"validation,omitempty"`
+	HostnameMatch  string      `json:"hostnamematch,omitempty" yaml:"hostnamematch,omitempty"`
+	MatchedName    string      `json:"matchedname,omitempty" yaml:"matchedname,omitempty"`
+	MissingNames   []string    `json:"missingnames,omitempty" yaml:"missingnames,omitempty"`
+	Serial         string      `json:"serial,omitempty" yaml:"serial,omitempty"`
+	Fingerprint    string      `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Chain          []ChainCert `json:"chain,omitempty" yaml:"chain,omitempty"`
+	ChainExpiry    string      `json:"chainexpiry,omitempty" yaml:"chainexpiry,omitempty"`
+	EarlyExpiry    []string    `json:"earlyexpiry,omitempty" yaml:"earlyexpiry,omitempty"`
+	ChainStatus    string      `json:"chainstatus,omitempty" yaml:"chainstatus,omitempty"`
+	AIAChased      bool        `json:"aiachased,omitempty" yaml:"aiachased,omitempty"`
+	ChainHash      string      `json:"chainhash,omitempty" yaml:"chainhash,omitempty"`
+	KeyType        string      `json:"keytype,omitempty" yaml:"keytype,omitempty"`
+	KeyBits        int         `json:"keybits,omitempty" yaml:"keybits,omitempty"`
+	WeakKey        bool        `json:"weakkey,omitempty" yaml:"weakkey,omitempty"`
+	UsageProblems  []string    `json:"usageproblems,omitempty" yaml:"usageproblems,omitempty"`
+	DualCert       bool        `json:"dualcert,omitempty" yaml:"dualcert,omitempty"`
+	LeafCerts      []LeafCert  `json:"leafcerts,omitempty" yaml:"leafcerts,omitempty"`
+	WeakSignature  []string    `json:"weaksignature,omitempty" yaml:"weaksignature,omitempty"`
+	IP             string      `json:"ip" yaml:"ip"`
+	ASN            uint64      `json:"asn,omitempty" yaml:"asn,omitempty"`
+	ASOrg          string      `json:"asorg,omitempty" yaml:"asorg,omitempty"`
+	Country        string      `json:"country,omitempty" yaml:"country,omitempty"`
+	SourceIP       string      `json:"sourceip,omitempty" yaml:"sourceip,omitempty"`
+	Interface      string      `json:"interface,omitempty" yaml:"interface,omitempty"`
+	NetPath        string      `json:"netpath,omitempty" yaml:"netpath,omitempty"`
+	Port           string      `json:"port" yaml:"port"`
+	Protocol       string      `json:"protocol" yaml:"protocol"`
+	TLSVersion     string      `json:"tlsversion" yaml:"tlsversion"`
+	ALPN           string      `json:"alpn,omitempty" yaml:"alpn,omitempty"`
+	TLSVersions    []string    `json:"tlsversions,omitempty" yaml:"tlsversions,omitempty"`
+	DeprecatedTLS  bool        `json:"deprecatedtls,omitempty" yaml:"deprecatedtls,omitempty"`
+	WeakCiphers    []string    `json:"weakciphers,omitempty" yaml:"weakciphers,omitempty"`
+	Session        *Session    `json:"session,omitempty" yaml:"session,omitempty"`
+	OCSPStapled    bool        `json:"ocspstapled" yaml:"ocspstapled"`
+	OCSPStatus     string      `json:"ocspstatus,omitempty" yaml:"ocspstatus,omitempty"`
+	OCSPResponder  string      `json:"ocspresponder,omitempty" yaml:"ocspresponder,omitempty"`
+	RevokedAt      string      `json:"revokedat,omitempty" yaml:"revokedat,omitempty"`
+	CRLStatus      string      `json:"crlstatus,omitempty" yaml:"crlstatus,omitempty"`
+	ACMEDNS        string      `json:"acmedns,omitempty" yaml:"acmedns,omitempty"`
+	CAA            string      `json:"caa,omitempty" yaml:"caa,omitempty"`
+	CTStatus       string      `json:"ctstatus,omitempty" yaml:"ctstatus,omitempty"`
+	CTCerts        []CTCert    `json:"ctcerts,omitempty" yaml:"ctcerts,omitempty"`
+	Pin            string      `json:"pin,omitempty" yaml:"pin,omitempty"`
+	GRPCHealth     string      `json:"grpchealth,omitempty" yaml:"grpchealth,omitempty"`
+	HTTP           *HTTPProbe  `json:"http,omitempty" yaml:"http,omitempty"`
+	TotalDays      int         `json:"totaldays" yaml:"totaldays"`
+	DaysToExpiry   int         `json:"daystoexpiry" yaml:"daystoexpiry"`
+	WarnAtDays     int         `json:"warnatdays" yaml:"warnatdays"`
+	CheckTime      string      `json:"checktime" yaml:"checktime"`
+	NotBefore      string      `json:"notbefore" yaml:"notbefore"`
+	NotAfter       string      `json:"notafter" yaml:"notafter"`
+	FetchTime      string      `json:"fetchtime" yaml:"fetchtime"`
+	Score          int         `json:"score,omitempty" yaml:"score,omitempty"`
+}
+
+// ChainCert a certificate in the chain a server sent
+type ChainCert struct {
+	Subject     string `json:"subject" yaml:"subject"`
+	Issuer      string `json:"issuer" yaml:"issuer"`
+	NotBefore   string `json:"notbefore" yaml:"notbefore"`
+	NotAfter    string `json:"notafter" yaml:"notafter"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	SPKISHA256  string `json:"spkisha256" yaml:"spkisha256"`
+}
+
+// PEMBlock what became of a PEM block in a certificate file, or of data
+// outside of any block
+type PEMBlock struct {
+	Line    int    `json:"line" yaml:"line"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+	Status  string `json:"status" yaml:"status"`
+	Reason  string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Subject string `json:"subject,omitempty" yaml:"subject,omitempty"`
+}
+
+// LeafCert the leaf certificate a server has for one key type
+type LeafCert struct {
+	KeyType     string `json:"keytype" yaml:"keytype"`
+	KeyBits     int    `json:"keybits" yaml:"keybits"`
+	Subject     string `json:"subject" yaml:"subject"`
+	Issuer      string `json:"issuer" yaml:"issuer"`
+	NotBefore   string `json:"notbefore" yaml:"notbefore"`
+	NotAfter    string `json:"notafter" yaml:"notafter"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+}
+
+// CTCert a certificate logged in Certificate Transparency logs
+type CTCert struct {
+	ID        int64    `json:"id" yaml:"id"`
+	Issuer    string   `json:"issuer" yaml:"issuer"`
+	Serial    string   `json:"serial" yaml:"serial"`
+	Names     []string `json:"names" yaml:"names"`
+	NotBefore string   `json:"notbefore" yaml:"notbefore"`
+	NotAfter  string   `json:"notafter" yaml:"notafter"`
+}
+
+// Session session resumption and renegotiation support of a server
+type Session struct {
+	Resumption          bool   `json:"resumption" yaml:"resumption"`
+	ResumedTLSVersion   string `json:"resumedtlsversion,omitempty" yaml:"resumedtlsversion,omitempty"`
+	SecureRenegotiation bool   `json:"securerenegotiation" yaml:"securerenegotiation"`
+}
+
+// HTTPProbe results of HTTP requests made to a host after its TLS check
+type HTTPProbe struct {
+	Status                int    `json:"status" yaml:"status"`
+	HSTS                  bool   `json:"hsts" yaml:"hsts"`
+	HSTSMaxAge            int64  `json:"hstsmaxage,omitempty" yaml:"hstsmaxage,omitempty"`
+	HSTSIncludeSubdomains bool   `json:"hstsincludesubdomains,omitempty" yaml:"hstsincludesubdomains,omitempty"`
+	HSTSPreload           bool   `json:"hstspreload,omitempty" yaml:"hstspreload,omitempty"`
+	RedirectsToHTTPS      bool   `json:"redirectstohttps" yaml:"redirectstohttps"`
+	Message               string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// RateLimit certificate issuance for a registered domain compared to a CA's
+// issuance rate limit
+type RateLimit struct {
+	Domain  string `json:"domain" yaml:"domain"`
+	Issued  int    `json:"issued" yaml:"issued"`
+	Limit   int    `json:"limit" yaml:"limit"`
+	Warning bool   `json:"warning" yaml:"warning"`
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// Cost connections, bytes and DNS queries a run sent to checked hosts, to
+// judge the impact of a scan
+type Cost struct {
+	Connections   int64         `json:"connections" yaml:"connections"`
+	BytesSent     int64         `json:"bytessent" yaml:"bytessent"`
+	BytesReceived int64         `json:"bytesreceived" yaml:"bytesreceived"`
+	DNSQueries    int64         `json:"dnsqueries" yaml:"dnsqueries"`
+	Networks      []NetworkCost `json:"networks,omitempty" yaml:"networks,omitempty"`
+}
+
+// NetworkCost connections and bytes sent to hosts in one network
+type NetworkCost struct {
+	Network       string `json:"network" yaml:"network"`
+	Connections   int64  `json:"connections" yaml:"connections"`
+	BytesSent     int64  `json:"bytessent" yaml:"bytessent"`
+	BytesReceived int64  `json:"bytesreceived" yaml:"bytesreceived"`
+}
+
+// CSRData a certificate signing request read from a file, with Problems
+// listing anything a CA would likely reject it for
+type CSRData struct {
+	File               string   `json:"file" yaml:"file"`
+	Subject            string   `json:"subject,omitempty" yaml:"subject,omitempty"`
+	DNSNames           []string `json:"dnsnames,omitempty" yaml:"dnsnames,omitempty"`
+	IPAddresses        []string `json:"ipaddresses,omitempty" yaml:"ipaddresses,omitempty"`
+	EmailAddresses     []string `json:"emailaddresses,omitempty" yaml:"emailaddresses,omitempty"`
+	URIs               []string `json:"uris,omitempty" yaml:"uris,omitempty"`
+	KeyType            string   `json:"keytype,omitempty" yaml:"keytype,omitempty"`
+	KeyBits            int      `json:"keybits,omitempty" yaml:"keybits,omitempty"`
+	WeakKey            bool     `json:"weakkey,omitempty" yaml:"weakkey,omitempty"`
+	SignatureAlgorithm string   `json:"signaturealgorithm,omitempty" yaml:"signaturealgorithm,omitempty"`
+	Problems           []string `json:"problems,omitempty" yaml:"problems,omitempty"`
+	Error              bool     `json:"error" yaml:"error"`
+	Message            string   `json:"message" yaml:"message"`
+}
+
+// CertGroup a certificate served by more than one host, or a serial number
+// an issuer used for more than one certificate. Hosts are listed as host:port,
+// or by file name for cert files.
+type CertGroup struct {
+	Fingerprint string   `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Serial      string   `json:"serial" yaml:"serial"`
+	Issuer      string   `json:"issuer" yaml:"issuer"`
+	Hosts       []string `json:"hosts" yaml:"hosts"`
+}
+
+// CertDataSet a set of TLS certificate data for a list of hosts plus summary
+type CertDataSet struct {
+	Total           int         `json:"total" yaml:"total"`
+	HostErrors      int         `json:"hosterrors" yaml:"hosterrors"`
+	ExpiredWarnings int         `json:"expirywarnings" yaml:"expirywarnings"`
+	Warnings        int         `json:"warnings" yaml:"warnings"`
+	OptedOut        int         `json:"optedout,omitempty" yaml:"optedout,omitempty"`
+	RateLimits      []RateLimit `json:"ratelimits,omitempty" yaml:"ratelimits,omitempty"`
+	Cost            *Cost       `json:"cost,omitempty" yaml:"cost,omitempty"`
+	SharedCerts     []CertGroup `json:"sharedcerts,omitempty" yaml:"sharedcerts,omitempty"`
+	SerialReuse     []CertGroup `json:"serialreuse,omitempty" yaml:"serialreuse,omitempty"`
+	PathDiffs       int         `json:"pathdiffs,omitempty" yaml:"pathdiffs,omitempty"`
+	Paths           []PathCheck `json:"paths,omitempty" yaml:"paths,omitempty"`
+	CertData        []CertData  `json:"certdata" yaml:"certdata"`
+}
+
+// NewCertDataSet new cert data set
+func NewCertDataSet() *CertDataSet {
+	certDataSet := new(CertDataSet)
+	certDataSet.CertData = make([]CertData, 0, 0)
+
+	return certDataSet
+}
+
+// Add add cert data to the set and update summary values
+func (certDataSet *CertDataSet) Add(items ...CertData) {
+	certDataSet.CertData = append(certDataSet.CertData, items...)
+	certDataSet.Finalize()
+}
+
+// Merge merge the cert data from another set into this set
+func (certDataSet *CertDataSet) Merge(other *CertDataSet) {
+	certDataSet.Add(other.CertData...)
+}
+
+// MergeSource merge the cert data from another set into this set, setting the
+// source of any that have none
+func (certDataSet *CertDataSet) MergeSource(other *CertDataSet, source string) {
+	for i := range other.CertData {
+		if other.CertData[i].Source == "" {
+			other.CertData[i].Source = source
+		}
+	}
+	certDataSet.Merge(other)
+}
+
+// Finalize set summary values for the cert data set and sort
+func (certDataSet *CertDataSet) Finalize() {
+	certDataSet.Total = 0
+	certDataSet.HostErrors = 0
+	certDataSet.ExpiredWarnings = 0
+	certDataSet.Warnings = 0
+	certDataSet.OptedOut = 0
+	for _, v := range certDataSet.CertData {
+		certDataSet.Total++
+		if v.HostError {
+			certDataSet.HostErrors++
+		}
+		if v.ExpiryWarning {
+			certDataSet.ExpiredWarnings++
+		}
+		if len(v.Warnings) > 0 {
+			certDataSet.Warnings++
+		}
+		if v.ScanPolicy == ScanPolicyOptOutDNS || v.ScanPolicy == ScanPolicyOptOutHTTPS {
+			certDataSet.OptedOut++
+		}
+	}
+	sort.Slice(certDataSet.CertData, func(i, j int) bool {
+		a, b := certDataSet.CertData[i], certDataSet.CertData[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		// The same host can appear once per port and address
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.NetPath != b.NetPath {
+			return a.NetPath < b.NetPath
+		}
+		if a.IP != b.IP {
+			return a.IP < b.IP
+		}
+		// A bundle gives a result per cert from the same file
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Subject < b.Subject
+	})
+	certDataSet.SharedCerts, certDataSet.SerialReuse = sharedCerts(certDataSet.CertData)
+}
+
+// endpoint name a result by host and port, or by file for cert files
+func (certData *CertData) endpoint() string {
+	if certData.File != "" {
+		return certData.File
+	}
+
+	return certData.Host + ":" + certData.Port
+}
+
+// sharedCerts group the hosts serving the same certificate, such as a shared
+// wildcard, and the certificates an issuer gave the same serial number, which
+// should never happen. Results served from several addresses of one host only
+// count once.
+func sharedCerts(certDataList []CertData) (shared, serialReuse []CertGroup) {
+	type group struct {
+		cert         CertGroup
+		fingerprints map[string]bool
+		hosts        map[string]bool
+	}
+	add := func(groups map[string]*group, order *[]string, key string, certData *CertData) {
+		g, ok := groups[key]
+		if !ok {
+			g = &group{
+				cert:         CertGroup{Serial: certData.Serial, Issuer: certData.Issuer},
+				fingerprints: make(map[string]bool),
+				hosts:        make(map[string]bool),
+			}
+			groups[key] = g
+			*order = append(*order, key)
+		}
+		g.fingerprints[certData.Fingerprint] = true
+		if endpoint := certData.endpoint(); !g.hosts[endpoint] {
+			g.hosts[endpoint] = true
+			g.cert.Hosts = append(g.cert.Hosts, endpoint)
+		}
+	}
+
+	byFingerprint, bySerial := make(map[string]*group), make(map[string]*group)
+	var fingerprintOrder, serialOrder []string
+	for i := range certDataList {
+		certData := &certDataList[i]
+		// CA certs are bundled with every leaf they issued
+		if certData.HostError || certData.Fingerprint == "" || certData.Role == RoleIntermediate || certData.Role == RoleRoot {
+			continue
+		}
+		add(byFingerprint, &fingerprintOrder, certData.Fingerprint, certData)
+		if certData.Serial != "" {
+			add(bySerial, &serialOrder, certData.Issuer+"\n"+certData.Serial, certData)
+		}
+	}
+	for _, key := range fingerprintOrder {
+		if g := byFingerprint[key]; len(g.hosts) > 1 {
+			g.cert.Fingerprint = key
+			shared = append(shared, g.cert)
+		}
+	}
+	for _, key := range serialOrder {
+		if g := bySerial[key]; len(g.fingerprints) > 1 {
+			serialReuse = append(serialReuse, g.cert)
+		}
+	}
+
+	return
+}
+
+// PathCheck what a host served over each network path it was checked over
+type PathCheck struct {
+	Host  string       `json:"host" yaml:"host"`
+	Port  string       `json:"port" yaml:"port"`
+	Same  bool         `json:"same" yaml:"same"`
+	Paths []PathResult `json:"paths" yaml:"paths"`
+}
+
+// PathResult what a host served over one network path. Fingerprint is empty
+// if the host could not be checked over the path, with Message saying why.
+type PathResult struct {
+	Name        string `json:"name" yaml:"name"`
+	IP          string `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Message     string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// ComparePaths set Paths to what each host served over each network path it
+// was checked over, from the NetPath of the results. A host is the same over
+// its paths only if it served one certificate over all of them, so one that
+// could only be reached over some paths differs too. The number of hosts that
+// differ is set in PathDiffs and returned. Results checked over several
+// addresses of a host count once per address.
+func (certDataSet *CertDataSet) ComparePaths() (diffs int) {
+	certDataSet.Paths = nil
+	index := make(map[string]int)
+	for _, certData := range certDataSet.CertData {
+		if certData.NetPath == "" {
+			continue
+		}
+		endpoint := certData.endpoint()
+		i, ok := index[endpoint]
+		if !ok {
+			i = len(certDataSet.Paths)
+			index[endpoint] = i
+			certDataSet.Paths = append(certDataSet.Paths, PathCheck{Host: certData.Host, Port: certData.Port, Same: true})
+		}
+		result := PathResult{Name: certData.NetPath, IP: certData.IP}
+		if certData.HostError {
+			result.Message = certData.Message
+		} else {
+			result.Fingerprint = certData.Fingerprint
+		}
+		check := &certDataSet.Paths[i]
+		if result.Fingerprint == "" || (len(check.Paths) > 0 && result.Fingerprint != check.Paths[0].Fingerprint) {
+			check.Same = false
+		}
+		check.Paths = append(check.Paths, result)
+	}
+	for _, check := range certDataSet.Paths {
+		if !check.Same {
+			diffs++
+		}
+	}
+	certDataSet.PathDiffs = diffs
+
+	return
+}
+
+// ExpiringBefore keep only the certs that expire before a time, whatever
+// their warning period. Results without an expiry, such as hosts that could
+// not be checked, are dropped.
+func (certDataSet *CertDataSet) ExpiringBefore(before time.Time) {
+	kept := certDataSet.CertData[:0]
+	for _, certData := range certDataSet.CertData {
+		notAfter, err := time.Parse(TimeFormat, certData.NotAfter)
+		if err == nil && notAfter.Before(before) {
+			kept = append(kept, certData)
+		}
+	}
+	certDataSet.CertData = kept
+	certDataSet.Finalize()
+}
+
+// MarkNewlyIssued set NewlyIssued for certs that became valid less than
+// a duration before now, which can mean unexpected issuance or an unplanned
+// renewal
+func (certDataSet *CertDataSet) MarkNewlyIssued(within time.Duration, now time.Time) {
+	for i, certData := range certDataSet.CertData {
+		notBefore, err := time.Parse(TimeFormat, certData.NotBefore)
+		if err == nil && now.Sub(notBefore) < within {
+			certDataSet.CertData[i].NewlyIssued = true
+		}
+	}
+}
+
+// MaxLifetimeDays longest validity the CA/Browser Forum baseline requirements
+// allow for a publicly trusted leaf certificate
+const MaxLifetimeDays = 398
+
+// MarkLongLifetime set LongLifetime for leaf certs valid for longer than
+// maxDays in total, which browsers reject for public certs and often means an
+// internal CA or misissuance
+func (certDataSet *CertDataSet) MarkLongLifetime(maxDays int) {
+	for i, certData := range certDataSet.CertData {
+		// The baseline requirements don't apply to SSH certs, and CA certs,
+		// including trust store roots and kubeconfig cluster CAs, are
+		// legitimately valid for years
+		if certData.Source == SourceSSHCert || certData.Role == RoleIntermediate || certData.Role == RoleRoot {
+			continue
+		}
+		notBefore, beforeErr := time.Parse(TimeFormat, certData.NotBefore)
+		notAfter, afterErr := time.Parse(TimeFormat, certData.NotAfter)
+		if beforeErr == nil && afterErr == nil && notAfter.Sub(notBefore) > time.Duration(maxDays)*24*time.Hour {
+			certDataSet.CertData[i].LongLifetime = true
+		}
+	}
+}
+
+// ExpectSame mark results that serve a different leaf certificate from the
+// rest of the set as host errors, for a pool of hosts that should all serve
+// the same one. The certificate most results serve is expected, the first in
+// order on a tie. Results that could not be checked are left as they are, as
+// are the CA certs of bundles, which are served alongside the leaf. The number
+// of outliers is returned.
+func (certDataSet *CertDataSet) ExpectSame() (outliers int) {
+	counts := make(map[string]int)
+	for _, certData := range certDataSet.CertData {
+		if !certData.HostError && certData.Fingerprint != "" && certData.Role != RoleIntermediate && certData.Role != RoleRoot {
+			counts[certData.Fingerprint]++
+		}
+	}
+	expected := ""
+	for _, certData := range certDataSet.CertData {
+		if counts[certData.Fingerprint] > counts[expected] {
+			expected = certData.Fingerprint
+		}
+	}
+
+	for i, certData := range certDataSet.CertData {
+		if certData.HostError || certData.Fingerprint == "" || certData.Fingerprint == expected ||
+			certData.Role == RoleIntermediate || certData.Role == RoleRoot {
+			continue
+		}
+		outliers++
+		certDataSet.CertData[i].HostError = true
+		certDataSet.CertData[i].Message = fmt.Sprintf("serves certificate %s, expected %s served by %d others",
+			shortHash(certData.Fingerprint), shortHash(expected), counts[expected])
+	}
+	certDataSet.Finalize()
+
+	return
+}
+
+// shortHash abbreviate a hash for messages
+func shortHash(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16]
+	}
+
+	return hash
+}
+
+// day length of a day for expiry, which ignores daylight saving changes
+const day = 24 * time.Hour
+
+// SetExpiry set the validity and expiry values of cert data for a cert valid
+// from notBefore, zero if the source doesn't give it, to notAfter, as of now.
+// Sources pass the time of their clock as now so --as-of applies to them all.
+// Days to expiry are whole days left, 0 once a cert has less than a day.
+func (certData *CertData) SetExpiry(notBefore, notAfter time.Time, warnAtDays int, now time.Time) {
+	if !notBefore.IsZero() {
+		certData.NotBefore = notBefore.UTC().Format(TimeFormat)
+		certData.TotalDays = int(notAfter.Sub(notBefore) / day)
+	}
+	certData.NotAfter = notAfter.UTC().Format(TimeFormat)
+
+	certData.DaysToExpiry = 0
+	if left := notAfter.Sub(now); left > 0 {
+		certData.DaysToExpiry = int(left / day)
+	}
+	certData.WarnAtDays = warnAtDays
+	certData.ExpiryWarning = now.Add(time.Duration(warnAtDays) * day).After(notAfter)
+}
+
+// JSON get JSON representation of data for a host certificate
+func (certData *CertData) JSON() (bytes []byte, err error) {
+	// Do JSON output by default
+	bytes, err = json.MarshalIndent(&certData, "", "  ")
+	if err != nil {
+		return
+	}
+	return
+}
+
+// YAML get YAML representation of data for a host certificate
+func (certData *CertData) YAML() (bytes []byte, err error) {
+	bytes, err = yaml.Marshal(&certData)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// JSON get JSON representation of data for a set of host certificates
+func (certDataSet *CertDataSet) JSON() (bytes []byte, err error) {
+	// Do JSON output by default
+	bytes, err = json.MarshalIndent(&certDataSet, "", "  ")
+	if err != nil {
+		return
+	}
+	return
+}
+
+// YAML get YAML representation of data for a set of host certificates
+func (certDataSet *CertDataSet) YAML() (bytes []byte, err error) {
+	bytes, err = yaml.Marshal(&certDataSet)
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,227 @@
+package model
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestAddAndMerge(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "b.example.com", ExpiryWarning: true},
+		CertData{Host: "a.example.com", HostError: true},
+	)
+	is.Equal(certDataSet.Total, 2)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.Equal(certDataSet.ExpiredWarnings, 1)
+	is.Equal(certDataSet.CertData[0].Host, "a.example.com")
+
+	other := NewCertDataSet()
+	other.Add(CertData{Host: "c.example.com", Message: "OK", Warnings: []string{"CRL unavailable"}})
+	certDataSet.Merge(other)
+	// Summary values are recalculated rather than added to
+	is.Equal(certDataSet.Total, 3)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.Equal(certDataSet.Warnings, 1)
+}
+
+func TestExpiringBefore(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "a.example.com", NotAfter: "2025-08-31T23:59:59Z"},
+		CertData{Host: "b.example.com", NotAfter: "2025-09-01T00:00:00Z"},
+		CertData{Host: "c.example.com", NotAfter: "2026-01-01T00:00:00Z", ExpiryWarning: true},
+		CertData{Host: "d.example.com", HostError: true},
+	)
+	certDataSet.ExpiringBefore(time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC))
+	is.Equal(certDataSet.Total, 1)
+	is.Equal(certDataSet.HostErrors, 0)
+	is.Equal(certDataSet.CertData[0].Host, "a.example.com")
+}
+
+func TestMarkNewlyIssued(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Date(2025, 9, 1, 12, 0, 0, 0, time.UTC)
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "a.example.com", NotBefore: "2025-09-01T06:00:00Z"},
+		CertData{Host: "b.example.com", NotBefore: "2025-08-01T00:00:00Z"},
+		CertData{Host: "c.example.com", HostError: true},
+	)
+	certDataSet.MarkNewlyIssued(24*time.Hour, now)
+	is.True(certDataSet.CertData[0].NewlyIssued)
+	is.True(!certDataSet.CertData[1].NewlyIssued)
+	is.True(!certDataSet.CertData[2].NewlyIssued)
+}
+
+func TestSharedCerts(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "a.example.com", Port: "443", IP: "192.0.2.1", Fingerprint: "aa", Serial: "01", Issuer: "CN=CA"},
+		CertData{Host: "a.example.com", Port: "443", IP: "192.0.2.2", Fingerprint: "aa", Serial: "01", Issuer: "CN=CA"},
+		CertData{Host: "b.example.com", Port: "443", Fingerprint: "aa", Serial: "01", Issuer: "CN=CA"},
+		CertData{Host: "c.example.com", Port: "443", Fingerprint: "cc", Serial: "01", Issuer: "CN=CA"},
+		CertData{Host: "d.example.com", Port: "443", Fingerprint: "dd", Serial: "01", Issuer: "CN=Other CA"},
+		CertData{Host: "e.example.com", HostError: true},
+		// The intermediate of two bundles is expected in both
+		CertData{File: "a.pem", Role: RoleIntermediate, Fingerprint: "ff", Serial: "02", Issuer: "CN=CA"},
+		CertData{File: "b.pem", Role: RoleIntermediate, Fingerprint: "ff", Serial: "02", Issuer: "CN=CA"},
+	)
+	// One host on several addresses is not sharing
+	is.Equal(len(certDataSet.SharedCerts), 1)
+	is.Equal(certDataSet.SharedCerts[0].Fingerprint, "aa")
+	is.Equal(certDataSet.SharedCerts[0].Hosts, []string{"a.example.com:443", "b.example.com:443"})
+	// Serials only clash within an issuer
+	is.Equal(len(certDataSet.SerialReuse), 1)
+	is.Equal(certDataSet.SerialReuse[0].Issuer, "CN=CA")
+	is.Equal(certDataSet.SerialReuse[0].Hosts, []string{"a.example.com:443", "b.example.com:443", "c.example.com:443"})
+
+	certDataSet.ExpiringBefore(time.Now())
+	is.Equal(len(certDataSet.SharedCerts), 0)
+}
+
+func TestMarkLongLifetime(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "a.example.com", NotBefore: "2025-01-01T00:00:00Z", NotAfter: "2026-02-03T00:00:00Z"},
+		CertData{Host: "b.example.com", NotBefore: "2025-01-01T00:00:00Z", NotAfter: "2026-02-04T00:00:00Z"},
+		CertData{Host: "c.example.com", HostError: true},
+		CertData{Host: "d.example.com", File: "chain.pem", Role: RoleIntermediate, NotBefore: "2020-01-01T00:00:00Z", NotAfter: "2030-01-01T00:00:00Z"},
+		CertData{Host: "e.example.com", File: "chain.pem", Role: RoleRoot, NotBefore: "2020-01-01T00:00:00Z", NotAfter: "2040-01-01T00:00:00Z"},
+	)
+	certDataSet.MarkLongLifetime(MaxLifetimeDays)
+	is.True(!certDataSet.CertData[0].LongLifetime)
+	is.True(certDataSet.CertData[1].LongLifetime)
+	is.True(!certDataSet.CertData[2].LongLifetime)
+	is.True(!certDataSet.CertData[3].LongLifetime)
+	is.True(!certDataSet.CertData[4].LongLifetime)
+}
+
+func TestSetExpiry(t *testing.T) {
+	is := is.New(t)
+
+	notBefore := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+	notAfter := time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC)
+	now := time.Date(2025, time.March, 20, 12, 0, 0, 0, time.UTC)
+
+	var certData CertData
+	certData.SetExpiry(notBefore, notAfter, 30, now)
+	is.Equal(certData.NotBefore, "2025-01-01T00:00:00Z")
+	is.Equal(certData.NotAfter, "2025-04-01T00:00:00Z")
+	is.Equal(certData.TotalDays, 90)
+	is.Equal(certData.DaysToExpiry, 11)
+	is.Equal(certData.WarnAtDays, 30)
+	is.True(certData.ExpiryWarning)
+
+	// Times are given in UTC, less than a day left is none, and an unknown
+	// start leaves the validity out
+	certData = CertData{}
+	certData.SetExpiry(time.Time{}, notAfter.In(time.FixedZone("EST", -5*3600)), 1, notAfter.Add(-time.Hour))
+	is.Equal(certData.NotBefore, "")
+	is.Equal(certData.TotalDays, 0)
+	is.Equal(certData.NotAfter, "2025-04-01T00:00:00Z")
+	is.Equal(certData.DaysToExpiry, 0)
+	certData.SetExpiry(time.Time{}, notAfter, 1, notAfter.Add(time.Hour))
+	is.Equal(certData.DaysToExpiry, 0)
+	is.True(certData.ExpiryWarning)
+}
+
+func TestMergeSource(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.MergeSource(&CertDataSet{CertData: []CertData{{Host: "b.example.com"}}}, SourceHost)
+	certDataSet.MergeSource(&CertDataSet{CertData: []CertData{
+		{Host: "a.example.com", File: "a.pem", HostError: true},
+		{Host: "c.example.com", File: "c.pem", Source: SourceArchive},
+	}}, SourceFile)
+	is.Equal(certDataSet.Total, 3)
+	is.Equal(certDataSet.HostErrors, 1)
+	is.Equal(certDataSet.CertData[0].Source, SourceFile)
+	is.Equal(certDataSet.CertData[1].Source, SourceHost)
+	is.Equal(certDataSet.CertData[2].Source, SourceArchive)
+}
+
+func TestExpectSame(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "pool.example.com", IP: "192.0.2.1", Fingerprint: "old"},
+		CertData{Host: "pool.example.com", IP: "192.0.2.2", Fingerprint: "new"},
+		CertData{Host: "pool.example.com", IP: "192.0.2.3", Fingerprint: "new"},
+		CertData{Host: "pool.example.com", IP: "192.0.2.4", HostError: true, Message: "timeout"},
+	)
+	is.Equal(certDataSet.ExpectSame(), 1)
+	is.Equal(certDataSet.HostErrors, 2)
+	is.True(certDataSet.CertData[0].HostError)
+	is.Equal(certDataSet.CertData[0].Message, "serves certificate old, expected new served by 2 others")
+	is.Equal(certDataSet.CertData[3].Message, "timeout")
+
+	// On a tie the first certificate is expected
+	tie := NewCertDataSet()
+	tie.Add(CertData{Host: "a.example.com", Fingerprint: "aa"}, CertData{Host: "b.example.com", Fingerprint: "bb"})
+	is.Equal(tie.ExpectSame(), 1)
+	is.True(tie.CertData[1].HostError)
+
+	// The CA certs of a bundle are neither expected nor outliers
+	bundle := NewCertDataSet()
+	bundle.Add(
+		CertData{Host: "mail.example.com", File: "test.pem", Role: RoleLeaf, Fingerprint: "leaf"},
+		CertData{File: "test.pem", Role: RoleIntermediate, Fingerprint: "intermediate"},
+		CertData{File: "test.pem", Role: RoleRoot, Fingerprint: "root"},
+	)
+	is.Equal(bundle.ExpectSame(), 0)
+	is.Equal(bundle.HostErrors, 0)
+}
+
+func TestRoundTrip(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(CertData{Host: "example.com", Port: "443", Message: "OK", DaysToExpiry: 60})
+
+	bytes, err := certDataSet.JSON()
+	is.NoErr(err)
+
+	var read CertDataSet
+	is.NoErr(json.Unmarshal(bytes, &read))
+	is.Equal(read.Total, 1)
+	is.Equal(read.CertData[0], certDataSet.CertData[0])
+}
+
+func TestComparePaths(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := NewCertDataSet()
+	certDataSet.Add(
+		CertData{Host: "a.example.com", Port: "443", NetPath: "public", Fingerprint: "aa"},
+		CertData{Host: "a.example.com", Port: "443", NetPath: "internal", Fingerprint: "aa"},
+		CertData{Host: "b.example.com", Port: "443", NetPath: "public", Fingerprint: "bb"},
+		CertData{Host: "b.example.com", Port: "443", NetPath: "internal", Fingerprint: "old"},
+		CertData{Host: "c.example.com", Port: "443", NetPath: "public", Fingerprint: "cc"},
+		CertData{Host: "c.example.com", Port: "443", NetPath: "internal", HostError: true, Message: "timeout"},
+		CertData{Host: "d.example.com", Port: "443", Fingerprint: "dd"},
+	)
+	is.Equal(certDataSet.ComparePaths(), 2)
+	is.Equal(certDataSet.PathDiffs, 2)
+	is.Equal(len(certDataSet.Paths), 3)
+	is.True(certDataSet.Paths[0].Same)
+	is.Equal(certDataSet.Paths[0].Paths[0].Name, "internal")
+	is.True(!certDataSet.Paths[1].Same)
+	is.True(!certDataSet.Paths[2].Same)
+	is.Equal(certDataSet.Paths[2].Paths[0].Message, "timeout")
+	is.Equal(certDataSet.Paths[2].Paths[0].Fingerprint, "")
+}
@@ -0,0 +1,310 @@
+// Package ocsp parses and checks OCSP responses (RFC 6960) using only the
+// standard library, for responses stapled during a handshake or fetched from
+// a responder.
+package ocsp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+)
+
+// Certificate status values
+const (
+	Good    = "good"
+	Revoked = "revoked"
+	Unknown = "unknown"
+)
+
+// maxResponseSize largest OCSP response read from a responder
+const maxResponseSize = 1 << 20
+
+var (
+	oidSHA1            = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidBasicResponse   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidTLSFeature      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+	statusRequestValue = []byte{0x30, 0x03, 0x02, 0x01, 0x05} // SEQUENCE { INTEGER 5 }
+)
+
+// signatureAlgorithms signature algorithms used by OCSP responders
+var signatureAlgorithms = map[string]x509.SignatureAlgorithm{
+	"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+	"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+	"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+	"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+	"1.2.840.10045.4.1":     x509.ECDSAWithSHA1,
+	"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+	"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+	"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+	"1.3.101.112":           x509.PureEd25519,
+}
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+type tbsRequest struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	RequestList []request
+}
+
+type request struct {
+	Cert certID
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type responseASN1 struct {
+	Status   asn1.Enumerated
+	Response responseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type responseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type basicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type responseData struct {
+	Raw            asn1.RawContent
+	Version        int `asn1:"optional,default:0,explicit,tag:0"`
+	RawResponderID asn1.RawValue
+	ProducedAt     time.Time `asn1:"generalized"`
+	Responses      []singleResponse
+}
+
+type singleResponse struct {
+	CertID     certID
+	Good       asn1.Flag   `asn1:"tag:0,optional"`
+	Revoked    revokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag   `asn1:"tag:2,optional"`
+	ThisUpdate time.Time   `asn1:"generalized"`
+	NextUpdate time.Time   `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type certID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// Response the status of a certificate from an OCSP response
+type Response struct {
+	Status       string
+	SerialNumber *big.Int
+	ProducedAt   time.Time
+	ThisUpdate   time.Time
+	NextUpdate   time.Time
+	RevokedAt    time.Time
+
+	tbsResponseData    []byte
+	signatureAlgorithm x509.SignatureAlgorithm
+	signature          []byte
+	certificates       []*x509.Certificate
+}
+
+// ParseResponse parse a DER encoded OCSP response holding a single
+// certificate status
+func ParseResponse(der []byte) (response *Response, err error) {
+	var outer responseASN1
+	if _, err = asn1.Unmarshal(der, &outer); err != nil {
+		return
+	}
+	if outer.Status != 0 {
+		err = fmt.Errorf("OCSP response status %d", outer.Status)
+		return
+	}
+	if !outer.Response.ResponseType.Equal(oidBasicResponse) {
+		err = errors.New("not a basic OCSP response")
+		return
+	}
+
+	var basic basicResponse
+	if _, err = asn1.Unmarshal(outer.Response.Response, &basic); err != nil {
+		return
+	}
+	var data responseData
+	if _, err = asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return
+	}
+	if len(data.Responses) != 1 {
+		err = fmt.Errorf("OCSP response has %d statuses", len(data.Responses))
+		return
+	}
+	single := data.Responses[0]
+
+	response = &Response{
+		SerialNumber:       single.CertID.SerialNumber,
+		ProducedAt:         data.ProducedAt,
+		ThisUpdate:         single.ThisUpdate,
+		NextUpdate:         single.NextUpdate,
+		tbsResponseData:    basic.TBSResponseData.FullBytes,
+		signatureAlgorithm: signatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()],
+		signature:          basic.Signature.RightAlign(),
+	}
+	switch {
+	case bool(single.Good):
+		response.Status = Good
+	case bool(single.Unknown):
+		response.Status = Unknown
+	default:
+		response.Status = Revoked
+		response.RevokedAt = single.Revoked.RevocationTime
+	}
+	for _, raw := range basic.Certificates {
+		var cert *x509.Certificate
+		cert, err = x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		response.certificates = append(response.certificates, cert)
+	}
+
+	return
+}
+
+// CheckSignatureFrom check the response is signed by the issuer or by a
+// responder certificate the issuer delegated OCSP signing to
+func (response *Response) CheckSignatureFrom(issuer *x509.Certificate) (err error) {
+	if response.signatureAlgorithm == x509.UnknownSignatureAlgorithm {
+		return errors.New("unsupported OCSP signature algorithm")
+	}
+
+	signer := issuer
+	if len(response.certificates) > 0 {
+		signer = response.certificates[0]
+		if !signer.Equal(issuer) {
+			if err = signer.CheckSignatureFrom(issuer); err != nil {
+				return fmt.Errorf("OCSP responder not issued by certificate issuer: %v", err)
+			}
+			delegated := false
+			for _, usage := range signer.ExtKeyUsage {
+				delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+			}
+			if !delegated {
+				return errors.New("OCSP responder not authorized for OCSP signing")
+			}
+		}
+	}
+
+	return signer.CheckSignature(response.signatureAlgorithm, response.tbsResponseData, response.signature)
+}
+
+// Check check the response is for the certificate, is signed for its issuer
+// and is current at now
+func (response *Response) Check(cert, issuer *x509.Certificate, now time.Time) (err error) {
+	if response.SerialNumber == nil || response.SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		return errors.New("OCSP response is for another certificate")
+	}
+	if err = response.CheckSignatureFrom(issuer); err != nil {
+		return
+	}
+	if now.Before(response.ThisUpdate) {
+		return fmt.Errorf("OCSP response not valid until %s", response.ThisUpdate.UTC().Format(time.RFC3339))
+	}
+	if !response.NextUpdate.IsZero() && now.After(response.NextUpdate) {
+		return fmt.Errorf("stale OCSP response, next update was %s", response.NextUpdate.UTC().Format(time.RFC3339))
+	}
+
+	return
+}
+
+// MustStaple check if a certificate has the TLS feature extension requiring a
+// stapled OCSP response (RFC 7633)
+func MustStaple(cert *x509.Certificate) bool {
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oidTLSFeature) && string(extension.Value) == string(statusRequestValue) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CreateRequest make a DER encoded OCSP request for a certificate, identified
+// by SHA-1 hashes of its issuer's name and key as responders expect
+func CreateRequest(cert, issuer *x509.Certificate) (der []byte, err error) {
+	var publicKeyInfo subjectPublicKeyInfo
+	if _, err = asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return
+	}
+	nameHash := sha1.Sum(issuer.RawSubject)
+	keyHash := sha1.Sum(publicKeyInfo.PublicKey.RightAlign())
+
+	return asn1.Marshal(ocspRequest{
+		TBSRequest: tbsRequest{
+			RequestList: []request{{
+				Cert: certID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+					NameHash:      nameHash[:],
+					IssuerKeyHash: keyHash[:],
+					SerialNumber:  cert.SerialNumber,
+				},
+			}},
+		},
+	})
+}
+
+// Query ask the OCSP responder at url for the status of a certificate. The
+// response is checked against the certificate and issuer before it is
+// returned.
+func Query(ctx context.Context, client *http.Client, url string, cert, issuer *x509.Certificate) (response *Response, err error) {
+	der, err := CreateRequest(cert, issuer)
+	if err != nil {
+		return
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(der))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/ocsp-request")
+	request.Header.Set("Accept", "application/ocsp-response")
+
+	httpResponse, err := client.Do(request)
+	if err != nil {
+		return
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		err = fmt.Errorf("OCSP responder returned %s", httpResponse.Status)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResponse.Body, maxResponseSize))
+	if err != nil {
+		return
+	}
+	response, err = ParseResponse(body)
+	if err != nil {
+		return
+	}
+	if err = response.Check(cert, issuer, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return
+}
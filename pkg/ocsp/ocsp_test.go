@@ -0,0 +1,159 @@
+package ocsp
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// makeCert make a certificate signed by parent, or self signed if parent is nil
+func makeCert(t *testing.T, serial int64, parent *x509.Certificate, parentKey crypto.Signer, extensions []pkix.Extension) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(serial),
+		Subject:         pkix.Name{CommonName: "test"},
+		NotBefore:       time.Now().Add(-time.Hour),
+		NotAfter:        time.Now().Add(time.Hour),
+		IsCA:            parent == nil,
+		ExtraExtensions: extensions,
+	}
+	if parent == nil {
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert, key
+}
+
+// makeResponse make a signed OCSP response for a serial number
+func makeResponse(t *testing.T, serial *big.Int, good bool, thisUpdate, nextUpdate time.Time, signer crypto.Signer) []byte {
+	single := singleResponse{
+		CertID:     certID{HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}}, SerialNumber: serial},
+		ThisUpdate: thisUpdate.UTC(),
+		NextUpdate: nextUpdate.UTC(),
+	}
+	if good {
+		single.Good = true
+	} else {
+		single.Revoked = revokedInfo{RevocationTime: thisUpdate.UTC()}
+	}
+	tbs, err := asn1.Marshal(responseData{
+		RawResponderID: asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: []byte{0x04, 0x00}},
+		ProducedAt:     thisUpdate.UTC(),
+		Responses:      []singleResponse{single},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(tbs)
+	signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basic, err := asn1.Marshal(basicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+		Signature:          asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(responseASN1{Response: responseBytes{ResponseType: oidBasicResponse, Response: basic}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func TestParseAndCheck(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+	issuer, issuerKey := makeCert(t, 1, nil, nil, nil)
+	leaf, _ := makeCert(t, 2, issuer, issuerKey, nil)
+	_, otherKey := makeCert(t, 3, nil, nil, nil)
+
+	response, err := ParseResponse(makeResponse(t, leaf.SerialNumber, true, now.Add(-time.Hour), now.Add(time.Hour), issuerKey))
+	is.NoErr(err)
+	is.Equal(response.Status, Good)
+	is.NoErr(response.Check(leaf, issuer, now))
+
+	// Stale response
+	is.True(response.Check(leaf, issuer, now.Add(2*time.Hour)) != nil)
+
+	// Response for another certificate
+	is.True(response.Check(issuer, issuer, now) != nil)
+
+	// Revoked and signed by the wrong key
+	response, err = ParseResponse(makeResponse(t, leaf.SerialNumber, false, now.Add(-time.Hour), now.Add(time.Hour), otherKey))
+	is.NoErr(err)
+	is.Equal(response.Status, Revoked)
+	is.True(response.Check(leaf, issuer, now) != nil)
+
+	_, err = ParseResponse([]byte{0x30, 0x03, 0x0a, 0x01, 0x01})
+	is.True(err != nil)
+}
+
+func TestMustStaple(t *testing.T) {
+	is := is.New(t)
+
+	issuer, issuerKey := makeCert(t, 1, nil, nil, nil)
+	leaf, _ := makeCert(t, 2, issuer, issuerKey, []pkix.Extension{{Id: oidTLSFeature, Value: statusRequestValue}})
+	is.True(MustStaple(leaf))
+	is.True(!MustStaple(issuer))
+}
+
+func TestQuery(t *testing.T) {
+	is := is.New(t)
+
+	now := time.Now()
+	issuer, issuerKey := makeCert(t, 1, nil, nil, nil)
+	leaf, _ := makeCert(t, 2, issuer, issuerKey, nil)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req ocspRequest
+		if _, err := asn1.Unmarshal(body, &req); err != nil || len(req.TBSRequest.RequestList) != 1 {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		serial := req.TBSRequest.RequestList[0].Cert.SerialNumber
+		w.Write(makeResponse(t, serial, serial.Int64() != 2, now.Add(-time.Hour), now.Add(time.Hour), issuerKey))
+	}))
+	defer server.Close()
+
+	response, err := Query(context.Background(), server.Client(), server.URL, leaf, issuer)
+	is.NoErr(err)
+	is.Equal(response.Status, Revoked)
+	is.True(!response.RevokedAt.IsZero())
+
+	_, err = Query(context.Background(), server.Client(), "http://127.0.0.1:1", leaf, issuer)
+	is.True(err != nil)
+}
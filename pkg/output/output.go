@@ -0,0 +1,68 @@
+// Package output writes cert data sets in the formats the command line
+// supports. Writer and New are part of the stable API of the module.
+package output
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+const (
+	// FormatJSON indented JSON output
+	FormatJSON = "json"
+	// FormatYAML YAML output
+	FormatYAML = "yaml"
+)
+
+// Formats names of the supported output formats
+var Formats = []string{FormatJSON, FormatYAML}
+
+// Writer write a cert data set to w
+type Writer interface {
+	Write(w io.Writer, certDataSet *model.CertDataSet) error
+}
+
+// WriterFunc adapt a function to the Writer interface
+type WriterFunc func(w io.Writer, certDataSet *model.CertDataSet) error
+
+// Write call f
+func (f WriterFunc) Write(w io.Writer, certDataSet *model.CertDataSet) error {
+	return f(w, certDataSet)
+}
+
+// JSON writer for indented JSON
+var JSON Writer = WriterFunc(func(w io.Writer, certDataSet *model.CertDataSet) error {
+	return write(w, certDataSet.JSON)
+})
+
+// YAML writer for YAML
+var YAML Writer = WriterFunc(func(w io.Writer, certDataSet *model.CertDataSet) error {
+	return write(w, certDataSet.YAML)
+})
+
+// write write encoded bytes followed by a newline
+func write(w io.Writer, encode func() ([]byte, error)) (err error) {
+	bytes, err := encode()
+	if err != nil {
+		return
+	}
+	_, err = fmt.Fprintln(w, string(bytes))
+
+	return
+}
+
+// New get the writer for a format name
+func New(format string) (writer Writer, err error) {
+	switch format {
+	case FormatJSON:
+		writer = JSON
+	case FormatYAML:
+		writer = YAML
+	default:
+		err = fmt.Errorf("unknown output format %s", format)
+	}
+
+	return
+}
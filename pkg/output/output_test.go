@@ -0,0 +1,35 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestWriters(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(model.CertData{Host: "example.com", Port: "443"})
+
+	writer, err := New(FormatJSON)
+	is.NoErr(err)
+	var buf bytes.Buffer
+	is.NoErr(writer.Write(&buf, certDataSet))
+	is.True(strings.HasSuffix(buf.String(), "\n"))
+
+	var decoded model.CertDataSet
+	is.NoErr(json.Unmarshal(buf.Bytes(), &decoded))
+	is.Equal(decoded.Total, 1)
+	is.Equal(decoded.CertData[0].Host, "example.com")
+
+	_, err = New(FormatYAML)
+	is.NoErr(err)
+
+	_, err = New("xml")
+	is.True(err != nil)
+}
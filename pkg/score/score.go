@@ -0,0 +1,137 @@
+// Package score rates checked hosts by risk so triage can start with the
+// riskiest endpoints.
+package score
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+)
+
+// Weights points added to a host's score for each kind of risk
+type Weights struct {
+	Unreachable   int // no certificate could be fetched
+	Violation     int // a certificate was fetched but a check failed
+	Expiry        int // scaled by how far into the warning period the cert is
+	WeakKey       int // RSA under 2048 bits or ECDSA under 256 bits
+	DeprecatedTLS int // TLS 1.0 or 1.1 accepted
+	WeakCipher    int // a weak cipher suite accepted
+}
+
+// DefaultWeights weights used if none are given
+var DefaultWeights = Weights{
+	Unreachable:   100,
+	Violation:     80,
+	Expiry:        60,
+	WeakKey:       40,
+	DeprecatedTLS: 20,
+	WeakCipher:    20,
+}
+
+// weightNames names of weights for ParseWeights
+var weightNames = []string{"unreachable", "violation", "expiry", "weakkey", "deprecatedtls", "weakcipher"}
+
+// fields get pointers to the weights in the order of weightNames
+func (weights *Weights) fields() []*int {
+	return []*int{
+		&weights.Unreachable, &weights.Violation, &weights.Expiry,
+		&weights.WeakKey, &weights.DeprecatedTLS, &weights.WeakCipher,
+	}
+}
+
+// ParseWeights get weights from name=value pairs separated by commas, such as
+// expiry=100,weakkey=10. Weights not named keep their default.
+func ParseWeights(pairs string) (weights Weights, err error) {
+	weights = DefaultWeights
+	fields := weights.fields()
+	for _, pair := range strings.Split(pairs, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return weights, fmt.Errorf("weight %s is not name=value", pair)
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		found := false
+		for i, weightName := range weightNames {
+			if name == weightName {
+				*fields[i], err = strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return weights, fmt.Errorf("weight %s is not an integer", pair)
+				}
+				found = true
+			}
+		}
+		if !found {
+			return weights, fmt.Errorf("unknown weight %s", name)
+		}
+	}
+
+	return
+}
+
+// Score get the risk score for a checked host
+func (weights Weights) Score(certData model.CertData) (score int) {
+	if certData.HostError && certData.Fingerprint == "" && certData.NotAfter == "" {
+		return weights.Unreachable
+	}
+	if certData.HostError {
+		score += weights.Violation
+	}
+	if certData.ExpiryWarning {
+		// A cert at the start of the warning period gets a small part of the
+		// weight and an expired one gets all of it
+		if certData.WarnAtDays < 1 || certData.DaysToExpiry < 1 {
+			score += weights.Expiry
+		} else {
+			used := certData.WarnAtDays - certData.DaysToExpiry
+			if used < 0 {
+				used = 0
+			}
+			score += weights.Expiry * (used + 1) / (certData.WarnAtDays + 1)
+		}
+	}
+	if certData.WeakKey {
+		score += weights.WeakKey
+	}
+	if certData.DeprecatedTLS {
+		score += weights.DeprecatedTLS
+	}
+	if len(certData.WeakCiphers) > 0 {
+		score += weights.WeakCipher
+	}
+
+	return
+}
+
+// Apply set the score of every host in the set
+func (weights Weights) Apply(certDataSet *model.CertDataSet) {
+	for i := range certDataSet.CertData {
+		certDataSet.CertData[i].Score = weights.Score(certDataSet.CertData[i])
+	}
+}
+
+// Filter drop hosts scoring below min from the set
+func Filter(certDataSet *model.CertDataSet, min int) {
+	kept := certDataSet.CertData[:0]
+	for _, certData := range certDataSet.CertData {
+		if certData.Score >= min {
+			kept = append(kept, certData)
+		}
+	}
+	certDataSet.CertData = kept
+	certDataSet.Finalize()
+}
+
+// Sort order the set with the highest scores first, keeping the order of
+// hosts with the same score. Call after anything that finalizes the set.
+func Sort(certDataSet *model.CertDataSet) {
+	sort.SliceStable(certDataSet.CertData, func(i, j int) bool {
+		return certDataSet.CertData[i].Score > certDataSet.CertData[j].Score
+	})
+}
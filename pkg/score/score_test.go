@@ -0,0 +1,64 @@
+package score
+
+import (
+	"testing"
+
+	"github.com/imarsman/certcheck/v2/pkg/model"
+	"github.com/matryer/is"
+)
+
+func TestParseWeights(t *testing.T) {
+	is := is.New(t)
+
+	weights, err := ParseWeights("expiry=100, WeakKey=5")
+	is.NoErr(err)
+	is.Equal(weights.Expiry, 100)
+	is.Equal(weights.WeakKey, 5)
+	is.Equal(weights.Unreachable, DefaultWeights.Unreachable)
+
+	_, err = ParseWeights("expiry")
+	is.True(err != nil)
+	_, err = ParseWeights("expiry=high")
+	is.True(err != nil)
+	_, err = ParseWeights("age=1")
+	is.True(err != nil)
+}
+
+func TestScore(t *testing.T) {
+	is := is.New(t)
+
+	weights := DefaultWeights
+	is.Equal(weights.Score(model.CertData{HostError: true}), weights.Unreachable)
+	is.Equal(weights.Score(model.CertData{KeyType: "RSA", KeyBits: 2048, WarnAtDays: 30, DaysToExpiry: 90}), 0)
+	is.Equal(weights.Score(model.CertData{KeyType: "RSA", KeyBits: 1024, WeakKey: true, DeprecatedTLS: true}), weights.WeakKey+weights.DeprecatedTLS)
+
+	// Risk grows through the warning period
+	early := weights.Score(model.CertData{ExpiryWarning: true, WarnAtDays: 30, DaysToExpiry: 29})
+	late := weights.Score(model.CertData{ExpiryWarning: true, WarnAtDays: 30, DaysToExpiry: 2})
+	expired := weights.Score(model.CertData{ExpiryWarning: true, WarnAtDays: 30, DaysToExpiry: 0})
+	is.True(early < late)
+	is.True(late < expired)
+	is.Equal(expired, weights.Expiry)
+
+	violation := model.CertData{HostError: true, Fingerprint: "ab", WeakCiphers: []string{"TLS_RSA_WITH_RC4_128_SHA"}}
+	is.Equal(weights.Score(violation), weights.Violation+weights.WeakCipher)
+}
+
+func TestSortAndFilter(t *testing.T) {
+	is := is.New(t)
+
+	certDataSet := model.NewCertDataSet()
+	certDataSet.Add(
+		model.CertData{Host: "a.example.com", KeyType: "ECDSA", KeyBits: 256},
+		model.CertData{Host: "b.example.com", HostError: true},
+		model.CertData{Host: "c.example.com", DeprecatedTLS: true},
+	)
+	DefaultWeights.Apply(certDataSet)
+	Sort(certDataSet)
+	is.Equal(certDataSet.CertData[0].Host, "b.example.com")
+	is.Equal(certDataSet.CertData[1].Host, "c.example.com")
+
+	Filter(certDataSet, 1)
+	is.Equal(certDataSet.Total, 2)
+	is.Equal(certDataSet.HostErrors, 1)
+}
@@ -0,0 +1,547 @@
+// Package sshcert reads OpenSSH certificates, as made by ssh-keygen -s and
+// shown by ssh-keygen -L, and known_hosts files, so SSH host and user
+// certificates can be checked for expiry like TLS certificates. Certificates
+// are read from the public key format of .pub files and ssh-keyscan output.
+package sshcert
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Certificate types
+const (
+	UserCert = 1
+	HostCert = 2
+)
+
+// Known hosts markers
+const (
+	MarkerCertAuthority = "@cert-authority" // a CA trusted to sign host certs for the hosts
+	MarkerRevoked       = "@revoked"        // a key that must not be accepted
+)
+
+// certSuffix ending of the key type of every certificate
+const certSuffix = "-cert-v01@openssh.com"
+
+// errShort error for a certificate that ends before all of its fields
+var errShort = errors.New("certificate is truncated")
+
+// Cert an OpenSSH certificate
+type Cert struct {
+	Type            string   // certificate key type, such as ssh-ed25519-cert-v01@openssh.com
+	KeyType         string   // type of the certified key, such as ssh-ed25519
+	KeyBits         int      // size of an RSA or ECDSA certified key
+	Key             []byte   // the certified public key in SSH wire format
+	Serial          uint64   // serial number given by the CA
+	CertType        uint32   // UserCert or HostCert
+	KeyID           string   // key ID given by the CA, for logs
+	Principals      []string // users or host names the certificate is for, any if empty
+	ValidAfter      uint64   // seconds since the epoch the certificate is valid from
+	ValidBefore     uint64   // seconds since the epoch the certificate is valid until
+	CriticalOptions []string // names of critical options such as force-command
+	Extensions      []string // names of extensions such as permit-pty
+	SignatureKey    []byte   // the CA public key in SSH wire format
+	Comment         string   // comment after the key in the file
+
+	raw       []byte // the whole certificate
+	signed    []byte // the part of the certificate the signature covers
+	signature []byte // the CA signature
+}
+
+// reader read SSH wire format fields
+type reader struct {
+	data []byte
+	err  error
+}
+
+// bytes read a length prefixed string
+func (r *reader) bytes() []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < 4 {
+		r.err = errShort
+		return nil
+	}
+	n := binary.BigEndian.Uint32(r.data)
+	if uint64(len(r.data)-4) < uint64(n) {
+		r.err = errShort
+		return nil
+	}
+	value := r.data[4 : 4+n]
+	r.data = r.data[4+n:]
+
+	return value
+}
+
+// string read a length prefixed string as text
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+// uint32 read a 32 bit integer
+func (r *reader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 4 {
+		r.err = errShort
+		return 0
+	}
+	value := binary.BigEndian.Uint32(r.data)
+	r.data = r.data[4:]
+
+	return value
+}
+
+// uint64 read a 64 bit integer
+func (r *reader) uint64() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.data) < 8 {
+		r.err = errShort
+		return 0
+	}
+	value := binary.BigEndian.Uint64(r.data)
+	r.data = r.data[8:]
+
+	return value
+}
+
+// names read the names of critical options or extensions, each followed by
+// its data
+func (r *reader) names() (names []string) {
+	list := &reader{data: r.bytes()}
+	for r.err == nil && list.err == nil && len(list.data) > 0 {
+		names = append(names, list.string())
+		list.bytes()
+	}
+	if r.err == nil {
+		r.err = list.err
+	}
+
+	return
+}
+
+// Parse read a certificate in SSH wire format
+func Parse(blob []byte) (cert *Cert, err error) {
+	r := &reader{data: blob}
+	cert = &Cert{raw: blob}
+	cert.Type = r.string()
+	if r.err == nil && !strings.HasSuffix(cert.Type, certSuffix) {
+		return nil, fmt.Errorf("%s is not a certificate type", cert.Type)
+	}
+	cert.KeyType = strings.TrimSuffix(cert.Type, certSuffix)
+	r.bytes() // nonce
+
+	// The certified key's fields follow the nonce, in the order of a public key
+	start := len(blob) - len(r.data)
+	switch cert.KeyType {
+	case "ssh-rsa":
+		r.bytes() // e
+		cert.KeyBits = new(big.Int).SetBytes(r.bytes()).BitLen()
+	case "ssh-dss":
+		r.bytes() // p
+		r.bytes() // q
+		r.bytes() // g
+		r.bytes() // y
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		curve := r.string()
+		r.bytes() // point
+		if c := ecdsaCurve(curve); c != nil {
+			cert.KeyBits = c.Params().BitSize
+		}
+	case "ssh-ed25519":
+		r.bytes()
+		cert.KeyBits = 256
+	case "sk-ecdsa-sha2-nistp256@openssh.com":
+		r.string() // curve
+		r.bytes()  // point
+		r.string() // application
+		cert.KeyBits = 256
+	case "sk-ssh-ed25519@openssh.com":
+		r.bytes()  // key
+		r.string() // application
+		cert.KeyBits = 256
+	default:
+		return nil, fmt.Errorf("unknown certificate type %s", cert.Type)
+	}
+	if r.err == nil {
+		key := bytes.NewBuffer(nil)
+		writeString(key, []byte(cert.KeyType))
+		key.Write(blob[start : len(blob)-len(r.data)])
+		cert.Key = key.Bytes()
+	}
+
+	cert.Serial = r.uint64()
+	cert.CertType = r.uint32()
+	cert.KeyID = r.string()
+	principals := &reader{data: r.bytes()}
+	for r.err == nil && principals.err == nil && len(principals.data) > 0 {
+		cert.Principals = append(cert.Principals, principals.string())
+	}
+	if r.err == nil {
+		r.err = principals.err
+	}
+	cert.ValidAfter = r.uint64()
+	cert.ValidBefore = r.uint64()
+	cert.CriticalOptions = r.names()
+	cert.Extensions = r.names()
+	r.bytes() // reserved
+	cert.SignatureKey = r.bytes()
+	cert.signed = blob[:len(blob)-len(r.data)]
+	cert.signature = r.bytes()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return cert, nil
+}
+
+// writeString write a length prefixed string
+func writeString(w *bytes.Buffer, value []byte) {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(value)))
+	w.Write(length[:])
+	w.Write(value)
+}
+
+// ecdsaCurve the curve named in an ECDSA key, nil if unknown
+func ecdsaCurve(name string) elliptic.Curve {
+	switch name {
+	case "nistp256":
+		return elliptic.P256()
+	case "nistp384":
+		return elliptic.P384()
+	case "nistp521":
+		return elliptic.P521()
+	}
+
+	return nil
+}
+
+// ParseLine read a certificate from a line in public key format, the key
+// type, the base64 certificate and an optional comment, as in a -cert.pub
+// file or ssh-keyscan output after the host name
+func ParseLine(line string) (*Cert, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, errors.New("expected a key type and certificate")
+	}
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate encoding: %v", err)
+	}
+	cert, err := Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Type != fields[0] {
+		return nil, fmt.Errorf("certificate is %s, not %s", cert.Type, fields[0])
+	}
+	cert.Comment = strings.Join(fields[2:], " ")
+
+	return cert, nil
+}
+
+// Read read every certificate in public key format in input, skipping blank
+// lines and # comments. Lines that are not certificates are an error.
+func Read(input io.Reader) (certs []*Cert, err error) {
+	scanner := bufio.NewScanner(input)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cert, err := ParseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		certs = append(certs, cert)
+	}
+	if err = scanner.Err(); err != nil {
+		return
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+
+	return
+}
+
+// IsCert whether a public key line holds a certificate rather than a plain
+// key
+func IsCert(keyType string) bool {
+	return strings.HasSuffix(keyType, certSuffix)
+}
+
+// Forever whether the certificate never expires
+func (cert *Cert) Forever() bool {
+	return cert.ValidBefore == math.MaxUint64
+}
+
+// NotBefore the time the certificate is valid from
+func (cert *Cert) NotBefore() time.Time {
+	return unixTime(cert.ValidAfter)
+}
+
+// NotAfter the time the certificate is valid until, which is far in the
+// future for a certificate valid forever
+func (cert *Cert) NotAfter() time.Time {
+	return unixTime(cert.ValidBefore)
+}
+
+// unixTime a certificate time, capped at the largest time that can be
+// formatted
+func unixTime(seconds uint64) time.Time {
+	const maxSeconds = 253402300799 // 9999-12-31T23:59:59Z
+	if seconds > maxSeconds {
+		seconds = maxSeconds
+	}
+
+	return time.Unix(int64(seconds), 0).UTC()
+}
+
+// TypeName user or host
+func (cert *Cert) TypeName() string {
+	switch cert.CertType {
+	case UserCert:
+		return "user"
+	case HostCert:
+		return "host"
+	}
+
+	return fmt.Sprintf("unknown type %d", cert.CertType)
+}
+
+// Fingerprint the SHA-256 fingerprint of the whole certificate, in hex
+func (cert *Cert) Fingerprint() string {
+	sum := sha256.Sum256(cert.raw)
+
+	return fmt.Sprintf("%x", sum)
+}
+
+// Fingerprint the SHA-256 fingerprint of a public key in SSH wire format, as
+// ssh-keygen -l shows it
+func Fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// Signer describe the CA that signed a certificate by its key type and
+// fingerprint, as ssh-keygen -L does
+func (cert *Cert) Signer() string {
+	r := &reader{data: cert.SignatureKey}
+
+	return r.string() + " " + Fingerprint(cert.SignatureKey)
+}
+
+// Verify check the CA signature on the certificate
+func (cert *Cert) Verify() error {
+	key, err := publicKey(cert.SignatureKey)
+	if err != nil {
+		return err
+	}
+	r := &reader{data: cert.signature}
+	algorithm := r.string()
+	signature := r.bytes()
+	if r.err != nil {
+		return fmt.Errorf("invalid signature: %v", r.err)
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch algorithm {
+	case "ssh-rsa":
+		hash = crypto.SHA1
+		sum := sha1.Sum(cert.signed)
+		digest = sum[:]
+	case "rsa-sha2-256", "ecdsa-sha2-nistp256":
+		hash = crypto.SHA256
+		sum := sha256.Sum256(cert.signed)
+		digest = sum[:]
+	case "ecdsa-sha2-nistp384":
+		hash = crypto.SHA384
+		sum := sha512.Sum384(cert.signed)
+		digest = sum[:]
+	case "rsa-sha2-512", "ecdsa-sha2-nistp521":
+		hash = crypto.SHA512
+		sum := sha512.Sum512(cert.signed)
+		digest = sum[:]
+	case "ssh-ed25519":
+	default:
+		return fmt.Errorf("unsupported signature algorithm %s", algorithm)
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm != "ssh-rsa" && !strings.HasPrefix(algorithm, "rsa-") {
+			return fmt.Errorf("%s signature from an RSA key", algorithm)
+		}
+		return rsa.VerifyPKCS1v15(key, hash, digest, signature)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(algorithm, "ecdsa") {
+			return fmt.Errorf("%s signature from an ECDSA key", algorithm)
+		}
+		values := &reader{data: signature}
+		rValue := new(big.Int).SetBytes(values.bytes())
+		sValue := new(big.Int).SetBytes(values.bytes())
+		if values.err != nil || !ecdsa.Verify(key, digest, rValue, sValue) {
+			return errors.New("signature does not verify")
+		}
+	case ed25519.PublicKey:
+		if algorithm != "ssh-ed25519" || !ed25519.Verify(key, cert.signed, signature) {
+			return errors.New("signature does not verify")
+		}
+	}
+
+	return nil
+}
+
+// publicKey read an RSA, ECDSA or Ed25519 public key in SSH wire format, the
+// key types a CA signs with
+func publicKey(blob []byte) (crypto.PublicKey, error) {
+	r := &reader{data: blob}
+	keyType := r.string()
+	switch keyType {
+	case "ssh-rsa":
+		e := new(big.Int).SetBytes(r.bytes())
+		n := new(big.Int).SetBytes(r.bytes())
+		if r.err != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA CA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "ecdsa-sha2-nistp256", "ecdsa-sha2-nistp384", "ecdsa-sha2-nistp521":
+		curve := ecdsaCurve(r.string())
+		point := r.bytes()
+		if r.err != nil || curve == nil {
+			return nil, errors.New("invalid ECDSA CA key")
+		}
+		x, y := elliptic.Unmarshal(curve, point)
+		if x == nil {
+			return nil, errors.New("invalid ECDSA CA key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "ssh-ed25519":
+		key := r.bytes()
+		if r.err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 CA key")
+		}
+		return ed25519.PublicKey(key), nil
+	}
+
+	return nil, fmt.Errorf("unsupported CA key type %s", keyType)
+}
+
+// KnownHost a line of a known_hosts file
+type KnownHost struct {
+	Line    int
+	Marker  string   // MarkerCertAuthority, MarkerRevoked or empty
+	Hosts   []string // host name patterns, or one hashed name starting |1|
+	KeyType string
+	Key     []byte // the public key in SSH wire format
+}
+
+// ReadKnownHosts read a known_hosts file. Blank lines and # comments are
+// skipped, and lines that can't be read are an error.
+func ReadKnownHosts(input io.Reader) (knownHosts []KnownHost, err error) {
+	scanner := bufio.NewScanner(input)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		knownHost := KnownHost{Line: line}
+		if strings.HasPrefix(fields[0], "@") {
+			knownHost.Marker = fields[0]
+			fields = fields[1:]
+			if knownHost.Marker != MarkerCertAuthority && knownHost.Marker != MarkerRevoked {
+				return nil, fmt.Errorf("line %d: unknown marker %s", line, knownHost.Marker)
+			}
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected hosts, a key type and a key", line)
+		}
+		knownHost.Hosts = strings.Split(fields[0], ",")
+		knownHost.KeyType = fields[1]
+		if knownHost.Key, err = base64.StdEncoding.DecodeString(fields[2]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid key encoding: %v", line, err)
+		}
+		knownHosts = append(knownHosts, knownHost)
+	}
+
+	return knownHosts, scanner.Err()
+}
+
+// Matches whether a known_hosts line applies to a host, given as a name, or
+// as [name]:port for a port other than 22. Patterns can use * and ?, and a
+// pattern starting with ! excludes the hosts it matches. Hashed names can't
+// be matched against and never match.
+func (knownHost KnownHost) Matches(host string) bool {
+	host = strings.ToLower(host)
+	matched := false
+	for _, pattern := range knownHost.Hosts {
+		negated := strings.HasPrefix(pattern, "!")
+		pattern = strings.ToLower(strings.TrimPrefix(pattern, "!"))
+		if !matchPattern(pattern, host) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+
+	return matched
+}
+
+// matchPattern whether a name matches a pattern where * matches any run of
+// characters and ? any one character, as in ssh_config and known_hosts
+func matchPattern(pattern, name string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := 0; i <= len(name); i++ {
+				if matchPattern(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return name == ""
+}
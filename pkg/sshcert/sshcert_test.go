@@ -0,0 +1,118 @@
+package sshcert
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+// hostCertPub an ECDSA host certificate for web1.example.com signed by caPub
+// with serial 42, valid for 2026
+const hostCertPub = `ecdsa-sha2-nistp256-cert-v01@openssh.com AAAAKGVjZHNhLXNoYTItbmlzdHAyNTYtY2VydC12MDFAb3BlbnNzaC5jb20AAAAgQJ2uA7/vHh2eylS/JC3vF33XM9d25aJ+G7rKTp9cW6cAAAAIbmlzdHAyNTYAAABBBAsebBPnxy/xELkkV8eHEfx+4x/p7qKfAJEmrMi9HTupKxQbxkxKRY7RJm3OCO1qFAiM0g4VO6fp4hzvMmUVGr4AAAAAAAAAKgAAAAIAAAAJd2ViMS1ob3N0AAAAHAAAABB3ZWIxLmV4YW1wbGUuY29tAAAABHdlYjEAAAAAaVW5AAAAAABrNuyAAAAAAAAAAAAAAAAAAAAAMwAAAAtzc2gtZWQyNTUxOQAAACAiAluZ5pfWzmiW07FE7MsGQIjT0IgyTUVwCqycYcRZywAAAFMAAAALc3NoLWVkMjU1MTkAAABAxv4GlnTEgm+bLC+tV5tDs3hXld7TxsIIDYiKynkpIgPZNP8gW0u+R/XGHndhdQHqP58JjlHQgwIGWWw6Gw+fAQ== host`
+
+// userCertPub an Ed25519 user certificate for alice and root signed by
+// rsaCAPub with rsa-sha2-512, valid forever
+const userCertPub = `ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQtdjAxQG9wZW5zc2guY29tAAAAICT5d4VufwYFB8dl0LecCX0tvPjXUPIUhG/+iM+6YcXwAAAAICmPpCRBw+Z1BM08n8RP3czOMj+TEfGBaaYZ8pvVB+yqAAAAAAAAAAcAAAABAAAABWFsaWNlAAAAEQAAAAVhbGljZQAAAARyb290AAAAAAAAAAD//////////wAAAAAAAACCAAAAFXBlcm1pdC1YMTEtZm9yd2FyZGluZwAAAAAAAAAXcGVybWl0LWFnZW50LWZvcndhcmRpbmcAAAAAAAAAFnBlcm1pdC1wb3J0LWZvcndhcmRpbmcAAAAAAAAACnBlcm1pdC1wdHkAAAAAAAAADnBlcm1pdC11c2VyLXJjAAAAAAAAAAAAAAEXAAAAB3NzaC1yc2EAAAADAQABAAABAQCXMBp5ibr/oZET4tOE71T0bZeEVRn/r4ld+O3hVyFaQXW3S778f+Y5DABNjTMIOYO762JBREh0ghugjvL3t8RJKM+Vryu7A2HCNCZhfCaTuNwoF+3DXHkKLJaKSH65ABpfTHJ0x0ySUuvu7FpYb9kbe9RAl21UFmicGA6SDq7pRV1KPnxZHdSfMC49clklqTS5sfoyzxTeFyY4GJlZCwLH9QZuV9s+PGvVVsK/kY4EDpW89TMziKjF1l1YPWFt47ahGUMVSXcuvRtefruqx6aChJm5W6wwk9WK94UkP4mgePAuYKPc3VKRk5aJjzu7mXPeetWMcyq8avx6sPlmiVnhAAABFAAAAAxyc2Etc2hhMi01MTIAAAEALSONhZuB0Wc6h5eoaWgEEYBg+xRsbpzaH2UluEZx3QowUdFCqdI4knD2+FZiqwUTP6rQDsYFfLbzjnpiDHC5MyvUdSHQNyLdy6Nd4D2nK540Oir/dv5HGZQVlQ2B7TAfHm2/uGugArUaFY5F1CCPKviKbPz5LD5bx6yj1m6xwuaSgLSsUHOHhFMql/4ac8/ZT7HiXs+u1b1QRjQafQ6DGdQfFSqD20WXr73NI7hTWtbi/Hy8r1oRCVp6Sy8sSJcFWEuo443/ASJM4txoZ4ZjFzWPTNJmqYEARLNRM2Bk2vRx5v5FXqWRbTAeAzKPqZxNgBzIILoZSiEaD7sxOiTy6w== user`
+
+// caPub an Ed25519 CA key
+const caPub = `ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAICICW5nml9bOaJbTsUTsywZAiNPQiDJNRXAKrJxhxFnL ca`
+
+// rsaCAPub an RSA CA key
+const rsaCAPub = `ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQCXMBp5ibr/oZET4tOE71T0bZeEVRn/r4ld+O3hVyFaQXW3S778f+Y5DABNjTMIOYO762JBREh0ghugjvL3t8RJKM+Vryu7A2HCNCZhfCaTuNwoF+3DXHkKLJaKSH65ABpfTHJ0x0ySUuvu7FpYb9kbe9RAl21UFmicGA6SDq7pRV1KPnxZHdSfMC49clklqTS5sfoyzxTeFyY4GJlZCwLH9QZuV9s+PGvVVsK/kY4EDpW89TMziKjF1l1YPWFt47ahGUMVSXcuvRtefruqx6aChJm5W6wwk9WK94UkP4mgePAuYKPc3VKRk5aJjzu7mXPeetWMcyq8avx6sPlmiVnh rsaca`
+
+// hostPub the plain key certified by hostCertPub
+const hostPub = `ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBAsebBPnxy/xELkkV8eHEfx+4x/p7qKfAJEmrMi9HTupKxQbxkxKRY7RJm3OCO1qFAiM0g4VO6fp4hzvMmUVGr4= host`
+
+func TestParseLine(t *testing.T) {
+	is := is.New(t)
+
+	cert, err := ParseLine(hostCertPub)
+	is.NoErr(err)
+	is.Equal(cert.Type, "ecdsa-sha2-nistp256-cert-v01@openssh.com")
+	is.Equal(cert.KeyType, "ecdsa-sha2-nistp256")
+	is.Equal(cert.KeyBits, 256)
+	is.Equal(cert.CertType, uint32(HostCert))
+	is.Equal(cert.TypeName(), "host")
+	is.Equal(cert.KeyID, "web1-host")
+	is.Equal(cert.Serial, uint64(42))
+	is.Equal(cert.Principals, []string{"web1.example.com", "web1"})
+	is.Equal(cert.NotBefore(), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	is.Equal(cert.NotAfter(), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC))
+	is.True(!cert.Forever())
+	is.Equal(len(cert.Extensions), 0)
+	is.Equal(cert.Comment, "host")
+	// As ssh-keygen -L and -l show them
+	is.Equal(cert.Signer(), "ssh-ed25519 SHA256:+md1YpVbNZR5IxBWbLHZm80SQ6FIFXVT6tpKHbd+ZxE")
+	is.Equal(Fingerprint(cert.Key), "SHA256:ae9ySvYNLAqs/UCeyLjWAUUIfHzvOtTIV1R6atSgiZg")
+	is.NoErr(cert.Verify())
+
+	cert, err = ParseLine(userCertPub)
+	is.NoErr(err)
+	is.Equal(cert.TypeName(), "user")
+	is.Equal(cert.Principals, []string{"alice", "root"})
+	is.True(cert.Forever())
+	is.Equal(cert.NotAfter().Year(), 9999)
+	is.Equal(cert.Extensions, []string{"permit-X11-forwarding", "permit-agent-forwarding", "permit-port-forwarding", "permit-pty", "permit-user-rc"})
+	is.True(strings.HasPrefix(cert.Signer(), "ssh-rsa SHA256:"))
+	is.NoErr(cert.Verify())
+
+	// A changed certificate no longer verifies
+	fields := strings.Fields(hostCertPub)
+	tampered := []byte(fields[1])
+	tampered[200] ^= 'A' ^ 'B'
+	if cert, err = ParseLine(fields[0] + " " + string(tampered)); err == nil {
+		is.True(cert.Verify() != nil)
+	}
+
+	_, err = ParseLine(caPub)
+	is.True(err != nil)
+	_, err = ParseLine("ssh-ed25519-cert-v01@openssh.com " + fields[1])
+	is.True(err != nil)
+	_, err = ParseLine(fields[0] + " " + fields[1][:100])
+	is.True(err != nil)
+}
+
+func TestRead(t *testing.T) {
+	is := is.New(t)
+
+	certs, err := Read(strings.NewReader("# certs\n" + hostCertPub + "\n\n" + userCertPub + "\n"))
+	is.NoErr(err)
+	is.Equal(len(certs), 2)
+
+	_, err = Read(strings.NewReader(hostCertPub + "\n" + caPub + "\n"))
+	is.True(strings.HasPrefix(err.Error(), "line 2:"))
+	_, err = Read(strings.NewReader("\n"))
+	is.True(err != nil)
+}
+
+func TestReadKnownHosts(t *testing.T) {
+	is := is.New(t)
+
+	input := "# hosts\n@cert-authority *.example.com,!old.example.com " + caPub + "\n" +
+		"@revoked * " + hostPub + "\n" +
+		"[web2.example.com]:2222,192.0.2.1 " + hostPub + "\n" +
+		"|1|c2FsdA==|aGFzaA== " + hostPub + "\n"
+	knownHosts, err := ReadKnownHosts(strings.NewReader(input))
+	is.NoErr(err)
+	is.Equal(len(knownHosts), 4)
+	is.Equal(knownHosts[0].Line, 2)
+	is.Equal(knownHosts[0].Marker, MarkerCertAuthority)
+	is.Equal(knownHosts[0].KeyType, "ssh-ed25519")
+	is.Equal(Fingerprint(knownHosts[0].Key), "SHA256:+md1YpVbNZR5IxBWbLHZm80SQ6FIFXVT6tpKHbd+ZxE")
+	is.True(knownHosts[0].Matches("web1.example.com"))
+	is.True(knownHosts[0].Matches("WEB1.example.com"))
+	is.True(!knownHosts[0].Matches("old.example.com"))
+	is.True(!knownHosts[0].Matches("example.org"))
+	is.Equal(knownHosts[1].Marker, MarkerRevoked)
+	is.Equal(knownHosts[2].Hosts, []string{"[web2.example.com]:2222", "192.0.2.1"})
+	is.True(knownHosts[2].Matches("[web2.example.com]:2222"))
+	is.True(!knownHosts[2].Matches("web2.example.com"))
+	is.True(!knownHosts[3].Matches("web1.example.com"))
+
+	_, err = ReadKnownHosts(strings.NewReader("@trusted * " + caPub + "\n"))
+	is.True(err != nil)
+	_, err = ReadKnownHosts(strings.NewReader("host ssh-ed25519\n"))
+	is.True(err != nil)
+}
@@ -0,0 +1,106 @@
+// Package trust provides the root certificate pools hosts can be verified
+// against, so results can be made the same on machines whose operating system
+// trust stores differ.
+package trust
+
+import (
+	"crypto/x509"
+	_ "embed"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Trust stores that can be selected
+const (
+	StoreSystem  = "system"  // the operating system roots
+	StoreMozilla = "mozilla" // the Mozilla roots embedded in certcheck
+	StoreNone    = "none"    // no roots, for use with roots added from files
+)
+
+// Stores names of the trust stores in order
+var Stores = []string{StoreSystem, StoreMozilla, StoreNone}
+
+// SystemFiles bundles operating systems keep their roots in, in the order
+// they are looked for, as by crypto/x509 on Linux and the BSDs
+var SystemFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian, Ubuntu, Gentoo and Arch
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora and RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS and RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, macOS and the BSDs
+	"/usr/local/share/certs/ca-root-nss.crt",            // FreeBSD
+}
+
+// MozillaDate the date of the Mozilla store the embedded roots were taken
+// from, certifi 2025.08.03, a copy of the store curl publishes as cacert.pem
+const MozillaDate = "2025-08-03"
+
+//go:embed mozilla.pem
+var mozillaPEM []byte
+
+var (
+	mozillaOnce  sync.Once
+	mozillaRoots []*x509.Certificate
+)
+
+// mozilla parse the embedded Mozilla roots once
+func mozilla() []*x509.Certificate {
+	mozillaOnce.Do(func() {
+		rest := mozillaPEM
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				mozillaRoots = append(mozillaRoots, cert)
+			}
+		}
+	})
+
+	return mozillaRoots
+}
+
+// Pool get a new pool holding the roots of a trust store. Roots can be added
+// to it without changing the store.
+func Pool(store string) (pool *x509.CertPool, err error) {
+	switch store {
+	case StoreSystem, "":
+		pool, err = x509.SystemCertPool()
+		if err != nil {
+			return nil, fmt.Errorf("system trust store unavailable: %v", err)
+		}
+	case StoreMozilla:
+		pool = x509.NewCertPool()
+		for _, cert := range mozilla() {
+			pool.AddCert(cert)
+		}
+	case StoreNone:
+		pool = x509.NewCertPool()
+	default:
+		err = fmt.Errorf("unknown trust store %s", store)
+	}
+
+	return
+}
+
+// SystemFile the bundle the operating system keeps its roots in, the one
+// named by SSL_CERT_FILE if set or else the first of SystemFiles found
+func SystemFile() (string, error) {
+	if file := os.Getenv("SSL_CERT_FILE"); file != "" {
+		return file, nil
+	}
+	for _, file := range SystemFiles {
+		if _, err := os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	return "", errors.New("no system trust store bundle found, give the path of an exported one")
+}
@@ -0,0 +1,55 @@
+package trust
+
+import (
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestPool(t *testing.T) {
+	is := is.New(t)
+
+	is.Equal(len(mozilla()), 146)
+
+	pool, err := Pool(StoreMozilla)
+	is.NoErr(err)
+	is.Equal(len(pool.Subjects()), 146)
+
+	// Pools are copies so adding to one leaves the store alone
+	none, err := Pool(StoreNone)
+	is.NoErr(err)
+	is.Equal(len(none.Subjects()), 0)
+	none.AddCert(mozilla()[0])
+	again, err := Pool(StoreNone)
+	is.NoErr(err)
+	is.Equal(len(again.Subjects()), 0)
+
+	_, err = Pool("windows")
+	is.True(err != nil)
+}
+
+func TestMozillaCurrent(t *testing.T) {
+	is := is.New(t)
+
+	// The embedded roots were all valid when the store was taken, and roots
+	// Mozilla removed for distrust or expiry are gone
+	date, err := time.Parse("2006-01-02", MozillaDate)
+	is.NoErr(err)
+	removed := []string{"E-Tugra Certification Authority", "Baltimore CyberTrust Root", "Hongkong Post Root CA 1"}
+	for _, cert := range mozilla() {
+		is.True(cert.NotAfter.After(date))
+		for _, name := range removed {
+			is.True(cert.Subject.CommonName != name)
+		}
+	}
+}
+
+func TestSystemFile(t *testing.T) {
+	is := is.New(t)
+
+	t.Setenv("SSL_CERT_FILE", "/tmp/roots.pem")
+	file, err := SystemFile()
+	is.NoErr(err)
+	is.Equal(file, "/tmp/roots.pem")
+}
@@ -0,0 +1,175 @@
+// Package webhook pushes results to an HTTP endpoint, signed so receivers can
+// check they came from certcheck, retrying failed deliveries and keeping those
+// that never arrive in a dead letter file so no results are silently lost.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Headers set on every delivery
+const (
+	SignatureHeader = "X-Certcheck-Signature" // sha256= and the hex HMAC of the timestamp, a dot and the body
+	TimestampHeader = "X-Certcheck-Timestamp" // Unix time the delivery was signed
+)
+
+// Defaults for new senders
+const (
+	DefaultRetries = 5
+	DefaultBackoff = time.Second
+	maxBackoff     = time.Minute
+)
+
+// Sender deliver payloads to a webhook URL
+type Sender struct {
+	URL        string
+	Secret     string        // shared secret to sign with, or none to not sign
+	Retries    int           // attempts after the first
+	Backoff    time.Duration // wait before the first retry, doubling for each one after
+	DeadLetter string        // file to append undelivered payloads to
+	Client     *http.Client
+}
+
+// NewSender deliver to a URL, signing with a secret if one is given
+func NewSender(url, secret string, timeout time.Duration) *Sender {
+	return &Sender{
+		URL:     url,
+		Secret:  secret,
+		Retries: DefaultRetries,
+		Backoff: DefaultBackoff,
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// deadLetter an undelivered payload as written to the dead letter file
+type deadLetter struct {
+	URL     string          `json:"url"`
+	Time    string          `json:"time"`
+	Error   string          `json:"error"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// retryableError a failed delivery worth trying again
+type retryableError struct {
+	err error
+}
+
+// Error implement error interface Error method
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+// Sign get the signature header value for a body sent at a Unix timestamp.
+// Receivers compute the same with the shared secret to check a delivery.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post make one delivery attempt. Network errors, 429 and 5xx responses can
+// be retried, other failures can't.
+func (sender *Sender) post(ctx context.Context, body []byte) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sender.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if sender.Secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		request.Header.Set(TimestampHeader, timestamp)
+		request.Header.Set(SignatureHeader, Sign(sender.Secret, timestamp, body))
+	}
+	response, err := sender.Client.Do(request)
+	if err != nil {
+		return &retryableError{err}
+	}
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return &retryableError{fmt.Errorf("%s returned %s", sender.URL, response.Status)}
+	}
+
+	return fmt.Errorf("%s returned %s", sender.URL, response.Status)
+}
+
+// Send deliver v as JSON, retrying with exponential backoff. If it can't be
+// delivered it is appended to the dead letter file, if there is one, and the
+// last error is returned.
+func (sender *Sender) Send(ctx context.Context, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	backoff := sender.Backoff
+	for attempt := 0; ; attempt++ {
+		err = sender.post(ctx, body)
+		if _, retryable := err.(*retryableError); !retryable || attempt >= sender.Retries {
+			break
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			err = ctx.Err()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	if sender.DeadLetter != "" {
+		if writeErr := sender.writeDeadLetter(body, err); writeErr != nil {
+			return fmt.Errorf("%v, and writing dead letter: %v", err, writeErr)
+		}
+	}
+
+	return err
+}
+
+// writeDeadLetter append an undelivered payload to the dead letter file as a
+// line of JSON, so it can be resent
+func (sender *Sender) writeDeadLetter(body []byte, sendErr error) error {
+	line, err := json.Marshal(deadLetter{
+		URL:     sender.URL,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Error:   sendErr.Error(),
+		Payload: body,
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(sender.DeadLetter, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
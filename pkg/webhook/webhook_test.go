@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/matryer/is"
+)
+
+func TestSend(t *testing.T) {
+	is := is.New(t)
+
+	var attempts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(TimestampHeader)
+		is.Equal(r.Header.Get(SignatureHeader), Sign("secret", timestamp, body))
+		is.Equal(string(body), `{"total":1}`)
+		// Fail twice before accepting
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	sender := NewSender(server.URL, "secret", 5*time.Second)
+	sender.Backoff = time.Millisecond
+	is.NoErr(sender.Send(context.Background(), map[string]int{"total": 1}))
+	is.Equal(attempts, 3)
+
+	is.True(Sign("secret", "1", []byte("{}")) != Sign("other", "1", []byte("{}")))
+	is.True(strings.HasPrefix(Sign("secret", "1", []byte("{}")), "sha256="))
+}
+
+func TestSendDeadLetter(t *testing.T) {
+	is := is.New(t)
+
+	var attempts int
+	status := http.StatusInternalServerError
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		is.Equal(r.Header.Get(SignatureHeader), "")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	deadLetters := filepath.Join(t.TempDir(), "dead.jsonl")
+	sender := NewSender(server.URL, "", 5*time.Second)
+	sender.Backoff = time.Millisecond
+	sender.Retries = 2
+	sender.DeadLetter = deadLetters
+	is.True(sender.Send(context.Background(), map[string]int{"total": 1}) != nil)
+	is.Equal(attempts, 3)
+
+	// Refused deliveries are not retried
+	attempts = 0
+	status = http.StatusBadRequest
+	is.True(sender.Send(context.Background(), map[string]int{"total": 2}) != nil)
+	is.Equal(attempts, 1)
+
+	data, err := os.ReadFile(deadLetters)
+	is.NoErr(err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	is.Equal(len(lines), 2)
+	var letter deadLetter
+	is.NoErr(json.Unmarshal([]byte(lines[1]), &letter))
+	is.Equal(letter.URL, server.URL)
+	is.Equal(string(letter.Payload), `{"total":2}`)
+	is.True(strings.Contains(letter.Error, "400"))
+}